@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/radvoogh/ralph-wiggo/internal/claude"
+	"github.com/radvoogh/ralph-wiggo/internal/fsutil"
+	"github.com/radvoogh/ralph-wiggo/internal/prd"
+	"github.com/radvoogh/ralph-wiggo/internal/prompts"
+)
+
+// Phases of an unattended 'full' run, in order. The agent loop is not
+// recorded: it resumes from the stories that do not pass yet.
+const (
+	phaseGenerate = "generate"
+	phaseConvert  = "convert"
+	phaseLint     = "lint"
+)
+
+// fullState records the progress of an unattended 'full' run in its artifact
+// directory, so that running it again resumes after the last finished phase.
+type fullState struct {
+	Description string   `json:"description"`
+	SessionID   string   `json:"sessionId,omitempty"` // of the PRD generation
+	Phases      []string `json:"phases"`              // finished phases
+}
+
+// unattended carries an unattended 'full' run between its phases.
+type unattended struct {
+	dir   string // artifact directory
+	state fullState
+}
+
+// done reports whether phase finished in an earlier run.
+func (u *unattended) done(phase string) bool {
+	return slices.Contains(u.state.Phases, phase)
+}
+
+// finish records that phase finished.
+func (u *unattended) finish(phase string) error {
+	if !u.done(phase) {
+		u.state.Phases = append(u.state.Phases, phase)
+	}
+	return u.save()
+}
+
+func (u *unattended) save() error {
+	data, err := json.MarshalIndent(u.state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return u.write("state.json", append(data, '\n'))
+}
+
+// write saves an artifact.
+func (u *unattended) write(name string, data []byte) error {
+	if err := fsutil.WriteFileAtomic(filepath.Join(u.dir, name), data, 0644); err != nil {
+		return fmt.Errorf("saving %s: %w", name, err)
+	}
+	return nil
+}
+
+// runUnattended runs the full workflow without interactive sessions: the PRD
+// is generated by a single capture call, converted with schema-constrained
+// calls and linted, and then the agent loop starts. Artifacts and progress go
+// to .ralph-wiggo/full/<slug>; phases that finished before are skipped as
+// long as their output still exists.
+func (f *FullCmd) runUnattended(globals *CLI, description string) error {
+	u := &unattended{dir: filepath.Join(globals.WorkDir, ".ralph-wiggo", "full", slugify(description))}
+	if err := os.MkdirAll(u.dir, 0755); err != nil {
+		return fmt.Errorf("creating artifact directory: %w", err)
+	}
+	data, err := os.ReadFile(filepath.Join(u.dir, "state.json"))
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return fmt.Errorf("reading run state: %w", err)
+	default:
+		if err := json.Unmarshal(data, &u.state); err != nil {
+			return fmt.Errorf("parsing %s: %w", filepath.Join(u.dir, "state.json"), err)
+		}
+	}
+	if u.state.Description != description {
+		u.state = fullState{Description: description}
+	}
+	if err := u.write("description.txt", []byte(description+"\n")); err != nil {
+		return err
+	}
+	fmt.Printf("Artifacts: %s\n", u.dir)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	exec := newExecutor(globals)
+
+	// Step 1: PRD generation.
+	prdOutputPath := f.prdOutputPath(description)
+	fmt.Println("\n=== Step 1: PRD Generation ===")
+	if u.done(phaseGenerate) && fileExists(prdOutputPath) {
+		fmt.Printf("Skipped: PRD already generated at %s\n", prdOutputPath)
+	} else {
+		if err := f.generateUnattended(ctx, globals, exec, u, description, prdOutputPath); err != nil {
+			return err
+		}
+		if err := u.finish(phaseGenerate); err != nil {
+			return err
+		}
+	}
+
+	// Step 2: Conversion.
+	fmt.Println("\n=== Step 2: PRD Conversion ===")
+	var parsedPRD *prd.PRD
+	if u.done(phaseConvert) && fileExists(f.JSONOutput) {
+		if parsedPRD, err = prd.LoadPRD(f.JSONOutput); err != nil {
+			return err
+		}
+		fmt.Printf("Skipped: %s already converted (%d stories)\n", f.JSONOutput, len(parsedPRD.UserStories))
+	} else {
+		markdown, err := os.ReadFile(prdOutputPath)
+		if err != nil {
+			return fmt.Errorf("reading PRD file %q: %w", prdOutputPath, err)
+		}
+		opts := convertOptions{nonInteractive: true, attempts: f.Attempts, yes: true}
+		if parsedPRD, err = convertPRD(ctx, globals, exec, string(markdown), f.JSONOutput, opts); err != nil {
+			return err
+		}
+		fmt.Printf("Wrote %s (%d stories, branch: %s)\n", f.JSONOutput, len(parsedPRD.UserStories), parsedPRD.BranchName)
+		if err := u.finish(phaseConvert); err != nil {
+			return err
+		}
+	}
+
+	// Lint findings are reported, not fixed: nobody is there to edit the
+	// stories.
+	if !u.done(phaseLint) {
+		var report strings.Builder
+		for _, finding := range lintConverted(parsedPRD) {
+			report.WriteString(finding.String() + "\n")
+		}
+		if err := u.write("lint.txt", []byte(report.String())); err != nil {
+			return err
+		}
+		if err := u.finish(phaseLint); err != nil {
+			return err
+		}
+	}
+
+	// Step 3: Run the agent loop.
+	fmt.Println("\n=== Step 3: Agent Loop ===")
+	return f.run(globals)
+}
+
+// generateUnattended writes the PRD markdown for description to path with a
+// single capture call. Claude answers its own clarifying questions and records
+// the answers as assumptions in the PRD.
+func (f *FullCmd) generateUnattended(ctx context.Context, globals *CLI, exec *claude.Executor, u *unattended, description, path string) error {
+	fmt.Printf("Generating PRD for: %s\n", description)
+	fmt.Printf("Output: %s\n", path)
+
+	skillContent, err := prompts.Get("prd-skill.md")
+	if err != nil {
+		return fmt.Errorf("loading prd-skill.md: %w", err)
+	}
+	cfg := claude.RunConfig{
+		Prompt: fmt.Sprintf(
+			"Generate a PRD for the following feature:\n\n%s\n\n"+
+				"This is an unattended run and nobody will answer questions. Instead of asking clarifying questions, "+
+				"choose the most reasonable answer to each yourself and list these choices in an \"Assumptions\" section of the PRD. "+
+				"Respond with the complete PRD markdown only; do not write any files.",
+			description,
+		),
+		Model:              globals.Model,
+		MaxTurns:           globals.MaxTurns,
+		MaxBudgetUSD:       globals.MaxBudget,
+		WorkDir:            globals.WorkDir,
+		AppendSystemPrompt: skillContent,
+	}
+	result, err := exec.RunPromptCapture(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("prd generation: %w", err)
+	}
+	u.state.SessionID = result.SessionID
+	if err := u.write("generation.md", []byte(result.Text)); err != nil {
+		return err
+	}
+
+	markdown := unfence(result.Text)
+	if markdown == "" {
+		return errors.New("prd generation: empty response")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("creating %s: %w", filepath.Dir(path), err)
+	}
+	if err := fsutil.WriteFileAtomic(path, []byte(markdown+"\n"), 0644); err != nil {
+		return fmt.Errorf("writing PRD: %w", err)
+	}
+	fmt.Printf("PRD generated at: %s\n", path)
+	return nil
+}
+
+// unfence returns text without surrounding whitespace and, if the whole of it
+// is a fenced code block, without the fence.
+func unfence(text string) string {
+	text = strings.TrimSpace(text)
+	first, rest, ok := strings.Cut(text, "\n")
+	if !ok || !strings.HasPrefix(first, "```") || !strings.HasSuffix(rest, "```") {
+		return text
+	}
+	return strings.TrimSpace(strings.TrimSuffix(rest, "```"))
+}
+
+// fileExists reports whether path exists.
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
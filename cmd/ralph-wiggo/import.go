@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/radvoogh/ralph-wiggo/internal/importer"
+	"github.com/radvoogh/ralph-wiggo/internal/prd"
+)
+
+// ImportCmd implements the 'import' subcommand.
+type ImportCmd struct {
+	File    string `arg:"" help:"Export to import: GitHub issues JSON, a Jira JSON or CSV export, or a CSV file; - reads stdin."`
+	Format  string `help:"Export format: auto, github, jira or csv." enum:"auto,github,jira,csv" default:"auto"`
+	PRDPath string `help:"PRD file to add the stories to (.json, .yaml or .md); created if missing." default:"prd.json" name:"prd"`
+	Project string `help:"Project name for a new PRD (default: the working directory's name)."`
+	Branch  string `help:"Branch name for a new PRD (default: ralph/<project>)."`
+	DryRun  bool   `help:"Print the stories that would be imported without writing the PRD." name:"dry-run"`
+}
+
+func (c *ImportCmd) Run(globals *CLI) error {
+	var data []byte
+	var err error
+	if c.File == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(c.File)
+	}
+	if err != nil {
+		return fmt.Errorf("reading export: %w", err)
+	}
+	stories, err := importer.Parse(c.File, data, importer.Format(c.Format))
+	if err != nil {
+		return err
+	}
+	if len(stories) == 0 {
+		fmt.Println("No stories in the export.")
+		return nil
+	}
+
+	if c.DryRun {
+		for _, s := range stories {
+			source := ""
+			if s.Source != nil {
+				source = fmt.Sprintf(" [%s %s]", s.Source.Tracker, s.Source.Key)
+			}
+			fmt.Printf("- %s%s (%d criteria)\n", s.Title, source, len(s.AcceptanceCriteria))
+		}
+		fmt.Printf("Dry run: %d stories, %s not written.\n", len(stories), c.PRDPath)
+		return nil
+	}
+
+	lock, err := lockForEdit(globals)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	var added, skipped []string
+	merge := func(p *prd.PRD) error {
+		var err error
+		if added, skipped, err = importer.Merge(p, stories); err != nil {
+			return err
+		}
+		if err := prd.Validate(p); err != nil {
+			return fmt.Errorf("not saving invalid PRD: %w", err)
+		}
+		return nil
+	}
+
+	if _, err := os.Stat(c.PRDPath); errors.Is(err, fs.ErrNotExist) {
+		p := c.newPRD(globals)
+		if err := merge(p); err != nil {
+			return err
+		}
+		if err := prd.SavePRD(c.PRDPath, p); err != nil {
+			return err
+		}
+		fmt.Printf("Created %s for %s (branch %s)\n", c.PRDPath, p.Project, p.BranchName)
+	} else if _, err := prd.UpdatePRD(c.PRDPath, merge); err != nil {
+		return err
+	}
+
+	if len(added) > 0 {
+		fmt.Printf("Imported %d stories: %s\n", len(added), strings.Join(added, ", "))
+	}
+	if len(skipped) > 0 {
+		fmt.Printf("Skipped %d already imported: %s\n", len(skipped), strings.Join(skipped, ", "))
+	}
+	return nil
+}
+
+// newPRD returns an empty PRD for the import, named after --project or the
+// working directory.
+func (c *ImportCmd) newPRD(globals *CLI) *prd.PRD {
+	project := c.Project
+	if project == "" {
+		if abs, err := filepath.Abs(globals.WorkDir); err == nil {
+			project = filepath.Base(abs)
+		}
+	}
+	branch := c.Branch
+	if branch == "" {
+		branch = "ralph/" + slugify(project)
+	}
+	source := c.File
+	if source == "-" {
+		source = "stdin"
+	}
+	return &prd.PRD{
+		SchemaVersion: prd.SchemaVersion,
+		Project:       project,
+		BranchName:    branch,
+		Description:   "Imported from " + filepath.Base(source) + ".",
+		UserStories:   []prd.UserStory{},
+	}
+}
@@ -1,24 +1,38 @@
 package main
 
 import (
+	"bufio"
+	"cmp"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
+	"maps"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
+	"text/tabwriter"
 	"time"
 
 	"github.com/alecthomas/kong"
+	"github.com/radvoogh/ralph-wiggo/internal/bench"
 	"github.com/radvoogh/ralph-wiggo/internal/claude"
 	"github.com/radvoogh/ralph-wiggo/internal/config"
+	"github.com/radvoogh/ralph-wiggo/internal/converter"
+	"github.com/radvoogh/ralph-wiggo/internal/fsutil"
 	"github.com/radvoogh/ralph-wiggo/internal/git"
 	"github.com/radvoogh/ralph-wiggo/internal/planner"
 	"github.com/radvoogh/ralph-wiggo/internal/prd"
 	"github.com/radvoogh/ralph-wiggo/internal/progress"
 	"github.com/radvoogh/ralph-wiggo/internal/prompts"
+	"github.com/radvoogh/ralph-wiggo/internal/search"
+	"github.com/radvoogh/ralph-wiggo/internal/splitter"
 	"github.com/radvoogh/ralph-wiggo/internal/state"
 	"github.com/radvoogh/ralph-wiggo/internal/web"
 )
@@ -27,15 +41,24 @@ import (
 type CLI struct {
 	Verbose  bool    `help:"Enable verbose output." short:"v"`
 	Model    string  `help:"Claude model to use." default:"claude-opus-4-6"`
+	Agent    string  `help:"Agent executable to invoke instead of claude; it must accept the claude CLI flags and output format." default:"claude"`
 	MaxBudget float64 `help:"Maximum budget in USD per agent session." name:"max-budget"`
 	MaxTurns int     `help:"Maximum agentic turns per story." default:"50" name:"max-turns"`
 	WorkDir         string   `help:"Working directory." default:"." name:"work-dir" type:"existingdir"`
 	PromptOverrides []string `help:"Override an embedded prompt file: name=path (e.g. prompt.md=/tmp/my-prompt.md)." name:"prompt-override"`
 
 	Run     RunCmd     `cmd:"" help:"Run the agent loop on prd.json stories."`
-	PRD     PRDCmd     `cmd:"" help:"Generate a PRD interactively with Claude."`
+	PRD     PRDCmd     `cmd:"" help:"Generate, migrate and validate PRDs."`
 	Convert ConvertCmd `cmd:"" help:"Convert a PRD markdown file to prd.json."`
+	Story   StoryCmd   `cmd:"" help:"List and edit the PRD's stories."`
+	Import  ImportCmd  `cmd:"" help:"Import stories from GitHub issues, Jira or CSV exports."`
 	Serve   ServeCmd   `cmd:"" help:"Start the web dashboard server."`
+	Search  SearchCmd  `cmd:"" help:"Search recorded agent sessions."`
+	History HistoryCmd `cmd:"" help:"List recorded runs."`
+	Report  ReportCmd  `cmd:"" help:"Export a report of a recorded run."`
+	Compare CompareCmd `cmd:"" help:"Compare two recorded runs story by story."`
+	Bench   BenchCmd   `cmd:"" help:"Benchmark models, prompts and parallelism modes on a fixed PRD."`
+	GC      GCCmd      `cmd:"" name:"gc" help:"Prune old run history and clean up stale worktrees."`
 	Full    FullCmd    `cmd:"" help:"Full workflow: PRD generation, conversion, and agent loop."`
 
 	// fileConfig holds settings loaded from .ralph-wiggo.yaml (not a CLI flag).
@@ -67,6 +90,9 @@ func (c *CLI) AfterApply() error {
 	if cfg.Model != "" && c.Model == "claude-opus-4-6" {
 		c.Model = cfg.Model
 	}
+	if cfg.Agent != "" && c.Agent == "claude" {
+		c.Agent = cfg.Agent
+	}
 	if cfg.MaxBudget != 0 && c.MaxBudget == 0 {
 		c.MaxBudget = cfg.MaxBudget
 	}
@@ -77,16 +103,34 @@ func (c *CLI) AfterApply() error {
 	return nil
 }
 
+// newExecutor returns an Executor that invokes the configured agent.
+func newExecutor(globals *CLI) *claude.Executor {
+	exec := claude.NewExecutor()
+	exec.ClaudePath = globals.Agent
+	return exec
+}
+
 // RunCmd implements the 'run' subcommand.
 type RunCmd struct {
-	PRDPath       string `help:"Path to prd.json." default:"prd.json" name:"prd"`
+	PRDPath       string `help:"Path to the PRD file (.json, .yaml or .md)." default:"prd.json" name:"prd"`
 	Parallelism   string `help:"Parallelism mode: sequential, parallel-N, or auto." default:"sequential"`
 	MaxIterations int    `help:"Maximum iterations per story before skipping." default:"10" name:"max-iterations"`
 	UI            bool   `help:"Start web dashboard alongside the agent loop."`
 	DryRun        bool   `help:"Print what would be executed without invoking Claude." name:"dry-run"`
+	Split         bool   `help:"Offer to split stories that exceed max iterations into smaller ones (automatic with autoSplit in the config file)."`
+
+	Only    []string `help:"Only run stories with one of these tags." placeholder:"TAG"`
+	Exclude []string `help:"Skip stories with any of these tags." placeholder:"TAG"`
+	Stories []string `help:"Only run these stories (e.g. US-003,US-007)." placeholder:"ID"`
+	From    string   `help:"Skip stories before this one in priority order." placeholder:"ID"`
+}
+
+// selector returns the story selection given by the run flags.
+func (r *RunCmd) selector() prd.Selector {
+	return prd.Selector{Only: r.Only, Exclude: r.Exclude, IDs: r.Stories, From: r.From}
 }
 
-func (r *RunCmd) Run(globals *CLI) error {
+func (r *RunCmd) Run(globals *CLI) (runErr error) {
 	// Apply config file overrides for subcommand-specific settings.
 	cfg := globals.fileConfig
 	if cfg.Parallelism != "" && r.Parallelism == "sequential" {
@@ -101,7 +145,7 @@ func (r *RunCmd) Run(globals *CLI) error {
 		return fmt.Errorf("loading PRD: %w", err)
 	}
 
-	// Archive existing progress.txt (and prd.json snapshot) if the branch changed.
+	// Archive existing progress.txt (and a PRD snapshot) if the branch changed.
 	archived, err := progress.ArchiveIfBranchChanged(
 		globals.WorkDir, r.PRDPath, progressPath, p.BranchName)
 	if err != nil {
@@ -112,6 +156,15 @@ func (r *RunCmd) Run(globals *CLI) error {
 	}
 
 	fmt.Printf("Loaded PRD: %s (%d stories)\n", p.Project, len(p.UserStories))
+	for _, s := range p.UserStories {
+		if err := s.Overrides.Validate(); err != nil {
+			return fmt.Errorf("story %s: %w", s.ID, err)
+		}
+	}
+	sel := r.selector()
+	if err := sel.Check(p); err != nil {
+		return fmt.Errorf("selecting stories: %w", err)
+	}
 
 	// Dry-run mode: print what would be executed without invoking Claude.
 	if r.DryRun {
@@ -129,12 +182,24 @@ func (r *RunCmd) Run(globals *CLI) error {
 			status := "pending"
 			if s.Passes {
 				status = "passed"
+			} else if !sel.Matches(p, &s) {
+				status = "not selected"
 			}
 			fmt.Printf("  %s [%s] %s\n", s.ID, status, s.Title)
 		}
 		return nil
 	}
 
+	// Only one agent loop may run in a work directory at a time.
+	lock, err := fsutil.Acquire(runLockPath(globals))
+	if err != nil {
+		if errors.Is(err, fsutil.ErrLocked) {
+			return fmt.Errorf("another ralph-wiggo run is active in %s: %w", globals.WorkDir, err)
+		}
+		return fmt.Errorf("acquiring run lock: %w", err)
+	}
+	defer lock.Release()
+
 	// Create or check out the feature branch.
 	if err := git.CreateOrCheckoutBranch(p.BranchName); err != nil {
 		return fmt.Errorf("switching to branch %q: %w", p.BranchName, err)
@@ -151,19 +216,18 @@ func (r *RunCmd) Run(globals *CLI) error {
 	if err != nil {
 		return fmt.Errorf("loading prompt.md: %w", err)
 	}
+	agentPrompt = withPRDFile(agentPrompt, r.PRDPath)
 
-	// Determine allowed tools (config file override or default).
-	allowedTools := []string{"Bash", "Read", "Edit", "Write", "Glob", "Grep"}
-	if len(globals.fileConfig.AllowedTools) > 0 {
-		allowedTools = globals.fileConfig.AllowedTools
-	}
+	// Run-wide agent settings, which stories may override.
+	settings := defaultSettings(globals, r.MaxIterations)
 
 	// Create state store for event tracking and persistence.
-	storeDir := filepath.Join(globals.WorkDir, ".ralph-wiggo", "runs")
-	store, err := state.NewMemoryStore(storeDir)
+	store, err := openStore(globals)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "warning: state store: %v\n", err)
 		store = nil
+	} else {
+		defer store.Close()
 	}
 
 	// Create a new run in the state store.
@@ -191,6 +255,7 @@ func (r *RunCmd) Run(globals *CLI) error {
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "warning: starting web dashboard: %v\n", err)
 		} else {
+			srv.SetDefaults(settings)
 			if err := srv.Start(); err != nil {
 				fmt.Fprintf(os.Stderr, "warning: web dashboard: %v\n", err)
 			}
@@ -198,7 +263,7 @@ func (r *RunCmd) Run(globals *CLI) error {
 		}
 	}
 
-	exec := claude.NewExecutor()
+	exec := newExecutor(globals)
 
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
 	defer stop()
@@ -206,10 +271,25 @@ func (r *RunCmd) Run(globals *CLI) error {
 	// Per-story iteration tracking.
 	storyIterations := make(map[string]int)
 	skippedStories := make(map[string]bool)
+	splitOffered := make(map[string]bool)
 
+	// Record how the run ended, however it ends.
+	if store != nil {
+		defer func() {
+			finishRun(store, runID, r.PRDPath, sel, ctx.Err() != nil, skippedStories, runErr)
+		}()
+	}
+
+	interrupted := false
 	for {
+		if ctx.Err() != nil {
+			fmt.Println("\nInterrupted.")
+			interrupted = true
+			break
+		}
+
 		// Get next stories to work on.
-		stories, err := planner.NextStories(ctx, p, r.Parallelism, exec)
+		stories, err := planner.NextSelectedStories(ctx, p, r.Parallelism, sel, exec)
 		if err != nil {
 			return fmt.Errorf("planner: %w", err)
 		}
@@ -222,9 +302,12 @@ func (r *RunCmd) Run(globals *CLI) error {
 			}
 		}
 		if len(eligible) == 0 {
-			if len(stories) > 0 {
+			switch {
+			case len(stories) > 0:
 				fmt.Println("\nRemaining stories skipped (exceeded max iterations).")
-			} else {
+			case !sel.IsZero():
+				fmt.Println("\nAll selected stories pass!")
+			default:
 				fmt.Println("\nAll stories pass!")
 			}
 			break
@@ -235,22 +318,42 @@ func (r *RunCmd) Run(globals *CLI) error {
 			story := eligible[0]
 			storyIterations[story.ID]++
 			iterNum := storyIterations[story.ID]
-			fmt.Printf("\n--- %s - %s (iteration %d/%d) ---\n", story.ID, story.Title, iterNum, r.MaxIterations)
+			storySettings := story.Effective(settings)
+			fmt.Printf("\n--- %s - %s (iteration %d/%d) ---\n", story.ID, story.Title, iterNum, storySettings.MaxIterations)
 
-			result := runSingleAgent(ctx, exec, story, agentPrompt, globals, r.PRDPath, store, allowedTools)
+			if store != nil {
+				if err := store.StartIteration(runID, story.ID, iterNum); err != nil {
+					fmt.Fprintf(os.Stderr, "warning: recording iteration start: %v\n", err)
+				}
+			}
 
-			p, err = processStoryResult(result, r.PRDPath, progressPath, p, iterNum, r.MaxIterations, storyIterations, skippedStories, store, runID)
+			key := state.StreamKey{RunID: runID, StoryID: story.ID, Iteration: iterNum}
+			result := runSingleAgent(ctx, exec, story, agentPrompt, globals, r.PRDPath, store, key, storySettings)
+
+			p, err = processStoryResult(result, r.PRDPath, progressPath, p, iterNum, storyIterations, skippedStories, store, runID)
 			if err != nil {
 				return err
 			}
+			if err := agentFailure(result); err != nil {
+				return err
+			}
 		} else {
 			// Parallel execution — run agents in separate worktrees.
-			results := runParallelAgents(ctx, exec, eligible, agentPrompt, globals, r.PRDPath, storyIterations, r.MaxIterations, store, allowedTools)
+			results := runParallelAgents(ctx, exec, eligible, agentPrompt, globals, r.PRDPath, storyIterations, settings, store, runID)
 
-			p, err = processParallelResults(results, r.PRDPath, progressPath, p, r.MaxIterations, storyIterations, skippedStories, store, runID)
+			p, err = processParallelResults(results, r.PRDPath, progressPath, p, storyIterations, skippedStories, store, runID)
 			if err != nil {
 				return err
 			}
+			for _, result := range results {
+				if err := agentFailure(result); err != nil {
+					return err
+				}
+			}
+		}
+
+		if r.Split || cfg.AutoSplit {
+			p = splitSkippedStories(ctx, exec, globals, r.PRDPath, p, skippedStories, splitOffered, store, runID)
 		}
 	}
 
@@ -275,9 +378,76 @@ func (r *RunCmd) Run(globals *CLI) error {
 		fmt.Println()
 	}
 
+	if interrupted {
+		return errors.New("run interrupted")
+	}
 	return nil
 }
 
+// finishRun records the terminal status and summary of a run. A run limited
+// to the stories picked by sel completes when those pass. interrupted reports
+// whether the run was stopped by a signal; runErr is the error the run loop
+// returned, if any.
+func finishRun(store state.Store, runID, prdPath string, sel prd.Selector, interrupted bool, skipped map[string]bool, runErr error) {
+	res := state.RunResult{EndTime: time.Now(), Skipped: len(skipped)}
+	selectedPass := false
+	if p, err := prd.LoadPRD(prdPath); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: loading PRD for run summary: %v\n", err)
+	} else {
+		res.Total = len(p.UserStories)
+		selectedPass = res.Total > 0
+		for _, s := range p.UserStories {
+			if s.Passes {
+				res.Passed++
+			} else if sel.Matches(p, &s) {
+				selectedPass = false
+			}
+		}
+	}
+
+	switch {
+	case interrupted:
+		res.Status = state.StatusInterrupted
+		res.StopReason = "interrupted by signal"
+	case runErr != nil:
+		res.Status = state.StatusFailed
+		res.StopReason = runErr.Error()
+	case res.Total > 0 && res.Passed == res.Total:
+		res.Status = state.StatusCompleted
+		res.StopReason = "all stories passed"
+	case selectedPass:
+		res.Status = state.StatusCompleted
+		res.StopReason = "all selected stories passed"
+	case budgetExhausted(store, runID, skipped):
+		res.Status = state.StatusBudgetExhausted
+		res.StopReason = "budget exhausted"
+	default:
+		res.Status = state.StatusPartial
+		res.StopReason = fmt.Sprintf("%d stories skipped after max iterations", len(skipped))
+	}
+
+	if err := store.FinishRun(runID, res); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: recording run result: %v\n", err)
+	}
+}
+
+// budgetExhausted reports whether any skipped story's last iteration ended
+// because the agent hit its spending limit.
+func budgetExhausted(store state.Store, runID string, skipped map[string]bool) bool {
+	for id := range skipped {
+		iters, err := store.GetIterationsForStory(runID, id)
+		if err != nil || len(iters) == 0 {
+			continue
+		}
+		for _, evt := range iters[len(iters)-1].Events {
+			if evt.Type == claude.EventResult && evt.Subtype == claude.ResultMaxBudget {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // buildStoryPrompt constructs the prompt sent to the Claude agent for a story.
 func buildStoryPrompt(s *prd.UserStory) string {
 	var sb strings.Builder
@@ -292,9 +462,65 @@ func buildStoryPrompt(s *prd.UserStory) string {
 	if s.Notes != "" {
 		sb.WriteString(fmt.Sprintf("\n**Notes:** %s\n", s.Notes))
 	}
+	if s.Prompt != "" {
+		sb.WriteString(fmt.Sprintf("\n**Additional instructions:**\n%s\n", s.Prompt))
+	}
 	return sb.String()
 }
 
+// defaultSettings returns the run-wide agent settings from the CLI flags and
+// config file. Stories may override them; see prd.UserStory.Effective.
+func defaultSettings(globals *CLI, maxIterations int) prd.Settings {
+	// Allowed tools: config file override or default.
+	allowedTools := []string{"Bash", "Read", "Edit", "Write", "Glob", "Grep"}
+	if len(globals.fileConfig.AllowedTools) > 0 {
+		allowedTools = globals.fileConfig.AllowedTools
+	}
+	return prd.Settings{
+		Model:         globals.Model,
+		MaxTurns:      globals.MaxTurns,
+		MaxBudget:     globals.MaxBudget,
+		MaxIterations: maxIterations,
+		AllowedTools:  allowedTools,
+	}
+}
+
+// agentConfig builds the agent invocation for a story from its effective
+// settings.
+func agentConfig(story *prd.UserStory, settings prd.Settings, agentPrompt, workDir string) claude.RunConfig {
+	return claude.RunConfig{
+		Prompt:             buildStoryPrompt(story),
+		Model:              settings.Model,
+		MaxTurns:           settings.MaxTurns,
+		MaxBudgetUSD:       settings.MaxBudget,
+		WorkDir:            workDir,
+		AppendSystemPrompt: agentPrompt,
+		AllowedTools:       settings.AllowedTools,
+		AdditionalFlags:    []string{"--dangerously-skip-permissions"},
+	}
+}
+
+// sessionContext bounds an agent session by the story's timeout, if it has
+// one.
+func sessionContext(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// timeoutEvent returns the error event recorded for a session that ran out of
+// time, or false if the session did not time out.
+func timeoutEvent(sessionCtx context.Context, timeout time.Duration) (claude.StreamEvent, bool) {
+	if !errors.Is(sessionCtx.Err(), context.DeadlineExceeded) {
+		return claude.StreamEvent{}, false
+	}
+	return claude.StreamEvent{
+		Type:    claude.EventError,
+		Message: fmt.Sprintf("agent session timed out after %s", timeout),
+	}, true
+}
+
 // printStreamEvent prints a streaming event from the Claude agent to stdout.
 func printStreamEvent(evt claude.StreamEvent) {
 	switch evt.Type {
@@ -312,7 +538,7 @@ func printStreamEvent(evt claude.StreamEvent) {
 	case claude.EventToolResult:
 		// Tool results can be large; skip to avoid noise.
 	case claude.EventError:
-		fmt.Fprintf(os.Stderr, "[error] %s\n", evt.Message)
+		printErrorEvent("", evt)
 	case claude.EventInit:
 		if evt.SessionID != "" {
 			fmt.Printf("[session: %s]\n", evt.SessionID)
@@ -322,6 +548,20 @@ func printStreamEvent(evt claude.StreamEvent) {
 	}
 }
 
+// printErrorEvent prints an error event to stderr, with the end of the agent
+// process's stderr and what to do about the failure, if known.
+func printErrorEvent(prefix string, evt claude.StreamEvent) {
+	fmt.Fprintf(os.Stderr, "%s[error] %s\n", prefix, evt.Message)
+	if evt.Stderr != "" {
+		for _, line := range strings.Split(evt.Stderr, "\n") {
+			fmt.Fprintf(os.Stderr, "%s  | %s\n", prefix, line)
+		}
+	}
+	if hint := claude.Hint(evt.Err); hint != "" {
+		fmt.Fprintf(os.Stderr, "%s  %s\n", prefix, hint)
+	}
+}
+
 // toolDetail extracts a short summary from a tool_use event's input.
 func toolDetail(evt claude.StreamEvent) string {
 	if len(evt.Input) == 0 {
@@ -376,67 +616,89 @@ type storyResult struct {
 	storyTitle string
 	passed     bool
 	events     []claude.StreamEvent
+	// err is the agent process failure that ended the session, if any.
+	err error
 	// For parallel execution — the worktree branch that needs merging.
 	worktreeBranch string
 	worktreePath   string
 	iterNum        int
+	maxIterations  int // the story's effective limit
+	startTime      time.Time
 }
 
 // runSingleAgent runs a Claude agent for a single story in the current working
-// directory and returns the result. Events are published to the store for SSE.
-func runSingleAgent(ctx context.Context, exec *claude.Executor, story *prd.UserStory, agentPrompt string, globals *CLI, prdPath string, store *state.MemoryStore, allowedTools []string) storyResult {
-	storyPrompt := buildStoryPrompt(story)
-
-	cfg := claude.RunConfig{
-		Prompt:             storyPrompt,
-		Model:              globals.Model,
-		MaxTurns:           globals.MaxTurns,
-		MaxBudgetUSD:       globals.MaxBudget,
-		WorkDir:            globals.WorkDir,
-		AppendSystemPrompt: agentPrompt,
-		AllowedTools:       allowedTools,
-		AdditionalFlags:    []string{"--dangerously-skip-permissions"},
-	}
+// directory and returns the result. Events are published to the store for SSE
+// on the stream identified by key.
+func runSingleAgent(ctx context.Context, exec *claude.Executor, story *prd.UserStory, agentPrompt string, globals *CLI, prdPath string, store state.Store, key state.StreamKey, settings prd.Settings) storyResult {
+	cfg := agentConfig(story, settings, agentPrompt, globals.WorkDir)
 
 	if store != nil {
-		store.ResetBroadcast(story.ID)
+		store.BeginBroadcast(key)
 	}
 
-	events, err := exec.RunStreaming(ctx, cfg)
+	sessionCtx, cancel := sessionContext(ctx, settings.Timeout)
+	defer cancel()
+
+	startTime := time.Now()
+	events, err := exec.RunStreaming(sessionCtx, cfg)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "error starting agent for %s: %v\n", story.ID, err)
-		return storyResult{storyID: story.ID, storyTitle: story.Title, passed: false}
+		return storyResult{storyID: story.ID, storyTitle: story.Title, passed: false, maxIterations: settings.MaxIterations, startTime: startTime, err: err}
 	}
 
 	exitedCleanly := true
 	var collectedEvents []claude.StreamEvent
+	var processErr error
 	for evt := range events {
 		printStreamEvent(evt)
 		collectedEvents = append(collectedEvents, evt)
 		if store != nil {
-			store.PublishEvent(story.ID, evt)
+			store.PublishEvent(key, evt)
 		}
 		if evt.Type == claude.EventError {
 			exitedCleanly = false
+			processErr = cmp.Or(evt.Err, processErr)
+		}
+	}
+	if evt, ok := timeoutEvent(sessionCtx, settings.Timeout); ok {
+		printStreamEvent(evt)
+		collectedEvents = append(collectedEvents, evt)
+		if store != nil {
+			store.PublishEvent(key, evt)
 		}
+		exitedCleanly = false
 	}
 
 	if store != nil {
-		store.CloseSubscribers(story.ID)
+		store.CloseSubscribers(key)
 	}
 
 	return storyResult{
-		storyID:    story.ID,
-		storyTitle: story.Title,
-		passed:     exitedCleanly,
-		events:     collectedEvents,
+		storyID:       story.ID,
+		storyTitle:    story.Title,
+		passed:        exitedCleanly,
+		events:        collectedEvents,
+		err:           processErr,
+		maxIterations: settings.MaxIterations,
+		startTime:     startTime,
 	}
 }
 
+// agentFailure returns the error that stops the run after result: a Claude
+// CLI failure that running more iterations cannot fix.
+func agentFailure(result storyResult) error {
+	for _, kind := range []error{claude.ErrNotFound, claude.ErrAuth, claude.ErrRateLimit} {
+		if errors.Is(result.err, kind) {
+			return fmt.Errorf("stopping run after %s: %w", result.storyID, result.err)
+		}
+	}
+	return nil
+}
+
 // processStoryResult handles the result of a single story execution: updates
 // PRD, appends progress, persists iteration to state store, and commits if
 // passed. Returns the reloaded PRD.
-func processStoryResult(result storyResult, prdPath, progressPath string, p *prd.PRD, iterNum, maxIterations int, storyIterations map[string]int, skippedStories map[string]bool, store *state.MemoryStore, runID string) (*prd.PRD, error) {
+func processStoryResult(result storyResult, prdPath, progressPath string, p *prd.PRD, iterNum int, storyIterations map[string]int, skippedStories map[string]bool, store state.Store, runID string) (*prd.PRD, error) {
 	// Reload PRD to pick up any changes the agent may have made.
 	p, err := prd.LoadPRD(prdPath)
 	if err != nil {
@@ -450,12 +712,13 @@ func processStoryResult(result storyResult, prdPath, progressPath string, p *prd
 			iterStatus = state.StatusPassed
 		}
 		iter := state.Iteration{
-			RunID:   runID,
-			StoryID: result.storyID,
-			Number:  iterNum,
-			EndTime: time.Now(),
-			Status:  iterStatus,
-			Events:  result.events,
+			RunID:     runID,
+			StoryID:   result.storyID,
+			Number:    iterNum,
+			StartTime: result.startTime,
+			EndTime:   time.Now(),
+			Status:    iterStatus,
+			Events:    result.events,
 		}
 		if err := store.AddIteration(runID, iter); err != nil {
 			fmt.Fprintf(os.Stderr, "warning: saving iteration: %v\n", err)
@@ -463,13 +726,7 @@ func processStoryResult(result storyResult, prdPath, progressPath string, p *prd
 	}
 
 	if result.passed {
-		for i := range p.UserStories {
-			if p.UserStories[i].ID == result.storyID {
-				p.UserStories[i].Passes = true
-				break
-			}
-		}
-		if err := prd.SavePRD(prdPath, p); err != nil {
+		if p, err = markPassed(prdPath, result.storyID); err != nil {
 			return nil, fmt.Errorf("saving PRD after %s passed: %w", result.storyID, err)
 		}
 		if err := progress.AppendEntry(progressPath, result.storyID, true, result.events); err != nil {
@@ -479,28 +736,84 @@ func processStoryResult(result storyResult, prdPath, progressPath string, p *prd
 		if err := git.CommitAll(commitMsg); err != nil {
 			fmt.Fprintf(os.Stderr, "warning: commit failed for %s: %v\n", result.storyID, err)
 		}
-		fmt.Printf("[%s] PASS (iteration %d/%d)\n", result.storyID, iterNum, maxIterations)
+		fmt.Printf("[%s] PASS (iteration %d/%d)\n", result.storyID, iterNum, result.maxIterations)
+		publishStoryStatus(store, runID, result.storyID, state.StatusPassed, "")
 	} else {
 		if err := progress.AppendEntry(progressPath, result.storyID, false, result.events); err != nil {
 			fmt.Fprintf(os.Stderr, "warning: updating progress.txt: %v\n", err)
 		}
-		fmt.Printf("[%s] FAIL (iteration %d/%d)\n", result.storyID, iterNum, maxIterations)
-		if iterNum >= maxIterations {
+		fmt.Printf("[%s] FAIL (iteration %d/%d)\n", result.storyID, iterNum, result.maxIterations)
+		if iterNum >= result.maxIterations {
 			skippedStories[result.storyID] = true
-			fmt.Printf("[%s] Skipping — exceeded max iterations (%d)\n", result.storyID, maxIterations)
+			fmt.Printf("[%s] Skipping — exceeded max iterations (%d)\n", result.storyID, result.maxIterations)
+			publishStoryStatus(store, runID, result.storyID, state.StatusFailed, "skipped: exceeded max iterations")
 		}
 	}
 	return p, nil
 }
 
+// withPRDFile points a prompt's references to prd.json at the PRD file
+// actually in use, which may have another name or format.
+func withPRDFile(prompt, prdPath string) string {
+	return strings.ReplaceAll(prompt, "`prd.json`", "`"+filepath.Base(prdPath)+"`")
+}
+
+// markPassed sets passes on a story in the PRD file. The agent may have edited
+// the file during the iteration, so the change is applied to its current
+// contents and retried if it changes again before the write.
+func markPassed(prdPath, storyID string) (*prd.PRD, error) {
+	return prd.UpdatePRD(prdPath, func(p *prd.PRD) error {
+		if story := prd.FindStory(p, storyID); story != nil {
+			story.Passes = true
+		}
+		return nil
+	})
+}
+
+// runLockPath returns the lock file held by the agent loop for its duration.
+func runLockPath(globals *CLI) string {
+	return filepath.Join(globals.WorkDir, ".ralph-wiggo", "run.lock")
+}
+
+// openStore opens the state store under .ralph-wiggo with the backend chosen
+// by stateBackend in the config file.
+func openStore(globals *CLI) (state.Store, error) {
+	return state.Open(globals.fileConfig.StateBackend, filepath.Join(globals.WorkDir, ".ralph-wiggo"))
+}
+
+// publishStoryStatus notifies run event subscribers that a story's status
+// changed. It is a no-op when store is nil.
+func publishStoryStatus(store state.Store, runID, storyID string, status state.Status, message string) {
+	if store == nil {
+		return
+	}
+	store.PublishRunEvent(state.RunEvent{
+		Type:    state.RunEventStoryStatus,
+		RunID:   runID,
+		StoryID: storyID,
+		Status:  status,
+		Message: message,
+	})
+}
+
 // runParallelAgents runs Claude agents concurrently in separate git worktrees,
-// one per story. Returns all results after all agents complete.
-func runParallelAgents(ctx context.Context, exec *claude.Executor, stories []*prd.UserStory, agentPrompt string, globals *CLI, prdPath string, storyIterations map[string]int, maxIterations int, store *state.MemoryStore, allowedTools []string) []storyResult {
+// one per story, each with its effective settings. Returns all results after
+// all agents complete.
+func runParallelAgents(ctx context.Context, exec *claude.Executor, stories []*prd.UserStory, agentPrompt string, globals *CLI, prdPath string, storyIterations map[string]int, settings prd.Settings, store state.Store, runID string) []storyResult {
 	worktreeBase := filepath.Join(globals.WorkDir, ".ralph-wiggo", "worktrees")
 
 	fmt.Printf("\n=== Parallel batch: %d stories ===\n", len(stories))
+	batchIDs := make([]string, 0, len(stories))
 	for _, s := range stories {
 		fmt.Printf("  - %s: %s\n", s.ID, s.Title)
+		batchIDs = append(batchIDs, s.ID)
+	}
+	if store != nil {
+		store.PublishRunEvent(state.RunEvent{
+			Type:    state.RunEventBatchStart,
+			RunID:   runID,
+			Stories: batchIDs,
+		})
 	}
 
 	var (
@@ -514,7 +827,7 @@ func runParallelAgents(ctx context.Context, exec *claude.Executor, stories []*pr
 		fmt.Fprintf(os.Stderr, "error creating worktree directory: %v\n", err)
 		// Fall back to sequential-style result with all failures.
 		for _, s := range stories {
-			results = append(results, storyResult{storyID: s.ID, storyTitle: s.Title, passed: false})
+			results = append(results, storyResult{storyID: s.ID, storyTitle: s.Title, passed: false, maxIterations: s.Effective(settings).MaxIterations})
 		}
 		return results
 	}
@@ -532,11 +845,12 @@ func runParallelAgents(ctx context.Context, exec *claude.Executor, stories []*pr
 	for _, story := range stories {
 		storyIterations[story.ID]++
 		iterNum := storyIterations[story.ID]
+		storySettings := story.Effective(settings)
 
 		wtPath := filepath.Join(worktreeBase, story.ID)
 		wtBranch := fmt.Sprintf("worktree-%s", story.ID)
 
-		fmt.Printf("\n--- %s - %s (iteration %d/%d) [parallel] ---\n", story.ID, story.Title, iterNum, maxIterations)
+		fmt.Printf("\n--- %s - %s (iteration %d/%d) [parallel] ---\n", story.ID, story.Title, iterNum, storySettings.MaxIterations)
 
 		// Create worktree for this story.
 		if err := git.WorktreeAdd(wtPath, wtBranch); err != nil {
@@ -544,7 +858,7 @@ func runParallelAgents(ctx context.Context, exec *claude.Executor, stories []*pr
 			mu.Lock()
 			results = append(results, storyResult{
 				storyID: story.ID, storyTitle: story.Title, passed: false,
-				iterNum: iterNum,
+				iterNum: iterNum, maxIterations: storySettings.MaxIterations,
 			})
 			mu.Unlock()
 			continue
@@ -554,33 +868,34 @@ func runParallelAgents(ctx context.Context, exec *claude.Executor, stories []*pr
 		worktrees = append(worktrees, worktreeInfo{path: wtPath, branch: wtBranch})
 		wtMu.Unlock()
 
+		if store != nil {
+			if err := store.StartIteration(runID, story.ID, iterNum); err != nil {
+				fmt.Fprintf(os.Stderr, "warning: recording iteration start: %v\n", err)
+			}
+		}
+
 		wg.Add(1)
-		go func(s *prd.UserStory, wtDir, branch string, iter int) {
+		go func(s *prd.UserStory, settings prd.Settings, wtDir, branch string, iter int) {
 			defer wg.Done()
 
+			key := state.StreamKey{RunID: runID, StoryID: s.ID, Iteration: iter}
 			if store != nil {
-				store.ResetBroadcast(s.ID)
+				store.BeginBroadcast(key)
 			}
 
-			storyPrompt := buildStoryPrompt(s)
-			cfg := claude.RunConfig{
-				Prompt:             storyPrompt,
-				Model:              globals.Model,
-				MaxTurns:           globals.MaxTurns,
-				MaxBudgetUSD:       globals.MaxBudget,
-				WorkDir:            wtDir,
-				AppendSystemPrompt: agentPrompt,
-				AllowedTools:       allowedTools,
-				AdditionalFlags:    []string{"--dangerously-skip-permissions"},
-			}
+			cfg := agentConfig(s, settings, agentPrompt, wtDir)
+			sessionCtx, cancel := sessionContext(ctx, settings.Timeout)
+			defer cancel()
 
-			events, err := exec.RunStreaming(ctx, cfg)
+			startTime := time.Now()
+			events, err := exec.RunStreaming(sessionCtx, cfg)
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "error starting agent for %s: %v\n", s.ID, err)
 				mu.Lock()
 				results = append(results, storyResult{
-					storyID: s.ID, storyTitle: s.Title, passed: false,
+					storyID: s.ID, storyTitle: s.Title, passed: false, err: err,
 					worktreeBranch: branch, worktreePath: wtDir, iterNum: iter,
+					maxIterations: settings.MaxIterations, startTime: startTime,
 				})
 				mu.Unlock()
 				return
@@ -588,20 +903,30 @@ func runParallelAgents(ctx context.Context, exec *claude.Executor, stories []*pr
 
 			exitedCleanly := true
 			var collectedEvents []claude.StreamEvent
+			var processErr error
 			for evt := range events {
 				// In parallel mode, prefix output with story ID for clarity.
 				printParallelEvent(s.ID, evt)
 				collectedEvents = append(collectedEvents, evt)
 				if store != nil {
-					store.PublishEvent(s.ID, evt)
+					store.PublishEvent(key, evt)
 				}
 				if evt.Type == claude.EventError {
 					exitedCleanly = false
+					processErr = cmp.Or(evt.Err, processErr)
 				}
 			}
+			if evt, ok := timeoutEvent(sessionCtx, settings.Timeout); ok {
+				printParallelEvent(s.ID, evt)
+				collectedEvents = append(collectedEvents, evt)
+				if store != nil {
+					store.PublishEvent(key, evt)
+				}
+				exitedCleanly = false
+			}
 
 			if store != nil {
-				store.CloseSubscribers(s.ID)
+				store.CloseSubscribers(key)
 			}
 
 			mu.Lock()
@@ -610,12 +935,15 @@ func runParallelAgents(ctx context.Context, exec *claude.Executor, stories []*pr
 				storyTitle:     s.Title,
 				passed:         exitedCleanly,
 				events:         collectedEvents,
+				err:            processErr,
 				worktreeBranch: branch,
 				worktreePath:   wtDir,
 				iterNum:        iter,
+				maxIterations:  settings.MaxIterations,
+				startTime:      startTime,
 			})
 			mu.Unlock()
-		}(story, wtPath, wtBranch, iterNum)
+		}(story, storySettings, wtPath, wtBranch, iterNum)
 	}
 
 	// Wait for all agents to complete.
@@ -641,15 +969,26 @@ func runParallelAgents(ctx context.Context, exec *claude.Executor, stories []*pr
 // processParallelResults handles the results of parallel story executions:
 // merges worktree branches, updates PRD, appends progress, persists iterations,
 // and commits.
-func processParallelResults(results []storyResult, prdPath, progressPath string, p *prd.PRD, maxIterations int, storyIterations map[string]int, skippedStories map[string]bool, store *state.MemoryStore, runID string) (*prd.PRD, error) {
+func processParallelResults(results []storyResult, prdPath, progressPath string, p *prd.PRD, storyIterations map[string]int, skippedStories map[string]bool, store state.Store, runID string) (*prd.PRD, error) {
 	for _, result := range results {
 		if result.passed && result.worktreeBranch != "" {
 			// Merge the worktree branch into the current branch.
+			mergeEvt := state.RunEvent{
+				Type:    state.RunEventMerge,
+				RunID:   runID,
+				StoryID: result.storyID,
+				Status:  state.StatusPassed,
+			}
 			if err := git.MergeFrom(result.worktreeBranch); err != nil {
 				fmt.Fprintf(os.Stderr, "[%s] merge conflict — marking as failed: %v\n", result.storyID, err)
 				// Abort the merge to restore working tree.
 				_ = git.AbortMerge()
 				result.passed = false
+				mergeEvt.Status = state.StatusFailed
+				mergeEvt.Message = "merge conflict"
+			}
+			if store != nil {
+				store.PublishRunEvent(mergeEvt)
 			}
 		}
 
@@ -667,12 +1006,13 @@ func processParallelResults(results []storyResult, prdPath, progressPath string,
 				iterStatus = state.StatusPassed
 			}
 			iter := state.Iteration{
-				RunID:   runID,
-				StoryID: result.storyID,
-				Number:  result.iterNum,
-				EndTime: time.Now(),
-				Status:  iterStatus,
-				Events:  result.events,
+				RunID:     runID,
+				StoryID:   result.storyID,
+				Number:    result.iterNum,
+				StartTime: result.startTime,
+				EndTime:   time.Now(),
+				Status:    iterStatus,
+				Events:    result.events,
 			}
 			if err := store.AddIteration(runID, iter); err != nil {
 				fmt.Fprintf(os.Stderr, "warning: saving iteration: %v\n", err)
@@ -680,13 +1020,7 @@ func processParallelResults(results []storyResult, prdPath, progressPath string,
 		}
 
 		if result.passed {
-			for i := range p.UserStories {
-				if p.UserStories[i].ID == result.storyID {
-					p.UserStories[i].Passes = true
-					break
-				}
-			}
-			if err := prd.SavePRD(prdPath, p); err != nil {
+			if p, err = markPassed(prdPath, result.storyID); err != nil {
 				return nil, fmt.Errorf("saving PRD after %s passed: %w", result.storyID, err)
 			}
 			if err := progress.AppendEntry(progressPath, result.storyID, true, result.events); err != nil {
@@ -696,21 +1030,111 @@ func processParallelResults(results []storyResult, prdPath, progressPath string,
 			if err := git.CommitAll(commitMsg); err != nil {
 				fmt.Fprintf(os.Stderr, "warning: commit failed for %s: %v\n", result.storyID, err)
 			}
-			fmt.Printf("[%s] PASS (iteration %d/%d)\n", result.storyID, result.iterNum, maxIterations)
+			fmt.Printf("[%s] PASS (iteration %d/%d)\n", result.storyID, result.iterNum, result.maxIterations)
+			publishStoryStatus(store, runID, result.storyID, state.StatusPassed, "")
 		} else {
 			if err := progress.AppendEntry(progressPath, result.storyID, false, result.events); err != nil {
 				fmt.Fprintf(os.Stderr, "warning: updating progress.txt: %v\n", err)
 			}
-			fmt.Printf("[%s] FAIL (iteration %d/%d)\n", result.storyID, result.iterNum, maxIterations)
-			if result.iterNum >= maxIterations {
+			fmt.Printf("[%s] FAIL (iteration %d/%d)\n", result.storyID, result.iterNum, result.maxIterations)
+			if result.iterNum >= result.maxIterations {
 				skippedStories[result.storyID] = true
-				fmt.Printf("[%s] Skipping — exceeded max iterations (%d)\n", result.storyID, maxIterations)
+				fmt.Printf("[%s] Skipping — exceeded max iterations (%d)\n", result.storyID, result.maxIterations)
+				publishStoryStatus(store, runID, result.storyID, state.StatusFailed, "skipped: exceeded max iterations")
 			}
 		}
 	}
 	return p, nil
 }
 
+// splitSkippedStories offers to split each newly skipped story into smaller
+// stories, which replace it at its priority so the loop picks them up next.
+// Splits must be confirmed unless autoSplit is set; stories that are not
+// split stay skipped. offered records the stories already considered.
+func splitSkippedStories(ctx context.Context, exec *claude.Executor, globals *CLI, prdPath string, p *prd.PRD, skipped, offered map[string]bool, store state.Store, runID string) *prd.PRD {
+	for _, id := range slices.Sorted(maps.Keys(skipped)) {
+		if offered[id] || ctx.Err() != nil {
+			continue
+		}
+		offered[id] = true
+		story := prd.FindStory(p, id)
+		if story == nil {
+			continue
+		}
+
+		var iters []state.Iteration
+		if store != nil {
+			var err error
+			if iters, err = store.GetIterationsForStory(runID, id); err != nil {
+				fmt.Fprintf(os.Stderr, "warning: loading iterations of %s: %v\n", id, err)
+			}
+		}
+		fmt.Printf("\n[%s] Proposing a split into smaller stories...\n", id)
+		cfg := claude.RunConfig{
+			Model:        globals.Model,
+			MaxBudgetUSD: globals.MaxBudget,
+			WorkDir:      globals.WorkDir,
+		}
+		parts, err := splitter.Propose(ctx, exec, cfg, story, splitter.Digest(iters))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "warning: splitting %s: %v\n", id, err)
+			continue
+		}
+		for i, part := range parts {
+			fmt.Printf("  %d. %s\n", i+1, part.Title)
+			for _, ac := range part.AcceptanceCriteria {
+				fmt.Printf("     - %s\n", ac)
+			}
+		}
+		if !globals.fileConfig.AutoSplit && !confirm(ctx, fmt.Sprintf("Split %s into these %d stories?", id, len(parts))) {
+			fmt.Printf("[%s] Not split; the story stays skipped.\n", id)
+			continue
+		}
+
+		var ids []string
+		updated, err := prd.UpdatePRD(prdPath, func(p *prd.PRD) error {
+			var err error
+			if ids, err = prd.SplitStory(p, id, parts); err != nil {
+				return err
+			}
+			return prd.Validate(p)
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "warning: saving split of %s: %v\n", id, err)
+			continue
+		}
+		p = updated
+		delete(skipped, id)
+		fmt.Printf("[%s] Split into %s\n", id, strings.Join(ids, ", "))
+		publishStoryStatus(store, runID, id, state.StatusSplit, "split into "+strings.Join(ids, ", "))
+	}
+	return p
+}
+
+// confirm asks a yes/no question on the terminal and reports whether the
+// answer was yes. Without a terminal to ask on, or if ctx is canceled while
+// waiting, the answer is no.
+func confirm(ctx context.Context, question string) bool {
+	fmt.Printf("%s [y/N] ", question)
+	if info, err := os.Stdin.Stat(); err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		fmt.Println("no (stdin is not a terminal)")
+		return false
+	}
+
+	answer := make(chan string, 1)
+	go func() {
+		line, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		answer <- strings.ToLower(strings.TrimSpace(line))
+	}()
+	select {
+	case a := <-answer:
+		return a == "y" || a == "yes"
+	case <-ctx.Done():
+		fmt.Println()
+		return false
+	}
+}
+
 // printParallelEvent prints a streaming event prefixed with the story ID.
 func printParallelEvent(storyID string, evt claude.StreamEvent) {
 	prefix := fmt.Sprintf("[%s] ", storyID)
@@ -729,7 +1153,7 @@ func printParallelEvent(storyID string, evt claude.StreamEvent) {
 	case claude.EventToolResult:
 		// Skip to avoid noise.
 	case claude.EventError:
-		fmt.Fprintf(os.Stderr, "%s[error] %s\n", prefix, evt.Message)
+		printErrorEvent(prefix, evt)
 	case claude.EventInit:
 		if evt.SessionID != "" {
 			fmt.Printf("%s[session: %s]\n", prefix, evt.SessionID)
@@ -766,13 +1190,14 @@ func runInteractiveWithPrompt(ctx context.Context, exec *claude.Executor, cfg cl
 	return exec.RunInteractive(ctx, resumeCfg)
 }
 
-// PRDCmd implements the 'prd' subcommand.
-type PRDCmd struct {
+// PRDGenerateCmd implements the 'prd generate' subcommand, which is also what
+// 'prd <description>' runs.
+type PRDGenerateCmd struct {
 	Description string `arg:"" help:"Feature description for PRD generation."`
 	Output      string `help:"Output path for generated PRD." default:""`
 }
 
-func (p *PRDCmd) Run(globals *CLI) error {
+func (p *PRDGenerateCmd) Run(globals *CLI) error {
 	skillContent, err := prompts.Get("prd-skill.md")
 	if err != nil {
 		return fmt.Errorf("loading prd-skill.md: %w", err)
@@ -791,7 +1216,7 @@ func (p *PRDCmd) Run(globals *CLI) error {
 		p.Description, outputPath,
 	)
 
-	exec := claude.NewExecutor()
+	exec := newExecutor(globals)
 	cfg := claude.RunConfig{
 		Prompt:             prompt,
 		Model:              globals.Model,
@@ -814,64 +1239,174 @@ func (p *PRDCmd) Run(globals *CLI) error {
 // ConvertCmd implements the 'convert' subcommand.
 type ConvertCmd struct {
 	PRDFile string `arg:"" help:"Path to PRD markdown file to convert."`
-	Output  string `help:"Output path for prd.json." default:"prd.json"`
+	Output  string `help:"Output path for the PRD; .yaml, .yml and .md select those formats." default:"prd.json"`
+
+	NonInteractive bool `help:"Convert with schema-constrained Claude calls instead of an interactive session, e.g. in CI." name:"non-interactive"`
+	Attempts       int  `help:"With --non-interactive, how many times to re-prompt Claude to repair an invalid PRD before giving up." default:"3"`
+	Yes            bool `help:"Write changes to an existing PRD without asking." short:"y"`
 }
 
 func (c *ConvertCmd) Run(globals *CLI) error {
-	// Load the ralph-skill.md content for the system prompt.
-	skillContent, err := prompts.Get("ralph-skill.md")
-	if err != nil {
-		return fmt.Errorf("loading ralph-skill.md: %w", err)
-	}
-
 	// Read the PRD markdown file.
 	prdContent, err := os.ReadFile(c.PRDFile)
 	if err != nil {
 		return fmt.Errorf("reading PRD file %q: %w", c.PRDFile, err)
 	}
 
-	// Build a prompt with the PRD content.
-	prompt := fmt.Sprintf(
-		"Convert the following PRD markdown into the prd.json format. Save the result to %s.\n\n%s",
-		c.Output, string(prdContent),
-	)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
 
-	exec := claude.NewExecutor()
+	opts := convertOptions{nonInteractive: c.NonInteractive, attempts: c.Attempts, yes: c.Yes}
+	parsedPRD, err := convertPRD(ctx, globals, newExecutor(globals), string(prdContent), c.Output, opts)
+	if err != nil {
+		return err
+	}
+
+	if err := prd.Validate(parsedPRD); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: validation issue: %v\n", err)
+	}
+
+	fmt.Printf("Wrote %s (%d stories)\n", c.Output, len(parsedPRD.UserStories))
+	lintConverted(parsedPRD)
+	return nil
+}
+
+// convertOptions select how convertPRD converts a PRD document.
+type convertOptions struct {
+	nonInteractive bool // schema-constrained calls instead of an interactive session
+	attempts       int  // re-prompts allowed to repair a non-interactive conversion
+	yes            bool // write changes to an existing PRD without asking
+}
+
+// convertPRD converts PRD markdown with the ralph skill and saves the result
+// to output, merging it into an existing PRD (see saveConversion).
+// Interactively the agent writes the PRD itself; otherwise converter.Convert
+// returns it and it is written here.
+func convertPRD(ctx context.Context, globals *CLI, exec *claude.Executor, markdown, output string, opts convertOptions) (*prd.PRD, error) {
+	skillContent, err := prompts.Get("ralph-skill.md")
+	if err != nil {
+		return nil, fmt.Errorf("loading ralph-skill.md: %w", err)
+	}
 	cfg := claude.RunConfig{
-		Prompt:             prompt,
 		Model:              globals.Model,
 		MaxTurns:           globals.MaxTurns,
 		MaxBudgetUSD:       globals.MaxBudget,
 		WorkDir:            globals.WorkDir,
 		AppendSystemPrompt: skillContent,
-		AdditionalFlags:    []string{"--dangerously-skip-permissions"},
 	}
 
-	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
-	defer stop()
+	if opts.nonInteractive {
+		converted, err := converter.Convert(ctx, exec, cfg, markdown, opts.attempts)
+		if err != nil {
+			return nil, fmt.Errorf("prd conversion: %w", err)
+		}
+		return saveConversion(ctx, globals, converted, output, opts.yes)
+	}
+
+	jsonPath, err := conversionTarget(output)
+	if err != nil {
+		return nil, err
+	}
+	defer removeConversionTarget(jsonPath, output)
 
+	cfg.Prompt = fmt.Sprintf(
+		"Convert the following PRD markdown into the prd.json format. Save the result to %s.\n\n%s",
+		jsonPath, markdown,
+	)
+	cfg.AdditionalFlags = []string{"--dangerously-skip-permissions"}
 	if err := exec.RunInteractive(ctx, cfg); err != nil {
-		return fmt.Errorf("prd conversion: %w", err)
+		return nil, fmt.Errorf("prd conversion: %w", err)
 	}
 
-	// Load and validate the prd.json that Claude wrote.
-	parsedPRD, err := prd.LoadPRD(c.Output)
+	// Load the prd.json that Claude wrote.
+	converted, err := prd.LoadPRD(jsonPath)
 	if err != nil {
-		return fmt.Errorf("loading converted %s: %w", c.Output, err)
+		return nil, fmt.Errorf("loading converted %s: %w", output, err)
+	}
+	if jsonPath == output {
+		return converted, nil
 	}
+	return saveConversion(ctx, globals, converted, output, opts.yes)
+}
 
-	if err := prd.Validate(parsedPRD); err != nil {
-		fmt.Fprintf(os.Stderr, "warning: validation issue: %v\n", err)
+// conversionTarget returns where the agent should write the converted PRD.
+// The agent always writes JSON, and an existing PRD must not be overwritten
+// (saveConversion merges into it instead), so unless output is a new JSON
+// file the agent writes to a temporary file next to it.
+func conversionTarget(output string) (string, error) {
+	if _, err := os.Stat(output); errors.Is(err, fs.ErrNotExist) && prd.FormatOf(output) == prd.FormatJSON {
+		return output, nil
 	}
+	// Reserve a unique name, but leave the file for the agent to create.
+	f, err := os.CreateTemp(filepath.Dir(output), ".prd-convert-*.json")
+	if err != nil {
+		return "", fmt.Errorf("creating conversion file: %w", err)
+	}
+	f.Close()
+	os.Remove(f.Name())
+	return f.Name(), nil
+}
 
-	fmt.Printf("Wrote %s (%d stories)\n", c.Output, len(parsedPRD.UserStories))
-	return nil
+// removeConversionTarget deletes the temporary file from conversionTarget,
+// if one was used.
+func removeConversionTarget(jsonPath, output string) {
+	if jsonPath != output {
+		os.Remove(jsonPath)
+	}
+}
+
+// saveConversion saves a converted PRD to output. If output already holds a
+// PRD, the conversion is merged into it so stories keep their progress (see
+// prd.MergeConversion); the changes are shown and, unless yes is set, must be
+// confirmed before they are written.
+func saveConversion(ctx context.Context, globals *CLI, converted *prd.PRD, output string, yes bool) (*prd.PRD, error) {
+	lock, err := lockForEdit(globals)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Release()
+
+	existing, version, err := prd.LoadPRDVersion(output)
+	if errors.Is(err, fs.ErrNotExist) {
+		if err := prd.SavePRD(output, converted); err != nil {
+			return nil, err
+		}
+		return converted, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("loading existing %s: %w", output, err)
+	}
+
+	merged, changes := prd.MergeConversion(existing, converted)
+	unchanged := 0
+	fmt.Printf("\nChanges to %s:\n", output)
+	for _, c := range changes {
+		if c.Kind == prd.StoryUnchanged {
+			unchanged++
+			continue
+		}
+		fmt.Printf("  %s\n", c)
+	}
+	fmt.Printf("  %d unchanged\n", unchanged)
+	if unchanged == len(changes) && merged.Project == existing.Project &&
+		merged.BranchName == existing.BranchName && merged.Description == existing.Description {
+		fmt.Printf("%s is up to date.\n", output)
+		return existing, nil
+	}
+
+	if !yes && !confirm(ctx, fmt.Sprintf("Write these changes to %s?", output)) {
+		return nil, fmt.Errorf("conversion not saved; %s is unchanged", output)
+	}
+	if _, err := prd.SavePRDIfUnchanged(output, merged, version); err != nil {
+		return nil, fmt.Errorf("saving %s: %w", output, err)
+	}
+	return merged, nil
 }
 
 // ServeCmd implements the 'serve' subcommand.
 type ServeCmd struct {
 	Port    int    `help:"Port for the web dashboard." default:"8484"`
-	PRDPath string `help:"Path to prd.json." default:"prd.json" name:"prd"`
+	PRDPath string `help:"Path to the PRD file (.json, .yaml or .md)." default:"prd.json" name:"prd"`
 }
 
 func (s *ServeCmd) Run(globals *CLI) error {
@@ -881,17 +1416,20 @@ func (s *ServeCmd) Run(globals *CLI) error {
 	}
 
 	// Load state store from disk for historical event data.
-	storeDir := filepath.Join(globals.WorkDir, ".ralph-wiggo", "runs")
-	store, err := state.NewMemoryStore(storeDir)
+	store, err := openStore(globals)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "warning: loading state: %v\n", err)
 		store = nil
+	} else {
+		defer store.Close()
 	}
 
 	srv, err := web.NewServer(s.PRDPath, s.Port, store)
 	if err != nil {
 		return fmt.Errorf("starting web server: %w", err)
 	}
+	// serve has no run flags; stories are shown with the run defaults.
+	srv.SetDefaults(defaultSettings(globals, 10))
 
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
 	defer stop()
@@ -904,30 +1442,83 @@ func (s *ServeCmd) Run(globals *CLI) error {
 	return srv.ListenAndServe()
 }
 
+// SearchCmd implements the 'search' subcommand.
+type SearchCmd struct {
+	Query   string `arg:"" help:"Search terms; all must match. Quote a phrase to match it exactly."`
+	RunID   string `help:"Only search this run ID." name:"run"`
+	StoryID string `help:"Only search this story ID." name:"story"`
+	Tool    string `help:"Only search calls to (and results of) this tool."`
+	Limit   int    `help:"Maximum number of results." default:"20"`
+}
+
+func (c *SearchCmd) Run(globals *CLI) error {
+	store, err := openStore(globals)
+	if err != nil {
+		return fmt.Errorf("loading state: %w", err)
+	}
+	defer store.Close()
+
+	hits := store.Search(search.Query{
+		Text:    c.Query,
+		RunID:   c.RunID,
+		StoryID: c.StoryID,
+		Tool:    c.Tool,
+		Limit:   c.Limit,
+	})
+	if len(hits) == 0 {
+		fmt.Println("No matches.")
+		return nil
+	}
+
+	port := 8484
+	if globals.fileConfig.Port != 0 {
+		port = globals.fileConfig.Port
+	}
+	for _, h := range hits {
+		kind := string(h.Type)
+		if h.ToolName != "" {
+			kind += " " + h.ToolName
+		}
+		fmt.Printf("%s  %s  iteration %d, event %d  [%s]\n", h.RunID, h.StoryID, h.Iteration, h.Offset, kind)
+		fmt.Printf("  %s\n", h.Snippet)
+		fmt.Printf("  http://localhost:%d%s\n\n", port, h.URL())
+	}
+	return nil
+}
+
 // FullCmd implements the 'full' subcommand.
 type FullCmd struct {
 	// PRD generation flags.
-	Description string `arg:"" help:"Feature description for the full workflow."`
-	Output      string `help:"Output path for generated PRD markdown." default:""`
+	Description     string `arg:"" optional:"" help:"Feature description for the full workflow."`
+	DescriptionFile string `help:"Read the feature description from a file instead." name:"description-file" type:"existingfile"`
+	Output          string `help:"Output path for generated PRD markdown." default:""`
 
 	// Convert flags.
-	JSONOutput string `help:"Output path for prd.json." default:"prd.json" name:"json-output"`
+	JSONOutput string `help:"Output path for the PRD; .yaml, .yml and .md select those formats." default:"prd.json" name:"json-output"`
+	Attempts   int    `help:"With --yes, how many times to re-prompt Claude to repair an invalid converted PRD." default:"3"`
 
 	// Run flags.
 	Parallelism   string `help:"Parallelism mode: sequential, parallel-N, or auto." default:"sequential"`
 	MaxIterations int    `help:"Maximum iterations per story before skipping." default:"10" name:"max-iterations"`
 	UI            bool   `help:"Start web dashboard during the run phase."`
+
+	Yes bool `help:"Run unattended: generate and convert the PRD without interactive sessions, answering clarifying questions with assumptions, then start the run. Rerunning resumes after the last finished phase." short:"y" aliases:"unattended"`
 }
 
 func (f *FullCmd) Run(globals *CLI) error {
-	// Step 1: PRD generation (interactive).
-	prdOutputPath := f.Output
-	if prdOutputPath == "" {
-		prdOutputPath = "tasks/prd-" + slugify(f.Description) + ".md"
+	description, err := f.description()
+	if err != nil {
+		return err
+	}
+	if f.Yes {
+		return f.runUnattended(globals, description)
 	}
 
+	// Step 1: PRD generation (interactive).
+	prdOutputPath := f.prdOutputPath(description)
+
 	fmt.Println("=== Step 1: PRD Generation ===")
-	fmt.Printf("Generating PRD for: %s\n", f.Description)
+	fmt.Printf("Generating PRD for: %s\n", description)
 	fmt.Printf("Output: %s\n\n", prdOutputPath)
 
 	skillContent, err := prompts.Get("prd-skill.md")
@@ -935,11 +1526,11 @@ func (f *FullCmd) Run(globals *CLI) error {
 		return fmt.Errorf("loading prd-skill.md: %w", err)
 	}
 
-	exec := claude.NewExecutor()
+	exec := newExecutor(globals)
 
 	prompt := fmt.Sprintf(
 		"Generate a PRD for the following feature:\n\n%s\n\nSave the PRD to: %s",
-		f.Description, prdOutputPath,
+		description, prdOutputPath,
 	)
 
 	cfg := claude.RunConfig{
@@ -964,39 +1555,14 @@ func (f *FullCmd) Run(globals *CLI) error {
 	// Step 2: Convert PRD to prd.json (interactive).
 	fmt.Println("\n=== Step 2: PRD Conversion ===")
 
-	ralphSkill, err := prompts.Get("ralph-skill.md")
-	if err != nil {
-		return fmt.Errorf("loading ralph-skill.md: %w", err)
-	}
-
 	prdContent, err := os.ReadFile(prdOutputPath)
 	if err != nil {
 		return fmt.Errorf("reading PRD file %q: %w", prdOutputPath, err)
 	}
 
-	convertPrompt := fmt.Sprintf(
-		"Convert the following PRD markdown into the prd.json format. Save the result to %s.\n\n%s",
-		f.JSONOutput, string(prdContent),
-	)
-
-	convertCfg := claude.RunConfig{
-		Prompt:             convertPrompt,
-		Model:              globals.Model,
-		MaxTurns:           globals.MaxTurns,
-		MaxBudgetUSD:       globals.MaxBudget,
-		WorkDir:            globals.WorkDir,
-		AppendSystemPrompt: ralphSkill,
-		AdditionalFlags:    []string{"--dangerously-skip-permissions"},
-	}
-
-	if err := exec.RunInteractive(ctx, convertCfg); err != nil {
-		return fmt.Errorf("prd conversion: %w", err)
-	}
-
-	// Load and validate the prd.json that Claude wrote.
-	parsedPRD, err := prd.LoadPRD(f.JSONOutput)
+	parsedPRD, err := convertPRD(ctx, globals, exec, string(prdContent), f.JSONOutput, convertOptions{})
 	if err != nil {
-		return fmt.Errorf("loading converted %s: %w", f.JSONOutput, err)
+		return err
 	}
 
 	if err := prd.Validate(parsedPRD); err != nil {
@@ -1004,9 +1570,44 @@ func (f *FullCmd) Run(globals *CLI) error {
 	}
 
 	fmt.Printf("Wrote %s (%d stories, branch: %s)\n", f.JSONOutput, len(parsedPRD.UserStories), parsedPRD.BranchName)
+	lintConverted(parsedPRD)
 
 	// Step 3: Run the agent loop.
 	fmt.Println("\n=== Step 3: Agent Loop ===")
+	return f.run(globals)
+}
+
+// description returns the feature description from the argument or from
+// --description-file.
+func (f *FullCmd) description() (string, error) {
+	switch {
+	case f.Description != "" && f.DescriptionFile != "":
+		return "", errors.New("give either a description or --description-file, not both")
+	case f.DescriptionFile != "":
+		data, err := os.ReadFile(f.DescriptionFile)
+		if err != nil {
+			return "", fmt.Errorf("reading description: %w", err)
+		}
+		if strings.TrimSpace(string(data)) == "" {
+			return "", fmt.Errorf("description file %s is empty", f.DescriptionFile)
+		}
+		return strings.TrimSpace(string(data)), nil
+	case strings.TrimSpace(f.Description) == "":
+		return "", errors.New("a feature description or --description-file is required")
+	}
+	return f.Description, nil
+}
+
+// prdOutputPath returns where the generated PRD markdown goes.
+func (f *FullCmd) prdOutputPath(description string) string {
+	if f.Output != "" {
+		return f.Output
+	}
+	return "tasks/prd-" + slugify(description) + ".md"
+}
+
+// run starts the agent loop on the converted PRD.
+func (f *FullCmd) run(globals *CLI) error {
 	runCmd := RunCmd{
 		PRDPath:       f.JSONOutput,
 		Parallelism:   f.Parallelism,
@@ -1055,6 +1656,498 @@ func main() {
 	err := ctx.Run(&cli)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		if hint := claude.Hint(err); hint != "" {
+			fmt.Fprintln(os.Stderr, hint)
+		}
 		os.Exit(1)
 	}
 }
+
+// HistoryCmd implements the 'history' subcommand.
+type HistoryCmd struct {
+	Status string `help:"Only list runs with this status (running, completed, partial, interrupted, failed, budget_exhausted)."`
+	Sort   string `help:"Sort by: started, ended, duration, passed, skipped, or status." default:"started"`
+	Limit  int    `help:"Maximum number of runs to list; 0 lists all." default:"20"`
+}
+
+func (c *HistoryCmd) Run(globals *CLI) error {
+	store, err := openStore(globals)
+	if err != nil {
+		return fmt.Errorf("loading state: %w", err)
+	}
+	defer store.Close()
+
+	runs, err := store.ListRuns()
+	if err != nil {
+		return fmt.Errorf("listing runs: %w", err)
+	}
+	runs = state.FilterRuns(runs, state.Status(c.Status))
+	if err := state.SortRuns(runs, c.Sort); err != nil {
+		return err
+	}
+	if c.Limit > 0 && len(runs) > c.Limit {
+		runs = runs[:c.Limit]
+	}
+	if len(runs) == 0 {
+		fmt.Println("No runs.")
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "RUN\tSTATUS\tSTARTED\tDURATION\tPASSED\tSKIPPED\tREASON")
+	for _, run := range runs {
+		passed := "-"
+		if run.Finished() {
+			passed = fmt.Sprintf("%d/%d", run.Passed, run.Total)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%d\t%s\n",
+			run.ID, run.Status, run.StartTime.Format("2006-01-02 15:04"),
+			run.Duration().Round(time.Second), passed, run.Skipped, run.StopReason)
+	}
+	return tw.Flush()
+}
+
+// ReportCmd implements the 'report' subcommand.
+type ReportCmd struct {
+	RunID   string `arg:"" help:"Run ID to report on."`
+	Format  string `help:"Report format: html, md, or json." default:"html" enum:"html,md,json"`
+	Output  string `help:"Write the report to this file instead of stdout." short:"o"`
+	PRDPath string `help:"Path to prd.json (default: the run's PRD)." name:"prd"`
+}
+
+func (c *ReportCmd) Run(globals *CLI) error {
+	store, err := openStore(globals)
+	if err != nil {
+		return fmt.Errorf("loading state: %w", err)
+	}
+	defer store.Close()
+
+	run, err := store.GetRun(c.RunID)
+	if err != nil {
+		return fmt.Errorf("loading run %s: %w", c.RunID, err)
+	}
+
+	prdPath := cmp.Or(c.PRDPath, run.PRDPath, "prd.json")
+	p, err := prd.LoadPRD(prdPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: loading PRD: %v\n", err)
+		p = nil
+	}
+	entries, err := progress.ParseEntries(filepath.Join(filepath.Dir(prdPath), "progress.txt"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: reading progress log: %v\n", err)
+	}
+	report := web.BuildReport(run, p, entries)
+
+	if c.Output == "" {
+		return writeReport(report, c.Format, os.Stdout)
+	}
+	f, err := os.Create(c.Output)
+	if err != nil {
+		return fmt.Errorf("creating report: %w", err)
+	}
+	if err := writeReport(report, c.Format, f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("writing report: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "Wrote %s\n", c.Output)
+	return nil
+}
+
+// writeReport writes a run report to w in the given format.
+func writeReport(report *web.Report, format string, w io.Writer) error {
+	var err error
+	switch format {
+	case "md":
+		err = report.WriteMarkdown(w)
+	case "json":
+		err = report.WriteJSON(w)
+	default:
+		err = report.WriteHTML(w)
+	}
+	if err != nil {
+		return fmt.Errorf("writing report: %w", err)
+	}
+	return nil
+}
+
+// CompareCmd implements the 'compare' subcommand.
+type CompareCmd struct {
+	A string `arg:"" help:"First run ID."`
+	B string `arg:"" help:"Second run ID."`
+}
+
+func (c *CompareCmd) Run(globals *CLI) error {
+	store, err := openStore(globals)
+	if err != nil {
+		return fmt.Errorf("loading state: %w", err)
+	}
+	defer store.Close()
+
+	a, err := store.GetRun(c.A)
+	if err != nil {
+		return fmt.Errorf("loading run %s: %w", c.A, err)
+	}
+	b, err := store.GetRun(c.B)
+	if err != nil {
+		return fmt.Errorf("loading run %s: %w", c.B, err)
+	}
+	res := web.CompareRuns(a, b)
+
+	fmt.Printf("A: %s (%s, started %s)\n", res.A.RunID, res.A.Status, res.A.StartTime.Format("2006-01-02 15:04"))
+	fmt.Printf("B: %s (%s, started %s)\n\n", res.B.RunID, res.B.Status, res.B.StartTime.Format("2006-01-02 15:04"))
+
+	cells := func(o *web.StoryOutcome) []string {
+		if o == nil {
+			return []string{"-", "-", "-", "-", "-", "-"}
+		}
+		return []string{o.Status, strconv.Itoa(o.Iterations), fmt.Sprintf("$%.2f", o.CostUSD),
+			msDuration(o.DurationMS).String(), fmt.Sprintf("+%d -%d", o.Added, o.Deleted),
+			web.FormatToolCalls(o.ToolCalls)}
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "STORY\tSTATUS A\tSTATUS B\tITERS A\tITERS B\tCOST A\tCOST B\tTIME A\tTIME B\tLINES A\tLINES B\tTOOLS A\tTOOLS B")
+	for _, s := range res.Stories {
+		a, b := cells(s.A), cells(s.B)
+		row := []string{s.ID}
+		for i := range a {
+			row = append(row, a[i], b[i])
+		}
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	fmt.Fprintf(tw, "TOTAL\t%d/%d passed\t%d/%d passed\t%d\t%d\t$%.2f\t$%.2f\t%s\t%s\t+%d -%d\t+%d -%d\t%s\t%s\n",
+		res.A.Passed, res.A.Stories, res.B.Passed, res.B.Stories,
+		res.A.Iterations, res.B.Iterations, res.A.CostUSD, res.B.CostUSD,
+		msDuration(res.A.DurationMS), msDuration(res.B.DurationMS),
+		res.A.Added, res.A.Deleted, res.B.Added, res.B.Deleted,
+		web.FormatToolCalls(res.A.ToolCalls), web.FormatToolCalls(res.B.ToolCalls))
+	return tw.Flush()
+}
+
+// msDuration converts milliseconds to a duration rounded to the second.
+func msDuration(ms int64) time.Duration {
+	return (time.Duration(ms) * time.Millisecond).Round(time.Second)
+}
+
+// BenchCmd implements the 'bench' subcommand.
+type BenchCmd struct {
+	PRDPath       string   `help:"Path to the prd.json to benchmark." default:"prd.json" name:"prd" type:"existingfile"`
+	Matrix        string   `help:"YAML file with models, parallelism, prompts (named sets of prompt overrides) and repeat." type:"existingfile"`
+	Models        []string `help:"Models to compare; overrides the matrix file (default: --model)."`
+	Parallelism   []string `help:"Parallelism modes to compare; overrides the matrix file (default: sequential)."`
+	Repeat        int      `help:"Trials per configuration; overrides the matrix file (default 1)."`
+	Commit        string   `help:"Commit every trial starts from." default:"HEAD"`
+	MaxIterations int      `help:"Maximum iterations per story in each trial." default:"10" name:"max-iterations"`
+	Out           string   `help:"Directory for results.json and trial logs (default: .ralph-wiggo/bench/<time>)."`
+	Keep          bool     `help:"Keep each trial's clone for inspection."`
+}
+
+func (c *BenchCmd) Run(globals *CLI) error {
+	var m bench.Matrix
+	if c.Matrix != "" {
+		var err error
+		if m, err = bench.LoadMatrix(c.Matrix); err != nil {
+			return fmt.Errorf("loading matrix: %w", err)
+		}
+	}
+	if len(c.Models) > 0 {
+		m.Models = c.Models
+	}
+	if len(m.Models) == 0 {
+		m.Models = []string{globals.Model}
+	}
+	if len(c.Parallelism) > 0 {
+		m.Parallelism = c.Parallelism
+	}
+	if len(m.Parallelism) == 0 {
+		m.Parallelism = []string{"sequential"}
+	}
+	if c.Repeat > 0 {
+		m.Repeat = c.Repeat
+	}
+	m.Repeat = max(m.Repeat, 1)
+
+	p, err := prd.LoadPRD(c.PRDPath)
+	if err != nil {
+		return fmt.Errorf("loading PRD: %w", err)
+	}
+	commit, err := git.ResolveCommit(c.Commit)
+	if err != nil {
+		return err
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("locating ralph-wiggo executable: %w", err)
+	}
+	// Trials run in their own clones, so a relative agent path must be made
+	// absolute; a bare name is looked up on PATH as usual.
+	agent := globals.Agent
+	if strings.ContainsRune(agent, filepath.Separator) {
+		if agent, err = filepath.Abs(agent); err != nil {
+			return err
+		}
+	}
+
+	out := c.Out
+	if out == "" {
+		out = filepath.Join(globals.WorkDir, ".ralph-wiggo", "bench", time.Now().Format("20060102-150405"))
+	}
+	if err := os.MkdirAll(out, 0755); err != nil {
+		return fmt.Errorf("creating output directory: %w", err)
+	}
+	resultsPath := filepath.Join(out, "results.json")
+
+	runner := &bench.Runner{
+		Exe:           exe,
+		Agent:         agent,
+		Commit:        commit,
+		PRD:           p,
+		MaxIterations: c.MaxIterations,
+		MaxTurns:      globals.MaxTurns,
+		MaxBudget:     globals.MaxBudget,
+		LogDir:        filepath.Join(out, "logs"),
+		Keep:          c.Keep,
+	}
+	results := &bench.Results{Commit: commit, PRD: c.PRDPath, Agent: agent, Started: time.Now()}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	configs := m.Configs()
+	total := len(configs) * m.Repeat
+	fmt.Printf("Benchmarking %s at %.12s: %d configuration(s) x %d = %d trial(s)\n",
+		p.Project, commit, len(configs), m.Repeat, total)
+
+	// Interleave repeats so that slow drift (API load, caches) affects every
+	// configuration alike.
+	n := 0
+	for rep := 1; rep <= m.Repeat && ctx.Err() == nil; rep++ {
+		for _, cfg := range configs {
+			if ctx.Err() != nil {
+				break
+			}
+			n++
+			fmt.Printf("[%d/%d] %s #%d ... ", n, total, cfg.Label(), rep)
+			res := runner.RunTrial(ctx, cfg, rep)
+			if res.RunID != "" {
+				fmt.Printf("%s, %d/%d passed, $%.2f, %s",
+					res.Status, res.Passed, res.Total, res.CostUSD, msDuration(res.WallTimeMS))
+			}
+			if res.Error != "" {
+				fmt.Printf(" error: %s", res.Error)
+			}
+			fmt.Println()
+
+			results.Trials = append(results.Trials, res)
+			if err := results.Save(resultsPath); err != nil {
+				fmt.Fprintf(os.Stderr, "warning: saving results: %v\n", err)
+			}
+		}
+	}
+
+	results.Finished = time.Now()
+	if err := results.Save(resultsPath); err != nil {
+		return fmt.Errorf("saving results: %w", err)
+	}
+	fmt.Println()
+	if err := bench.WriteTable(os.Stdout, results.Summary); err != nil {
+		return err
+	}
+	fmt.Printf("\nResults: %s\n", resultsPath)
+	if ctx.Err() != nil {
+		return errors.New("bench interrupted")
+	}
+	return nil
+}
+
+// GCCmd implements the 'gc' subcommand.
+type GCCmd struct {
+	PRDPath      string `help:"PRD whose stories' leftover worktree branches are deleted." default:"prd.json" name:"prd"`
+	DryRun       bool   `help:"Print what would be removed without changing anything." name:"dry-run"`
+	KeepRuns     int    `help:"Keep the newest N runs (default 50; -1 disables)." name:"keep-runs"`
+	MaxAgeDays   int    `help:"Keep runs younger than N days (-1 disables)." name:"max-age-days"`
+	CompactAfter int    `help:"Compact the events of all but the newest N kept runs (default 10; -1 disables)." name:"compact-after"`
+}
+
+func (c *GCCmd) Run(globals *CLI) error {
+	// Hold the run lock so a run cannot start while its worktrees and history
+	// are being cleaned up.
+	if !c.DryRun {
+		lock, err := fsutil.Acquire(runLockPath(globals))
+		if err != nil {
+			if errors.Is(err, fsutil.ErrLocked) {
+				return fmt.Errorf("a ralph-wiggo run is active in %s; stop it before running gc: %w", globals.WorkDir, err)
+			}
+			return fmt.Errorf("acquiring run lock: %w", err)
+		}
+		defer lock.Release()
+	}
+
+	act := func(did, would string) string {
+		if c.DryRun {
+			return "Would " + would
+		}
+		return did
+	}
+
+	store, err := openStore(globals)
+	if err != nil {
+		return fmt.Errorf("loading state: %w", err)
+	}
+	defer store.Close()
+
+	report, err := state.ApplyRetention(store, c.policy(globals.fileConfig.Retention), time.Now(), c.DryRun)
+	if err != nil {
+		return fmt.Errorf("applying retention: %w", err)
+	}
+	for _, id := range report.Pruned {
+		fmt.Printf("%s run %s\n", act("Pruned", "prune"), id)
+	}
+	for _, id := range report.Compacted {
+		fmt.Printf("%s run %s\n", act("Compacted", "compact"), id)
+	}
+	if report.EventsDropped > 0 {
+		fmt.Printf("%s %d events from compacted iterations\n", act("Dropped", "drop"), report.EventsDropped)
+	}
+
+	// Parallel runs name worktree branches after story IDs. Without a PRD,
+	// only the branches of the removed worktrees are deleted.
+	var storyIDs []string
+	p, err := prd.LoadPRD(c.PRDPath)
+	switch {
+	case err == nil:
+		for _, story := range p.UserStories {
+			storyIDs = append(storyIDs, story.ID)
+		}
+	case !errors.Is(err, fs.ErrNotExist):
+		return fmt.Errorf("loading PRD: %w", err)
+	}
+
+	worktrees, branches, err := cleanStaleWorktrees(globals, storyIDs, c.DryRun)
+	for _, wt := range worktrees {
+		fmt.Printf("%s worktree %s\n", act("Removed", "remove"), wt)
+	}
+	for _, b := range branches {
+		fmt.Printf("%s branch %s\n", act("Deleted", "delete"), b)
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(report.Pruned)+len(report.Compacted)+len(worktrees)+len(branches) == 0 {
+		fmt.Println("Nothing to clean up.")
+	}
+	return nil
+}
+
+// policy resolves the retention policy: flags override the config file, which
+// overrides the defaults. Negative limits disable a rule.
+func (c *GCCmd) policy(cfg config.Retention) state.RetentionPolicy {
+	pick := func(flag, file, def int) int {
+		v := def
+		if file != 0 {
+			v = file
+		}
+		if flag != 0 {
+			v = flag
+		}
+		return max(v, 0)
+	}
+	def := state.DefaultRetention
+	return state.RetentionPolicy{
+		KeepRuns:     pick(c.KeepRuns, cfg.KeepRuns, def.KeepRuns),
+		MaxAge:       time.Duration(pick(c.MaxAgeDays, cfg.MaxAgeDays, int(def.MaxAge/(24*time.Hour)))) * 24 * time.Hour,
+		CompactAfter: pick(c.CompactAfter, cfg.CompactAfter, def.CompactAfter),
+	}
+}
+
+// cleanStaleWorktrees removes the worktrees under .ralph-wiggo/worktrees and
+// the branches that parallel runs normally clean up on exit but leave behind
+// when they crash: those of the removed worktrees and the worktree-<id>
+// branches of storyIDs. Other branches, including worktree-* ones the user
+// created, are left alone. The caller must ensure no run is active. It
+// returns the worktrees and branches removed (or, in a dry run, that would
+// be).
+func cleanStaleWorktrees(globals *CLI, storyIDs []string, dryRun bool) (worktrees, branches []string, err error) {
+	base, err := filepath.Abs(filepath.Join(globals.WorkDir, ".ralph-wiggo", "worktrees"))
+	if err != nil {
+		return nil, nil, err
+	}
+	if resolved, err := filepath.EvalSymlinks(base); err == nil {
+		base = resolved
+	}
+	under := func(path string) bool {
+		if resolved, err := filepath.EvalSymlinks(path); err == nil {
+			path = resolved
+		}
+		rel, err := filepath.Rel(base, path)
+		return err == nil && rel != "." && !strings.HasPrefix(rel, "..")
+	}
+
+	wts, err := git.WorktreeList()
+	if err != nil {
+		return nil, nil, err
+	}
+	stale := make(map[string]bool) // branches left behind by parallel runs
+	for _, id := range storyIDs {
+		stale["worktree-"+id] = true
+	}
+	inUse := make(map[string]bool) // branches checked out in worktrees that stay
+	for _, wt := range wts {
+		if !under(wt.Path) {
+			inUse[wt.Branch] = true
+			continue
+		}
+		if !dryRun {
+			if err := git.WorktreeRemove(wt.Path); err != nil {
+				return worktrees, branches, err
+			}
+		}
+		worktrees = append(worktrees, wt.Path)
+		if wt.Branch != "" {
+			stale[wt.Branch] = true
+		}
+	}
+
+	// Directories git no longer knows about, e.g. after a manual prune.
+	entries, _ := os.ReadDir(base)
+	for _, e := range entries {
+		path := filepath.Join(base, e.Name())
+		if slices.Contains(worktrees, path) {
+			continue
+		}
+		if !dryRun {
+			if err := os.RemoveAll(path); err != nil {
+				return worktrees, branches, fmt.Errorf("removing %s: %w", path, err)
+			}
+		}
+		worktrees = append(worktrees, path)
+		stale["worktree-"+e.Name()] = true // worktrees are named after their story
+	}
+	if !dryRun {
+		_ = os.Remove(base)
+		if err := git.WorktreePrune(); err != nil {
+			return worktrees, branches, err
+		}
+	}
+
+	names, err := git.ListBranches("worktree-*")
+	if err != nil {
+		return worktrees, branches, err
+	}
+	for _, name := range names {
+		if !stale[name] || inUse[name] {
+			continue
+		}
+		if !dryRun {
+			if err := git.DeleteBranch(name); err != nil {
+				return worktrees, branches, err
+			}
+		}
+		branches = append(branches, name)
+	}
+	return worktrees, branches, nil
+}
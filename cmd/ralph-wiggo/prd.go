@@ -0,0 +1,180 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"slices"
+
+	"github.com/radvoogh/ralph-wiggo/internal/claude"
+	"github.com/radvoogh/ralph-wiggo/internal/lint"
+	"github.com/radvoogh/ralph-wiggo/internal/prd"
+)
+
+// PRDCmd groups the 'prd' subcommands. Generation is the default, so
+// 'prd <description>' keeps working.
+type PRDCmd struct {
+	Generate PRDGenerateCmd `cmd:"" default:"withargs" help:"Generate a PRD interactively with Claude."`
+	Migrate  PRDMigrateCmd  `cmd:"" help:"Upgrade a PRD file to the current schema version."`
+	Validate PRDValidateCmd `cmd:"" help:"Check a PRD file against the schema and report every problem."`
+	Lint     PRDLintCmd     `cmd:"" help:"Check stories for vague criteria, missing checks and oversized scope."`
+}
+
+// PRDMigrateCmd implements the 'prd migrate' subcommand.
+type PRDMigrateCmd struct {
+	PRDPath string `help:"Path to the PRD file (.json, .yaml or .md)." default:"prd.json" name:"prd"`
+	DryRun  bool   `help:"Show the migrations that would be applied without writing the file."`
+}
+
+func (c *PRDMigrateCmd) Run(globals *CLI) error {
+	lock, err := lockForEdit(globals)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	data, err := os.ReadFile(c.PRDPath)
+	if err != nil {
+		return fmt.Errorf("reading PRD file: %w", err)
+	}
+	f := prd.FormatOf(c.PRDPath)
+	p, applied, err := prd.Upgrade(data, f)
+	if err != nil {
+		return err
+	}
+	if len(applied) == 0 {
+		fmt.Printf("%s is already at schema version %d.\n", c.PRDPath, prd.SchemaVersion)
+		return nil
+	}
+
+	fmt.Printf("Migrations for %s:\n", c.PRDPath)
+	for _, m := range applied {
+		fmt.Printf("  - %s\n", m)
+	}
+	// Fields the schema does not have do not survive the rewrite.
+	problems, err := prd.Check(data, f)
+	if err != nil {
+		return err
+	}
+	for _, pr := range problems {
+		if pr.Message == prd.UnknownField {
+			fmt.Fprintf(os.Stderr, "warning: %s: unknown field will be dropped\n", pr.Path)
+		}
+	}
+
+	if c.DryRun {
+		fmt.Println("Dry run: file not written.")
+		return nil
+	}
+	if _, err := prd.SavePRDIfUnchanged(c.PRDPath, p, prd.Version(data)); err != nil {
+		return fmt.Errorf("saving PRD: %w", err)
+	}
+	fmt.Printf("Upgraded %s to schema version %d.\n", c.PRDPath, prd.SchemaVersion)
+	return nil
+}
+
+// PRDValidateCmd implements the 'prd validate' subcommand.
+type PRDValidateCmd struct {
+	PRDPath string `help:"Path to the PRD file (.json, .yaml or .md)." default:"prd.json" name:"prd"`
+}
+
+func (c *PRDValidateCmd) Run(globals *CLI) error {
+	data, err := os.ReadFile(c.PRDPath)
+	if err != nil {
+		return fmt.Errorf("reading PRD file: %w", err)
+	}
+	problems, err := prd.Check(data, prd.FormatOf(c.PRDPath))
+	if err != nil {
+		return err
+	}
+	if len(problems) == 0 {
+		fmt.Printf("%s is valid.\n", c.PRDPath)
+		return nil
+	}
+	for _, pr := range problems {
+		fmt.Println(pr)
+	}
+	if len(problems) == 1 {
+		return errors.New("found 1 problem")
+	}
+	return fmt.Errorf("found %d problems", len(problems))
+}
+
+// PRDLintCmd implements the 'prd lint' subcommand.
+type PRDLintCmd struct {
+	PRDPath string `help:"Path to the PRD file (.json, .yaml or .md)." default:"prd.json" name:"prd"`
+	Review  bool   `help:"Also ask Claude to score each story's size and testability."`
+}
+
+func (c *PRDLintCmd) Run(globals *CLI) error {
+	p, err := prd.LoadPRD(c.PRDPath)
+	if err != nil {
+		return err
+	}
+	findings := lint.Lint(p, lint.Options{})
+
+	if c.Review {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+
+		fmt.Printf("Reviewing %d stories...\n", len(p.UserStories))
+		cfg := claude.RunConfig{
+			Model:        globals.Model,
+			MaxBudgetUSD: globals.MaxBudget,
+			WorkDir:      globals.WorkDir,
+		}
+		scores, err := lint.Review(ctx, newExecutor(globals), cfg, p)
+		if err != nil {
+			return fmt.Errorf("reviewing stories: %w", err)
+		}
+		fmt.Printf("\n%-12s %4s  %s\n", "STORY", "SIZE", "TESTABILITY")
+		for _, s := range scores {
+			fmt.Printf("%-12s %4d  %d\n", s.StoryID, s.Size, s.Testability)
+			if s.Flagged() {
+				findings = append(findings, s.Finding())
+			}
+		}
+		fmt.Println()
+		// Keep each story's findings together.
+		order := make(map[string]int, len(p.UserStories))
+		for i, s := range p.UserStories {
+			order[s.ID] = i
+		}
+		slices.SortStableFunc(findings, func(a, b lint.Finding) int {
+			return cmp.Compare(order[a.StoryID], order[b.StoryID])
+		})
+	}
+
+	if len(findings) == 0 {
+		fmt.Printf("%s: no findings.\n", c.PRDPath)
+		return nil
+	}
+	printFindings(findings)
+	if len(findings) == 1 {
+		return errors.New("found 1 lint finding")
+	}
+	return fmt.Errorf("found %d lint findings", len(findings))
+}
+
+// lintConverted shows the lint findings for a freshly converted PRD, so
+// stories can be fixed before the agent loop works on them, and returns them.
+func lintConverted(p *prd.PRD) []lint.Finding {
+	findings := lint.Lint(p, lint.Options{})
+	if len(findings) == 0 {
+		return nil
+	}
+	fmt.Printf("\nLint found %d issue(s) to consider before running:\n", len(findings))
+	printFindings(findings)
+	fmt.Println("Edit the stories with 'ralph-wiggo story edit', or run 'ralph-wiggo prd lint --review' for a closer look.")
+	return findings
+}
+
+// printFindings prints lint findings one per line.
+func printFindings(findings []lint.Finding) {
+	for _, f := range findings {
+		fmt.Printf("  %s\n", f)
+	}
+}
@@ -0,0 +1,410 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/radvoogh/ralph-wiggo/internal/fsutil"
+	"github.com/radvoogh/ralph-wiggo/internal/prd"
+	"github.com/radvoogh/ralph-wiggo/internal/state"
+)
+
+// StoryCmd groups the 'story' subcommands, which read and edit the PRD's
+// stories. Edits are validated before they are written and refused while a
+// run holds the run lock.
+type StoryCmd struct {
+	PRDPath string `help:"Path to the PRD file (.json, .yaml or .md)." default:"prd.json" name:"prd"`
+
+	List     StoryListCmd     `cmd:"" help:"List stories with their status and recorded iterations, grouped by tag."`
+	Add      StoryAddCmd      `cmd:"" help:"Add a story."`
+	Edit     StoryEditCmd     `cmd:"" help:"Edit a story in $EDITOR."`
+	Move     StoryMoveCmd     `cmd:"" help:"Move a story to another priority, renumbering the others."`
+	Reset    StoryResetCmd    `cmd:"" help:"Mark a story as not passing."`
+	Remove   StoryRemoveCmd   `cmd:"" help:"Remove a story."`
+	Renumber StoryRenumberCmd `cmd:"" help:"Renumber priorities 1..N, keeping the current order."`
+}
+
+// lockForEdit takes the run lock, so the PRD is not edited under a running
+// agent loop and no run starts mid-edit.
+func lockForEdit(globals *CLI) (*fsutil.Lock, error) {
+	lock, err := fsutil.Acquire(runLockPath(globals))
+	if err != nil {
+		if errors.Is(err, fsutil.ErrLocked) {
+			return nil, fmt.Errorf("a ralph-wiggo run is active in %s; stop it before editing the PRD: %w", globals.WorkDir, err)
+		}
+		return nil, fmt.Errorf("acquiring run lock: %w", err)
+	}
+	return lock, nil
+}
+
+// update applies fn to the PRD under the run lock and writes the result if it
+// passes prd.Validate.
+func (c *StoryCmd) update(globals *CLI, fn func(*prd.PRD) error) (*prd.PRD, error) {
+	lock, err := lockForEdit(globals)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Release()
+
+	return prd.UpdatePRD(c.PRDPath, func(p *prd.PRD) error {
+		if err := fn(p); err != nil {
+			return err
+		}
+		if err := prd.Validate(p); err != nil {
+			return fmt.Errorf("not saving invalid PRD: %w", err)
+		}
+		return nil
+	})
+}
+
+// StoryListCmd implements 'story list'.
+type StoryListCmd struct{}
+
+func (c *StoryListCmd) Run(globals *CLI, parent *StoryCmd) error {
+	p, err := prd.LoadPRD(parent.PRDPath)
+	if err != nil {
+		return fmt.Errorf("loading PRD: %w", err)
+	}
+	if len(p.UserStories) == 0 {
+		fmt.Println("No stories.")
+		return nil
+	}
+
+	var history map[string]*storyHistory
+	if store, err := openStore(globals); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: state store: %v\n", err)
+	} else {
+		runs, err := store.ListRuns()
+		store.Close()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "warning: listing runs: %v\n", err)
+		}
+		history = storyHistories(runs, p.BranchName)
+	}
+
+	stories := slices.Clone(p.UserStories)
+	slices.SortStableFunc(stories, func(a, b prd.UserStory) int {
+		return cmp.Compare(a.Priority, b.Priority)
+	})
+
+	tags := prd.Tags(p)
+	if len(tags) == 0 {
+		return printStoryTable(stories, history)
+	}
+
+	// One table per tag; a story with several tags is listed under each.
+	groups := make([]storyGroup, 0, len(tags)+1)
+	for _, tag := range tags {
+		g := storyGroup{name: tag}
+		for _, s := range stories {
+			if s.HasTag(tag) {
+				g.stories = append(g.stories, s)
+			}
+		}
+		groups = append(groups, g)
+	}
+	untagged := storyGroup{name: "untagged"}
+	for _, s := range stories {
+		if len(s.Tags) == 0 {
+			untagged.stories = append(untagged.stories, s)
+		}
+	}
+	if len(untagged.stories) > 0 {
+		groups = append(groups, untagged)
+	}
+
+	for i, g := range groups {
+		if i > 0 {
+			fmt.Println()
+		}
+		passed := 0
+		for _, s := range g.stories {
+			if s.Passes {
+				passed++
+			}
+		}
+		fmt.Printf("%s (%d/%d passed)\n", g.name, passed, len(g.stories))
+		if err := printStoryTable(g.stories, history); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// storyGroup is a titled set of stories in 'story list' output.
+type storyGroup struct {
+	name    string
+	stories []prd.UserStory
+}
+
+// printStoryTable prints stories as a table with their recorded history.
+func printStoryTable(stories []prd.UserStory, history map[string]*storyHistory) error {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PRI\tID\tSTATUS\tLAST RUN\tITERATIONS\tTITLE")
+	for _, s := range stories {
+		status := "pending"
+		if s.Passes {
+			status = "passed"
+		}
+		last, iterations := "-", 0
+		if h := history[s.ID]; h != nil {
+			last, iterations = string(h.last), h.iterations
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%d\t%s\n", s.Priority, s.ID, status, last, iterations, s.Title)
+	}
+	return tw.Flush()
+}
+
+// storyHistory summarizes a story's sessions across recorded runs.
+type storyHistory struct {
+	last       state.Status // status in the newest run that worked on the story
+	iterations int          // across all runs
+}
+
+// storyHistories summarizes the sessions of runs on the given branch, which
+// identifies runs of this PRD. runs must be sorted newest first, as ListRuns
+// returns them.
+func storyHistories(runs []*state.Run, branch string) map[string]*storyHistory {
+	history := make(map[string]*storyHistory)
+	for _, run := range runs {
+		if branch != "" && run.BranchName != branch {
+			continue
+		}
+		for _, sess := range run.Stories {
+			h := history[sess.StoryID]
+			if h == nil {
+				h = &storyHistory{last: sess.Status}
+				history[sess.StoryID] = h
+			}
+			h.iterations += len(sess.Iterations)
+		}
+	}
+	return history
+}
+
+// StoryAddCmd implements 'story add'.
+type StoryAddCmd struct {
+	Title       string   `arg:"" help:"Story title."`
+	ID          string   `help:"Story ID (default: the next free ID, e.g. US-007)." name:"id"`
+	Description string   `help:"Story description." short:"d"`
+	Criteria    []string `help:"Acceptance criterion; repeat for several." name:"criterion" short:"c" sep:"none"`
+	Notes       string   `help:"Implementation notes."`
+	Tags        []string `help:"Tags, comma-separated or repeated." name:"tag"`
+	Priority    int      `help:"Priority to insert at, shifting later stories down (default: last)."`
+}
+
+func (c *StoryAddCmd) Run(globals *CLI, parent *StoryCmd) error {
+	story := prd.UserStory{
+		ID:                 c.ID,
+		Title:              c.Title,
+		Description:        c.Description,
+		AcceptanceCriteria: c.Criteria,
+		Priority:           c.Priority,
+		Notes:              c.Notes,
+		Tags:               c.Tags,
+	}
+	if story.AcceptanceCriteria == nil {
+		story.AcceptanceCriteria = []string{}
+	}
+
+	p, err := parent.update(globals, func(p *prd.PRD) error {
+		if c.ID == "" {
+			story.ID = prd.NextStoryID(p)
+		}
+		return prd.AddStory(p, story)
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Added %s at priority %d\n", story.ID, prd.FindStory(p, story.ID).Priority)
+	return nil
+}
+
+// StoryEditCmd implements 'story edit'.
+type StoryEditCmd struct {
+	ID string `arg:"" help:"ID of the story to edit."`
+}
+
+func (c *StoryEditCmd) Run(globals *CLI, parent *StoryCmd) error {
+	lock, err := lockForEdit(globals)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	p, version, err := prd.LoadPRDVersion(parent.PRDPath)
+	if err != nil {
+		return fmt.Errorf("loading PRD: %w", err)
+	}
+	story := prd.FindStory(p, c.ID)
+	if story == nil {
+		return fmt.Errorf("story %s not found", c.ID)
+	}
+
+	// The story is edited in the PRD's own format.
+	format := prd.FormatOf(parent.PRDPath)
+	original, err := prd.MarshalStory(story, format)
+	if err != nil {
+		return err
+	}
+	path, err := writeTempStory(original, cmp.Or(filepath.Ext(parent.PRDPath), ".json"))
+	if err != nil {
+		return err
+	}
+	if err := editFile(path); err != nil {
+		os.Remove(path)
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading edited story: %w", err)
+	}
+	if bytes.Equal(data, original) {
+		os.Remove(path)
+		fmt.Println("No changes.")
+		return nil
+	}
+
+	// From here on, failures keep the edited file so the edit is not lost.
+	if err := applyStoryEdit(p, story, data, format); err != nil {
+		return fmt.Errorf("%w (your edit is saved in %s)", err, path)
+	}
+	if _, err := prd.SavePRDIfUnchanged(parent.PRDPath, p, version); err != nil {
+		if errors.Is(err, prd.ErrConflict) {
+			return fmt.Errorf("%s changed while you were editing; not saved (your edit is saved in %s)", parent.PRDPath, path)
+		}
+		return err
+	}
+	os.Remove(path)
+	fmt.Printf("Updated %s\n", c.ID)
+	return nil
+}
+
+// applyStoryEdit replaces story, which belongs to p, with the edited data and
+// validates the result. A changed priority moves the story there.
+func applyStoryEdit(p *prd.PRD, story *prd.UserStory, data []byte, format prd.Format) error {
+	edited, err := prd.UnmarshalStory(data, format)
+	if err != nil {
+		return err
+	}
+	priority := story.Priority
+	*story = *edited
+	story.Priority = priority
+	if edited.Priority != priority {
+		if err := prd.MoveStory(p, edited.ID, edited.Priority); err != nil {
+			return err
+		}
+	}
+	if err := prd.Validate(p); err != nil {
+		return fmt.Errorf("edited PRD is invalid: %w", err)
+	}
+	return nil
+}
+
+// writeTempStory writes data to a new temporary file with the given extension
+// and returns its path.
+func writeTempStory(data []byte, ext string) (string, error) {
+	f, err := os.CreateTemp("", "ralph-story-*"+ext)
+	if err != nil {
+		return "", fmt.Errorf("creating temporary file: %w", err)
+	}
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("writing temporary file: %w", err)
+	}
+	return f.Name(), nil
+}
+
+// editFile opens path in the user's editor: $VISUAL, then $EDITOR, then vi.
+// The variable may include arguments, e.g. "code --wait".
+func editFile(path string) error {
+	editor := cmp.Or(os.Getenv("VISUAL"), os.Getenv("EDITOR"), "vi")
+	args := strings.Fields(editor)
+	cmd := exec.Command(args[0], append(args[1:], path)...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("running editor %q: %w", editor, err)
+	}
+	return nil
+}
+
+// StoryMoveCmd implements 'story move'.
+type StoryMoveCmd struct {
+	ID string `arg:"" help:"ID of the story to move."`
+	To int    `help:"New priority (1 = highest)." required:""`
+}
+
+func (c *StoryMoveCmd) Run(globals *CLI, parent *StoryCmd) error {
+	p, err := parent.update(globals, func(p *prd.PRD) error {
+		return prd.MoveStory(p, c.ID, c.To)
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Moved %s to priority %d\n", c.ID, prd.FindStory(p, c.ID).Priority)
+	return nil
+}
+
+// StoryResetCmd implements 'story reset'.
+type StoryResetCmd struct {
+	ID string `arg:"" help:"ID of the story to reset."`
+}
+
+func (c *StoryResetCmd) Run(globals *CLI, parent *StoryCmd) error {
+	_, err := parent.update(globals, func(p *prd.PRD) error {
+		story := prd.FindStory(p, c.ID)
+		if story == nil {
+			return fmt.Errorf("story %s not found", c.ID)
+		}
+		story.Passes = false
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Reset %s\n", c.ID)
+	return nil
+}
+
+// StoryRemoveCmd implements 'story remove'.
+type StoryRemoveCmd struct {
+	ID string `arg:"" help:"ID of the story to remove."`
+}
+
+func (c *StoryRemoveCmd) Run(globals *CLI, parent *StoryCmd) error {
+	_, err := parent.update(globals, func(p *prd.PRD) error {
+		return prd.RemoveStory(p, c.ID)
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Removed %s\n", c.ID)
+	return nil
+}
+
+// StoryRenumberCmd implements 'story renumber'.
+type StoryRenumberCmd struct{}
+
+func (c *StoryRenumberCmd) Run(globals *CLI, parent *StoryCmd) error {
+	p, err := parent.update(globals, func(p *prd.PRD) error {
+		prd.Renumber(p)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Renumbered %d stories\n", len(p.UserStories))
+	return nil
+}
@@ -0,0 +1,343 @@
+// Package bench runs a PRD repeatedly under different agent configurations,
+// each in a fresh clone of a pinned commit, and compares how they fared.
+package bench
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/radvoogh/ralph-wiggo/internal/claude"
+	"github.com/radvoogh/ralph-wiggo/internal/config"
+	"github.com/radvoogh/ralph-wiggo/internal/fsutil"
+	"github.com/radvoogh/ralph-wiggo/internal/git"
+	"github.com/radvoogh/ralph-wiggo/internal/prd"
+	"github.com/radvoogh/ralph-wiggo/internal/state"
+)
+
+// DefaultPromptSet labels the configuration that uses the embedded prompts.
+const DefaultPromptSet = "default"
+
+// Matrix lists the settings to benchmark. Every combination of model, prompt
+// set and parallelism mode is one configuration.
+type Matrix struct {
+	Models      []string `yaml:"models"`
+	Parallelism []string `yaml:"parallelism"`
+	// Prompts maps a label to a set of prompt overrides (prompt name to file
+	// path). An empty set runs with the embedded prompts.
+	Prompts map[string]map[string]string `yaml:"prompts"`
+	Repeat  int                          `yaml:"repeat"`
+}
+
+// LoadMatrix reads a matrix file. Prompt override paths are made absolute,
+// relative to the file, since trials run in other directories.
+func LoadMatrix(path string) (Matrix, error) {
+	var m Matrix
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return m, err
+	}
+	if err := yaml.Unmarshal(data, &m); err != nil {
+		return m, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	dir, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return m, err
+	}
+	for _, set := range m.Prompts {
+		for name, p := range set {
+			if !filepath.IsAbs(p) {
+				set[name] = filepath.Join(dir, p)
+			}
+		}
+	}
+	return m, nil
+}
+
+// Config is one combination of benchmarked settings.
+type Config struct {
+	Model       string            `json:"model"`
+	PromptSet   string            `json:"promptSet"`
+	Overrides   map[string]string `json:"overrides,omitempty"` // prompt name to file path
+	Parallelism string            `json:"parallelism"`
+}
+
+// Label identifies the configuration in tables and file names.
+func (c Config) Label() string {
+	return c.Model + "/" + c.PromptSet + "/" + c.Parallelism
+}
+
+// Configs expands the matrix into configurations, models varying slowest.
+// A matrix without prompt sets benchmarks the embedded prompts only.
+func (m Matrix) Configs() []Config {
+	prompts := m.Prompts
+	if len(prompts) == 0 {
+		prompts = map[string]map[string]string{DefaultPromptSet: nil}
+	}
+	labels := slices.Sorted(maps.Keys(prompts))
+
+	var configs []Config
+	for _, model := range m.Models {
+		for _, label := range labels {
+			for _, par := range m.Parallelism {
+				configs = append(configs, Config{Model: model, PromptSet: label, Overrides: prompts[label], Parallelism: par})
+			}
+		}
+	}
+	return configs
+}
+
+// Runner runs benchmark trials. Each trial clones the repository in the
+// current directory at Commit and runs `ralph-wiggo run` there.
+type Runner struct {
+	Exe           string   // ralph-wiggo executable
+	Agent         string   // agent executable passed to each run; empty for claude
+	Commit        string   // commit every trial starts from
+	PRD           *prd.PRD // written to prd.json in each clone
+	MaxIterations int      // per-story iteration limit; 0 keeps the run default
+	MaxTurns      int      // 0 keeps the run default
+	MaxBudget     float64  // per agent session; 0 for none
+	TempDir       string   // parent of the clones; empty for the system default
+	LogDir        string   // where each trial's output is written
+	Keep          bool     // keep clones after the trial
+}
+
+// interruptGrace is how long a trial may take to record its run after being
+// interrupted.
+const interruptGrace = 30 * time.Second
+
+// RunTrial runs one trial of cfg and collects its results. Failures are
+// reported in the result's Error rather than returned, so a benchmark keeps
+// going past a broken configuration.
+func (r *Runner) RunTrial(ctx context.Context, cfg Config, repeat int) TrialResult {
+	res := TrialResult{Config: cfg, Repeat: repeat}
+	name := fmt.Sprintf("%s-%d", strings.NewReplacer("/", "_", ":", "_").Replace(cfg.Label()), repeat)
+
+	dir, err := os.MkdirTemp(r.TempDir, "ralph-bench-")
+	if err != nil {
+		res.Error = fmt.Sprintf("creating clone directory: %v", err)
+		return res
+	}
+	if r.Keep {
+		res.Dir = dir
+	} else {
+		defer os.RemoveAll(dir)
+	}
+	// git clone wants a missing or empty target.
+	clone := filepath.Join(dir, "repo")
+	if err := r.prepare(clone); err != nil {
+		res.Error = err.Error()
+		return res
+	}
+
+	if err := os.MkdirAll(r.LogDir, 0755); err != nil {
+		res.Error = fmt.Sprintf("creating log directory: %v", err)
+		return res
+	}
+	res.Log = filepath.Join(r.LogDir, name+".log")
+	logFile, err := os.Create(res.Log)
+	if err != nil {
+		res.Error = fmt.Sprintf("creating log: %v", err)
+		return res
+	}
+	defer logFile.Close()
+
+	cmd := exec.CommandContext(ctx, r.Exe, r.args(cfg)...)
+	cmd.Dir = clone
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	// Interrupt rather than kill, so the run records how it ended.
+	cmd.Cancel = func() error { return cmd.Process.Signal(os.Interrupt) }
+	cmd.WaitDelay = interruptGrace
+
+	start := time.Now()
+	runErr := cmd.Run()
+	res.WallTimeMS = time.Since(start).Milliseconds()
+
+	run, err := latestRun(clone)
+	if err != nil {
+		res.Error = fmt.Sprintf("reading run state: %v", errors.Join(runErr, err))
+		return res
+	}
+	res.record(run, len(r.PRD.UserStories))
+	if runErr != nil && run.Status != state.StatusInterrupted {
+		res.Error = runErr.Error()
+	}
+	return res
+}
+
+// prepare clones the pinned commit into dir and writes the PRD there.
+func (r *Runner) prepare(dir string) error {
+	if err := git.CloneAt(dir, r.Commit); err != nil {
+		return err
+	}
+	if err := isolateConfig(dir); err != nil {
+		return err
+	}
+	return prd.SavePRD(filepath.Join(dir, "prd.json"), r.PRD)
+}
+
+// isolateConfig clears the settings the benchmark varies from the clone's
+// config file; otherwise the file would override the matrix's defaults.
+func isolateConfig(dir string) error {
+	path := filepath.Join(dir, config.DefaultConfigFile)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil
+	}
+	cfg, err := config.Load(dir)
+	if err != nil {
+		return fmt.Errorf("loading %s: %w", config.DefaultConfigFile, err)
+	}
+	cfg.Model, cfg.Agent, cfg.Parallelism = "", "", ""
+	data, err := yaml.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// args builds the command line of a trial's run.
+func (r *Runner) args(cfg Config) []string {
+	var args []string
+	if r.Agent != "" {
+		args = append(args, "--agent", r.Agent)
+	}
+	if cfg.Model != "" {
+		args = append(args, "--model", cfg.Model)
+	}
+	if r.MaxTurns > 0 {
+		args = append(args, "--max-turns", strconv.Itoa(r.MaxTurns))
+	}
+	if r.MaxBudget > 0 {
+		args = append(args, "--max-budget", strconv.FormatFloat(r.MaxBudget, 'f', -1, 64))
+	}
+	for _, name := range slices.Sorted(maps.Keys(cfg.Overrides)) {
+		args = append(args, "--prompt-override", name+"="+cfg.Overrides[name])
+	}
+	args = append(args, "run", "--prd", "prd.json")
+	if cfg.Parallelism != "" {
+		args = append(args, "--parallelism", cfg.Parallelism)
+	}
+	if r.MaxIterations > 0 {
+		args = append(args, "--max-iterations", strconv.Itoa(r.MaxIterations))
+	}
+	return args
+}
+
+// latestRun loads the most recent run recorded in a clone.
+func latestRun(dir string) (*state.Run, error) {
+	cfg, err := config.Load(dir)
+	if err != nil {
+		return nil, err
+	}
+	store, err := state.Open(cfg.StateBackend, filepath.Join(dir, ".ralph-wiggo"))
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+
+	runs, err := store.ListRuns()
+	if err != nil {
+		return nil, err
+	}
+	if len(runs) == 0 {
+		return nil, errors.New("no run was recorded")
+	}
+	latest := slices.MaxFunc(runs, func(a, b *state.Run) int {
+		return a.StartTime.Compare(b.StartTime)
+	})
+	// ListRuns may omit events, which hold the costs.
+	return store.GetRun(latest.ID)
+}
+
+// TrialResult is the outcome of one trial.
+type TrialResult struct {
+	Config
+	Repeat     int    `json:"repeat"`
+	RunID      string `json:"runId,omitempty"`
+	Status     string `json:"status,omitempty"`
+	Passed     int    `json:"passed"`
+	Total      int    `json:"total"`
+	Iterations int    `json:"iterations"`
+	// IterationsToPass is the mean number of iterations the passing stories
+	// took; zero if none passed.
+	IterationsToPass float64 `json:"iterationsToPass,omitempty"`
+	CostUSD          float64 `json:"costUsd"`
+	WallTimeMS       int64   `json:"wallTimeMs"`
+	Error            string  `json:"error,omitempty"`
+	Log              string  `json:"log,omitempty"`
+	Dir              string  `json:"dir,omitempty"` // kept clone
+}
+
+// PassRate is the fraction of the PRD's stories passing after the trial.
+func (t TrialResult) PassRate() float64 {
+	if t.Total == 0 {
+		return 0
+	}
+	return float64(t.Passed) / float64(t.Total)
+}
+
+// record fills the result from the trial's run. total is the number of
+// stories in the PRD, used if the run ended without recording it.
+func (t *TrialResult) record(run *state.Run, total int) {
+	t.RunID = run.ID
+	t.Status = string(run.Status)
+	t.Total = total
+	if run.Finished() {
+		t.Passed, t.Total = run.Passed, run.Total
+	}
+
+	passed, toPass := 0, 0
+	for _, sess := range run.Stories {
+		t.Iterations += len(sess.Iterations)
+		if sess.Status == state.StatusPassed {
+			passed++
+			toPass += len(sess.Iterations)
+		}
+		for _, iter := range sess.Iterations {
+			for _, evt := range iter.Events {
+				if evt.Type == claude.EventResult {
+					t.CostUSD += evt.CostUSD
+				}
+			}
+		}
+	}
+	if !run.Finished() {
+		t.Passed = passed
+	}
+	if passed > 0 {
+		t.IterationsToPass = float64(toPass) / float64(passed)
+	}
+}
+
+// Results is the record of a benchmark, saved as it progresses.
+type Results struct {
+	Commit   string        `json:"commit"`
+	PRD      string        `json:"prd"`
+	Agent    string        `json:"agent,omitempty"`
+	Started  time.Time     `json:"started"`
+	Finished time.Time     `json:"finished,omitzero"`
+	Trials   []TrialResult `json:"trials"`
+	Summary  []Summary     `json:"summary"`
+}
+
+// Save summarizes the trials so far and writes the results as JSON.
+func (r *Results) Save(path string) error {
+	r.Summary = Summarize(r.Trials)
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return fsutil.WriteFileAtomic(path, data, 0644)
+}
@@ -0,0 +1,215 @@
+package bench
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/radvoogh/ralph-wiggo/internal/claude"
+	"github.com/radvoogh/ralph-wiggo/internal/prd"
+	"github.com/radvoogh/ralph-wiggo/internal/state"
+)
+
+func TestLoadMatrixAndConfigs(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "bench.yaml")
+	content := `models: [opus, sonnet]
+parallelism: [sequential, parallel-2]
+prompts:
+  terse:
+    prompt.md: prompts/terse.md
+  baseline: {}
+repeat: 3
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := LoadMatrix(path)
+	if err != nil {
+		t.Fatalf("LoadMatrix: %v", err)
+	}
+	if m.Repeat != 3 {
+		t.Errorf("Repeat = %d, want 3", m.Repeat)
+	}
+	if got, want := m.Prompts["terse"]["prompt.md"], filepath.Join(dir, "prompts", "terse.md"); got != want {
+		t.Errorf("override path = %q, want %q", got, want)
+	}
+
+	configs := m.Configs()
+	if len(configs) != 8 {
+		t.Fatalf("got %d configs, want 8", len(configs))
+	}
+	if got := configs[0].Label(); got != "opus/baseline/sequential" {
+		t.Errorf("first config = %q", got)
+	}
+	if got := configs[7].Label(); got != "sonnet/terse/parallel-2" {
+		t.Errorf("last config = %q", got)
+	}
+
+	// Without prompt sets, only the embedded prompts are benchmarked.
+	configs = Matrix{Models: []string{"opus"}, Parallelism: []string{"sequential"}}.Configs()
+	if len(configs) != 1 || configs[0].PromptSet != DefaultPromptSet {
+		t.Errorf("configs = %+v", configs)
+	}
+}
+
+func TestRunnerArgs(t *testing.T) {
+	r := &Runner{Agent: "/bin/stub", MaxIterations: 4, MaxBudget: 1.5}
+	cfg := Config{Model: "opus", Parallelism: "parallel-2", Overrides: map[string]string{"prompt.md": "/p/a.md"}}
+	got := strings.Join(r.args(cfg), " ")
+	want := "--agent /bin/stub --model opus --max-budget 1.5 --prompt-override prompt.md=/p/a.md run --prd prd.json --parallelism parallel-2 --max-iterations 4"
+	if got != want {
+		t.Errorf("args = %q\nwant   %q", got, want)
+	}
+}
+
+func TestTrialRecord(t *testing.T) {
+	iter := func(cost float64) state.Iteration {
+		return state.Iteration{Events: []claude.StreamEvent{{Type: claude.EventResult, CostUSD: cost}}}
+	}
+	run := &state.Run{ID: "run-1", Status: state.StatusRunning, Stories: []*state.AgentSession{
+		{StoryID: "US-001", Status: state.StatusPassed, Iterations: []state.Iteration{iter(0.5), iter(0.25)}},
+		{StoryID: "US-002", Status: state.StatusPassed, Iterations: []state.Iteration{iter(0.25)}},
+		{StoryID: "US-003", Status: state.StatusFailed, Iterations: []state.Iteration{iter(1)}},
+	}}
+
+	// An unfinished run is scored from its sessions.
+	var res TrialResult
+	res.record(run, 4)
+	if res.Passed != 2 || res.Total != 4 || res.Iterations != 4 || res.IterationsToPass != 1.5 || res.CostUSD != 2 {
+		t.Errorf("result = %+v", res)
+	}
+	if res.PassRate() != 0.5 {
+		t.Errorf("PassRate = %v, want 0.5", res.PassRate())
+	}
+
+	// A finished run's own counts win.
+	run.Status, run.Passed, run.Total, run.EndTime = state.StatusPartial, 3, 5, time.Now()
+	res = TrialResult{}
+	res.record(run, 4)
+	if res.Passed != 3 || res.Total != 5 {
+		t.Errorf("finished result = %d/%d, want 3/5", res.Passed, res.Total)
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	a := Config{Model: "a", PromptSet: DefaultPromptSet, Parallelism: "sequential"}
+	b := Config{Model: "b", PromptSet: DefaultPromptSet, Parallelism: "sequential"}
+	sums := Summarize([]TrialResult{
+		{Config: a, RunID: "r1", Passed: 2, Total: 2, IterationsToPass: 1, CostUSD: 1, WallTimeMS: 1000},
+		{Config: b, RunID: "r2", Passed: 0, Total: 2, CostUSD: 3, WallTimeMS: 3000},
+		{Config: a, RunID: "r3", Passed: 1, Total: 2, IterationsToPass: 2, CostUSD: 2, WallTimeMS: 2000},
+		{Config: a, Error: "clone failed"},
+	})
+	if len(sums) != 2 || sums[0].Model != "a" || sums[1].Model != "b" {
+		t.Fatalf("summaries = %+v", sums)
+	}
+	s := sums[0]
+	if s.Trials != 3 || s.Errors != 1 || s.PassRate != 0.75 || s.IterationsToPass != 1.5 || s.CostUSD != 1.5 || s.WallTimeMS != 1500 {
+		t.Errorf("summary a = %+v", s)
+	}
+	if sums[1].IterationsToPass != 0 || sums[1].PassRate != 0 {
+		t.Errorf("summary b = %+v", sums[1])
+	}
+
+	var sb strings.Builder
+	if err := WriteTable(&sb, sums); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(sb.String(), "75%") {
+		t.Errorf("table = %q", sb.String())
+	}
+}
+
+// stubRalph stands in for the ralph-wiggo executable: it records its
+// arguments and the run a real `run` would have recorded.
+const stubRalph = `#!/bin/sh
+echo "$@" > args.txt
+mkdir -p .ralph-wiggo/runs
+cat > .ralph-wiggo/runs/run-1.json <<'EOF'
+{"id":"run-1","startTime":"2026-03-01T10:00:00Z","endTime":"2026-03-01T10:01:00Z","status":"completed","passed":1,"total":1,
+ "stories":[{"storyID":"US-001","status":"passed","iterations":[{"number":1,"status":"passed","events":[{"type":"result","cost_usd":0.4}]}]}]}
+EOF
+echo done
+`
+
+func TestRunTrial(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("stub executable is a shell script")
+	}
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+
+	repo := t.TempDir()
+	gitCmd := func(args ...string) string {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = repo
+		cmd.Env = append(os.Environ(), "GIT_AUTHOR_NAME=t", "GIT_AUTHOR_EMAIL=t@t", "GIT_COMMITTER_NAME=t", "GIT_COMMITTER_EMAIL=t@t")
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	gitCmd("init", "-q")
+	if err := os.WriteFile(filepath.Join(repo, ".ralph-wiggo.yaml"), []byte("model: pinned\nparallelism: parallel-4\nport: 9000\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	gitCmd("add", "-A")
+	gitCmd("commit", "-qm", "init")
+	commit := gitCmd("rev-parse", "HEAD")
+
+	exe := filepath.Join(t.TempDir(), "ralph-wiggo")
+	if err := os.WriteFile(exe, []byte(stubRalph), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(repo)
+
+	r := &Runner{
+		Exe:     exe,
+		Agent:   "/bin/agent",
+		Commit:  commit,
+		PRD:     &prd.PRD{Project: "demo", UserStories: []prd.UserStory{{ID: "US-001", Title: "One"}}},
+		TempDir: t.TempDir(),
+		LogDir:  filepath.Join(t.TempDir(), "logs"),
+		Keep:    true,
+	}
+	res := r.RunTrial(context.Background(), Config{Model: "opus", PromptSet: DefaultPromptSet, Parallelism: "sequential"}, 1)
+	if res.Error != "" {
+		t.Fatalf("RunTrial error: %s", res.Error)
+	}
+	if res.RunID != "run-1" || res.Passed != 1 || res.Total != 1 || res.CostUSD != 0.4 || res.IterationsToPass != 1 {
+		t.Errorf("result = %+v", res)
+	}
+
+	clone := filepath.Join(res.Dir, "repo")
+	args, err := os.ReadFile(filepath.Join(clone, "args.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(args), "--model opus") || !strings.Contains(string(args), "--parallelism sequential") {
+		t.Errorf("args = %q", args)
+	}
+	if p, err := prd.LoadPRD(filepath.Join(clone, "prd.json")); err != nil || p.Project != "demo" {
+		t.Errorf("clone prd.json = %+v, %v", p, err)
+	}
+	// The clone's config keeps unrelated settings but not the varied ones.
+	cfg, err := os.ReadFile(filepath.Join(clone, ".ralph-wiggo.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(cfg), "pinned") || strings.Contains(string(cfg), "parallel-4") || !strings.Contains(string(cfg), "9000") {
+		t.Errorf("clone config = %q", cfg)
+	}
+	if log, _ := os.ReadFile(res.Log); !strings.Contains(string(log), "done") {
+		t.Errorf("log = %q", log)
+	}
+}
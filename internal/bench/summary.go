@@ -0,0 +1,91 @@
+package bench
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+)
+
+// Summary aggregates the trials of one configuration.
+type Summary struct {
+	Config
+	Trials int `json:"trials"`
+	Errors int `json:"errors"` // trials that failed to run or record a result
+	// Means over the trials that recorded a result. IterationsToPass is
+	// averaged over the trials in which any story passed.
+	PassRate         float64 `json:"passRate"`
+	IterationsToPass float64 `json:"iterationsToPass"`
+	CostUSD          float64 `json:"costUsd"`
+	WallTimeMS       int64   `json:"wallTimeMs"`
+}
+
+// Summarize aggregates trials per configuration, in the order configurations
+// first appear.
+func Summarize(trials []TrialResult) []Summary {
+	var sums []Summary
+	index := make(map[string]int)
+	type totals struct {
+		recorded, passing int
+		passRate, toPass  float64
+		cost              float64
+		wall              int64
+	}
+	var acc []totals
+
+	for _, t := range trials {
+		i, ok := index[t.Label()]
+		if !ok {
+			i = len(sums)
+			index[t.Label()] = i
+			sums = append(sums, Summary{Config: t.Config})
+			acc = append(acc, totals{})
+		}
+		sums[i].Trials++
+		if t.RunID == "" {
+			sums[i].Errors++
+			continue
+		}
+		if t.Error != "" {
+			sums[i].Errors++
+		}
+		a := &acc[i]
+		a.recorded++
+		a.passRate += t.PassRate()
+		a.cost += t.CostUSD
+		a.wall += t.WallTimeMS
+		if t.IterationsToPass > 0 {
+			a.passing++
+			a.toPass += t.IterationsToPass
+		}
+	}
+
+	for i, a := range acc {
+		if a.recorded > 0 {
+			sums[i].PassRate = a.passRate / float64(a.recorded)
+			sums[i].CostUSD = a.cost / float64(a.recorded)
+			sums[i].WallTimeMS = a.wall / int64(a.recorded)
+		}
+		if a.passing > 0 {
+			sums[i].IterationsToPass = a.toPass / float64(a.passing)
+		}
+	}
+	return sums
+}
+
+// WriteTable writes summaries as an aligned comparison table.
+func WriteTable(w io.Writer, sums []Summary) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "MODEL\tPROMPTS\tPARALLELISM\tTRIALS\tERRORS\tPASS RATE\tITERS TO PASS\tCOST\tWALL TIME")
+	for _, s := range sums {
+		toPass := "-"
+		if s.IterationsToPass > 0 {
+			toPass = fmt.Sprintf("%.1f", s.IterationsToPass)
+		}
+		wall := (time.Duration(s.WallTimeMS) * time.Millisecond).Round(time.Second)
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%d\t%.0f%%\t%s\t$%.2f\t%s\n",
+			s.Model, s.PromptSet, s.Parallelism, s.Trials, s.Errors,
+			s.PassRate*100, toPass, s.CostUSD, wall)
+	}
+	return tw.Flush()
+}
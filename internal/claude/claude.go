@@ -7,10 +7,13 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"strconv"
+	"strings"
 )
 
 // RunConfig holds all configuration for a single Claude CLI invocation.
@@ -51,7 +54,40 @@ type StreamEvent struct {
 	ToolID    string          `json:"tool_id,omitempty"`
 	Input     json.RawMessage `json:"input,omitempty"`
 	Output    json.RawMessage `json:"output,omitempty"`
-	Raw       json.RawMessage `json:"-"`
+	IsError   bool            `json:"is_error,omitempty"`
+	Subtype   string          `json:"subtype,omitempty"` // result events: how the session ended
+
+	// Error events for a failed CLI process: the end of its stderr, and the
+	// *ProcessError for errors.Is and Hint (not recorded).
+	Stderr string `json:"stderr,omitempty"`
+	Err    error  `json:"-"`
+
+	// Result events only: what the session cost and how long it took.
+	CostUSD    float64 `json:"cost_usd,omitempty"`
+	DurationMS int64   `json:"duration_ms,omitempty"`
+	NumTurns   int     `json:"num_turns,omitempty"`
+
+	Raw json.RawMessage `json:"-"`
+}
+
+// Subtypes reported on EventResult.
+const (
+	ResultSuccess   = "success"
+	ResultMaxTurns  = "error_max_turns"
+	ResultMaxBudget = "error_max_budget_usd"
+)
+
+// OutputText returns a tool result's output as plain text. Output produced by
+// this package is a JSON string; anything else is returned verbatim.
+func (e StreamEvent) OutputText() string {
+	if len(e.Output) == 0 {
+		return ""
+	}
+	var text string
+	if err := json.Unmarshal(e.Output, &text); err == nil {
+		return text
+	}
+	return string(e.Output)
 }
 
 // parseStreamLine parses a raw NDJSON line from the Claude CLI stream-json
@@ -63,8 +99,13 @@ func parseStreamLine(line []byte) []StreamEvent {
 	// First pass: extract top-level fields with message as raw JSON.
 	var top struct {
 		Type      EventType       `json:"type"`
+		Subtype   string          `json:"subtype,omitempty"`
 		SessionID string          `json:"session_id,omitempty"`
 		Message   json.RawMessage `json:"message,omitempty"`
+
+		TotalCostUSD float64 `json:"total_cost_usd,omitempty"`
+		DurationMS   int64   `json:"duration_ms,omitempty"`
+		NumTurns     int     `json:"num_turns,omitempty"`
 	}
 	if err := json.Unmarshal(line, &top); err != nil {
 		return []StreamEvent{{
@@ -79,7 +120,15 @@ func parseStreamLine(line []byte) []StreamEvent {
 		return parseMessageBlocks(top.Type, top.SessionID, top.Message, raw)
 
 	case EventResult:
-		return []StreamEvent{{Type: EventResult, SessionID: top.SessionID, Raw: raw}}
+		return []StreamEvent{{
+			Type:       EventResult,
+			SessionID:  top.SessionID,
+			Subtype:    top.Subtype,
+			CostUSD:    top.TotalCostUSD,
+			DurationMS: top.DurationMS,
+			NumTurns:   top.NumTurns,
+			Raw:        raw,
+		}}
 
 	default:
 		// For init, error, system, etc. — try message as a plain string.
@@ -105,6 +154,8 @@ func parseMessageBlocks(evtType EventType, sessionID string, msgRaw json.RawMess
 			ID        string          `json:"id,omitempty"`
 			ToolUseID string          `json:"tool_use_id,omitempty"`
 			Input     json.RawMessage `json:"input,omitempty"`
+			Content   json.RawMessage `json:"content,omitempty"`
+			IsError   bool            `json:"is_error,omitempty"`
 		} `json:"content"`
 	}
 	if err := json.Unmarshal(msgRaw, &msg); err != nil {
@@ -132,18 +183,56 @@ func parseMessageBlocks(evtType EventType, sessionID string, msgRaw json.RawMess
 				Raw:       raw,
 			})
 		case "tool_result":
-			events = append(events, StreamEvent{
+			evt := StreamEvent{
 				Type:      EventToolResult,
 				SessionID: sessionID,
 				ToolID:    block.ToolUseID,
+				IsError:   block.IsError,
 				Raw:       raw,
-			})
+			}
+			if text, ok := toolResultText(block.Content); ok {
+				evt.Output, _ = json.Marshal(text)
+			}
+			events = append(events, evt)
 		// Skip "thinking", "signature", and other block types.
 		}
 	}
 	return events
 }
 
+// toolResultText flattens the content of a tool_result block to text. Content
+// is either a plain string or an array of content blocks, of which only text
+// blocks are kept. It returns false if there is no content.
+func toolResultText(content json.RawMessage) (string, bool) {
+	if len(content) == 0 || string(content) == "null" {
+		return "", false
+	}
+
+	var text string
+	if err := json.Unmarshal(content, &text); err == nil {
+		return text, true
+	}
+
+	var blocks []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(content, &blocks); err != nil {
+		return string(content), true
+	}
+	var sb strings.Builder
+	for _, b := range blocks {
+		if b.Type != "text" {
+			continue
+		}
+		if sb.Len() > 0 {
+			sb.WriteString("\n")
+		}
+		sb.WriteString(b.Text)
+	}
+	return sb.String(), true
+}
+
 // Executor shells out to the Claude CLI.
 type Executor struct {
 	// ClaudePath is the path to the claude binary. Defaults to "claude".
@@ -197,9 +286,14 @@ func (e *Executor) buildStreamingArgs(cfg RunConfig) []string {
 	return args
 }
 
+// maxStreamLine is the longest stream-json line RunStreaming can read.
+const maxStreamLine = 10 * 1024 * 1024
+
 // RunStreaming spawns the claude CLI with --output-format stream-json and
 // returns a channel of parsed StreamEvent values. The channel is closed when
-// the subprocess exits. Context cancellation kills the subprocess.
+// the subprocess exits. Context cancellation kills the subprocess. A failed
+// process ends the stream with an error event carrying the end of its stderr
+// and a *ProcessError.
 func (e *Executor) RunStreaming(ctx context.Context, cfg RunConfig) (<-chan StreamEvent, error) {
 	bin := e.ClaudePath
 	if bin == "" {
@@ -218,13 +312,11 @@ func (e *Executor) RunStreaming(ctx context.Context, cfg RunConfig) (<-chan Stre
 		return nil, fmt.Errorf("claude: stdout pipe: %w", err)
 	}
 
-	stderr, err := cmd.StderrPipe()
-	if err != nil {
-		return nil, fmt.Errorf("claude: stderr pipe: %w", err)
-	}
+	stderr := newRingBuffer(stderrTailSize)
+	cmd.Stderr = stderr
 
 	if err := cmd.Start(); err != nil {
-		return nil, fmt.Errorf("claude: start: %w", err)
+		return nil, fmt.Errorf("claude: start: %w", newProcessError(bin, err, ""))
 	}
 
 	ch := make(chan StreamEvent, 64)
@@ -232,19 +324,21 @@ func (e *Executor) RunStreaming(ctx context.Context, cfg RunConfig) (<-chan Stre
 	go func() {
 		defer close(ch)
 
-		// Drain stderr in the background to prevent blocking.
-		go func() {
-			scanner := bufio.NewScanner(stderr)
-			for scanner.Scan() {
-				// stderr is intentionally discarded; verbose logging goes here.
-			}
-		}()
-
 		scanner := bufio.NewScanner(stdout)
 		// Increase buffer for potentially large JSON lines (e.g. tool outputs).
-		scanner.Buffer(make([]byte, 0, 1024*1024), 10*1024*1024)
+		scanner.Buffer(make([]byte, 0, 1024*1024), maxStreamLine)
 
 		sentInit := false
+		var cliError string // the last error the CLI reported, for classifying a failure
+
+		send := func(evt StreamEvent) bool {
+			select {
+			case ch <- evt:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
 
 		for scanner.Scan() {
 			line := scanner.Bytes()
@@ -252,39 +346,45 @@ func (e *Executor) RunStreaming(ctx context.Context, cfg RunConfig) (<-chan Stre
 				continue
 			}
 
+			if text := cliErrorText(line); text != "" {
+				cliError = text
+			}
 			events := parseStreamLine(line)
 
 			for _, evt := range events {
 				// Emit a synthetic init event the first time we see a session ID.
 				if !sentInit && evt.SessionID != "" {
 					sentInit = true
-					select {
-					case ch <- StreamEvent{
-						Type:      EventInit,
-						SessionID: evt.SessionID,
-					}:
-					case <-ctx.Done():
+					if !send(StreamEvent{Type: EventInit, SessionID: evt.SessionID}) {
 						return
 					}
 				}
-
-				select {
-				case ch <- evt:
-				case <-ctx.Done():
+				if !send(evt) {
 					return
 				}
 			}
 		}
 
+		// A line the scanner cannot read ends the stream; the rest of the
+		// output is discarded so the process can finish.
+		if err := scanner.Err(); err != nil {
+			if errors.Is(err, bufio.ErrTooLong) {
+				err = fmt.Errorf("a line is longer than %d MiB", maxStreamLine>>20)
+			}
+			if !send(StreamEvent{Type: EventError, Message: fmt.Sprintf("reading agent output: %v", err)}) {
+				return
+			}
+			_, _ = io.Copy(io.Discard, stdout)
+		}
+
 		// Wait for process to exit and report non-zero exit as an error event.
 		if waitErr := cmd.Wait(); waitErr != nil {
-			select {
-			case ch <- StreamEvent{
-				Type:    EventError,
-				Message: fmt.Sprintf("agent process exited with error: %v", waitErr),
-			}:
-			case <-ctx.Done():
+			pe := newProcessError(bin, waitErr, stderr.String(), cliError)
+			msg := pe.Error()
+			if pe.Kind == nil {
+				msg = fmt.Sprintf("agent process exited with error: %v", waitErr)
 			}
+			send(StreamEvent{Type: EventError, Message: msg, Stderr: pe.Stderr, Err: pe})
 		}
 	}()
 
@@ -317,7 +417,7 @@ func (e *Executor) RunInteractive(ctx context.Context, cfg RunConfig) error {
 	cmd.Stderr = os.Stderr
 
 	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("claude: interactive: %w", err)
+		return fmt.Errorf("claude: interactive: %w", newProcessError(bin, err, ""))
 	}
 	return nil
 }
@@ -348,11 +448,12 @@ func (e *Executor) RunPromptCapture(ctx context.Context, cfg RunConfig) (*Prompt
 	}
 
 	var stdout bytes.Buffer
+	stderr := newRingBuffer(stderrTailSize)
 	cmd.Stdout = &stdout
-	cmd.Stderr = os.Stderr
+	cmd.Stderr = io.MultiWriter(os.Stderr, stderr)
 
 	if err := cmd.Run(); err != nil {
-		return nil, fmt.Errorf("claude: prompt capture: %w", err)
+		return nil, fmt.Errorf("claude: prompt capture: %w", newProcessError(bin, err, stderr.String(), cliErrorText(stdout.Bytes())))
 	}
 
 	output := stdout.Bytes()
@@ -407,12 +508,17 @@ func (e *Executor) RunJSON(ctx context.Context, cfg RunConfig, jsonSchema string
 		cmd.Dir = cfg.WorkDir
 	}
 
-	var stdout, stderr bytes.Buffer
+	var stdout bytes.Buffer
+	stderr := newRingBuffer(stderrTailSize)
 	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
+	cmd.Stderr = stderr
 
 	if err := cmd.Run(); err != nil {
-		return nil, fmt.Errorf("claude: json mode: %w (stderr: %s)", err, stderr.String())
+		pe := newProcessError(bin, err, stderr.String(), cliErrorText(stdout.Bytes()))
+		if pe.Stderr == "" {
+			return nil, fmt.Errorf("claude: json mode: %w", pe)
+		}
+		return nil, fmt.Errorf("claude: json mode: %w (stderr: %s)", pe, pe.Stderr)
 	}
 
 	output := stdout.Bytes()
@@ -0,0 +1,78 @@
+package claude
+
+import (
+	"testing"
+)
+
+func TestParseStreamLineToolResult(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		output  string
+		isError bool
+	}{
+		{
+			name:   "string content",
+			line:   `{"type":"user","session_id":"s1","message":{"content":[{"type":"tool_result","tool_use_id":"toolu_1","content":"file1.go\nfile2.go"}]}}`,
+			output: "file1.go\nfile2.go",
+		},
+		{
+			name:   "block content",
+			line:   `{"type":"user","message":{"content":[{"type":"tool_result","tool_use_id":"toolu_1","content":[{"type":"text","text":"line one"},{"type":"image"},{"type":"text","text":"line two"}]}]}}`,
+			output: "line one\nline two",
+		},
+		{
+			name:    "error result",
+			line:    `{"type":"user","message":{"content":[{"type":"tool_result","tool_use_id":"toolu_1","content":"Exit code 1\nboom","is_error":true}]}}`,
+			output:  "Exit code 1\nboom",
+			isError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events := parseStreamLine([]byte(tt.line))
+			if len(events) != 1 {
+				t.Fatalf("expected 1 event, got %d", len(events))
+			}
+			evt := events[0]
+			if evt.Type != EventToolResult {
+				t.Errorf("Type = %q, want %q", evt.Type, EventToolResult)
+			}
+			if evt.ToolID != "toolu_1" {
+				t.Errorf("ToolID = %q, want %q", evt.ToolID, "toolu_1")
+			}
+			if got := evt.OutputText(); got != tt.output {
+				t.Errorf("OutputText = %q, want %q", got, tt.output)
+			}
+			if evt.IsError != tt.isError {
+				t.Errorf("IsError = %v, want %v", evt.IsError, tt.isError)
+			}
+		})
+	}
+}
+
+func TestParseStreamLineToolUse(t *testing.T) {
+	line := `{"type":"assistant","session_id":"s1","message":{"content":[{"type":"text","text":"Editing."},{"type":"tool_use","id":"toolu_2","name":"Edit","input":{"file_path":"a.go"}}]}}`
+	events := parseStreamLine([]byte(line))
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(events))
+	}
+	if events[0].Type != EventAssistant || events[0].Message != "Editing." {
+		t.Errorf("first event = %+v", events[0])
+	}
+	if events[1].Type != EventToolUse || events[1].ToolName != "Edit" || events[1].ToolID != "toolu_2" {
+		t.Errorf("second event = %+v", events[1])
+	}
+}
+
+func TestParseStreamLineResultSubtype(t *testing.T) {
+	line := `{"type":"result","subtype":"error_max_budget_usd","session_id":"s1","is_error":true,"total_cost_usd":5.01,"duration_ms":42000,"num_turns":7}`
+	events := parseStreamLine([]byte(line))
+	if len(events) != 1 || events[0].Type != EventResult || events[0].Subtype != ResultMaxBudget {
+		t.Fatalf("events = %+v", events)
+	}
+	if e := events[0]; e.CostUSD != 5.01 || e.DurationMS != 42000 || e.NumTurns != 7 {
+		t.Errorf("cost/duration/turns = %v/%v/%v", e.CostUSD, e.DurationMS, e.NumTurns)
+	}
+}
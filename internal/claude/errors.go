@@ -0,0 +1,184 @@
+package claude
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// Failures of the Claude CLI that the user has to fix before retrying. A
+// *ProcessError matches them with errors.Is.
+var (
+	ErrNotFound  = errors.New("claude CLI not found")
+	ErrAuth      = errors.New("claude CLI is not authenticated")
+	ErrRateLimit = errors.New("claude API rate limit reached")
+)
+
+// Hint returns what to do about err if it is one of the typed Claude CLI
+// failures, or "" otherwise.
+func Hint(err error) string {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return "Install the Claude CLI (npm install -g @anthropic-ai/claude-code) or pass --agent with the path to it."
+	case errors.Is(err, ErrAuth):
+		return "Run `claude` and log in with /login, or set ANTHROPIC_API_KEY to a valid key."
+	case errors.Is(err, ErrRateLimit):
+		return "Wait for the limit to reset and run again; completed stories are kept."
+	}
+	return ""
+}
+
+// A ProcessError is a Claude CLI invocation that failed.
+type ProcessError struct {
+	Err    error  // from starting or waiting for the process
+	Kind   error  // ErrNotFound, ErrAuth, ErrRateLimit or nil
+	Stderr string // the end of the process's stderr
+}
+
+func (e *ProcessError) Error() string {
+	if e.Kind == nil {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("%v (%v)", e.Kind, e.Err)
+}
+
+func (e *ProcessError) Unwrap() []error {
+	if e.Kind == nil {
+		return []error{e.Err}
+	}
+	return []error{e.Kind, e.Err}
+}
+
+// newProcessError classifies a failed invocation of bin by its error, the end
+// of its stderr and the errors the CLI reported in its output (see
+// cliErrorText). Model-authored text must not be passed: a story about rate
+// limiting would otherwise read as a rate limit failure.
+func newProcessError(bin string, err error, stderr string, cliErrors ...string) *ProcessError {
+	output := strings.Join(append(cliErrors, stderr), "\n")
+	return &ProcessError{Err: err, Kind: classify(bin, err, output), Stderr: stderr}
+}
+
+// cliErrorText returns what the CLI itself reports as an error in a line of
+// its JSON output: the result of a result with is_error set, and an API error
+// payload. Assistant messages and successful results are ignored.
+func cliErrorText(line []byte) string {
+	var out struct {
+		IsError bool            `json:"is_error"`
+		Result  json.RawMessage `json:"result"`
+		Error   json.RawMessage `json:"error"`
+	}
+	if json.Unmarshal(line, &out) != nil {
+		return ""
+	}
+	var parts []string
+	if out.IsError && len(out.Result) > 0 {
+		parts = append(parts, string(out.Result))
+	}
+	if len(out.Error) > 0 && string(out.Error) != "null" {
+		parts = append(parts, string(out.Error))
+	}
+	return strings.Join(parts, "\n")
+}
+
+// Substrings of the Claude CLI's messages for failures with a typed error,
+// matched case-insensitively.
+var (
+	authPatterns = []string{
+		"invalid api key", "please run /login", "not logged in", "authentication_error",
+		"oauth token has expired", "invalid x-api-key", "401 unauthorized",
+	}
+	rateLimitPatterns = []string{
+		"rate limit", "rate_limit_error", "429 too many requests", "usage limit reached",
+	}
+)
+
+// classify returns the typed error for a failure of bin, or nil.
+func classify(bin string, err error, output string) error {
+	if isMissingBinary(bin, err) {
+		return ErrNotFound
+	}
+	output = strings.ToLower(output)
+	containsAny := func(patterns []string) bool {
+		for _, p := range patterns {
+			if strings.Contains(output, p) {
+				return true
+			}
+		}
+		return false
+	}
+	switch {
+	case containsAny(authPatterns):
+		return ErrAuth
+	case containsAny(rateLimitPatterns):
+		return ErrRateLimit
+	}
+	return nil
+}
+
+// isMissingBinary reports whether err is from starting bin because it does
+// not exist, rather than because of a missing working directory.
+func isMissingBinary(bin string, err error) bool {
+	if errors.Is(err, exec.ErrNotFound) {
+		return true
+	}
+	var pathErr *fs.PathError
+	return errors.As(err, &pathErr) && pathErr.Op != "chdir" && pathErr.Path == bin &&
+		errors.Is(pathErr.Err, fs.ErrNotExist)
+}
+
+// stderrTailSize is how much of a process's stderr a ringBuffer keeps.
+const stderrTailSize = 8 << 10
+
+// ringBuffer is an io.Writer that keeps the last size bytes written to it,
+// for reporting the end of a process's stderr.
+type ringBuffer struct {
+	mu        sync.Mutex
+	buf       []byte
+	start     int // index of the oldest byte once full
+	truncated bool
+}
+
+func newRingBuffer(size int) *ringBuffer {
+	return &ringBuffer{buf: make([]byte, 0, size)}
+}
+
+func (r *ringBuffer) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n, size := len(p), cap(r.buf)
+	if len(p) > size {
+		p = p[len(p)-size:]
+		r.truncated = true
+	}
+	if free := size - len(r.buf); free > 0 {
+		k := min(free, len(p))
+		r.buf = append(r.buf, p[:k]...)
+		p = p[k:]
+	}
+	for len(p) > 0 {
+		k := copy(r.buf[r.start:], p)
+		r.start = (r.start + k) % size
+		p = p[k:]
+		r.truncated = true
+	}
+	return n, nil
+}
+
+// String returns the kept bytes, starting at a line boundary if earlier ones
+// were dropped.
+func (r *ringBuffer) String() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s := string(r.buf[r.start:]) + string(r.buf[:r.start])
+	if r.truncated {
+		if _, rest, ok := strings.Cut(s, "\n"); ok {
+			s = rest
+		}
+		s = "...\n" + s
+	}
+	return strings.TrimSpace(s)
+}
@@ -0,0 +1,161 @@
+package claude
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestRingBuffer(t *testing.T) {
+	r := newRingBuffer(16)
+	r.Write([]byte("one\n"))
+	if got := r.String(); got != "one" {
+		t.Errorf("String = %q, want %q", got, "one")
+	}
+	r.Write([]byte("two\nthree\n"))
+	r.Write([]byte("four\nfive\n"))
+	if got, want := r.String(), "...\nfour\nfive"; got != want {
+		t.Errorf("String = %q, want %q", got, want)
+	}
+	r.Write([]byte(strings.Repeat("x", 20) + "\nlast\n"))
+	if got, want := r.String(), "...\nlast"; got != want {
+		t.Errorf("String = %q, want %q", got, want)
+	}
+}
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		err    error
+		output string
+		want   error
+	}{
+		{exec.ErrNotFound, "", ErrNotFound},
+		{&fs.PathError{Op: "fork/exec", Path: "claude", Err: fs.ErrNotExist}, "", ErrNotFound},
+		{&fs.PathError{Op: "chdir", Path: "/gone", Err: fs.ErrNotExist}, "", nil},
+		{errors.New("exit status 1"), "Invalid API key · Please run /login", ErrAuth},
+		{errors.New("exit status 1"), `API Error: 429 {"type":"error","error":{"type":"rate_limit_error"}}`, ErrRateLimit},
+		{errors.New("exit status 1"), "Claude AI usage limit reached|1760000000", ErrRateLimit},
+		{errors.New("exit status 2"), "panic: boom", nil},
+	}
+	for _, tt := range tests {
+		if got := classify("claude", tt.err, tt.output); got != tt.want {
+			t.Errorf("classify(%v, %q) = %v, want %v", tt.err, tt.output, got, tt.want)
+		}
+	}
+}
+
+// stubClaude writes a shell script standing in for the claude CLI.
+func stubClaude(t *testing.T, script string) *Executor {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("stub executable is a shell script")
+	}
+	path := filepath.Join(t.TempDir(), "claude")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return &Executor{ClaudePath: path}
+}
+
+// collect runs a streaming invocation and returns its events.
+func collect(t *testing.T, e *Executor) []StreamEvent {
+	t.Helper()
+	ch, err := e.RunStreaming(context.Background(), RunConfig{Prompt: "p"})
+	if err != nil {
+		t.Fatalf("RunStreaming: %v", err)
+	}
+	var events []StreamEvent
+	for evt := range ch {
+		events = append(events, evt)
+	}
+	return events
+}
+
+func TestRunStreaming_AuthFailure(t *testing.T) {
+	e := stubClaude(t, `echo '{"type":"assistant","session_id":"s1","message":{"content":[{"type":"text","text":"Invalid API key · Please run /login"}]}}'
+echo '{"type":"result","subtype":"success","is_error":true,"result":"Invalid API key · Please run /login"}'
+echo "starting" >&2
+echo "request failed" >&2
+exit 1
+`)
+	events := collect(t, e)
+	last := events[len(events)-1]
+	if last.Type != EventError || last.Stderr != "starting\nrequest failed" {
+		t.Fatalf("last event = %+v, want an error with stderr", last)
+	}
+	if !errors.Is(last.Err, ErrAuth) || !strings.Contains(last.Message, ErrAuth.Error()) {
+		t.Errorf("error event = %q (%v), want ErrAuth", last.Message, last.Err)
+	}
+	if Hint(last.Err) == "" {
+		t.Error("no hint for an auth failure")
+	}
+}
+
+func TestRunStreaming_ModelTextNotClassified(t *testing.T) {
+	e := stubClaude(t, `echo '{"type":"assistant","session_id":"s1","message":{"content":[{"type":"text","text":"Added a rate limit; users who are not logged in get an invalid API key error."}]}}'
+echo '{"type":"result","subtype":"success","is_error":false,"result":"Rate limit middleware added."}'
+exit 1
+`)
+	events := collect(t, e)
+	last := events[len(events)-1]
+	var pe *ProcessError
+	if last.Type != EventError || !errors.As(last.Err, &pe) || pe.Kind != nil {
+		t.Errorf("last event = %+v, want an unclassified process error", last)
+	}
+	if Hint(last.Err) != "" {
+		t.Errorf("hint for an ordinary failure: %q", Hint(last.Err))
+	}
+}
+
+func TestRunStreaming_MissingWorkDir(t *testing.T) {
+	e := stubClaude(t, "exit 0\n")
+	_, err := e.RunStreaming(context.Background(), RunConfig{Prompt: "p", WorkDir: filepath.Join(t.TempDir(), "gone")})
+	if err == nil || errors.Is(err, ErrNotFound) {
+		t.Errorf("err = %v, want a start error that is not ErrNotFound", err)
+	}
+}
+
+func TestRunJSON_GeneratedTextNotClassified(t *testing.T) {
+	e := stubClaude(t, `echo '{"type":"result","is_error":false,"result":"# PRD: Login\n\nShow a rate limit message when users are not logged in."}'
+exit 1
+`)
+	_, err := e.RunJSON(context.Background(), RunConfig{Prompt: "p"}, "")
+	if err == nil || Hint(err) != "" {
+		t.Errorf("err = %v, want an unclassified failure", err)
+	}
+}
+
+func TestRunStreaming_LineTooLong(t *testing.T) {
+	e := stubClaude(t, `head -c 11000000 /dev/zero | tr '\0' 'x'
+echo
+echo '{"type":"result","subtype":"success"}'
+`)
+	events := collect(t, e)
+	if len(events) != 1 || events[0].Type != EventError || !strings.Contains(events[0].Message, "longer than 10 MiB") {
+		t.Errorf("events = %+v, want one error for the long line", events)
+	}
+}
+
+func TestRunStreaming_NotFound(t *testing.T) {
+	e := &Executor{ClaudePath: filepath.Join(t.TempDir(), "missing")}
+	_, err := e.RunStreaming(context.Background(), RunConfig{Prompt: "p"})
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestRunJSON_RateLimit(t *testing.T) {
+	e := stubClaude(t, `echo '{"type":"result","is_error":true,"result":"API Error: Rate limit reached"}'
+exit 1
+`)
+	_, err := e.RunJSON(context.Background(), RunConfig{Prompt: "p"}, "")
+	if !errors.Is(err, ErrRateLimit) {
+		t.Errorf("err = %v, want ErrRateLimit", err)
+	}
+}
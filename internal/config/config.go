@@ -11,12 +11,24 @@ import (
 
 // Config represents the settings from .ralph-wiggo.yaml.
 type Config struct {
-	Model        string   `yaml:"model"`
-	MaxBudget    float64  `yaml:"maxBudget"`
-	MaxTurns     int      `yaml:"maxTurns"`
-	Parallelism  string   `yaml:"parallelism"`
-	AllowedTools []string `yaml:"allowedTools"`
-	Port         int      `yaml:"port"`
+	Model        string    `yaml:"model"`
+	Agent        string    `yaml:"agent"` // agent executable; defaults to "claude"
+	MaxBudget    float64   `yaml:"maxBudget"`
+	MaxTurns     int       `yaml:"maxTurns"`
+	Parallelism  string    `yaml:"parallelism"`
+	AllowedTools []string  `yaml:"allowedTools"`
+	Port         int       `yaml:"port"`
+	StateBackend string    `yaml:"stateBackend"` // "json" (default) or "sqlite"
+	AutoSplit    bool      `yaml:"autoSplit"`    // split stories that exhaust their iterations without asking
+	Retention    Retention `yaml:"retention"`
+}
+
+// Retention holds the run history limits applied by `ralph-wiggo gc`. Zero
+// values fall back to the built-in defaults; negative values disable a limit.
+type Retention struct {
+	KeepRuns     int `yaml:"keepRuns"`     // keep the newest N runs
+	MaxAgeDays   int `yaml:"maxAgeDays"`   // keep runs younger than this many days
+	CompactAfter int `yaml:"compactAfter"` // compact all but the newest N kept runs
 }
 
 // DefaultConfigFile is the name of the config file looked for in the working directory.
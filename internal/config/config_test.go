@@ -9,6 +9,7 @@ import (
 func TestLoad_FileExists(t *testing.T) {
 	dir := t.TempDir()
 	content := `model: claude-opus-4-6
+agent: /opt/bin/claude
 maxBudget: 5.0
 maxTurns: 100
 parallelism: parallel-3
@@ -17,6 +18,12 @@ allowedTools:
   - Read
   - Edit
 port: 9090
+stateBackend: sqlite
+autoSplit: true
+retention:
+  keepRuns: 5
+  maxAgeDays: 30
+  compactAfter: -1
 `
 	if err := os.WriteFile(filepath.Join(dir, DefaultConfigFile), []byte(content), 0644); err != nil {
 		t.Fatal(err)
@@ -29,6 +36,9 @@ port: 9090
 	if cfg.Model != "claude-opus-4-6" {
 		t.Errorf("Model = %q, want %q", cfg.Model, "claude-opus-4-6")
 	}
+	if cfg.Agent != "/opt/bin/claude" {
+		t.Errorf("Agent = %q, want %q", cfg.Agent, "/opt/bin/claude")
+	}
 	if cfg.MaxBudget != 5.0 {
 		t.Errorf("MaxBudget = %v, want 5.0", cfg.MaxBudget)
 	}
@@ -44,6 +54,15 @@ port: 9090
 	if cfg.Port != 9090 {
 		t.Errorf("Port = %d, want 9090", cfg.Port)
 	}
+	if cfg.StateBackend != "sqlite" {
+		t.Errorf("StateBackend = %q, want %q", cfg.StateBackend, "sqlite")
+	}
+	if !cfg.AutoSplit {
+		t.Error("AutoSplit = false, want true")
+	}
+	if want := (Retention{KeepRuns: 5, MaxAgeDays: 30, CompactAfter: -1}); cfg.Retention != want {
+		t.Errorf("Retention = %+v, want %+v", cfg.Retention, want)
+	}
 }
 
 func TestLoad_FileNotExists(t *testing.T) {
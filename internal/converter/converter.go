@@ -0,0 +1,114 @@
+// Package converter converts a PRD markdown document into a PRD with
+// schema-constrained Claude calls, without an interactive session, so
+// conversion can run in CI.
+package converter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/radvoogh/ralph-wiggo/internal/claude"
+	"github.com/radvoogh/ralph-wiggo/internal/prd"
+)
+
+// JSONRunner is the interface required to invoke Claude for a conversion. It
+// is satisfied by *claude.Executor.
+type JSONRunner interface {
+	RunJSON(ctx context.Context, cfg claude.RunConfig, jsonSchema string) (json.RawMessage, error)
+}
+
+// maxReportedProblems bounds the problems quoted in a repair prompt.
+const maxReportedProblems = 20
+
+// An InvalidError is returned by Convert when Claude's last attempt still
+// had problems.
+type InvalidError struct {
+	Attempts int // calls made, the first one included
+	Problems []prd.Problem
+}
+
+func (e *InvalidError) Error() string {
+	return fmt.Sprintf("converted PRD still invalid after %d attempts: %s (%d problems)",
+		e.Attempts, e.Problems[0], len(e.Problems))
+}
+
+// Convert asks Claude for the PRD described by markdown, constrained to
+// prd.JSONSchema. cfg.AppendSystemPrompt should hold the conversion skill. A
+// response with problems (see prd.Check) is sent back with the problems to be
+// repaired, up to repairs times. Errors from the call itself are returned
+// without retrying.
+func Convert(ctx context.Context, exec JSONRunner, cfg claude.RunConfig, markdown string, repairs int) (*prd.PRD, error) {
+	attempts := max(repairs, 0) + 1
+	cfg.Prompt = buildConvertPrompt(markdown)
+	var problems []prd.Problem
+	for range attempts {
+		raw, err := exec.RunJSON(ctx, cfg, prd.JSONSchema)
+		if err != nil {
+			return nil, err
+		}
+		data := unquote(raw)
+		problems = check(data)
+		if len(problems) == 0 {
+			return prd.Unmarshal(data, prd.FormatJSON)
+		}
+		cfg.Prompt = buildRepairPrompt(markdown, data, problems)
+	}
+	return nil, &InvalidError{Attempts: attempts, Problems: problems}
+}
+
+// unquote returns the JSON text inside raw when the response is a JSON
+// string rather than an object.
+func unquote(raw json.RawMessage) []byte {
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return []byte(s)
+	}
+	return raw
+}
+
+// check returns the problems of a converted PRD, including contents that are
+// not a PRD at all and a PRD without stories.
+func check(data []byte) []prd.Problem {
+	problems, err := prd.Check(data, prd.FormatJSON)
+	if err != nil {
+		return []prd.Problem{{Path: "$", Message: err.Error()}}
+	}
+	if len(problems) > 0 {
+		return problems
+	}
+	p, err := prd.Unmarshal(data, prd.FormatJSON)
+	if err != nil {
+		return []prd.Problem{{Path: "$", Message: err.Error()}}
+	}
+	if len(p.UserStories) == 0 {
+		return []prd.Problem{{Path: "$.userStories", Message: "no stories"}}
+	}
+	return nil
+}
+
+// buildConvertPrompt constructs the prompt for the first conversion attempt.
+func buildConvertPrompt(markdown string) string {
+	return "Convert the following PRD markdown into the prd.json format. " +
+		"Respond with the complete PRD as JSON matching the schema; do not write any files.\n\n" + markdown
+}
+
+// buildRepairPrompt constructs the prompt for another attempt, quoting the
+// previous response and its problems.
+func buildRepairPrompt(markdown string, previous []byte, problems []prd.Problem) string {
+	var sb strings.Builder
+	sb.WriteString(buildConvertPrompt(markdown))
+	sb.WriteString("\n\nA previous conversion had these problems:\n")
+	for i, p := range problems {
+		if i == maxReportedProblems {
+			sb.WriteString(fmt.Sprintf("- and %d more\n", len(problems)-i))
+			break
+		}
+		sb.WriteString(fmt.Sprintf("- %s\n", p))
+	}
+	sb.WriteString("\nPrevious conversion:\n\n```json\n")
+	sb.WriteString(strings.TrimSpace(string(previous)))
+	sb.WriteString("\n```\n\nFix these problems and respond with the corrected PRD in full.\n")
+	return sb.String()
+}
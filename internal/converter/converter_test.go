@@ -0,0 +1,100 @@
+package converter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/radvoogh/ralph-wiggo/internal/claude"
+)
+
+// mockJSONRunner implements JSONRunner, returning one response per call and
+// recording the prompts it was sent.
+type mockJSONRunner struct {
+	responses []string
+	err       error
+	prompts   []string
+}
+
+func (m *mockJSONRunner) RunJSON(_ context.Context, cfg claude.RunConfig, _ string) (json.RawMessage, error) {
+	m.prompts = append(m.prompts, cfg.Prompt)
+	if m.err != nil {
+		return nil, m.err
+	}
+	resp := m.responses[min(len(m.prompts), len(m.responses))-1]
+	return json.RawMessage(resp), nil
+}
+
+const validPRD = `{"schemaVersion": 1, "project": "shop", "branchName": "ralph/shop", "description": "d",
+  "userStories": [{"id": "US-001", "title": "Orders", "description": "d", "acceptanceCriteria": ["a"], "priority": 1, "passes": false}]}`
+
+const invalidPRD = `{"schemaVersion": 1, "project": "shop", "branchName": "ralph/shop", "description": "d",
+  "userStories": [{"id": "US-001", "title": "Orders", "priority": 2, "estimate": 3}]}`
+
+func TestConvert(t *testing.T) {
+	runner := &mockJSONRunner{responses: []string{validPRD}}
+	p, err := Convert(context.Background(), runner, claude.RunConfig{}, "# PRD: Shop", 3)
+	if err != nil {
+		t.Fatalf("Convert: %v", err)
+	}
+	if p.Project != "shop" || len(p.UserStories) != 1 {
+		t.Errorf("PRD = %+v", p)
+	}
+	if len(runner.prompts) != 1 || !strings.Contains(runner.prompts[0], "# PRD: Shop") {
+		t.Errorf("prompts = %q", runner.prompts)
+	}
+}
+
+func TestConvert_StringResponse(t *testing.T) {
+	quoted, _ := json.Marshal(validPRD)
+	runner := &mockJSONRunner{responses: []string{string(quoted)}}
+	if _, err := Convert(context.Background(), runner, claude.RunConfig{}, "md", 1); err != nil {
+		t.Fatalf("Convert: %v", err)
+	}
+}
+
+func TestConvert_Repairs(t *testing.T) {
+	runner := &mockJSONRunner{responses: []string{invalidPRD, validPRD}}
+	if _, err := Convert(context.Background(), runner, claude.RunConfig{}, "md", 3); err != nil {
+		t.Fatalf("Convert: %v", err)
+	}
+	if len(runner.prompts) != 2 {
+		t.Fatalf("got %d calls, want 2", len(runner.prompts))
+	}
+	for _, want := range []string{"$.userStories[0].estimate: unknown field", "$.userStories[0].priority", `"estimate": 3`} {
+		if !strings.Contains(runner.prompts[1], want) {
+			t.Errorf("repair prompt missing %q", want)
+		}
+	}
+}
+
+func TestConvert_GivesUp(t *testing.T) {
+	runner := &mockJSONRunner{responses: []string{`{"schemaVersion": 1, "userStories": []}`}}
+	_, err := Convert(context.Background(), runner, claude.RunConfig{}, "md", 2)
+	var invalid *InvalidError
+	if !errors.As(err, &invalid) || invalid.Attempts != 3 {
+		t.Fatalf("err = %v, want InvalidError after 3 attempts", err)
+	}
+	if len(runner.prompts) != 3 || invalid.Problems[0].Message != "no stories" {
+		t.Errorf("calls = %d, problems = %v", len(runner.prompts), invalid.Problems)
+	}
+}
+
+func TestConvert_CallFails(t *testing.T) {
+	runner := &mockJSONRunner{err: errors.New("claude failed")}
+	if _, err := Convert(context.Background(), runner, claude.RunConfig{}, "md", 3); err == nil || len(runner.prompts) != 1 {
+		t.Errorf("err = %v after %d calls, want the call's error without retrying", err, len(runner.prompts))
+	}
+}
+
+func TestConvert_NotJSON(t *testing.T) {
+	runner := &mockJSONRunner{responses: []string{`"not a PRD"`, validPRD}}
+	if _, err := Convert(context.Background(), runner, claude.RunConfig{}, "md", 2); err != nil {
+		t.Fatalf("Convert: %v", err)
+	}
+	if !strings.Contains(runner.prompts[1], "- $: ") {
+		t.Errorf("repair prompt does not report the parse error:\n%s", runner.prompts[1])
+	}
+}
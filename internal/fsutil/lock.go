@@ -0,0 +1,76 @@
+package fsutil
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ErrLocked is returned by Acquire when another process holds the lock.
+var ErrLocked = errors.New("lock is held by another process")
+
+// Lock is an exclusive advisory lock on a file. The lock is tied to the open
+// file, so the operating system releases it if the process dies.
+type Lock struct {
+	f *os.File
+}
+
+// Acquire takes the lock at path without blocking, creating the file and its
+// directory if needed, and records the current process ID in it. If another
+// process holds the lock, the returned error wraps ErrLocked and names that
+// process when known.
+func Acquire(path string) (*Lock, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFile(f); err != nil {
+		f.Close()
+		if errors.Is(err, ErrLocked) {
+			if pid := Holder(path); pid > 0 {
+				return nil, fmt.Errorf("%w (pid %d)", ErrLocked, pid)
+			}
+		}
+		return nil, err
+	}
+
+	if err := f.Truncate(0); err == nil {
+		f.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	}
+	return &Lock{f: f}, nil
+}
+
+// Release releases the lock. The file is left in place: removing it could let
+// a second process lock a fresh file while a third still holds the old one.
+func (l *Lock) Release() error {
+	l.f.Truncate(0)
+	return l.f.Close()
+}
+
+// Held reports whether another process currently holds the lock at path. It
+// briefly takes the lock itself if it is free.
+func Held(path string) bool {
+	l, err := Acquire(path)
+	if err != nil {
+		return errors.Is(err, ErrLocked)
+	}
+	l.Release()
+	return false
+}
+
+// Holder returns the process ID recorded in the lock file at path, or 0 if
+// none is recorded.
+func Holder(path string) int {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	pid, _ := strconv.Atoi(strings.TrimSpace(string(data)))
+	return pid
+}
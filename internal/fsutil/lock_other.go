@@ -0,0 +1,10 @@
+//go:build !unix
+
+package fsutil
+
+import "os"
+
+// lockFile is a no-op where flock is unavailable; locks always succeed.
+func lockFile(f *os.File) error {
+	return nil
+}
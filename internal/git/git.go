@@ -11,7 +11,14 @@ import (
 // run executes a git command and returns combined output. It returns an error
 // if the command exits non-zero.
 func run(args ...string) (string, error) {
+	return runIn("", args...)
+}
+
+// runIn is like run but executes git in dir; an empty dir means the current
+// directory.
+func runIn(dir string, args ...string) (string, error) {
 	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
 	out, err := cmd.CombinedOutput()
 	if err != nil {
 		return "", fmt.Errorf("git %s: %w\n%s", args[0], err, strings.TrimSpace(string(out)))
@@ -61,6 +68,75 @@ func WorktreeRemove(path string) error {
 	return nil
 }
 
+// Worktree is an entry of `git worktree list`.
+type Worktree struct {
+	Path   string
+	Branch string // short branch name; empty for a detached HEAD
+}
+
+// WorktreeList returns the worktrees of the repository, starting with the main
+// working tree.
+func WorktreeList() ([]Worktree, error) {
+	out, err := run("worktree", "list", "--porcelain")
+	if err != nil {
+		return nil, fmt.Errorf("worktree list: %w", err)
+	}
+	var wts []Worktree
+	for _, line := range strings.Split(out, "\n") {
+		switch {
+		case strings.HasPrefix(line, "worktree "):
+			wts = append(wts, Worktree{Path: strings.TrimPrefix(line, "worktree ")})
+		case strings.HasPrefix(line, "branch ") && len(wts) > 0:
+			wts[len(wts)-1].Branch = strings.TrimPrefix(line, "branch refs/heads/")
+		}
+	}
+	return wts, nil
+}
+
+// WorktreePrune removes administrative entries for worktrees whose directories
+// no longer exist.
+func WorktreePrune() error {
+	if _, err := run("worktree", "prune"); err != nil {
+		return fmt.Errorf("worktree prune: %w", err)
+	}
+	return nil
+}
+
+// ListBranches returns the local branches whose names match a glob pattern,
+// e.g. "worktree-*".
+func ListBranches(pattern string) ([]string, error) {
+	out, err := run("for-each-ref", "--format=%(refname:short)", "refs/heads/"+pattern)
+	if err != nil {
+		return nil, fmt.Errorf("list branches %q: %w", pattern, err)
+	}
+	if out == "" {
+		return nil, nil
+	}
+	return strings.Split(out, "\n"), nil
+}
+
+// ResolveCommit returns the full hash of the commit a revision names.
+func ResolveCommit(rev string) (string, error) {
+	out, err := run("rev-parse", "--verify", rev+"^{commit}")
+	if err != nil {
+		return "", fmt.Errorf("resolve %q: %w", rev, err)
+	}
+	return out, nil
+}
+
+// CloneAt clones the repository in the current directory to dir and checks out
+// commit with a detached HEAD. The clone shares the source's object store, so
+// it is cheap but must not outlive the source repository.
+func CloneAt(dir, commit string) error {
+	if _, err := run("clone", "--quiet", "--shared", "--no-checkout", ".", dir); err != nil {
+		return fmt.Errorf("clone to %q: %w", dir, err)
+	}
+	if _, err := runIn(dir, "checkout", "--quiet", "--detach", commit); err != nil {
+		return fmt.Errorf("checkout %s in %q: %w", commit, dir, err)
+	}
+	return nil
+}
+
 // MergeFrom merges the given branch into the currently checked-out branch.
 // Returns an error if merge conflicts occur.
 func MergeFrom(branch string) error {
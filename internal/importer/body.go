@@ -0,0 +1,52 @@
+package importer
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	// checklistItem matches a Markdown task list item: "- [ ] text".
+	checklistItem = regexp.MustCompile(`^\s*(?:[-*+]|\d+[.)])\s+\[[ xX]\]\s+(.+?)\s*$`)
+	// criteriaHeading matches a line introducing acceptance criteria, as a
+	// Markdown or Jira heading, in bold or followed by a colon.
+	criteriaHeading = regexp.MustCompile(`(?i)^\s*(?:#{1,6}\s*|h[1-6]\.\s*)?(?:\*{1,2}|_{1,2})?acceptance criteria(?:\*{1,2}|_{1,2})?\s*:?\s*(?:\*{1,2}|_{1,2})?\s*$`)
+	// listItem matches a bullet or numbered list item.
+	listItem = regexp.MustCompile(`^\s*(?:[-*+•]|\d+[.)])\s+(.+?)\s*$`)
+	// blankRuns matches the blank lines left where criteria were taken out.
+	blankRuns = regexp.MustCompile(`\n{3,}`)
+)
+
+// splitBody separates the acceptance criteria in an item's body from its
+// description. Criteria are checklist items anywhere in the body and the list
+// items under an "Acceptance criteria" heading; the description is the rest.
+func splitBody(body string) (description string, criteria []string) {
+	lines := strings.Split(strings.ReplaceAll(body, "\r\n", "\n"), "\n")
+	var kept []string
+	inSection := false
+	for _, line := range lines {
+		if m := checklistItem.FindStringSubmatch(line); m != nil {
+			criteria = append(criteria, m[1])
+			continue
+		}
+		if criteriaHeading.MatchString(line) {
+			inSection = true
+			continue
+		}
+		if inSection {
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			if m := listItem.FindStringSubmatch(line); m != nil {
+				criteria = append(criteria, m[1])
+				continue
+			}
+			// The section ends at the first line that is not a list item.
+			inSection = false
+			kept = append(kept, "")
+		}
+		kept = append(kept, line)
+	}
+	description = blankRuns.ReplaceAllString(strings.Join(kept, "\n"), "\n\n")
+	return strings.TrimSpace(description), criteria
+}
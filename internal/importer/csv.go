@@ -0,0 +1,142 @@
+package importer
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/radvoogh/ralph-wiggo/internal/prd"
+)
+
+// csvRow is a data row of a CSV file with the header's column names, which
+// are normalized to lower case with single spaces.
+type csvRow struct {
+	names  []string
+	values []string
+}
+
+// readCSV reads a CSV file whose first row names the columns.
+func readCSV(data []byte) ([]csvRow, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("no header row")
+	}
+
+	names := make([]string, len(records[0]))
+	for i, name := range records[0] {
+		name = strings.NewReplacer("_", " ", "-", " ").Replace(strings.ToLower(name))
+		names[i] = strings.Join(strings.Fields(name), " ")
+	}
+	rows := make([]csvRow, 0, len(records)-1)
+	for _, rec := range records[1:] {
+		if slices.IndexFunc(rec, func(v string) bool { return strings.TrimSpace(v) != "" }) < 0 {
+			continue // blank line
+		}
+		rows = append(rows, csvRow{names, rec})
+	}
+	return rows, nil
+}
+
+// all returns the non-empty values of every column with the given name.
+func (r csvRow) all(name string) []string {
+	var values []string
+	for i, n := range r.names {
+		if n == name && i < len(r.values) {
+			if v := strings.TrimSpace(r.values[i]); v != "" {
+				values = append(values, v)
+			}
+		}
+	}
+	return values
+}
+
+// first returns the first non-empty value of the columns with any of the
+// given names, or "".
+func (r csvRow) first(names ...string) string {
+	for _, name := range names {
+		if values := r.all(name); len(values) > 0 {
+			return values[0]
+		}
+	}
+	return ""
+}
+
+// columns returns the distinct column names in order.
+func (r csvRow) columns() []string {
+	var names []string
+	for _, n := range r.names {
+		if !slices.Contains(names, n) {
+			names = append(names, n)
+		}
+	}
+	return names
+}
+
+// parseCSV reads a plain CSV file with a title column and optional id,
+// description, acceptance criteria (one per line or separated by
+// semicolons), tags (comma-separated), notes, url and status or passes
+// columns. Column names are case-insensitive and may use "_" or "-" for
+// spaces; summary, body, criteria and labels work as well.
+func parseCSV(data []byte) ([]prd.UserStory, error) {
+	rows, err := readCSV(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var stories []prd.UserStory
+	for i, row := range rows {
+		title := row.first("title", "summary")
+		if title == "" {
+			return nil, fmt.Errorf("row %d has no title", i+2)
+		}
+		it := item{
+			title:    title,
+			body:     row.first("description", "body"),
+			criteria: splitList(row.first("acceptance criteria", "criteria"), "\n;"),
+			done:     csvDone(row.first("passes"), row.first("status")),
+		}
+		for _, col := range []string{"tags", "labels"} {
+			for _, v := range row.all(col) {
+				it.tags = append(it.tags, splitList(v, ",")...)
+			}
+		}
+		if key := row.first("id", "key"); key != "" {
+			it.source = &prd.Source{Tracker: "csv", Key: key, URL: row.first("url")}
+		}
+		s := it.story()
+		if notes := row.first("notes"); notes != "" {
+			s.Notes = strings.TrimSpace(s.Notes + " " + notes)
+		}
+		stories = append(stories, s)
+	}
+	return stories, nil
+}
+
+// splitList splits a cell at any of the separator characters, dropping
+// empty items.
+func splitList(cell, seps string) []string {
+	var items []string
+	for _, v := range strings.FieldsFunc(cell, func(r rune) bool { return strings.ContainsRune(seps, r) }) {
+		if v = strings.TrimSpace(v); v != "" {
+			items = append(items, v)
+		}
+	}
+	return items
+}
+
+// csvDone reports whether a plain CSV row is marked as done.
+func csvDone(passes, status string) bool {
+	switch strings.ToLower(passes) {
+	case "true", "yes", "1", "x":
+		return true
+	}
+	return statusDone("", status)
+}
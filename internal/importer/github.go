@@ -0,0 +1,49 @@
+package importer
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/radvoogh/ralph-wiggo/internal/prd"
+)
+
+// githubIssue is an issue as listed by
+// `gh issue list --json number,title,body,labels,url,state`.
+type githubIssue struct {
+	Number int    `json:"number"`
+	Title  string `json:"title"`
+	Body   string `json:"body"`
+	URL    string `json:"url"`
+	State  string `json:"state"` // OPEN or CLOSED
+	Labels []struct {
+		Name string `json:"name"`
+	} `json:"labels"`
+}
+
+// parseGitHub reads a JSON array of GitHub issues.
+func parseGitHub(data []byte) ([]prd.UserStory, error) {
+	var issues []githubIssue
+	if err := json.Unmarshal(data, &issues); err != nil {
+		return nil, err
+	}
+
+	stories := make([]prd.UserStory, 0, len(issues))
+	for i, issue := range issues {
+		if issue.Number == 0 || strings.TrimSpace(issue.Title) == "" {
+			return nil, fmt.Errorf("issue %d has no number or title; include number and title in --json", i+1)
+		}
+		it := item{
+			title:  issue.Title,
+			body:   issue.Body,
+			source: &prd.Source{Tracker: "github", Key: strconv.Itoa(issue.Number), URL: issue.URL},
+			done:   strings.EqualFold(issue.State, "closed"),
+		}
+		for _, l := range issue.Labels {
+			it.tags = append(it.tags, l.Name)
+		}
+		stories = append(stories, it.story())
+	}
+	return stories, nil
+}
@@ -0,0 +1,155 @@
+// Package importer turns issue-tracker exports into PRD stories: GitHub issues
+// as listed by `gh issue list --json`, Jira JSON and CSV exports, and plain
+// CSV. Each story records the item it came from (see prd.Source), so imports
+// can be repeated and status reported back.
+package importer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/radvoogh/ralph-wiggo/internal/prd"
+)
+
+// Format is the kind of export a file holds.
+type Format string
+
+const (
+	FormatAuto   Format = "auto" // detect from the file name and contents
+	FormatGitHub Format = "github"
+	FormatJira   Format = "jira" // JSON or CSV
+	FormatCSV    Format = "csv"
+)
+
+// Parse reads the stories in an export. name is the export's file name, used
+// with the contents to detect the format and to tell JSON from CSV. The
+// stories have no IDs or priorities yet; Merge assigns them.
+func Parse(name string, data []byte, f Format) ([]prd.UserStory, error) {
+	data = bytes.TrimPrefix(data, []byte("\uFEFF")) // spreadsheet exports often start with a BOM
+	isJSON := looksLikeJSON(name, data)
+	if f == FormatAuto || f == "" {
+		f = detect(data, isJSON)
+	}
+
+	var stories []prd.UserStory
+	var err error
+	switch {
+	case f == FormatGitHub && isJSON:
+		stories, err = parseGitHub(data)
+	case f == FormatJira && isJSON:
+		stories, err = parseJiraJSON(data)
+	case f == FormatJira:
+		stories, err = parseJiraCSV(data)
+	case f == FormatCSV && !isJSON:
+		stories, err = parseCSV(data)
+	default:
+		return nil, fmt.Errorf("%s is not a %s export", name, f)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s export: %w", f, err)
+	}
+	return stories, nil
+}
+
+// looksLikeJSON reports whether an export is JSON rather than CSV.
+func looksLikeJSON(name string, data []byte) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".json":
+		return true
+	case ".csv":
+		return false
+	}
+	trimmed := bytes.TrimSpace(data)
+	return len(trimmed) > 0 && (trimmed[0] == '[' || trimmed[0] == '{')
+}
+
+// detect guesses the format of an export: GitHub issue lists are JSON arrays
+// of objects with a number, Jira JSON has issue keys, and Jira CSV has an
+// "Issue key" column.
+func detect(data []byte, isJSON bool) Format {
+	if !isJSON {
+		header, _, _ := bytes.Cut(data, []byte("\n"))
+		if bytes.Contains(bytes.ToLower(header), []byte("issue key")) {
+			return FormatJira
+		}
+		return FormatCSV
+	}
+	var probe []struct {
+		Number *int   `json:"number"`
+		Key    string `json:"key"`
+	}
+	if json.Unmarshal(data, &probe) == nil && len(probe) > 0 && probe[0].Number != nil {
+		return FormatGitHub
+	}
+	return FormatJira
+}
+
+// Merge appends stories to the PRD in order, after its existing stories, with
+// the next free IDs. Stories whose source is already in the PRD are left out,
+// so importing a newer export adds only the new items. It returns the IDs of
+// the added stories and the source keys of the skipped ones.
+func Merge(p *prd.PRD, stories []prd.UserStory) (added, skipped []string, err error) {
+	for _, s := range stories {
+		if s.Source != nil && hasSource(p, s.Source) {
+			skipped = append(skipped, s.Source.Key)
+			continue
+		}
+		s.ID = prd.NextStoryID(p)
+		s.Priority = 0 // append
+		if s.AcceptanceCriteria == nil {
+			s.AcceptanceCriteria = []string{}
+		}
+		if err := prd.AddStory(p, s); err != nil {
+			return nil, nil, err
+		}
+		added = append(added, s.ID)
+	}
+	return added, skipped, nil
+}
+
+// hasSource reports whether a story of the PRD was imported from src.
+func hasSource(p *prd.PRD, src *prd.Source) bool {
+	for _, s := range p.UserStories {
+		if s.Source != nil && s.Source.Tracker == src.Tracker && s.Source.Key == src.Key {
+			return true
+		}
+	}
+	return false
+}
+
+// An item is an issue-tracker item as read from an export.
+type item struct {
+	title    string
+	body     string
+	criteria []string // given explicitly, e.g. by a CSV column
+	tags     []string
+	links    []string // related items, e.g. "blocks PROJ-2"
+	source   *prd.Source
+	done     bool
+}
+
+// story maps the item to a story. Checklist items and the items of an
+// "Acceptance criteria" section in the body become acceptance criteria,
+// after those given explicitly, and the item's URL and links go in the notes.
+func (it item) story() prd.UserStory {
+	description, listed := splitBody(it.body)
+	var notes []string
+	if it.source != nil && it.source.URL != "" {
+		notes = append(notes, "Imported from "+it.source.URL+".")
+	}
+	if len(it.links) > 0 {
+		notes = append(notes, "Links: "+strings.Join(it.links, "; ")+".")
+	}
+	return prd.UserStory{
+		Title:              strings.TrimSpace(it.title),
+		Description:        description,
+		AcceptanceCriteria: append(it.criteria, listed...),
+		Passes:             it.done,
+		Notes:              strings.Join(notes, " "),
+		Tags:               it.tags,
+		Source:             it.source,
+	}
+}
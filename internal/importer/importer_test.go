@@ -0,0 +1,194 @@
+package importer
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/radvoogh/ralph-wiggo/internal/prd"
+)
+
+func TestSplitBody(t *testing.T) {
+	body := "Users need to log out.\r\n\r\n" +
+		"## Acceptance criteria\n" +
+		"- Button in header\n" +
+		"1. Session is cleared\n\n" +
+		"Design: see Figma.\n" +
+		"- [ ] go vet ./... passes\n" +
+		"- [x] Tests pass\n"
+	desc, criteria := splitBody(body)
+	if want := "Users need to log out.\n\nDesign: see Figma."; desc != want {
+		t.Errorf("description = %q, want %q", desc, want)
+	}
+	want := []string{"Button in header", "Session is cleared", "go vet ./... passes", "Tests pass"}
+	if !slices.Equal(criteria, want) {
+		t.Errorf("criteria = %q, want %q", criteria, want)
+	}
+}
+
+func TestSplitBody_JiraHeading(t *testing.T) {
+	desc, criteria := splitBody("Intro\nh3. Acceptance Criteria:\n* One\n* Two")
+	if desc != "Intro" || !slices.Equal(criteria, []string{"One", "Two"}) {
+		t.Errorf("splitBody = %q, %q", desc, criteria)
+	}
+}
+
+func TestParseGitHub(t *testing.T) {
+	data := `[
+  {"number": 42, "title": "Add logout", "state": "OPEN", "url": "https://github.com/o/r/issues/42",
+   "body": "Log out from the header.\n\n- [ ] Button in header", "labels": [{"name": "ui"}, {"name": "auth"}]},
+  {"number": 7, "title": "Fix login", "state": "CLOSED", "url": "https://github.com/o/r/issues/7", "body": "", "labels": []}
+]`
+	stories, err := Parse("issues.json", []byte(data), FormatAuto)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	want := []prd.UserStory{
+		{
+			Title:              "Add logout",
+			Description:        "Log out from the header.",
+			AcceptanceCriteria: []string{"Button in header"},
+			Notes:              "Imported from https://github.com/o/r/issues/42.",
+			Tags:               []string{"ui", "auth"},
+			Source:             &prd.Source{Tracker: "github", Key: "42", URL: "https://github.com/o/r/issues/42"},
+		},
+		{
+			Title:  "Fix login",
+			Passes: true,
+			Notes:  "Imported from https://github.com/o/r/issues/7.",
+			Source: &prd.Source{Tracker: "github", Key: "7", URL: "https://github.com/o/r/issues/7"},
+		},
+	}
+	if !reflect.DeepEqual(stories, want) {
+		t.Errorf("Parse = %+v\nwant %+v", stories, want)
+	}
+}
+
+func TestParseJiraJSON(t *testing.T) {
+	data := `{"issues": [
+  {"key": "PROJ-1", "self": "https://acme.atlassian.net/rest/api/2/issue/10001",
+   "fields": {"summary": "Export orders", "labels": ["backend"],
+     "description": "Export as CSV.\nh3. Acceptance criteria\n* File downloads",
+     "status": {"name": "In Progress", "statusCategory": {"key": "indeterminate"}},
+     "issuelinks": [{"type": {"inward": "is blocked by", "outward": "blocks"}, "outwardIssue": {"key": "PROJ-2"}}]}},
+  {"key": "PROJ-2", "self": "https://acme.atlassian.net/rest/api/3/issue/10002",
+   "fields": {"summary": "Import orders", "status": {"name": "Done", "statusCategory": {"key": "done"}},
+     "description": {"type": "doc", "content": [
+       {"type": "paragraph", "content": [{"type": "text", "text": "Import from CSV."}]},
+       {"type": "taskList", "content": [
+         {"type": "taskItem", "attrs": {"state": "TODO"}, "content": [{"type": "text", "text": "Rows are validated"}]}]},
+       {"type": "bulletList", "content": [
+         {"type": "listItem", "content": [{"type": "paragraph", "content": [{"type": "text", "text": "Not a criterion"}]}]}]}]},
+     "issuelinks": [{"type": {"inward": "is blocked by", "outward": "blocks"}, "inwardIssue": {"key": "PROJ-1"}}]}}
+]}`
+	stories, err := Parse("export.json", []byte(data), FormatAuto)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if len(stories) != 2 {
+		t.Fatalf("got %d stories, want 2", len(stories))
+	}
+	first, second := stories[0], stories[1]
+	if first.Description != "Export as CSV." || !slices.Equal(first.AcceptanceCriteria, []string{"File downloads"}) {
+		t.Errorf("first = %q, %q", first.Description, first.AcceptanceCriteria)
+	}
+	if want := "Imported from https://acme.atlassian.net/browse/PROJ-1. Links: blocks PROJ-2."; first.Notes != want {
+		t.Errorf("first notes = %q, want %q", first.Notes, want)
+	}
+	if first.Passes || !second.Passes {
+		t.Errorf("passes = %v, %v; want false, true", first.Passes, second.Passes)
+	}
+	if second.Description != "Import from CSV.\n\n- Not a criterion" || !slices.Equal(second.AcceptanceCriteria, []string{"Rows are validated"}) {
+		t.Errorf("second = %q, %q", second.Description, second.AcceptanceCriteria)
+	}
+	if *second.Source != (prd.Source{Tracker: "jira", Key: "PROJ-2", URL: "https://acme.atlassian.net/browse/PROJ-2"}) {
+		t.Errorf("second source = %+v", second.Source)
+	}
+}
+
+func TestParseJiraCSV(t *testing.T) {
+	data := "\uFEFFSummary,Issue key,Status,Description,Labels,Labels,Outward issue link (Blocks),Inward issue link (Blocks)\n" +
+		"Export orders,PROJ-1,Done,\"Export.\n- [ ] File downloads\",backend,api,PROJ-2,PROJ-9\n"
+	stories, err := Parse("jira.csv", []byte(data), FormatAuto)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	want := []prd.UserStory{{
+		Title:              "Export orders",
+		Description:        "Export.",
+		AcceptanceCriteria: []string{"File downloads"},
+		Passes:             true,
+		Notes:              "Links: blocks PROJ-2; PROJ-9 blocks this.",
+		Tags:               []string{"backend", "api"},
+		Source:             &prd.Source{Tracker: "jira", Key: "PROJ-1"},
+	}}
+	if !reflect.DeepEqual(stories, want) {
+		t.Errorf("Parse = %+v\nwant %+v", stories, want)
+	}
+}
+
+func TestParseCSV(t *testing.T) {
+	data := "ID,Title,Description,Acceptance_Criteria,Tags,Notes\n" +
+		"T-1,Add search,Search orders,\"Box on page; go vet ./... passes\",\"ui, search\",Use the index\n" +
+		",Untracked,,,,\n"
+	stories, err := Parse("backlog.csv", []byte(data), FormatAuto)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	want := []prd.UserStory{
+		{
+			Title:              "Add search",
+			Description:        "Search orders",
+			AcceptanceCriteria: []string{"Box on page", "go vet ./... passes"},
+			Notes:              "Use the index",
+			Tags:               []string{"ui", "search"},
+			Source:             &prd.Source{Tracker: "csv", Key: "T-1"},
+		},
+		{Title: "Untracked"},
+	}
+	if !reflect.DeepEqual(stories, want) {
+		t.Errorf("Parse = %+v\nwant %+v", stories, want)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name, file, data string
+		format           Format
+	}{
+		{"csv as github", "x.csv", "title\nA\n", FormatGitHub},
+		{"json as csv", "x.json", "[]", FormatCSV},
+		{"github without title", "x.json", `[{"number": 1}]`, FormatAuto},
+		{"csv without title", "x.csv", "title,notes\n,n\n", FormatAuto},
+		{"invalid json", "x.json", `{"issues": 3}`, FormatJira},
+	}
+	for _, tt := range tests {
+		if _, err := Parse(tt.file, []byte(tt.data), tt.format); err == nil {
+			t.Errorf("%s: Parse succeeded", tt.name)
+		}
+	}
+}
+
+func TestMerge(t *testing.T) {
+	p := &prd.PRD{UserStories: []prd.UserStory{
+		{ID: "US-001", Title: "Existing", Priority: 1, Source: &prd.Source{Tracker: "github", Key: "7"}},
+	}}
+	stories := []prd.UserStory{
+		{Title: "Fix login", Source: &prd.Source{Tracker: "github", Key: "7"}},
+		{Title: "Add logout", Source: &prd.Source{Tracker: "github", Key: "42"}},
+		{Title: "Untracked"},
+	}
+	added, skipped, err := Merge(p, stories)
+	if err != nil {
+		t.Fatalf("Merge: %v", err)
+	}
+	if !slices.Equal(added, []string{"US-002", "US-003"}) || !slices.Equal(skipped, []string{"7"}) {
+		t.Errorf("Merge = %v, %v", added, skipped)
+	}
+	if err := prd.Validate(p); err != nil {
+		t.Errorf("merged PRD is invalid: %v", err)
+	}
+	if s := prd.FindStory(p, "US-002"); s == nil || s.Title != "Add logout" || s.Priority != 2 || s.AcceptanceCriteria == nil {
+		t.Errorf("US-002 = %+v", s)
+	}
+}
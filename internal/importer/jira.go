@@ -0,0 +1,203 @@
+package importer
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/radvoogh/ralph-wiggo/internal/prd"
+)
+
+// jiraIssue is an issue in a Jira REST API search result.
+type jiraIssue struct {
+	Key    string `json:"key"`
+	Self   string `json:"self"` // API URL of the issue
+	Fields struct {
+		Summary     string          `json:"summary"`
+		Description json.RawMessage `json:"description"` // wiki text (API v2) or a document (API v3)
+		Labels      []string        `json:"labels"`
+		Status      struct {
+			Name           string `json:"name"`
+			StatusCategory struct {
+				Key string `json:"key"` // "new", "indeterminate" or "done"
+			} `json:"statusCategory"`
+		} `json:"status"`
+		IssueLinks []struct {
+			Type struct {
+				Inward  string `json:"inward"`
+				Outward string `json:"outward"`
+			} `json:"type"`
+			InwardIssue  *struct{ Key string } `json:"inwardIssue"`
+			OutwardIssue *struct{ Key string } `json:"outwardIssue"`
+		} `json:"issuelinks"`
+	} `json:"fields"`
+}
+
+// parseJiraJSON reads a Jira search result, {"issues": [...]}, or a bare
+// array of issues.
+func parseJiraJSON(data []byte) ([]prd.UserStory, error) {
+	var issues []jiraIssue
+	if err := json.Unmarshal(data, &issues); err != nil {
+		var result struct {
+			Issues []jiraIssue `json:"issues"`
+		}
+		if err := json.Unmarshal(data, &result); err != nil {
+			return nil, err
+		}
+		issues = result.Issues
+	}
+
+	stories := make([]prd.UserStory, 0, len(issues))
+	for i, issue := range issues {
+		if issue.Key == "" || strings.TrimSpace(issue.Fields.Summary) == "" {
+			return nil, fmt.Errorf("issue %d has no key or summary", i+1)
+		}
+		it := item{
+			title:  issue.Fields.Summary,
+			body:   jiraDescription(issue.Fields.Description),
+			tags:   issue.Fields.Labels,
+			source: &prd.Source{Tracker: "jira", Key: issue.Key, URL: browseURL(issue.Self, issue.Key)},
+			done:   statusDone(issue.Fields.Status.StatusCategory.Key, issue.Fields.Status.Name),
+		}
+		for _, l := range issue.Fields.IssueLinks {
+			if l.OutwardIssue != nil {
+				it.links = append(it.links, l.Type.Outward+" "+l.OutwardIssue.Key)
+			}
+			if l.InwardIssue != nil {
+				it.links = append(it.links, l.Type.Inward+" "+l.InwardIssue.Key)
+			}
+		}
+		stories = append(stories, it.story())
+	}
+	return stories, nil
+}
+
+// jiraDescription returns an issue description as text. API v3 returns
+// descriptions as Atlassian documents, which are flattened to Markdown-like
+// text so their checklists and lists read like those of other trackers.
+func jiraDescription(raw json.RawMessage) string {
+	var text string
+	if json.Unmarshal(raw, &text) == nil {
+		return text
+	}
+	var doc adfNode
+	if json.Unmarshal(raw, &doc) != nil {
+		return ""
+	}
+	var sb strings.Builder
+	doc.write(&sb)
+	return sb.String()
+}
+
+// adfNode is a node of an Atlassian document.
+type adfNode struct {
+	Type    string    `json:"type"`
+	Text    string    `json:"text"`
+	Content []adfNode `json:"content"`
+	Attrs   struct {
+		State string `json:"state"` // of a taskItem: TODO or DONE
+	} `json:"attrs"`
+}
+
+// write appends the node to sb as text: paragraphs separated by blank lines
+// and list items on lines of their own.
+func (n adfNode) write(sb *strings.Builder) {
+	switch n.Type {
+	case "text":
+		sb.WriteString(n.Text)
+	case "hardBreak":
+		sb.WriteString("\n")
+	case "paragraph", "heading":
+		for _, c := range n.Content {
+			c.write(sb)
+		}
+		sb.WriteString("\n\n")
+	case "listItem":
+		sb.WriteString("- " + n.plain() + "\n")
+	case "taskItem":
+		box := "[ ]"
+		if n.Attrs.State == "DONE" {
+			box = "[x]"
+		}
+		sb.WriteString("- " + box + " " + n.plain() + "\n")
+	default:
+		for _, c := range n.Content {
+			c.write(sb)
+		}
+	}
+}
+
+// plain returns the text of the node on one line.
+func (n adfNode) plain() string {
+	if n.Type == "text" {
+		return n.Text
+	}
+	var parts []string
+	for _, c := range n.Content {
+		if t := c.plain(); t != "" {
+			parts = append(parts, t)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// browseURL derives an issue's web URL from its API URL.
+func browseURL(self, key string) string {
+	u, err := url.Parse(self)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	return u.Scheme + "://" + u.Host + "/browse/" + key
+}
+
+// jiraDone reports whether a Jira status counts as done.
+func statusDone(category, status string) bool {
+	if category != "" {
+		return strings.EqualFold(category, "done")
+	}
+	switch strings.ToLower(status) {
+	case "done", "closed", "resolved":
+		return true
+	}
+	return false
+}
+
+// parseJiraCSV reads a Jira CSV export. Jira repeats a column for each value
+// of multi-valued fields such as labels and issue links.
+func parseJiraCSV(data []byte) ([]prd.UserStory, error) {
+	rows, err := readCSV(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var stories []prd.UserStory
+	for i, row := range rows {
+		key, title := row.first("issue key"), row.first("summary")
+		if key == "" || title == "" {
+			return nil, fmt.Errorf("row %d has no issue key or summary", i+2)
+		}
+		it := item{
+			title:  title,
+			body:   row.first("description"),
+			tags:   row.all("labels"),
+			source: &prd.Source{Tracker: "jira", Key: key},
+			done:   statusDone(row.first("status category"), row.first("status")),
+		}
+		for _, col := range row.columns() {
+			// Link columns are named e.g. "Outward issue link (Blocks)".
+			if kind, ok := strings.CutPrefix(col, "outward issue link ("); ok {
+				for _, linked := range row.all(col) {
+					it.links = append(it.links, strings.TrimSuffix(kind, ")")+" "+linked)
+				}
+			}
+			if kind, ok := strings.CutPrefix(col, "inward issue link ("); ok {
+				for _, linked := range row.all(col) {
+					it.links = append(it.links, linked+" "+strings.TrimSuffix(kind, ")")+" this")
+				}
+			}
+		}
+		stories = append(stories, it.story())
+	}
+	return stories, nil
+}
@@ -0,0 +1,117 @@
+// Package lint checks PRD stories for the problems that keep agents iterating
+// until they give up: too much work in one story, criteria an agent cannot
+// verify, and no build or test step to tell it when it is done.
+package lint
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/radvoogh/ralph-wiggo/internal/prd"
+)
+
+// Rule names a lint check.
+type Rule string
+
+const (
+	RuleTooManyCriteria  Rule = "too-many-criteria"
+	RuleVagueCriterion   Rule = "vague-criterion"
+	RuleNoCheckCriterion Rule = "no-check-criterion"
+	RuleLongDescription  Rule = "long-description"
+	RuleDuplicateTitle   Rule = "duplicate-title"
+	RuleReview           Rule = "review" // flagged by Review
+)
+
+// A Finding is a problem with one story.
+type Finding struct {
+	StoryID string
+	Rule    Rule
+	Message string
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("%s [%s] %s", f.StoryID, f.Rule, f.Message)
+}
+
+// Options are the limits Lint checks stories against.
+type Options struct {
+	MaxCriteria    int // acceptance criteria per story
+	MaxDescription int // characters in a story's description
+}
+
+// DefaultOptions are the limits used unless the caller sets its own. A story
+// that needs more is usually more than one agent session of work.
+var DefaultOptions = Options{MaxCriteria: 8, MaxDescription: 800}
+
+// vaguePatterns match wording an agent cannot check, as in the converter
+// skill's examples of bad criteria.
+var vaguePatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)\bworks? (well|correctly|properly|as expected|fine)\b`),
+	regexp.MustCompile(`(?i)\b(is|are|be|feels?) (fast|quick|responsive|performant|intuitive|user[- ]friendly|clean|robust|smooth|seamless|nice|good)\b`),
+	regexp.MustCompile(`(?i)\b(easily|intuitively|seamlessly|gracefully|appropriately|properly|reasonably|efficiently)\b`),
+	regexp.MustCompile(`(?i)\b(good|great|better|nice) (ux|ui|experience|performance)\b`),
+	regexp.MustCompile(`(?i)\bhandles? (all )?edge cases\b`),
+	regexp.MustCompile(`(?i)\b(etc\.?|and so on)$`),
+}
+
+// checkPattern matches criteria that run a typecheck, build, linter or tests.
+var checkPattern = regexp.MustCompile(`(?i)\b(type-?check\w*|type check\w*|tests?|vet|build|builds|compiles?|lint\w*)\b`)
+
+// Lint checks every story of the PRD and returns the findings in story order.
+// Zero fields in opts use DefaultOptions.
+func Lint(p *prd.PRD, opts Options) []Finding {
+	if opts.MaxCriteria <= 0 {
+		opts.MaxCriteria = DefaultOptions.MaxCriteria
+	}
+	if opts.MaxDescription <= 0 {
+		opts.MaxDescription = DefaultOptions.MaxDescription
+	}
+
+	titles := make(map[string]string, len(p.UserStories))
+	var findings []Finding
+	for _, s := range p.UserStories {
+		add := func(rule Rule, format string, args ...any) {
+			findings = append(findings, Finding{s.ID, rule, fmt.Sprintf(format, args...)})
+		}
+
+		if n := len(s.AcceptanceCriteria); n > opts.MaxCriteria {
+			add(RuleTooManyCriteria, "%d acceptance criteria (more than %d); consider splitting the story", n, opts.MaxCriteria)
+		}
+		hasCheck := false
+		for _, ac := range s.AcceptanceCriteria {
+			switch phrase := vaguePhrase(ac); {
+			case phrase == "":
+			case strings.EqualFold(phrase, strings.TrimSpace(ac)):
+				add(RuleVagueCriterion, "%q is not verifiable", ac)
+			default:
+				add(RuleVagueCriterion, "%q is not verifiable (%q)", ac, phrase)
+			}
+			hasCheck = hasCheck || checkPattern.MatchString(ac)
+		}
+		if !hasCheck {
+			add(RuleNoCheckCriterion, "no criterion runs a typecheck, build or tests")
+		}
+		if n := len([]rune(s.Description)); n > opts.MaxDescription {
+			add(RuleLongDescription, "description is %d characters (more than %d); the story is likely too large", n, opts.MaxDescription)
+		}
+
+		key := strings.ToLower(strings.Join(strings.Fields(s.Title), " "))
+		if first, ok := titles[key]; ok && key != "" {
+			add(RuleDuplicateTitle, "same title as %s", first)
+		} else {
+			titles[key] = s.ID
+		}
+	}
+	return findings
+}
+
+// vaguePhrase returns the first vague phrase in criterion, or "".
+func vaguePhrase(criterion string) string {
+	for _, re := range vaguePatterns {
+		if m := re.FindString(criterion); m != "" {
+			return m
+		}
+	}
+	return ""
+}
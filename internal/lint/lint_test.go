@@ -0,0 +1,125 @@
+package lint
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/radvoogh/ralph-wiggo/internal/claude"
+	"github.com/radvoogh/ralph-wiggo/internal/prd"
+)
+
+func testPRD() *prd.PRD {
+	return &prd.PRD{Project: "shop", UserStories: []prd.UserStory{
+		{ID: "US-001", Title: "Add orders table", Description: "As a dev, I need orders.", Priority: 1,
+			AcceptanceCriteria: []string{"Migration creates orders table", "go vet ./... passes"}},
+		{ID: "US-002", Title: "Checkout page", Description: "As a user, I want to pay.", Priority: 2,
+			AcceptanceCriteria: []string{"Checkout works well", "Page is fast"}},
+		{ID: "US-003", Title: "checkout  Page", Description: strings.Repeat("x", 801), Priority: 3,
+			AcceptanceCriteria: []string{"a", "b", "c", "d", "e", "f", "g", "h", "Tests pass"}},
+	}}
+}
+
+func rules(findings []Finding) []string {
+	var out []string
+	for _, f := range findings {
+		out = append(out, f.StoryID+" "+string(f.Rule))
+	}
+	return out
+}
+
+func TestLint(t *testing.T) {
+	got := rules(Lint(testPRD(), Options{}))
+	want := []string{
+		"US-002 vague-criterion",
+		"US-002 vague-criterion",
+		"US-002 no-check-criterion",
+		"US-003 too-many-criteria",
+		"US-003 long-description",
+		"US-003 duplicate-title",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("Lint = %q, want %q", got, want)
+	}
+}
+
+func TestLintOptions(t *testing.T) {
+	got := rules(Lint(testPRD(), Options{MaxCriteria: 20, MaxDescription: 1000}))
+	if slices.Contains(got, "US-003 too-many-criteria") || slices.Contains(got, "US-003 long-description") {
+		t.Errorf("Lint with raised limits = %q", got)
+	}
+}
+
+func TestVaguePhrase(t *testing.T) {
+	tests := []struct {
+		criterion string
+		want      string
+	}{
+		{"Works correctly", "Works correctly"},
+		{"User can do X easily", "easily"},
+		{"Good UX", "Good UX"},
+		{"Handles edge cases", "Handles edge cases"},
+		{"Search is fast", "is fast"},
+		{"Filter dropdown has options: All, Active, Completed", ""},
+		{"Clicking delete shows confirmation dialog", ""},
+		{"go build ./... succeeds", ""},
+	}
+	for _, tt := range tests {
+		if got := vaguePhrase(tt.criterion); got != tt.want {
+			t.Errorf("vaguePhrase(%q) = %q, want %q", tt.criterion, got, tt.want)
+		}
+	}
+}
+
+// mockJSONRunner implements JSONRunner, recording the prompt it was sent.
+type mockJSONRunner struct {
+	response json.RawMessage
+	err      error
+	prompt   string
+}
+
+func (m *mockJSONRunner) RunJSON(_ context.Context, cfg claude.RunConfig, _ string) (json.RawMessage, error) {
+	m.prompt = cfg.Prompt
+	return m.response, m.err
+}
+
+func TestReview(t *testing.T) {
+	runner := &mockJSONRunner{response: json.RawMessage(`{"stories":[
+		{"id":"US-002","size":4,"testability":2,"comment":"Name the payment provider."},
+		{"id":"US-001","size":1,"testability":5,"comment":""},
+		{"id":"US-009","size":1,"testability":5,"comment":""}]}`)}
+
+	scores, err := Review(context.Background(), runner, claude.RunConfig{}, testPRD())
+	if err != nil {
+		t.Fatalf("Review: %v", err)
+	}
+	if len(scores) != 2 || scores[0].StoryID != "US-001" || scores[1].StoryID != "US-002" {
+		t.Fatalf("scores = %+v, want US-001 and US-002 in story order", scores)
+	}
+	if scores[0].Flagged() || !scores[1].Flagged() {
+		t.Errorf("Flagged = %v, %v; want false, true", scores[0].Flagged(), scores[1].Flagged())
+	}
+	if got := scores[1].Finding().String(); got != "US-002 [review] size 4/5, testability 2/5: Name the payment provider." {
+		t.Errorf("Finding = %q", got)
+	}
+	for _, want := range []string{"### US-002: Checkout page", "- Page is fast"} {
+		if !strings.Contains(runner.prompt, want) {
+			t.Errorf("prompt missing %q", want)
+		}
+	}
+}
+
+func TestReviewErrors(t *testing.T) {
+	for name, runner := range map[string]*mockJSONRunner{
+		"call fails":   {err: errors.New("claude failed")},
+		"invalid JSON": {response: json.RawMessage(`not json`)},
+		"out of range": {response: json.RawMessage(`{"stories":[{"id":"US-001","size":9,"testability":1}]}`)},
+	} {
+		if _, err := Review(context.Background(), runner, claude.RunConfig{}, testPRD()); err == nil {
+			t.Errorf("%s: Review succeeded", name)
+		}
+	}
+}
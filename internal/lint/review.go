@@ -0,0 +1,118 @@
+package lint
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/radvoogh/ralph-wiggo/internal/claude"
+	"github.com/radvoogh/ralph-wiggo/internal/prd"
+)
+
+// JSONRunner is the interface required to invoke Claude for a review. It is
+// satisfied by *claude.Executor.
+type JSONRunner interface {
+	RunJSON(ctx context.Context, cfg claude.RunConfig, jsonSchema string) (json.RawMessage, error)
+}
+
+// reviewSchema is the JSON schema for the review response.
+const reviewSchema = `{
+  "type": "object",
+  "required": ["stories"],
+  "properties": {
+    "stories": {
+      "type": "array",
+      "items": {
+        "type": "object",
+        "required": ["id", "size", "testability", "comment"],
+        "properties": {
+          "id": { "type": "string" },
+          "size": { "type": "integer", "minimum": 1, "maximum": 5, "description": "1: a few lines of change; 3: a full agent session; 5: several sessions" },
+          "testability": { "type": "integer", "minimum": 1, "maximum": 5, "description": "1: no criterion can be checked; 5: every criterion can be checked by running a command or reading the code" },
+          "comment": { "type": "string", "description": "One sentence on what to change, or empty if nothing" }
+        }
+      }
+    }
+  }
+}`
+
+// A Score is Claude's assessment of one story, on scales of 1 to 5.
+type Score struct {
+	StoryID     string `json:"id"`
+	Size        int    `json:"size"`        // 5 is too large for one session
+	Testability int    `json:"testability"` // 1 is not verifiable
+	Comment     string `json:"comment"`
+}
+
+// Flagged reports whether the story should be reworked before a run: it is
+// larger than one session of work, or its criteria are mostly unverifiable.
+func (s Score) Flagged() bool {
+	return s.Size >= 4 || s.Testability <= 2
+}
+
+// Finding returns the score as a finding, for flagged scores.
+func (s Score) Finding() Finding {
+	msg := fmt.Sprintf("size %d/5, testability %d/5", s.Size, s.Testability)
+	if s.Comment != "" {
+		msg += ": " + s.Comment
+	}
+	return Finding{s.StoryID, RuleReview, msg}
+}
+
+// reviewResponse is the parsed response from Claude.
+type reviewResponse struct {
+	Stories []Score `json:"stories"`
+}
+
+// Review asks Claude to score the size and testability of every story in the
+// PRD. Scores are returned in story order; stories Claude did not score are
+// left out.
+func Review(ctx context.Context, exec JSONRunner, cfg claude.RunConfig, p *prd.PRD) ([]Score, error) {
+	cfg.Prompt = buildReviewPrompt(p)
+	raw, err := exec.RunJSON(ctx, cfg, reviewSchema)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp reviewResponse
+	if err := json.Unmarshal(raw, &resp); err != nil {
+		return nil, fmt.Errorf("parsing review response: %w", err)
+	}
+	byID := make(map[string]Score, len(resp.Stories))
+	for _, s := range resp.Stories {
+		if s.Size < 1 || s.Size > 5 || s.Testability < 1 || s.Testability > 5 {
+			return nil, fmt.Errorf("review of %s has scores out of range", s.StoryID)
+		}
+		byID[s.StoryID] = s
+	}
+
+	var scores []Score
+	for _, s := range p.UserStories {
+		if score, ok := byID[s.ID]; ok {
+			scores = append(scores, score)
+		}
+	}
+	return scores, nil
+}
+
+// buildReviewPrompt constructs the prompt sent to Claude for a review.
+func buildReviewPrompt(p *prd.PRD) string {
+	var sb strings.Builder
+	sb.WriteString("Review the user stories below before an autonomous coding agent implements them, one fresh agent session per story. ")
+	sb.WriteString("For each story, score its size (can one session complete it?) and its testability (can the agent check every acceptance criterion itself?), ")
+	sb.WriteString("and say in one sentence what to change. Stories run in priority order, so a story may rely on earlier ones.\n\n")
+	sb.WriteString(fmt.Sprintf("**Project:** %s\n", p.Project))
+	if p.Description != "" {
+		sb.WriteString(fmt.Sprintf("**Description:** %s\n", p.Description))
+	}
+	for _, s := range p.UserStories {
+		sb.WriteString(fmt.Sprintf("\n### %s: %s (priority %d)\n\n", s.ID, s.Title, s.Priority))
+		sb.WriteString(s.Description)
+		sb.WriteString("\n\n**Acceptance Criteria:**\n")
+		for _, ac := range s.AcceptanceCriteria {
+			sb.WriteString(fmt.Sprintf("- %s\n", ac))
+		}
+	}
+	return sb.String()
+}
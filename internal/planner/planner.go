@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
@@ -32,14 +33,31 @@ type JSONRunner interface {
 // Stories with Passes == true are never returned.
 // Returns an empty slice when all stories pass.
 func NextStories(ctx context.Context, p *prd.PRD, mode string, exec JSONRunner) ([]*prd.UserStory, error) {
+	return NextSelectedStories(ctx, p, mode, prd.Selector{}, exec)
+}
+
+// NextSelectedStories is like NextStories but only returns stories picked by
+// sel. Priority order still applies among them. Auto mode analyzes
+// dependencies across all incomplete stories and chooses the first batch with
+// selected stories in it. If those depend on incomplete stories that are not
+// selected, the ones that are ready run first; if any of them is excluded by
+// sel, an error is returned instead. Returns an empty slice when all selected
+// stories pass.
+func NextSelectedStories(ctx context.Context, p *prd.PRD, mode string, sel prd.Selector, exec JSONRunner) ([]*prd.UserStory, error) {
 	incomplete := incompleteByPriority(p)
-	if len(incomplete) == 0 {
+	var selected []*prd.UserStory
+	for _, s := range incomplete {
+		if sel.Matches(p, s) {
+			selected = append(selected, s)
+		}
+	}
+	if len(selected) == 0 {
 		return nil, nil
 	}
 
 	switch {
 	case mode == "sequential":
-		return incomplete[:1], nil
+		return selected[:1], nil
 
 	case strings.HasPrefix(mode, "parallel-"):
 		nStr := strings.TrimPrefix(mode, "parallel-")
@@ -50,13 +68,13 @@ func NextStories(ctx context.Context, p *prd.PRD, mode string, exec JSONRunner)
 		if n < 1 {
 			return nil, fmt.Errorf("parallel count must be >= 1, got %d", n)
 		}
-		if n > len(incomplete) {
-			n = len(incomplete)
+		if n > len(selected) {
+			n = len(selected)
 		}
-		return incomplete[:n], nil
+		return selected[:n], nil
 
 	case mode == "auto":
-		return autoMode(ctx, p, incomplete, exec)
+		return autoMode(ctx, incomplete, selected, sel.Exclude, exec)
 
 	default:
 		return nil, fmt.Errorf("unknown planner mode: %q", mode)
@@ -75,21 +93,33 @@ const batchSchema = `{
         "type": "array",
         "items": { "type": "string" }
       }
+    },
+    "dependsOn": {
+      "type": "object",
+      "description": "Maps a story ID to the IDs of the stories it directly depends on. Stories without dependencies may be left out.",
+      "additionalProperties": {
+        "type": "array",
+        "items": { "type": "string" }
+      }
     }
   }
 }`
 
 // batchResponse is the parsed response from Claude's dependency analysis.
 type batchResponse struct {
-	Batches [][]string `json:"batches"`
+	Batches   [][]string          `json:"batches"`
+	DependsOn map[string][]string `json:"dependsOn"`
 }
 
 // autoMode sends incomplete stories to Claude for dependency analysis and
-// returns the first incomplete batch. Falls back to sequential mode on error.
-func autoMode(ctx context.Context, p *prd.PRD, incomplete []*prd.UserStory, exec JSONRunner) ([]*prd.UserStory, error) {
+// returns the selected stories of the first batch that has any, or the
+// unselected stories they depend on that are ready to run. A dependency on a
+// story excluded by one of the exclude tags is an error. Falls back to
+// sequential mode if the analysis fails.
+func autoMode(ctx context.Context, incomplete, selected []*prd.UserStory, exclude []string, exec JSONRunner) ([]*prd.UserStory, error) {
 	if exec == nil {
 		log.Println("planner: auto mode requires an executor, falling back to sequential")
-		return incomplete[:1], nil
+		return selected[:1], nil
 	}
 
 	prompt := buildAutoPrompt(incomplete)
@@ -100,42 +130,107 @@ func autoMode(ctx context.Context, p *prd.PRD, incomplete []*prd.UserStory, exec
 	raw, err := exec.RunJSON(ctx, cfg, batchSchema)
 	if err != nil {
 		log.Printf("planner: auto mode Claude call failed, falling back to sequential: %v", err)
-		return incomplete[:1], nil
+		return selected[:1], nil
 	}
 
 	var resp batchResponse
 	if err := json.Unmarshal(raw, &resp); err != nil {
 		log.Printf("planner: auto mode failed to parse batches, falling back to sequential: %v", err)
-		return incomplete[:1], nil
+		return selected[:1], nil
 	}
 
 	if len(resp.Batches) == 0 {
 		log.Println("planner: auto mode returned empty batches, falling back to sequential")
-		return incomplete[:1], nil
+		return selected[:1], nil
 	}
 
-	// Build a lookup from story ID to pointer for incomplete stories.
+	// Build lookups from story ID to pointer for incomplete stories and to
+	// whether they are selected.
 	byID := make(map[string]*prd.UserStory, len(incomplete))
 	for _, s := range incomplete {
 		byID[s.ID] = s
 	}
+	isSelected := make(map[string]bool, len(selected))
+	for _, s := range selected {
+		isSelected[s.ID] = true
+	}
 
-	// Find the first batch that contains at least one incomplete story.
+	// Find the first batch that contains at least one selected story.
 	for _, batch := range resp.Batches {
 		var stories []*prd.UserStory
 		for _, id := range batch {
-			if s, ok := byID[id]; ok {
+			if s, ok := byID[id]; ok && isSelected[id] {
 				stories = append(stories, s)
 			}
 		}
 		if len(stories) > 0 {
-			return stories, nil
+			return prerequisites(stories, incomplete, byID, isSelected, resp.DependsOn, exclude)
 		}
 	}
 
 	// All batches resolved or empty — fall back to sequential.
-	log.Println("planner: auto mode batches contain no incomplete stories, falling back to sequential")
-	return incomplete[:1], nil
+	log.Println("planner: auto mode batches contain no selected stories, falling back to sequential")
+	return selected[:1], nil
+}
+
+// prerequisites returns stories, or, if they depend directly or indirectly
+// on incomplete stories that are not selected, those of the dependencies that
+// do not depend on another one, in priority order. It returns an error if a
+// dependency has one of the exclude tags: the user ruled it out.
+func prerequisites(stories, incomplete []*prd.UserStory, byID map[string]*prd.UserStory, isSelected map[string]bool, dependsOn map[string][]string, exclude []string) ([]*prd.UserStory, error) {
+	// Collect the unselected incomplete stories the batch needs, transitively.
+	needed := make(map[string]bool)
+	queue := storyIDList(stories)
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		for _, dep := range dependsOn[id] {
+			s, ok := byID[dep]
+			if !ok || isSelected[dep] || needed[dep] {
+				continue
+			}
+			if slices.ContainsFunc(exclude, s.HasTag) {
+				return nil, fmt.Errorf("%s depends on %s, which is excluded", id, dep)
+			}
+			needed[dep] = true
+			queue = append(queue, dep)
+		}
+	}
+	if len(needed) == 0 {
+		return stories, nil
+	}
+
+	var ready []*prd.UserStory
+	for _, s := range incomplete {
+		if needed[s.ID] && !slices.ContainsFunc(dependsOn[s.ID], func(dep string) bool { return needed[dep] }) {
+			ready = append(ready, s)
+		}
+	}
+	if len(ready) == 0 {
+		// The dependencies form a cycle; start with the most important one.
+		for _, s := range incomplete {
+			if needed[s.ID] {
+				ready = []*prd.UserStory{s}
+				break
+			}
+		}
+	}
+	log.Printf("planner: running %s first; the selected stories depend on them", storyIDs(ready))
+	return ready, nil
+}
+
+// storyIDList returns the IDs of stories.
+func storyIDList(stories []*prd.UserStory) []string {
+	ids := make([]string, len(stories))
+	for i, s := range stories {
+		ids[i] = s.ID
+	}
+	return ids
+}
+
+// storyIDs joins the IDs of stories with commas.
+func storyIDs(stories []*prd.UserStory) string {
+	return strings.Join(storyIDList(stories), ", ")
 }
 
 // buildAutoPrompt constructs the prompt sent to Claude for dependency analysis.
@@ -144,7 +239,7 @@ func buildAutoPrompt(stories []*prd.UserStory) string {
 	sb.WriteString("Analyze the following user stories and group them into parallelizable batches. ")
 	sb.WriteString("Stories in the same batch can be worked on concurrently (they have no dependencies on each other). ")
 	sb.WriteString("Batches must be executed in order — all stories in batch 1 must complete before batch 2 starts.\n\n")
-	sb.WriteString("Return ONLY the batches as an array of arrays of story IDs.\n\n")
+	sb.WriteString("Return the batches as an array of arrays of story IDs, and in dependsOn, the IDs of the stories each story directly depends on.\n\n")
 	sb.WriteString("Stories:\n")
 	for _, s := range stories {
 		sb.WriteString(fmt.Sprintf("- %s (priority %d): %s — %s\n", s.ID, s.Priority, s.Title, s.Description))
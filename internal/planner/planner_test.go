@@ -354,6 +354,101 @@ func TestNextStories_AutoModeIgnoresUnknownIDs(t *testing.T) {
 	}
 }
 
+func TestNextSelectedStories(t *testing.T) {
+	p := testPRD()
+	p.UserStories[1].Tags = []string{"ui"}      // US-002
+	p.UserStories[2].Tags = []string{"backend"} // US-003
+	p.UserStories[4].Tags = []string{"backend"} // US-005
+
+	tests := []struct {
+		name string
+		mode string
+		sel  prd.Selector
+		want []string
+	}{
+		{"only", "parallel-5", prd.Selector{Only: []string{"backend"}}, []string{"US-003", "US-005"}},
+		{"exclude", "sequential", prd.Selector{Exclude: []string{"ui"}}, []string{"US-003"}},
+		{"ids", "parallel-5", prd.Selector{IDs: []string{"US-005", "US-002"}}, []string{"US-002", "US-005"}},
+		{"from", "parallel-2", prd.Selector{From: "US-004"}, []string{"US-004", "US-005"}},
+		{"none left", "sequential", prd.Selector{IDs: []string{"US-001"}}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stories, err := NextSelectedStories(context.Background(), p, tt.mode, tt.sel, nil)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var got []string
+			for _, s := range stories {
+				got = append(got, s.ID)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNextSelectedStories_AutoMode(t *testing.T) {
+	p := testPRD()
+	p.UserStories[3].Tags = []string{"backend"} // US-004
+	p.UserStories[1].Passes = true              // US-002
+	// The first batch has no incomplete stories left, so the second is used.
+	mock := &mockJSONRunner{response: json.RawMessage(`{"batches":[["US-002"],["US-003","US-004","US-005"]]}`)}
+	stories, err := NextSelectedStories(context.Background(), p, "auto", prd.Selector{Only: []string{"backend"}}, mock)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(stories) != 1 || stories[0].ID != "US-004" {
+		t.Errorf("got %v, want [US-004]", stories)
+	}
+}
+
+func TestNextSelectedStories_AutoModeRunsPrerequisites(t *testing.T) {
+	p := testPRD()
+	p.UserStories[3].Tags = []string{"backend"} // US-004
+	const batches = `"batches":[["US-002","US-003"],["US-004","US-005"]]`
+
+	tests := []struct {
+		name      string
+		dependsOn string
+		want      []string
+	}{
+		// Only the stories the selected one depends on run first, not the
+		// whole earlier batch.
+		{"direct", `{"US-004":["US-003"]}`, []string{"US-003"}},
+		{"transitive", `{"US-004":["US-003"],"US-003":["US-002"]}`, []string{"US-002"}},
+		{"none", `{}`, []string{"US-004"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := &mockJSONRunner{response: json.RawMessage(`{` + batches + `,"dependsOn":` + tt.dependsOn + `}`)}
+			stories, err := NextSelectedStories(context.Background(), p, "auto", prd.Selector{Only: []string{"backend"}}, mock)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var got []string
+			for _, s := range stories {
+				got = append(got, s.ID)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNextSelectedStories_AutoModeExcludedPrerequisite(t *testing.T) {
+	p := testPRD()
+	p.UserStories[2].Tags = []string{"slow"} // US-003
+	mock := &mockJSONRunner{response: json.RawMessage(`{"batches":[["US-002","US-003"],["US-004","US-005"]],"dependsOn":{"US-004":["US-003"]}}`)}
+	sel := prd.Selector{IDs: []string{"US-004"}, Exclude: []string{"slow"}}
+	stories, err := NextSelectedStories(context.Background(), p, "auto", sel, mock)
+	if err == nil {
+		t.Fatalf("got %v, want an error for the excluded dependency", stories)
+	}
+}
+
 func TestBuildAutoPrompt(t *testing.T) {
 	stories := []*prd.UserStory{
 		{ID: "US-002", Title: "Second", Description: "Desc 2", Priority: 2},
@@ -0,0 +1,275 @@
+package prd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/radvoogh/ralph-wiggo/internal/fsutil"
+)
+
+// ErrConflict is returned by SavePRDIfUnchanged when the file on disk no
+// longer matches the version the caller loaded, e.g. because the agent
+// updated prd.json in the meantime.
+var ErrConflict = errors.New("PRD file was modified concurrently")
+
+// Version returns the version token for raw PRD file contents. Tokens are
+// content hashes, so rewriting identical bytes does not change the version.
+func Version(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// LoadPRDVersion reads and parses a PRD file like LoadPRD and also
+// returns the version token of the contents that were parsed.
+func LoadPRDVersion(path string) (*PRD, string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", fmt.Errorf("reading PRD file: %w", err)
+	}
+
+	prd, err := Unmarshal(data, FormatOf(path))
+	if err != nil {
+		return nil, "", err
+	}
+
+	return prd, Version(data), nil
+}
+
+// SavePRDIfUnchanged writes a PRD to the given path only if the file still
+// has the given version, returning ErrConflict otherwise. The write is atomic
+// so concurrent readers never observe a partially written file. It returns the
+// version of the newly written contents.
+func SavePRDIfUnchanged(path string, prd *PRD, version string) (string, error) {
+	current, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("reading PRD file: %w", err)
+	}
+	if Version(current) != version {
+		return "", ErrConflict
+	}
+
+	data, err := Marshal(prd, FormatOf(path))
+	if err != nil {
+		return "", err
+	}
+
+	if err := fsutil.WriteFileAtomic(path, data, 0644); err != nil {
+		return "", fmt.Errorf("writing PRD file: %w", err)
+	}
+	return Version(data), nil
+}
+
+// maxUpdateAttempts bounds how often UpdatePRD retries after losing a race
+// with another writer.
+const maxUpdateAttempts = 5
+
+// UpdatePRD applies fn to the current contents of the PRD file and writes the
+// result with SavePRDIfUnchanged. If the file changes between the read and
+// the write (e.g. the agent or the dashboard edited it), fn is applied again
+// to the fresh contents, so neither change is lost. It returns the PRD as
+// written, or ErrConflict if the file kept changing.
+func UpdatePRD(path string, fn func(*PRD) error) (*PRD, error) {
+	for range maxUpdateAttempts {
+		p, version, err := LoadPRDVersion(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := fn(p); err != nil {
+			return nil, err
+		}
+		if _, err := SavePRDIfUnchanged(path, p, version); err == nil {
+			return p, nil
+		} else if !errors.Is(err, ErrConflict) {
+			return nil, err
+		}
+	}
+	return nil, ErrConflict
+}
+
+// FindStory returns a pointer to the story with the given ID, or nil if the
+// PRD has no such story.
+func FindStory(prd *PRD, id string) *UserStory {
+	for i := range prd.UserStories {
+		if prd.UserStories[i].ID == id {
+			return &prd.UserStories[i]
+		}
+	}
+	return nil
+}
+
+// NextStoryID suggests an ID for a new story by incrementing the highest
+// numeric suffix among existing "PREFIX-NNN" IDs.
+func NextStoryID(p *PRD) string {
+	prefix, highest, width := "US-", 0, 3
+	for _, s := range p.UserStories {
+		i := strings.LastIndex(s.ID, "-")
+		if i < 0 {
+			continue
+		}
+		n, err := strconv.Atoi(s.ID[i+1:])
+		if err != nil {
+			continue
+		}
+		if n > highest {
+			prefix, highest, width = s.ID[:i+1], n, len(s.ID)-i-1
+		}
+	}
+	return fmt.Sprintf("%s%0*d", prefix, width, highest+1)
+}
+
+// AddStory inserts a story at its Priority, shifting lower-priority stories
+// down. A priority outside 1..N+1 appends the story at the end.
+func AddStory(prd *PRD, story UserStory) error {
+	if story.ID == "" {
+		return fmt.Errorf("story has empty ID")
+	}
+	if FindStory(prd, story.ID) != nil {
+		return fmt.Errorf("duplicate story ID: %s", story.ID)
+	}
+
+	stories := sortedByPriority(prd)
+	pos := story.Priority - 1
+	if pos < 0 || pos > len(stories) {
+		pos = len(stories)
+	}
+	stories = append(stories[:pos], append([]UserStory{story}, stories[pos:]...)...)
+	setOrder(prd, stories)
+	return nil
+}
+
+// MoveStory changes a story's priority to the given position (1-based,
+// clamped to the valid range) and renumbers the others so priorities remain
+// sequential.
+func MoveStory(prd *PRD, id string, to int) error {
+	stories := sortedByPriority(prd)
+	from := -1
+	for i := range stories {
+		if stories[i].ID == id {
+			from = i
+			break
+		}
+	}
+	if from < 0 {
+		return fmt.Errorf("story %s not found", id)
+	}
+
+	story := stories[from]
+	stories = append(stories[:from], stories[from+1:]...)
+	pos := min(max(to-1, 0), len(stories))
+	stories = append(stories[:pos], append([]UserStory{story}, stories[pos:]...)...)
+	setOrder(prd, stories)
+	return nil
+}
+
+// RemoveStory deletes a story and renumbers the remaining priorities.
+func RemoveStory(prd *PRD, id string) error {
+	stories := sortedByPriority(prd)
+	for i := range stories {
+		if stories[i].ID == id {
+			setOrder(prd, append(stories[:i], stories[i+1:]...))
+			return nil
+		}
+	}
+	return fmt.Errorf("story %s not found", id)
+}
+
+// SplitStory replaces a story with the given smaller stories, inserted at its
+// priority in order, and renumbers the rest. The parts get IDs derived from
+// the original (US-003 becomes US-003.1, US-003.2, ...), start out not
+// passing, keep its tags, source and overrides, and their notes record the
+// split. It returns the new IDs.
+func SplitStory(prd *PRD, id string, parts []UserStory) ([]string, error) {
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("splitting %s: no replacement stories", id)
+	}
+	stories := sortedByPriority(prd)
+	pos := -1
+	for i := range stories {
+		if stories[i].ID == id {
+			pos = i
+			break
+		}
+	}
+	if pos < 0 {
+		return nil, fmt.Errorf("story %s not found", id)
+	}
+	original := stories[pos]
+
+	replacements := make([]UserStory, len(parts))
+	ids := make([]string, len(parts))
+	for i, part := range parts {
+		part.ID = fmt.Sprintf("%s.%d", id, i+1)
+		if FindStory(prd, part.ID) != nil {
+			return nil, fmt.Errorf("splitting %s: duplicate story ID: %s", id, part.ID)
+		}
+		part.Passes = false
+		part.Tags = original.Tags
+		part.Source = original.Source
+		part.Overrides = original.Overrides
+		note := fmt.Sprintf("Split from %s (%s).", id, original.Title)
+		part.Notes = strings.TrimSpace(note + " " + part.Notes)
+		if part.AcceptanceCriteria == nil {
+			part.AcceptanceCriteria = []string{}
+		}
+		replacements[i] = part
+		ids[i] = part.ID
+	}
+	setOrder(prd, slices.Concat(stories[:pos], replacements, stories[pos+1:]))
+	return ids, nil
+}
+
+// Reorder assigns priorities 1..N following the given order of story IDs,
+// which must name every story exactly once.
+func Reorder(prd *PRD, ids []string) error {
+	if len(ids) != len(prd.UserStories) {
+		return fmt.Errorf("reorder lists %d stories, PRD has %d", len(ids), len(prd.UserStories))
+	}
+	stories := make([]UserStory, 0, len(ids))
+	seen := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		if seen[id] {
+			return fmt.Errorf("duplicate story ID in order: %s", id)
+		}
+		seen[id] = true
+		s := FindStory(prd, id)
+		if s == nil {
+			return fmt.Errorf("story %s not found", id)
+		}
+		stories = append(stories, *s)
+	}
+	setOrder(prd, stories)
+	return nil
+}
+
+// Renumber assigns sequential priorities 1..N, preserving the current
+// relative order (ties keep their file order).
+func Renumber(prd *PRD) {
+	setOrder(prd, sortedByPriority(prd))
+}
+
+// sortedByPriority returns a copy of the stories sorted by priority, keeping
+// file order for equal priorities.
+func sortedByPriority(prd *PRD) []UserStory {
+	stories := make([]UserStory, len(prd.UserStories))
+	copy(stories, prd.UserStories)
+	sort.SliceStable(stories, func(i, j int) bool {
+		return stories[i].Priority < stories[j].Priority
+	})
+	return stories
+}
+
+// setOrder replaces the PRD's stories with the given slice, assigning
+// priorities by position.
+func setOrder(prd *PRD, stories []UserStory) {
+	for i := range stories {
+		stories[i].Priority = i + 1
+	}
+	prd.UserStories = stories
+}
@@ -0,0 +1,251 @@
+package prd
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// threeStoryPRD returns a valid PRD with stories US-001..US-003 at priorities 1..3.
+func threeStoryPRD() *PRD {
+	p := testPRD()
+	p.UserStories = append(p.UserStories, UserStory{
+		ID:       "US-003",
+		Title:    "Third story",
+		Priority: 3,
+	})
+	return p
+}
+
+// priorityOrder returns story IDs in priority order.
+func priorityOrder(p *PRD) []string {
+	var ids []string
+	for _, s := range sortedByPriority(p) {
+		ids = append(ids, s.ID)
+	}
+	return ids
+}
+
+func assertOrder(t *testing.T, p *PRD, want ...string) {
+	t.Helper()
+	got := priorityOrder(p)
+	if len(got) != len(want) {
+		t.Fatalf("order = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("order = %v, want %v", got, want)
+		}
+	}
+	if err := Validate(p); err != nil {
+		t.Fatalf("Validate after edit: %v", err)
+	}
+}
+
+func TestSavePRDIfUnchanged(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "prd.json")
+	if err := SavePRD(path, testPRD()); err != nil {
+		t.Fatalf("SavePRD: %v", err)
+	}
+
+	p, version, err := LoadPRDVersion(path)
+	if err != nil {
+		t.Fatalf("LoadPRDVersion: %v", err)
+	}
+
+	p.Project = "renamed"
+	newVersion, err := SavePRDIfUnchanged(path, p, version)
+	if err != nil {
+		t.Fatalf("SavePRDIfUnchanged: %v", err)
+	}
+	if newVersion == version {
+		t.Error("expected version to change after write")
+	}
+
+	// Saving again with the stale version must not clobber the file.
+	p.Project = "stale"
+	if _, err := SavePRDIfUnchanged(path, p, version); !errors.Is(err, ErrConflict) {
+		t.Fatalf("expected ErrConflict, got %v", err)
+	}
+	loaded, err := LoadPRD(path)
+	if err != nil {
+		t.Fatalf("LoadPRD: %v", err)
+	}
+	if loaded.Project != "renamed" {
+		t.Errorf("project = %q, want %q", loaded.Project, "renamed")
+	}
+
+	// No temp files are left behind.
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatalf("ReadDir: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("expected only prd.json in dir, found %d entries", len(entries))
+	}
+}
+
+func TestUpdatePRDReappliesAfterConcurrentWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "prd.json")
+	if err := SavePRD(path, testPRD()); err != nil {
+		t.Fatalf("SavePRD: %v", err)
+	}
+
+	calls := 0
+	p, err := UpdatePRD(path, func(p *PRD) error {
+		calls++
+		if calls == 1 {
+			// Simulate the agent writing notes between our read and write.
+			other, err := LoadPRD(path)
+			if err != nil {
+				return err
+			}
+			other.UserStories[0].Notes = "agent notes"
+			if err := SavePRD(path, other); err != nil {
+				return err
+			}
+		}
+		FindStory(p, "US-002").Passes = true
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("UpdatePRD: %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("fn called %d times, want 2", calls)
+	}
+
+	loaded, err := LoadPRD(path)
+	if err != nil {
+		t.Fatalf("LoadPRD: %v", err)
+	}
+	if loaded.UserStories[0].Notes != "agent notes" || !FindStory(loaded, "US-002").Passes || !FindStory(p, "US-002").Passes {
+		t.Errorf("concurrent change lost: %+v", loaded.UserStories)
+	}
+}
+
+func TestAddStory(t *testing.T) {
+	p := threeStoryPRD()
+	if err := AddStory(p, UserStory{ID: "US-004", Priority: 2}); err != nil {
+		t.Fatalf("AddStory: %v", err)
+	}
+	assertOrder(t, p, "US-001", "US-004", "US-002", "US-003")
+
+	// Out-of-range priority appends.
+	if err := AddStory(p, UserStory{ID: "US-005", Priority: 0}); err != nil {
+		t.Fatalf("AddStory: %v", err)
+	}
+	assertOrder(t, p, "US-001", "US-004", "US-002", "US-003", "US-005")
+
+	if err := AddStory(p, UserStory{ID: "US-001"}); err == nil {
+		t.Error("expected error for duplicate ID")
+	}
+	if err := AddStory(p, UserStory{}); err == nil {
+		t.Error("expected error for empty ID")
+	}
+}
+
+func TestMoveStory(t *testing.T) {
+	p := threeStoryPRD()
+	if err := MoveStory(p, "US-003", 1); err != nil {
+		t.Fatalf("MoveStory: %v", err)
+	}
+	assertOrder(t, p, "US-003", "US-001", "US-002")
+
+	// Targets beyond the end are clamped.
+	if err := MoveStory(p, "US-003", 99); err != nil {
+		t.Fatalf("MoveStory: %v", err)
+	}
+	assertOrder(t, p, "US-001", "US-002", "US-003")
+
+	if err := MoveStory(p, "US-999", 1); err == nil {
+		t.Error("expected error for unknown story")
+	}
+}
+
+func TestRemoveStory(t *testing.T) {
+	p := threeStoryPRD()
+	if err := RemoveStory(p, "US-002"); err != nil {
+		t.Fatalf("RemoveStory: %v", err)
+	}
+	assertOrder(t, p, "US-001", "US-003")
+
+	if err := RemoveStory(p, "US-002"); err == nil {
+		t.Error("expected error removing a missing story")
+	}
+}
+
+func TestReorder(t *testing.T) {
+	p := threeStoryPRD()
+	if err := Reorder(p, []string{"US-002", "US-003", "US-001"}); err != nil {
+		t.Fatalf("Reorder: %v", err)
+	}
+	assertOrder(t, p, "US-002", "US-003", "US-001")
+
+	for _, ids := range [][]string{
+		{"US-001", "US-002"},
+		{"US-001", "US-001", "US-002"},
+		{"US-001", "US-002", "US-999"},
+	} {
+		if err := Reorder(p, ids); err == nil {
+			t.Errorf("Reorder(%v) succeeded, want error", ids)
+		}
+	}
+}
+
+func TestRenumber(t *testing.T) {
+	p := threeStoryPRD()
+	p.UserStories[0].Priority = 10
+	p.UserStories[1].Priority = 5
+	p.UserStories[2].Priority = 5
+	Renumber(p)
+	assertOrder(t, p, "US-002", "US-003", "US-001")
+}
+
+func TestNextStoryID(t *testing.T) {
+	p := &PRD{UserStories: []UserStory{{ID: "US-009"}, {ID: "US-010"}, {ID: "misc"}}}
+	if got := NextStoryID(p); got != "US-011" {
+		t.Errorf("NextStoryID = %q, want %q", got, "US-011")
+	}
+	if got := NextStoryID(&PRD{}); got != "US-001" {
+		t.Errorf("NextStoryID(empty) = %q, want %q", got, "US-001")
+	}
+}
+
+func TestSplitStory(t *testing.T) {
+	p := &PRD{UserStories: []UserStory{
+		{ID: "US-001", Title: "First", Priority: 1, Passes: true},
+		{ID: "US-002", Title: "Too big", Priority: 2, Overrides: Overrides{Model: "claude-sonnet-4-5"}},
+		{ID: "US-003", Title: "Third", Priority: 3},
+	}}
+	parts := []UserStory{
+		{Title: "Schema", Notes: "Do this first.", Passes: true},
+		{Title: "Handler", AcceptanceCriteria: []string{"Returns 200"}},
+	}
+	ids, err := SplitStory(p, "US-002", parts)
+	if err != nil {
+		t.Fatalf("SplitStory: %v", err)
+	}
+	if len(ids) != 2 || ids[1] != "US-002.2" {
+		t.Errorf("ids = %v", ids)
+	}
+	if err := Validate(p); err != nil {
+		t.Fatalf("Validate after split: %v", err)
+	}
+	assertOrder(t, p, "US-001", "US-002.1", "US-002.2", "US-003")
+	first := FindStory(p, "US-002.1")
+	if first.Passes || first.Notes != "Split from US-002 (Too big). Do this first." || first.AcceptanceCriteria == nil || first.Model != "claude-sonnet-4-5" {
+		t.Errorf("first part = %+v", first)
+	}
+	if FindStory(p, "US-002") != nil {
+		t.Error("original story was kept")
+	}
+
+	if _, err := SplitStory(p, "US-404", parts); err == nil {
+		t.Error("expected error for unknown story")
+	}
+	if _, err := SplitStory(p, "US-003", nil); err == nil {
+		t.Error("expected error for empty split")
+	}
+}
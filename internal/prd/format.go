@@ -0,0 +1,500 @@
+package prd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Format is an on-disk encoding of a PRD.
+type Format int
+
+const (
+	// FormatJSON is the original prd.json format.
+	FormatJSON Format = iota
+	// FormatYAML holds the same fields as the JSON format in YAML.
+	FormatYAML
+	// FormatMarkdown is a Markdown document with one "## ID: Title" section
+	// per story. Project fields are YAML frontmatter at the top of the file,
+	// story fields are frontmatter below each heading and the story's
+	// description is the section body.
+	FormatMarkdown
+)
+
+// String returns the format's name.
+func (f Format) String() string {
+	switch f {
+	case FormatYAML:
+		return "YAML"
+	case FormatMarkdown:
+		return "Markdown"
+	default:
+		return "JSON"
+	}
+}
+
+// FormatOf chooses a format by file extension: .yaml and .yml are YAML, .md
+// and .markdown are Markdown and anything else is JSON.
+func FormatOf(path string) Format {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return FormatYAML
+	case ".md", ".markdown":
+		return FormatMarkdown
+	default:
+		return FormatJSON
+	}
+}
+
+// Marshal encodes a PRD in the given format, at the current schema version.
+func Marshal(prd *PRD, f Format) ([]byte, error) {
+	current := *prd
+	current.SchemaVersion = SchemaVersion
+	prd = &current
+
+	var data []byte
+	var err error
+	switch f {
+	case FormatYAML:
+		data, err = marshalYAML(prd)
+	case FormatMarkdown:
+		data, err = marshalMarkdown(prd)
+	default:
+		data, err = json.MarshalIndent(prd, "", "  ")
+		data = append(data, '\n')
+	}
+	if err != nil {
+		return nil, fmt.Errorf("marshaling PRD: %w", err)
+	}
+	return data, nil
+}
+
+// Unmarshal decodes a PRD in the given format, migrating documents written
+// with an older schema version (see Migrate). Fields the schema does not have
+// are ignored; Check reports them.
+func Unmarshal(data []byte, f Format) (*PRD, error) {
+	prd, _, err := Upgrade(data, f)
+	return prd, err
+}
+
+// document is a PRD file decoded for migration and checks.
+type document struct {
+	format Format
+	// values holds the document as generic values (objects are
+	// map[string]any and arrays []any), which migrations work on.
+	values map[string]any
+	// changed reports whether a migration changed values beyond the
+	// schema version. Unchanged documents decode from the source, which
+	// keeps YAML scalars such as "id: 007" exactly as written.
+	changed bool
+
+	json []byte     // source of a JSON document
+	node *yaml.Node // source of a YAML or Markdown document
+}
+
+// decodeDocument decodes a PRD file's contents. A Markdown PRD decodes to
+// the YAML document it corresponds to.
+func decodeDocument(data []byte, f Format) (*document, error) {
+	doc := &document{format: f}
+	var err error
+	switch f {
+	case FormatYAML:
+		var node yaml.Node
+		if err = yaml.Unmarshal(data, &node); err == nil {
+			doc.node = &node
+		}
+	case FormatMarkdown:
+		doc.node, err = markdownNode(data)
+	default:
+		doc.json = data
+	}
+	if err != nil {
+		return nil, err
+	}
+	if doc.values, err = doc.sourceValues(); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// sourceValues decodes the document's source into generic values.
+func (doc *document) sourceValues() (map[string]any, error) {
+	var values map[string]any
+	var err error
+	switch {
+	case doc.node != nil && doc.node.Kind != 0:
+		err = doc.node.Decode(&values)
+	case doc.json != nil:
+		err = json.Unmarshal(doc.json, &values)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if values == nil {
+		values = make(map[string]any)
+	}
+	return values, nil
+}
+
+// migrate applies Migrate to the document's values.
+func (doc *document) migrate() ([]string, error) {
+	applied, err := Migrate(doc.values)
+	if err != nil || len(applied) == 0 {
+		return applied, err
+	}
+	original, err := doc.sourceValues()
+	if err != nil {
+		return nil, err
+	}
+	original["schemaVersion"] = doc.values["schemaVersion"]
+	doc.changed = !reflect.DeepEqual(original, doc.values)
+	return applied, nil
+}
+
+// decode decodes the document into a PRD at the current schema version. On a
+// type error, the PRD holds what did decode.
+func (doc *document) decode() (*PRD, error) {
+	var prd PRD
+	var err error
+	switch {
+	case doc.changed:
+		err = decodeValue(doc.values, doc.format, &prd)
+	case doc.node != nil && doc.node.Kind != 0:
+		err = doc.node.Decode(&prd)
+	case doc.json != nil:
+		err = json.Unmarshal(doc.json, &prd)
+	}
+	prd.SchemaVersion = SchemaVersion
+	return &prd, err
+}
+
+// decodeValue decodes generic values into v with the decoding rules of the
+// format: YAML and Markdown decode like YAML, which is more lenient about
+// scalar types than JSON.
+func decodeValue(generic any, f Format, v any) error {
+	if f == FormatJSON {
+		data, err := json.Marshal(generic)
+		if err != nil {
+			return err
+		}
+		return json.Unmarshal(data, v)
+	}
+	data, err := marshalYAML(generic)
+	if err != nil {
+		return err
+	}
+	return yaml.Unmarshal(data, v)
+}
+
+// MarshalStory encodes a single story in the given format: a JSON object, a
+// YAML mapping or one Markdown story section.
+func MarshalStory(s *UserStory, f Format) ([]byte, error) {
+	var data []byte
+	var err error
+	switch f {
+	case FormatYAML:
+		data, err = marshalYAML(s)
+	case FormatMarkdown:
+		var buf bytes.Buffer
+		err = writeStorySection(&buf, s)
+		data = buf.Bytes()
+	default:
+		data, err = json.MarshalIndent(s, "", "  ")
+		data = append(data, '\n')
+	}
+	if err != nil {
+		return nil, fmt.Errorf("marshaling story: %w", err)
+	}
+	return data, nil
+}
+
+// UnmarshalStory decodes a single story encoded as by MarshalStory.
+func UnmarshalStory(data []byte, f Format) (*UserStory, error) {
+	var s UserStory
+	var err error
+	switch f {
+	case FormatYAML:
+		err = yaml.Unmarshal(data, &s)
+	case FormatMarkdown:
+		var stories []*yaml.Node
+		stories, err = parseStorySections(splitLines(data))
+		if err == nil && len(stories) != 1 {
+			err = fmt.Errorf("found %d story sections, want 1", len(stories))
+		}
+		if err == nil {
+			err = stories[0].Decode(&s)
+		}
+	default:
+		err = json.Unmarshal(data, &s)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parsing story %s: %w", f, err)
+	}
+	return &s, nil
+}
+
+// marshalYAML encodes v as YAML with two-space indentation.
+func marshalYAML(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// frontmatterDelim opens and closes a block of YAML frontmatter.
+const frontmatterDelim = "---"
+
+// storyHeading starts a story's section in the Markdown format.
+const storyHeading = "## "
+
+// markdownHeader is the frontmatter at the top of a Markdown PRD.
+type markdownHeader struct {
+	SchemaVersion int    `yaml:"schemaVersion"`
+	Project       string `yaml:"project"`
+	BranchName    string `yaml:"branchName"`
+	Description   string `yaml:"description"`
+}
+
+// markdownStory is the frontmatter of a story section as written. ID, Title
+// and Description are only set when the heading or body cannot hold them
+// exactly, and then take precedence when the section is read.
+type markdownStory struct {
+	ID                 *string  `yaml:"id,omitempty"`
+	Title              *string  `yaml:"title,omitempty"`
+	Priority           int      `yaml:"priority"`
+	Passes             bool     `yaml:"passes"`
+	AcceptanceCriteria []string `yaml:"acceptanceCriteria"`
+	Notes              string   `yaml:"notes,omitempty"`
+	Tags               []string `yaml:"tags,omitempty"`
+	Source             *Source  `yaml:"source,omitempty"`
+	Overrides          `yaml:",inline"`
+	Description        *string `yaml:"description,omitempty"`
+}
+
+func marshalMarkdown(prd *PRD) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := writeFrontmatter(&buf, markdownHeader{prd.SchemaVersion, prd.Project, prd.BranchName, prd.Description}); err != nil {
+		return nil, err
+	}
+
+	for i := range prd.UserStories {
+		buf.WriteString("\n")
+		if err := writeStorySection(&buf, &prd.UserStories[i]); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// writeStorySection writes a story's heading, frontmatter and body.
+func writeStorySection(buf *bytes.Buffer, s *UserStory) error {
+	meta := markdownStory{
+		Priority:           s.Priority,
+		Passes:             s.Passes,
+		AcceptanceCriteria: s.AcceptanceCriteria,
+		Notes:              s.Notes,
+		Tags:               s.Tags,
+		Source:             s.Source,
+		Overrides:          s.Overrides,
+	}
+	if meta.AcceptanceCriteria == nil {
+		meta.AcceptanceCriteria = []string{}
+	}
+	heading := s.ID + ": " + s.Title
+	if !headingSafe(s.ID, s.Title) {
+		heading = "Story"
+		meta.ID, meta.Title = &s.ID, &s.Title
+	}
+	body := s.Description
+	if !bodySafe(body) {
+		body = ""
+		meta.Description = &s.Description
+	}
+
+	fmt.Fprintf(buf, "%s%s\n\n", storyHeading, strings.TrimRight(heading, " "))
+	if err := writeFrontmatter(buf, meta); err != nil {
+		return err
+	}
+	if body != "" {
+		fmt.Fprintf(buf, "\n%s\n", body)
+	}
+	return nil
+}
+
+// headingSafe reports whether a story's ID and title survive being written as
+// an "ID: Title" heading.
+func headingSafe(id, title string) bool {
+	return id != "" && !strings.ContainsAny(id, ":\r\n") && id == strings.TrimSpace(id) &&
+		!strings.ContainsAny(title, "\r\n") && title == strings.TrimSpace(title)
+}
+
+// bodySafe reports whether a description survives being written as a section
+// body: parsing trims surrounding whitespace and a body line must not start a
+// new story or look like frontmatter.
+func bodySafe(desc string) bool {
+	if desc != strings.TrimSpace(desc) || strings.Contains(desc, "\r") {
+		return false
+	}
+	for line := range strings.SplitSeq(desc, "\n") {
+		if strings.HasPrefix(line, storyHeading) || line == frontmatterDelim {
+			return false
+		}
+	}
+	return true
+}
+
+func writeFrontmatter(buf *bytes.Buffer, v any) error {
+	data, err := marshalYAML(v)
+	if err != nil {
+		return err
+	}
+	buf.WriteString(frontmatterDelim + "\n")
+	buf.Write(data)
+	buf.WriteString(frontmatterDelim + "\n")
+	return nil
+}
+
+// markdownNode decodes a Markdown PRD into the YAML document it
+// corresponds to: the project frontmatter with the story sections added as
+// userStories.
+func markdownNode(data []byte) (*yaml.Node, error) {
+	var header yaml.Node
+	rest, err := readFrontmatter(splitLines(data), &header)
+	if err != nil {
+		return nil, fmt.Errorf("project frontmatter: %w", err)
+	}
+	root, err := mappingNode(&header)
+	if err != nil {
+		return nil, fmt.Errorf("project frontmatter: %w", err)
+	}
+
+	stories, err := parseStorySections(rest)
+	if err != nil {
+		return nil, err
+	}
+	if len(stories) > 0 {
+		root.Content = append(root.Content,
+			stringNode("userStories"),
+			&yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", Content: stories})
+	}
+	return &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{root}}, nil
+}
+
+// mappingNode returns the mapping of decoded frontmatter, which may be empty.
+func mappingNode(doc *yaml.Node) (*yaml.Node, error) {
+	if doc.Kind == yaml.DocumentNode && len(doc.Content) == 1 {
+		doc = doc.Content[0]
+	}
+	switch {
+	case doc.Kind == yaml.MappingNode:
+		return doc, nil
+	case doc.Kind == 0 || doc.Tag == "!!null":
+		return &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}, nil
+	default:
+		return nil, fmt.Errorf("frontmatter must be a mapping")
+	}
+}
+
+// stringNode returns a YAML string scalar.
+func stringNode(s string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: s}
+}
+
+// splitLines splits data into lines without their line endings.
+func splitLines(data []byte) []string {
+	var lines []string
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(nil, len(data)+1)
+	for sc.Scan() {
+		lines = append(lines, strings.TrimSuffix(sc.Text(), "\r"))
+	}
+	return lines
+}
+
+// parseStorySections parses the "## " story sections in lines into YAML
+// story mappings. Text before the first story is not part of the PRD.
+func parseStorySections(rest []string) ([]*yaml.Node, error) {
+	var stories []*yaml.Node
+	for len(rest) > 0 && !strings.HasPrefix(rest[0], storyHeading) {
+		rest = rest[1:]
+	}
+	for len(rest) > 0 {
+		heading := strings.TrimSpace(strings.TrimPrefix(rest[0], storyHeading))
+		end := 1
+		for end < len(rest) && !strings.HasPrefix(rest[end], storyHeading) {
+			end++
+		}
+		s, err := parseStorySection(heading, rest[1:end])
+		if err != nil {
+			return nil, fmt.Errorf("story %q: %w", heading, err)
+		}
+		stories = append(stories, s)
+		rest = rest[end:]
+	}
+	return stories, nil
+}
+
+// parseStorySection builds a story mapping from its heading and the lines
+// below it. The ID, title and description come from the heading and body
+// unless the frontmatter has them.
+func parseStorySection(heading string, lines []string) (*yaml.Node, error) {
+	var meta yaml.Node
+	body, err := readFrontmatter(lines, &meta)
+	if err != nil {
+		return nil, err
+	}
+	story, err := mappingNode(&meta)
+	if err != nil {
+		return nil, err
+	}
+
+	has := make(map[string]bool)
+	for i := 0; i+1 < len(story.Content); i += 2 {
+		has[story.Content[i].Value] = true
+	}
+	id, title, _ := strings.Cut(heading, ":")
+	for _, field := range [][2]string{
+		{"id", strings.TrimSpace(id)},
+		{"title", strings.TrimSpace(title)},
+		{"description", strings.TrimSpace(strings.Join(body, "\n"))},
+	} {
+		if !has[field[0]] {
+			story.Content = append(story.Content, stringNode(field[0]), stringNode(field[1]))
+		}
+	}
+	return story, nil
+}
+
+// readFrontmatter decodes the frontmatter at the start of lines (after any
+// blank lines) into v and returns the lines that follow it. Without
+// frontmatter, v is left untouched and all lines are returned.
+func readFrontmatter(lines []string, v any) ([]string, error) {
+	start := 0
+	for start < len(lines) && strings.TrimSpace(lines[start]) == "" {
+		start++
+	}
+	if start == len(lines) || lines[start] != frontmatterDelim {
+		return lines, nil
+	}
+	for end := start + 1; end < len(lines); end++ {
+		if lines[end] == frontmatterDelim {
+			if err := yaml.Unmarshal([]byte(strings.Join(lines[start+1:end], "\n")), v); err != nil {
+				return nil, err
+			}
+			return lines[end+1:], nil
+		}
+	}
+	return nil, fmt.Errorf("unterminated frontmatter")
+}
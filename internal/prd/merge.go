@@ -0,0 +1,287 @@
+package prd
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// ChangeKind classifies how a story differs between an existing PRD and a new
+// conversion of its source document.
+type ChangeKind string
+
+const (
+	StoryUnchanged ChangeKind = "unchanged"
+	StoryAdded     ChangeKind = "added"
+	StoryRemoved   ChangeKind = "removed"
+	StoryModified  ChangeKind = "modified"
+)
+
+// A StoryChange describes what MergeConversion did with one story.
+type StoryChange struct {
+	Kind  ChangeKind
+	ID    string // in the merged PRD, or of the removed story
+	Title string
+	// Details lists what changed in a modified story: "title",
+	// "description" or "acceptance criteria".
+	Details []string
+	// ResetPasses is set when the story passed but its acceptance criteria
+	// changed, so it has to be done again.
+	ResetPasses bool
+}
+
+func (c StoryChange) String() string {
+	mark := map[ChangeKind]string{StoryAdded: "+", StoryRemoved: "-", StoryModified: "~", StoryUnchanged: "="}[c.Kind]
+	s := fmt.Sprintf("%s %s %s", mark, c.ID, c.Title)
+	details := c.Details
+	if c.ResetPasses {
+		details = append(slices.Clone(details), "passes reset")
+	}
+	if len(details) > 0 {
+		s += " (" + strings.Join(details, ", ") + ")"
+	}
+	return s
+}
+
+// minTitleSimilarity is how alike two titles must be for MergeConversion to
+// treat them as the same story.
+const minTitleSimilarity = 0.6
+
+// MergeConversion merges a fresh conversion of a PRD's source document into
+// the existing PRD, so re-running a conversion after editing the document
+// keeps the progress made so far. Stories are matched by title, exactly and
+// then by similarity, and then by ID. Matched stories take the converted
+// content but keep their ID, passes (unless the acceptance criteria changed),
+// notes, source and overrides. Stories split from a story that is still in
+// the document are kept in its place. Existing stories the conversion no
+// longer has are removed. Priorities follow the conversion. The returned
+// changes are in the merged PRD's order, followed by the removed stories.
+func MergeConversion(existing, converted *PRD) (*PRD, []StoryChange) {
+	stories := sortedByPriority(converted)
+	match := make([]int, len(stories)) // index into existing.UserStories, or -1
+	parts := make([][]int, len(stories))
+	used := make(map[int]bool)
+	for i := range stories {
+		match[i] = -1
+		// A story that was split is only in the existing PRD as its parts.
+		parts[i] = splitParts(existing, &stories[i], used)
+		for _, j := range parts[i] {
+			used[j] = true
+		}
+	}
+	// pair matches each unmatched converted story to the unused existing
+	// story that scores highest, if any scores above zero.
+	pair := func(score func(conv, old *UserStory) float64) {
+		for i := range stories {
+			if match[i] >= 0 || len(parts[i]) > 0 {
+				continue
+			}
+			best, bestScore := -1, 0.0
+			for j := range existing.UserStories {
+				if sc := score(&stories[i], &existing.UserStories[j]); !used[j] && sc > bestScore {
+					best, bestScore = j, sc
+				}
+			}
+			if best >= 0 {
+				match[i], used[best] = best, true
+			}
+		}
+	}
+	pair(func(conv, old *UserStory) float64 {
+		return boolScore(normalizeTitle(conv.Title) == normalizeTitle(old.Title))
+	})
+	pair(func(conv, old *UserStory) float64 {
+		if sim := titleSimilarity(conv.Title, old.Title); sim >= minTitleSimilarity {
+			return sim
+		}
+		return 0
+	})
+	pair(func(conv, old *UserStory) float64 { return boolScore(conv.ID != "" && conv.ID == old.ID) })
+
+	merged := &PRD{
+		SchemaVersion: converted.SchemaVersion,
+		Project:       converted.Project,
+		BranchName:    converted.BranchName,
+		Description:   converted.Description,
+	}
+	var changes []StoryChange
+	var added []int // indexes into merged.UserStories that need a free ID
+	for i, conv := range stories {
+		switch {
+		case len(parts[i]) > 0:
+			for _, j := range parts[i] {
+				part := existing.UserStories[j]
+				merged.UserStories = append(merged.UserStories, part)
+				changes = append(changes, StoryChange{Kind: StoryUnchanged, ID: part.ID, Title: part.Title})
+			}
+		case match[i] < 0:
+			added = append(added, len(merged.UserStories))
+			merged.UserStories = append(merged.UserStories, conv)
+			changes = append(changes, StoryChange{Kind: StoryAdded, ID: conv.ID, Title: conv.Title})
+		default:
+			story, change := mergeStory(existing.UserStories[match[i]], conv)
+			merged.UserStories = append(merged.UserStories, story)
+			changes = append(changes, change)
+		}
+	}
+
+	// Added stories keep their converted IDs unless another story has, or
+	// had, the same ID: run history is recorded by ID.
+	for _, k := range added {
+		s := &merged.UserStories[k]
+		if s.ID == "" || idTaken(merged, k) || FindStory(existing, s.ID) != nil {
+			s.ID = NextStoryID(merged)
+		}
+		changes[k].ID = s.ID
+	}
+	setOrder(merged, merged.UserStories)
+
+	for j, old := range existing.UserStories {
+		if !used[j] {
+			changes = append(changes, StoryChange{Kind: StoryRemoved, ID: old.ID, Title: old.Title})
+		}
+	}
+	return merged, changes
+}
+
+// mergeStory combines an existing story with its converted version.
+func mergeStory(old, conv UserStory) (UserStory, StoryChange) {
+	story := conv
+	story.ID = old.ID
+	story.Notes = cmp.Or(old.Notes, conv.Notes)
+	story.Source = old.Source
+	if conv.Source != nil {
+		story.Source = conv.Source
+	}
+	if story.Tags == nil {
+		story.Tags = old.Tags
+	}
+	if story.Overrides.isZero() {
+		story.Overrides = old.Overrides
+	}
+
+	change := StoryChange{Kind: StoryUnchanged, ID: story.ID, Title: story.Title}
+	if normalizeTitle(old.Title) != normalizeTitle(conv.Title) {
+		change.Details = append(change.Details, "title")
+	}
+	if strings.TrimSpace(old.Description) != strings.TrimSpace(conv.Description) {
+		change.Details = append(change.Details, "description")
+	}
+	criteriaChanged := !slices.Equal(normalizeAll(old.AcceptanceCriteria), normalizeAll(conv.AcceptanceCriteria))
+	if criteriaChanged {
+		change.Details = append(change.Details, "acceptance criteria")
+	}
+	story.Passes = old.Passes && !criteriaChanged
+	change.ResetPasses = old.Passes && criteriaChanged
+	if len(change.Details) > 0 {
+		change.Kind = StoryModified
+	}
+	return story, change
+}
+
+// boolScore is 1 for true and 0 for false.
+func boolScore(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// splitParts returns the indexes of the unused stories of p that were split
+// from story (see SplitStory), in priority order. Parts are found by the
+// original title their notes record, or else by the original ID.
+func splitParts(p *PRD, story *UserStory, used map[int]bool) []int {
+	var byTitle, byID []int
+	for j, s := range p.UserStories {
+		if used[j] {
+			continue
+		}
+		id, title, ok := splitOrigin(&s)
+		switch {
+		case !ok || FindStory(p, id) != nil:
+		case titleSimilarity(title, story.Title) >= minTitleSimilarity:
+			byTitle = append(byTitle, j)
+		case id == story.ID:
+			byID = append(byID, j)
+		}
+	}
+	parts := byTitle
+	if len(parts) == 0 {
+		parts = byID
+	}
+	slices.SortFunc(parts, func(a, b int) int { return p.UserStories[a].Priority - p.UserStories[b].Priority })
+	return parts
+}
+
+// splitOrigin returns the ID and title of the story s was split from, as
+// recorded in its notes by SplitStory.
+func splitOrigin(s *UserStory) (id, title string, ok bool) {
+	rest, ok := strings.CutPrefix(s.Notes, "Split from ")
+	if !ok {
+		return "", "", false
+	}
+	id, rest, ok = strings.Cut(rest, " (")
+	if !ok || !strings.HasPrefix(s.ID, id+".") {
+		return "", "", false
+	}
+	title, _, ok = strings.Cut(rest, ").")
+	return id, title, ok
+}
+
+// idTaken reports whether another story of p than the k-th has its ID.
+func idTaken(p *PRD, k int) bool {
+	for i, s := range p.UserStories {
+		if i != k && s.ID == p.UserStories[k].ID {
+			return true
+		}
+	}
+	return false
+}
+
+// isZero reports whether no override is set.
+func (o *Overrides) isZero() bool {
+	return o.Model == "" && o.MaxTurns == 0 && o.MaxBudget == 0 && o.MaxIterations == 0 &&
+		len(o.AllowedTools) == 0 && o.Timeout == "" && o.Prompt == ""
+}
+
+// normalizeTitle lowercases s and collapses whitespace, for comparing text
+// that may have been reformatted.
+func normalizeTitle(s string) string {
+	return strings.Join(strings.Fields(strings.ToLower(s)), " ")
+}
+
+// normalizeAll applies normalizeTitle to every string in list.
+func normalizeAll(list []string) []string {
+	out := make([]string, len(list))
+	for i, s := range list {
+		out[i] = normalizeTitle(s)
+	}
+	return out
+}
+
+// titleSimilarity returns the Dice coefficient of the words in a and b: 1 for
+// the same words, 0 for none in common.
+func titleSimilarity(a, b string) float64 {
+	words := func(s string) map[string]bool {
+		set := make(map[string]bool)
+		for _, w := range strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		}) {
+			set[w] = true
+		}
+		return set
+	}
+	wa, wb := words(a), words(b)
+	if len(wa)+len(wb) == 0 {
+		return 0
+	}
+	common := 0
+	for w := range wa {
+		if wb[w] {
+			common++
+		}
+	}
+	return 2 * float64(common) / float64(len(wa)+len(wb))
+}
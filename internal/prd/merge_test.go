@@ -0,0 +1,79 @@
+package prd
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestMergeConversion(t *testing.T) {
+	existing := &PRD{Project: "old", UserStories: []UserStory{
+		{ID: "US-001", Title: "Add orders table", AcceptanceCriteria: []string{"Table exists"}, Priority: 1, Passes: true, Notes: "used sqlc"},
+		{ID: "US-002", Title: "Export orders as CSV", AcceptanceCriteria: []string{"File downloads"}, Priority: 2, Passes: true},
+		{ID: "US-003.1", Title: "Checkout form", Priority: 3, Passes: true, Notes: "Split from US-003 (Checkout)."},
+		{ID: "US-003.2", Title: "Payment call", Priority: 4, Notes: "Split from US-003 (Checkout)."},
+		{ID: "US-004", Title: "Dropped story", Priority: 5},
+		{ID: "US-005", Title: "Reports", Priority: 6, Tags: []string{"ui"}, Source: &Source{Tracker: "github", Key: "9"}},
+	}}
+	converted := &PRD{Project: "new", UserStories: []UserStory{
+		{ID: "US-001", Title: "New first story", AcceptanceCriteria: []string{"x"}, Priority: 1},
+		{ID: "US-002", Title: "Add  orders table", AcceptanceCriteria: []string{"table exists"}, Priority: 2},
+		{ID: "US-003", Title: "Export all orders as CSV", AcceptanceCriteria: []string{"File downloads", "Has header row"}, Priority: 4},
+		{ID: "US-004", Title: "Checkout", Priority: 3},
+		{ID: "US-005", Title: "Monthly reports page", Priority: 5},
+	}}
+
+	merged, changes := MergeConversion(existing, converted)
+
+	var got []string
+	for _, c := range changes {
+		got = append(got, c.String())
+	}
+	want := []string{
+		"+ US-006 New first story",
+		"= US-001 Add  orders table",
+		"= US-003.1 Checkout form",
+		"= US-003.2 Payment call",
+		"~ US-002 Export all orders as CSV (title, acceptance criteria, passes reset)",
+		"~ US-005 Monthly reports page (title)",
+		"- US-004 Dropped story",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("changes:\n%q\nwant\n%q", got, want)
+	}
+
+	if merged.Project != "new" {
+		t.Errorf("Project = %q, want the converted one", merged.Project)
+	}
+	if err := Validate(merged); err != nil {
+		t.Errorf("merged PRD is invalid: %v", err)
+	}
+	if s := FindStory(merged, "US-001"); !s.Passes || s.Notes != "used sqlc" || s.Priority != 2 {
+		t.Errorf("US-001 = %+v, want passes and notes kept at priority 2", s)
+	}
+	if s := FindStory(merged, "US-002"); s.Passes {
+		t.Error("US-002 still passes after its criteria changed")
+	}
+	if s := FindStory(merged, "US-003.1"); !s.Passes {
+		t.Error("split part US-003.1 lost its progress")
+	}
+	if s := FindStory(merged, "US-005"); s.Source == nil || !slices.Equal(s.Tags, []string{"ui"}) {
+		t.Errorf("US-005 = %+v, want source and tags kept", s)
+	}
+}
+
+func TestTitleSimilarity(t *testing.T) {
+	tests := []struct {
+		a, b string
+		min  float64
+		max  float64
+	}{
+		{"Add orders table", "add orders table", 1, 1},
+		{"Export orders as CSV", "Export all orders as CSV", 0.8, 0.9},
+		{"Add orders table", "Checkout", 0, 0},
+	}
+	for _, tt := range tests {
+		if got := titleSimilarity(tt.a, tt.b); got < tt.min || got > tt.max {
+			t.Errorf("titleSimilarity(%q, %q) = %v, want %v to %v", tt.a, tt.b, got, tt.min, tt.max)
+		}
+	}
+}
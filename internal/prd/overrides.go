@@ -0,0 +1,90 @@
+package prd
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Overrides are optional per-story execution settings. Fields that are set
+// take precedence over the CLI flags and config file for that story.
+type Overrides struct {
+	Model         string   `json:"model,omitempty" yaml:"model,omitempty"`
+	MaxTurns      int      `json:"maxTurns,omitempty" yaml:"maxTurns,omitempty"`
+	MaxBudget     float64  `json:"maxBudget,omitempty" yaml:"maxBudget,omitempty"`         // USD per agent session
+	MaxIterations int      `json:"maxIterations,omitempty" yaml:"maxIterations,omitempty"` // before the story is skipped
+	AllowedTools  []string `json:"allowedTools,omitempty" yaml:"allowedTools,omitempty"`
+	Timeout       string   `json:"timeout,omitempty" yaml:"timeout,omitempty"` // per agent session, e.g. "30m"
+	Prompt        string   `json:"prompt,omitempty" yaml:"prompt,omitempty"`   // extra text appended to the story prompt
+}
+
+// Validate checks that the overrides hold usable values.
+func (o *Overrides) Validate() error {
+	if problems := o.problems(); len(problems) > 0 {
+		return errors.New(problems[0].Message)
+	}
+	return nil
+}
+
+// problems reports every unusable override, with paths relative to the story.
+func (o *Overrides) problems() []Problem {
+	var problems []Problem
+	for _, f := range []struct {
+		name  string
+		value float64
+	}{
+		{"maxTurns", float64(o.MaxTurns)},
+		{"maxBudget", o.MaxBudget},
+		{"maxIterations", float64(o.MaxIterations)},
+	} {
+		if f.value < 0 {
+			problems = append(problems, Problem{f.name, f.name + " must not be negative"})
+		}
+	}
+	if o.Timeout != "" {
+		d, err := time.ParseDuration(o.Timeout)
+		switch {
+		case err != nil:
+			problems = append(problems, Problem{"timeout", fmt.Sprintf("invalid timeout %q: %v", o.Timeout, err)})
+		case d <= 0:
+			problems = append(problems, Problem{"timeout", fmt.Sprintf("timeout must be positive, got %q", o.Timeout)})
+		}
+	}
+	return problems
+}
+
+// Settings are the settings an agent works on a story with.
+type Settings struct {
+	Model         string
+	MaxTurns      int
+	MaxBudget     float64
+	MaxIterations int
+	AllowedTools  []string
+	Timeout       time.Duration // zero for none
+}
+
+// Effective returns base with the story's overrides applied. A timeout that
+// does not parse is ignored; Validate reports it. The extra prompt text is not
+// a setting: it is part of the story's prompt.
+func (s *UserStory) Effective(base Settings) Settings {
+	o := s.Overrides
+	if o.Model != "" {
+		base.Model = o.Model
+	}
+	if o.MaxTurns > 0 {
+		base.MaxTurns = o.MaxTurns
+	}
+	if o.MaxBudget > 0 {
+		base.MaxBudget = o.MaxBudget
+	}
+	if o.MaxIterations > 0 {
+		base.MaxIterations = o.MaxIterations
+	}
+	if len(o.AllowedTools) > 0 {
+		base.AllowedTools = o.AllowedTools
+	}
+	if d, err := time.ParseDuration(o.Timeout); err == nil && d > 0 {
+		base.Timeout = d
+	}
+	return base
+}
@@ -0,0 +1,83 @@
+package prd
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEffective(t *testing.T) {
+	base := Settings{
+		Model:         "claude-opus-4-6",
+		MaxTurns:      50,
+		MaxIterations: 10,
+		AllowedTools:  []string{"Bash", "Read"},
+	}
+
+	var plain UserStory
+	if got := plain.Effective(base); !reflect.DeepEqual(got, base) {
+		t.Errorf("no overrides: got %+v, want %+v", got, base)
+	}
+
+	s := UserStory{Overrides: Overrides{
+		Model:         "claude-sonnet-4-5",
+		MaxBudget:     2,
+		MaxIterations: 3,
+		AllowedTools:  []string{"Read"},
+		Timeout:       "15m",
+	}}
+	want := Settings{
+		Model:         "claude-sonnet-4-5",
+		MaxTurns:      50,
+		MaxBudget:     2,
+		MaxIterations: 3,
+		AllowedTools:  []string{"Read"},
+		Timeout:       15 * time.Minute,
+	}
+	if got := s.Effective(base); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestOverridesValidate(t *testing.T) {
+	tests := []struct {
+		o       Overrides
+		wantErr bool
+	}{
+		{Overrides{}, false},
+		{Overrides{Timeout: "1h30m", MaxTurns: 5}, false},
+		{Overrides{Timeout: "soon"}, true},
+		{Overrides{Timeout: "-5m"}, true},
+		{Overrides{MaxIterations: -1}, true},
+	}
+	for _, tt := range tests {
+		if err := tt.o.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("Validate(%+v) = %v, wantErr %v", tt.o, err, tt.wantErr)
+		}
+	}
+
+	p := testPRD()
+	p.UserStories[1].Timeout = "soon"
+	if err := Validate(p); err == nil {
+		t.Error("Validate accepted a story with an invalid timeout")
+	}
+}
+
+func TestOverridesJSON(t *testing.T) {
+	// Overrides are flat fields of the story and omitted when unset.
+	data, err := json.Marshal(UserStory{ID: "US-001", Overrides: Overrides{MaxTurns: 5}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil {
+		t.Fatal(err)
+	}
+	if fields["maxTurns"] != 5.0 {
+		t.Errorf("maxTurns = %v in %s", fields["maxTurns"], data)
+	}
+	if _, ok := fields["model"]; ok {
+		t.Errorf("unset model was written: %s", data)
+	}
+}
@@ -1,93 +1,81 @@
 package prd
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
-	"sort"
+
+	"github.com/radvoogh/ralph-wiggo/internal/fsutil"
 )
 
 // UserStory represents a single user story in the PRD.
 type UserStory struct {
-	ID                 string   `json:"id"`
-	Title              string   `json:"title"`
-	Description        string   `json:"description"`
-	AcceptanceCriteria []string `json:"acceptanceCriteria"`
-	Priority           int      `json:"priority"`
-	Passes             bool     `json:"passes"`
-	Notes              string   `json:"notes"`
+	ID                 string   `json:"id" yaml:"id"`
+	Title              string   `json:"title" yaml:"title"`
+	Description        string   `json:"description" yaml:"description"`
+	AcceptanceCriteria []string `json:"acceptanceCriteria" yaml:"acceptanceCriteria"`
+	Priority           int      `json:"priority" yaml:"priority"`
+	Passes             bool     `json:"passes" yaml:"passes"`
+	Notes              string   `json:"notes" yaml:"notes"`
+	Tags               []string `json:"tags,omitempty" yaml:"tags,omitempty"`
+	Source             *Source  `json:"source,omitempty" yaml:"source,omitempty"`
+	Overrides          `yaml:",inline"`
+}
+
+// Source identifies the issue-tracker item a story was imported from, so its
+// status can be reported back.
+type Source struct {
+	Tracker string `json:"tracker" yaml:"tracker"` // "github", "jira" or "csv"
+	Key     string `json:"key" yaml:"key"`         // the item's ID in the tracker, e.g. "42" or "PROJ-123"
+	URL     string `json:"url,omitempty" yaml:"url,omitempty"`
 }
 
 // PRD represents the full product requirements document.
 type PRD struct {
-	Project     string      `json:"project"`
-	BranchName  string      `json:"branchName"`
-	Description string      `json:"description"`
-	UserStories []UserStory `json:"userStories"`
+	// SchemaVersion is the version of the PRD schema. Loading migrates
+	// older files and saving writes the current version, so it is always
+	// SchemaVersion outside this package.
+	SchemaVersion int         `json:"schemaVersion" yaml:"schemaVersion"`
+	Project       string      `json:"project" yaml:"project"`
+	BranchName    string      `json:"branchName" yaml:"branchName"`
+	Description   string      `json:"description" yaml:"description"`
+	UserStories   []UserStory `json:"userStories" yaml:"userStories"`
 }
 
-// LoadPRD reads and parses a prd.json file from the given path.
+// LoadPRD reads and parses a PRD file from the given path. The format is
+// chosen by the file's extension (see FormatOf).
 func LoadPRD(path string) (*PRD, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("reading PRD file: %w", err)
 	}
 
-	var prd PRD
-	if err := json.Unmarshal(data, &prd); err != nil {
-		return nil, fmt.Errorf("parsing PRD JSON: %w", err)
-	}
-
-	return &prd, nil
+	return Unmarshal(data, FormatOf(path))
 }
 
-// SavePRD writes a PRD to the given path with indented JSON formatting.
+// SavePRD writes a PRD to the given path in the format chosen by its
+// extension. The write is atomic, so a crash never leaves a truncated file.
+// Use UpdatePRD or SavePRDIfUnchanged when another process may be editing the
+// file.
 func SavePRD(path string, prd *PRD) error {
-	data, err := json.MarshalIndent(prd, "", "  ")
+	data, err := Marshal(prd, FormatOf(path))
 	if err != nil {
-		return fmt.Errorf("marshaling PRD: %w", err)
+		return err
 	}
-	data = append(data, '\n')
 
-	if err := os.WriteFile(path, data, 0644); err != nil {
+	if err := fsutil.WriteFileAtomic(path, data, 0644); err != nil {
 		return fmt.Errorf("writing PRD file: %w", err)
 	}
 
 	return nil
 }
 
-// Validate checks a PRD for consistency: unique story IDs and sequential priorities.
+// Validate checks a PRD for consistency: unique story IDs, valid overrides
+// and sequential priorities. It returns the first problem Problems finds.
 func Validate(prd *PRD) error {
-	if len(prd.UserStories) == 0 {
-		return nil
-	}
-
-	// Check unique IDs.
-	ids := make(map[string]bool, len(prd.UserStories))
-	for _, s := range prd.UserStories {
-		if s.ID == "" {
-			return fmt.Errorf("story with priority %d has empty ID", s.Priority)
-		}
-		if ids[s.ID] {
-			return fmt.Errorf("duplicate story ID: %s", s.ID)
-		}
-		ids[s.ID] = true
+	if problems := Problems(prd); len(problems) > 0 {
+		return errors.New(problems[0].Message)
 	}
-
-	// Check sequential priorities (1, 2, 3, ...).
-	sorted := make([]UserStory, len(prd.UserStories))
-	copy(sorted, prd.UserStories)
-	sort.Slice(sorted, func(i, j int) bool {
-		return sorted[i].Priority < sorted[j].Priority
-	})
-
-	for i, s := range sorted {
-		expected := i + 1
-		if s.Priority != expected {
-			return fmt.Errorf("non-sequential priority: story %s has priority %d, expected %d", s.ID, s.Priority, expected)
-		}
-	}
-
 	return nil
 }
 
@@ -95,8 +83,13 @@ func Validate(prd *PRD) error {
 // use with claude --json-schema.
 const JSONSchema = `{
   "type": "object",
-  "required": ["project", "branchName", "description", "userStories"],
+  "required": ["schemaVersion", "project", "branchName", "description", "userStories"],
   "properties": {
+    "schemaVersion": {
+      "type": "integer",
+      "const": 1,
+      "description": "PRD schema version"
+    },
     "project": {
       "type": "string",
       "description": "Project name identifier"
@@ -143,6 +136,50 @@ const JSONSchema = `{
           "notes": {
             "type": "string",
             "description": "Additional implementation notes"
+          },
+          "tags": {
+            "type": "array",
+            "items": { "type": "string" },
+            "description": "Optional: labels for selecting stories, e.g. backend or ui"
+          },
+          "source": {
+            "type": "object",
+            "required": ["tracker", "key"],
+            "properties": {
+              "tracker": { "type": "string" },
+              "key": { "type": "string" },
+              "url": { "type": "string" }
+            },
+            "description": "Optional: the issue-tracker item the story was imported from"
+          },
+          "model": {
+            "type": "string",
+            "description": "Optional: model to use for this story instead of the default"
+          },
+          "maxTurns": {
+            "type": "integer",
+            "description": "Optional: maximum agentic turns per session for this story"
+          },
+          "maxBudget": {
+            "type": "number",
+            "description": "Optional: maximum budget in USD per session for this story"
+          },
+          "maxIterations": {
+            "type": "integer",
+            "description": "Optional: iterations before this story is skipped"
+          },
+          "allowedTools": {
+            "type": "array",
+            "items": { "type": "string" },
+            "description": "Optional: tools the agent may use for this story"
+          },
+          "timeout": {
+            "type": "string",
+            "description": "Optional: time limit per session as a Go duration (e.g. 30m)"
+          },
+          "prompt": {
+            "type": "string",
+            "description": "Optional: extra instructions appended to the story prompt"
           }
         }
       }
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"os"
 	"path/filepath"
+	"reflect"
 	"testing"
 )
 
@@ -255,3 +256,142 @@ func TestJSONSchema_ValidJSON(t *testing.T) {
 		t.Errorf("schema type = %v, want object", schema["type"])
 	}
 }
+
+func TestJSONSchema_SchemaVersion(t *testing.T) {
+	var schema struct {
+		Properties struct {
+			SchemaVersion struct {
+				Const int `json:"const"`
+			} `json:"schemaVersion"`
+		} `json:"properties"`
+	}
+	if err := json.Unmarshal([]byte(JSONSchema), &schema); err != nil {
+		t.Fatalf("JSONSchema is not valid JSON: %v", err)
+	}
+	if got := schema.Properties.SchemaVersion.Const; got != SchemaVersion {
+		t.Errorf("JSONSchema schemaVersion const = %d, want %d", got, SchemaVersion)
+	}
+}
+
+func TestFormatOf(t *testing.T) {
+	for path, want := range map[string]Format{
+		"prd.json":     FormatJSON,
+		"prd":          FormatJSON,
+		"prd.yaml":     FormatYAML,
+		"dir/prd.YML":  FormatYAML,
+		"prd.md":       FormatMarkdown,
+		"prd.markdown": FormatMarkdown,
+	} {
+		if got := FormatOf(path); got != want {
+			t.Errorf("FormatOf(%q) = %v, want %v", path, got, want)
+		}
+	}
+}
+
+func TestSavePRD_RoundTripFormats(t *testing.T) {
+	original := testPRD()
+	original.SchemaVersion = SchemaVersion
+	original.Description = "Line one\n\n## not a story"
+	// Stories the Markdown heading and body cannot hold verbatim.
+	original.UserStories = append(original.UserStories,
+		UserStory{ID: "US:3", Title: " padded ", Description: "  indented\n---\n## Heading", AcceptanceCriteria: []string{}, Priority: 3},
+		UserStory{ID: "", Title: "", Description: "", AcceptanceCriteria: []string{"a: b"}, Priority: 4, Notes: "multi\nline"},
+		UserStory{ID: "US-005", Title: "Overrides", AcceptanceCriteria: []string{}, Priority: 5, Tags: []string{"backend", "db"}, Source: &Source{Tracker: "jira", Key: "PROJ-7", URL: "https://example.atlassian.net/browse/PROJ-7"}, Overrides: Overrides{
+			Model: "claude-sonnet-4-5", MaxTurns: 20, MaxBudget: 1.5, MaxIterations: 3,
+			AllowedTools: []string{"Read", "Edit"}, Timeout: "30m", Prompt: "Keep the diff small.",
+		}},
+	)
+
+	for _, name := range []string{"prd.json", "prd.yaml", "prd.md"} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), name)
+			if err := SavePRD(path, original); err != nil {
+				t.Fatalf("SavePRD: %v", err)
+			}
+			loaded, err := LoadPRD(path)
+			if err != nil {
+				t.Fatalf("LoadPRD: %v", err)
+			}
+			if !reflect.DeepEqual(loaded, original) {
+				data, _ := os.ReadFile(path)
+				t.Errorf("round trip changed the PRD:\ngot  %+v\nwant %+v\nfile:\n%s", loaded, original, data)
+			}
+		})
+	}
+}
+
+func TestLoadPRD_Markdown(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "prd.md")
+	content := `---
+project: demo
+branchName: ralph/demo
+---
+
+# Demo PRD
+
+Notes for humans before the first story are ignored.
+
+## US-001: Add login
+
+---
+priority: 1
+passes: true
+acceptanceCriteria:
+  - Form renders
+---
+
+As a user, I want to log in.
+
+Second paragraph.
+
+## US-002: Add logout
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	p, err := LoadPRD(path)
+	if err != nil {
+		t.Fatalf("LoadPRD: %v", err)
+	}
+	if p.Project != "demo" || len(p.UserStories) != 2 {
+		t.Fatalf("PRD = %+v", p)
+	}
+	s := p.UserStories[0]
+	if s.ID != "US-001" || s.Title != "Add login" || !s.Passes || s.Priority != 1 || len(s.AcceptanceCriteria) != 1 {
+		t.Errorf("story 1 = %+v", s)
+	}
+	if s.Description != "As a user, I want to log in.\n\nSecond paragraph." {
+		t.Errorf("description = %q", s.Description)
+	}
+	if s := p.UserStories[1]; s.ID != "US-002" || s.Title != "Add logout" {
+		t.Errorf("story 2 = %+v", s)
+	}
+
+	if err := os.WriteFile(path, []byte("## US-001: A\n\n---\npriority: [\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadPRD(path); err == nil {
+		t.Error("expected error for unterminated frontmatter")
+	}
+}
+
+func TestMarshalStory_RoundTrip(t *testing.T) {
+	original := testPRD().UserStories[0]
+	for _, f := range []Format{FormatJSON, FormatYAML, FormatMarkdown} {
+		data, err := MarshalStory(&original, f)
+		if err != nil {
+			t.Fatalf("MarshalStory(%v): %v", f, err)
+		}
+		loaded, err := UnmarshalStory(data, f)
+		if err != nil {
+			t.Fatalf("UnmarshalStory(%v): %v", f, err)
+		}
+		if !reflect.DeepEqual(*loaded, original) {
+			t.Errorf("%v round trip = %+v, want %+v", f, *loaded, original)
+		}
+	}
+
+	if _, err := UnmarshalStory([]byte("no heading here\n"), FormatMarkdown); err == nil {
+		t.Error("expected error for Markdown without a story section")
+	}
+}
@@ -0,0 +1,322 @@
+package prd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// SchemaVersion is the version of the PRD schema this package reads and
+// writes. Files record it in schemaVersion; files without one are version 0.
+const SchemaVersion = 1
+
+// A Migration upgrades a PRD document from schema version From to From+1.
+// Migrations work on the decoded document (objects are map[string]any and
+// arrays []any), so they can rename, move or drop fields the current structs
+// no longer have.
+type Migration struct {
+	From        int
+	Description string
+	Apply       func(doc map[string]any) error
+}
+
+// migrations upgrade older documents, one version at a time. Whenever the
+// schema changes in a way older files do not already satisfy, bump
+// SchemaVersion and add the migration here.
+var migrations = []Migration{
+	{
+		From:        0,
+		Description: "record schemaVersion in unversioned PRDs",
+		Apply:       func(map[string]any) error { return nil },
+	},
+}
+
+// Migrate upgrades a decoded PRD document to SchemaVersion in place and
+// returns the descriptions of the migrations it applied. Documents newer than
+// SchemaVersion are an error.
+func Migrate(doc map[string]any) ([]string, error) {
+	version, err := documentVersion(doc)
+	if err != nil {
+		return nil, err
+	}
+	if version > SchemaVersion {
+		return nil, fmt.Errorf("PRD schema version %d is newer than this ralph-wiggo supports (%d); upgrade ralph-wiggo", version, SchemaVersion)
+	}
+
+	var applied []string
+	for _, m := range migrations {
+		if m.From < version {
+			continue
+		}
+		if err := m.Apply(doc); err != nil {
+			return applied, fmt.Errorf("migrating PRD from schema version %d: %w", m.From, err)
+		}
+		version = m.From + 1
+		doc["schemaVersion"] = version
+		applied = append(applied, m.Description)
+	}
+	return applied, nil
+}
+
+// Upgrade decodes a PRD file's contents like Unmarshal and also returns the
+// descriptions of the migrations that brought it to SchemaVersion, which are
+// none if the file is current.
+func Upgrade(data []byte, f Format) (*PRD, []string, error) {
+	doc, err := decodeDocument(data, f)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parsing PRD %s: %w", f, err)
+	}
+	applied, err := doc.migrate()
+	if err != nil {
+		return nil, nil, err
+	}
+	prd, err := doc.decode()
+	if err != nil {
+		return nil, nil, fmt.Errorf("parsing PRD %s: %w", f, err)
+	}
+	return prd, applied, nil
+}
+
+// documentVersion returns the schemaVersion of a decoded document.
+func documentVersion(doc map[string]any) (int, error) {
+	switch v := doc["schemaVersion"].(type) {
+	case nil:
+		return 0, nil
+	case int:
+		return v, nil
+	case float64:
+		if v == math.Trunc(v) && v >= 0 {
+			return int(v), nil
+		}
+	}
+	return 0, fmt.Errorf("invalid schemaVersion %v", doc["schemaVersion"])
+}
+
+// A Problem is something wrong with a PRD, located by a JSON path such as
+// $.userStories[2].priority.
+type Problem struct {
+	Path    string
+	Message string
+}
+
+// UnknownField is the message of problems reporting a field the schema does
+// not have. Such fields are ignored on load and dropped when the PRD is saved.
+const UnknownField = "unknown field"
+
+func (p Problem) String() string {
+	return p.Path + ": " + p.Message
+}
+
+// storyPath returns the JSON path of a field of the i-th story.
+func storyPath(i int, field string) string {
+	return fmt.Sprintf("$.userStories[%d].%s", i, field)
+}
+
+// Problems checks a PRD for consistency and returns every problem found:
+// empty or duplicate story IDs, invalid overrides, and priorities that are
+// not 1..N without gaps or repeats.
+func Problems(prd *PRD) []Problem {
+	var problems []Problem
+	ids := make(map[string]bool, len(prd.UserStories))
+	for i, s := range prd.UserStories {
+		switch {
+		case s.ID == "":
+			problems = append(problems, Problem{storyPath(i, "id"), fmt.Sprintf("story with priority %d has empty ID", s.Priority)})
+		case ids[s.ID]:
+			problems = append(problems, Problem{storyPath(i, "id"), fmt.Sprintf("duplicate story ID: %s", s.ID)})
+		}
+		ids[s.ID] = true
+		for _, p := range s.Overrides.problems() {
+			problems = append(problems, Problem{storyPath(i, p.Path), fmt.Sprintf("story %s: %s", s.ID, p.Message)})
+		}
+	}
+
+	// Priorities must be a permutation of 1..N.
+	n := len(prd.UserStories)
+	order := make([]int, n)
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return prd.UserStories[order[a]].Priority < prd.UserStories[order[b]].Priority
+	})
+	holder := make(map[int]string, n)
+	for _, i := range order {
+		s := prd.UserStories[i]
+		switch {
+		case s.Priority < 1 || s.Priority > n:
+			problems = append(problems, Problem{storyPath(i, "priority"),
+				fmt.Sprintf("non-sequential priority: story %s has priority %d, expected 1 to %d", s.ID, s.Priority, n)})
+		case holder[s.Priority] != "":
+			problems = append(problems, Problem{storyPath(i, "priority"),
+				fmt.Sprintf("non-sequential priority: story %s has priority %d, like %s", s.ID, s.Priority, holder[s.Priority])})
+		default:
+			holder[s.Priority] = s.ID
+		}
+	}
+	return problems
+}
+
+// Check decodes a PRD file's contents in the given format, migrating them in
+// memory if they are older, and returns every problem: fields the schema does
+// not have, values of the wrong type and the consistency problems reported by
+// Problems. The error is for contents that cannot be decoded at all.
+func Check(data []byte, f Format) ([]Problem, error) {
+	doc, err := decodeDocument(data, f)
+	if err != nil {
+		return nil, fmt.Errorf("parsing PRD %s: %w", f, err)
+	}
+	if _, err := doc.migrate(); err != nil {
+		return nil, err
+	}
+
+	// YAML, and so Markdown frontmatter, decodes any scalar into a string.
+	problems := checkValue(doc.values, reflect.TypeFor[PRD](), "$", f != FormatJSON)
+	prd, err := doc.decode()
+	if err != nil && (len(problems) == 0 || !isTypeError(err)) {
+		return nil, fmt.Errorf("parsing PRD %s: %w", f, err)
+	}
+	// Values of the wrong type decode to zero values, so skip consistency
+	// problems where a type problem was already reported.
+	reported := make(map[string]bool, len(problems))
+	for _, p := range problems {
+		reported[p.Path] = true
+	}
+	for _, p := range Problems(prd) {
+		if !reported[p.Path] {
+			problems = append(problems, p)
+		}
+	}
+	return problems, nil
+}
+
+// isTypeError reports whether err is a decoding error for values of the wrong
+// type, after which the rest of the document was still decoded.
+func isTypeError(err error) bool {
+	var jsonErr *json.UnmarshalTypeError
+	var yamlErr *yaml.TypeError
+	return errors.As(err, &jsonErr) || errors.As(err, &yamlErr)
+}
+
+// checkValue reports where a decoded value does not fit the Go type t: object
+// fields t does not have and values of the wrong type. looseStrings accepts
+// any scalar where a string is expected.
+func checkValue(v any, t reflect.Type, path string, looseStrings bool) []Problem {
+	if v == nil {
+		return nil // null decodes to the zero value
+	}
+	wrongType := func(want string) []Problem {
+		return []Problem{{path, fmt.Sprintf("must be %s, got %s", want, describeValue(v))}}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return checkValue(v, t.Elem(), path, looseStrings)
+	case reflect.Struct:
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return wrongType("an object")
+		}
+		fields := jsonFields(t)
+		var problems []Problem
+		for _, key := range slices.Sorted(maps.Keys(obj)) {
+			ft, ok := fields[key]
+			if !ok {
+				problems = append(problems, Problem{path + "." + key, UnknownField})
+				continue
+			}
+			problems = append(problems, checkValue(obj[key], ft, path+"."+key, looseStrings)...)
+		}
+		return problems
+	case reflect.Slice:
+		arr, ok := v.([]any)
+		if !ok {
+			return wrongType("an array")
+		}
+		var problems []Problem
+		for i, elem := range arr {
+			problems = append(problems, checkValue(elem, t.Elem(), fmt.Sprintf("%s[%d]", path, i), looseStrings)...)
+		}
+		return problems
+	case reflect.String:
+		switch v.(type) {
+		case string:
+			return nil
+		case int, float64, bool:
+			if looseStrings {
+				return nil
+			}
+		}
+		return wrongType("a string")
+	case reflect.Int:
+		switch n := v.(type) {
+		case int:
+			return nil
+		case float64:
+			if n == math.Trunc(n) {
+				return nil
+			}
+		}
+		return wrongType("an integer")
+	case reflect.Float64:
+		switch v.(type) {
+		case int, float64:
+			return nil
+		}
+		return wrongType("a number")
+	case reflect.Bool:
+		if _, ok := v.(bool); ok {
+			return nil
+		}
+		return wrongType("true or false")
+	}
+	return nil
+}
+
+// jsonFields maps the JSON field names of struct type t, including those of
+// embedded structs, to their types.
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	for i := range t.NumField() {
+		f := t.Field(i)
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			maps.Copy(fields, jsonFields(f.Type))
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" || !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[name] = f.Type
+	}
+	return fields
+}
+
+// describeValue names the type of a decoded value for error messages.
+func describeValue(v any) string {
+	switch v := v.(type) {
+	case string:
+		return fmt.Sprintf("string %q", v)
+	case int, float64:
+		return fmt.Sprintf("number %v", v)
+	case bool:
+		return fmt.Sprintf("%v", v)
+	case []any:
+		return "an array"
+	case map[string]any:
+		return "an object"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
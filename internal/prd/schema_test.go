@@ -0,0 +1,149 @@
+package prd
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func problemStrings(problems []Problem) []string {
+	var out []string
+	for _, p := range problems {
+		out = append(out, p.String())
+	}
+	return out
+}
+
+func TestMigrate_Unversioned(t *testing.T) {
+	doc := map[string]any{"project": "X"}
+	applied, err := Migrate(doc)
+	if err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	if len(applied) != SchemaVersion {
+		t.Errorf("applied %d migrations, want %d: %v", len(applied), SchemaVersion, applied)
+	}
+	if doc["schemaVersion"] != SchemaVersion {
+		t.Errorf("schemaVersion = %v, want %d", doc["schemaVersion"], SchemaVersion)
+	}
+
+	applied, err = Migrate(doc)
+	if err != nil || len(applied) != 0 {
+		t.Errorf("Migrate of current document = %v, %v; want no migrations", applied, err)
+	}
+}
+
+func TestMigrate_TooNew(t *testing.T) {
+	doc := map[string]any{"schemaVersion": float64(SchemaVersion + 1)}
+	if _, err := Migrate(doc); err == nil || !strings.Contains(err.Error(), "newer") {
+		t.Errorf("Migrate of newer document = %v, want version error", err)
+	}
+}
+
+func TestUpgrade(t *testing.T) {
+	p, applied, err := Upgrade([]byte(`{"project":"X","userStories":[]}`), FormatJSON)
+	if err != nil {
+		t.Fatalf("Upgrade: %v", err)
+	}
+	if len(applied) == 0 {
+		t.Error("Upgrade of unversioned PRD applied no migrations")
+	}
+	if p.SchemaVersion != SchemaVersion || p.Project != "X" {
+		t.Errorf("Upgrade = %+v", p)
+	}
+}
+
+func TestCheck_ReportsEveryProblem(t *testing.T) {
+	data := `{
+  "schemaVersion": 1,
+  "project": "X",
+  "extra": true,
+  "userStories": [
+    {"id": "A", "title": "a", "priority": 1, "passes": "no", "foo": 1},
+    {"id": "A", "title": 7, "priority": 3, "timeout": "soon"}
+  ]
+}`
+	problems, err := Check([]byte(data), FormatJSON)
+	if err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+	got := problemStrings(problems)
+	for _, want := range []string{
+		"$.extra: unknown field",
+		"$.userStories[0].foo: unknown field",
+		`$.userStories[0].passes: must be true or false, got string "no"`,
+		"$.userStories[1].title: must be a string, got number 7",
+		"$.userStories[1].id: duplicate story ID: A",
+		`$.userStories[1].timeout: story A: invalid timeout "soon": time: invalid duration "soon"`,
+		"$.userStories[1].priority: non-sequential priority: story A has priority 3, expected 1 to 2",
+	} {
+		if !slices.Contains(got, want) {
+			t.Errorf("Check missing %q; got:\n%s", want, strings.Join(got, "\n"))
+		}
+	}
+}
+
+func TestCheck_YAML(t *testing.T) {
+	data := `project: X
+userStories:
+  - id: 001
+    title: yes
+    priority: high
+    tags: backend
+`
+	problems, err := Check([]byte(data), FormatYAML)
+	if err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+	got := problemStrings(problems)
+	want := []string{
+		`$.userStories[0].priority: must be an integer, got string "high"`,
+		`$.userStories[0].tags: must be an array, got string "backend"`,
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("Check = %q, want %q", got, want)
+	}
+}
+
+func TestCheck_Valid(t *testing.T) {
+	data, err := Marshal(testPRD(), FormatMarkdown)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	problems, err := Check(data, FormatMarkdown)
+	if err != nil || len(problems) != 0 {
+		t.Errorf("Check of valid PRD = %v, %v", problems, err)
+	}
+}
+
+func TestUnmarshal_YAMLScalarsVerbatim(t *testing.T) {
+	data := "userStories:\n  - id: 001\n    title: 1.50\n    priority: 1\n"
+	p, err := Unmarshal([]byte(data), FormatYAML)
+	if err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	s := p.UserStories[0]
+	if s.ID != "001" || s.Title != "1.50" {
+		t.Errorf("story = %q %q, want 001 1.50", s.ID, s.Title)
+	}
+	if p.SchemaVersion != SchemaVersion {
+		t.Errorf("SchemaVersion = %d, want %d", p.SchemaVersion, SchemaVersion)
+	}
+}
+
+func TestProblems_Priorities(t *testing.T) {
+	p := &PRD{UserStories: []UserStory{
+		{ID: "A", Priority: 1},
+		{ID: "B", Priority: 1},
+		{ID: "", Priority: 0},
+	}}
+	got := problemStrings(Problems(p))
+	want := []string{
+		"$.userStories[2].id: story with priority 0 has empty ID",
+		"$.userStories[2].priority: non-sequential priority: story  has priority 0, expected 1 to 3",
+		"$.userStories[1].priority: non-sequential priority: story B has priority 1, like A",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("Problems = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,103 @@
+package prd
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// HasTag reports whether the story has the given tag. Tags compare
+// case-insensitively.
+func (s *UserStory) HasTag(tag string) bool {
+	return slices.ContainsFunc(s.Tags, func(t string) bool {
+		return strings.EqualFold(t, tag)
+	})
+}
+
+// Tags returns the distinct tags of the PRD's stories, sorted
+// case-insensitively.
+func Tags(prd *PRD) []string {
+	var tags []string
+	for _, s := range prd.UserStories {
+		for _, t := range s.Tags {
+			if !slices.ContainsFunc(tags, func(have string) bool { return strings.EqualFold(have, t) }) {
+				tags = append(tags, t)
+			}
+		}
+	}
+	slices.SortFunc(tags, func(a, b string) int {
+		return strings.Compare(strings.ToLower(a), strings.ToLower(b))
+	})
+	return tags
+}
+
+// Selector picks the stories a run works on. The zero Selector picks every
+// story; each field that is set narrows the selection.
+type Selector struct {
+	Only    []string // tags; a story must have at least one
+	Exclude []string // tags; a story must have none
+	IDs     []string // stories to pick
+	From    string   // story ID; stories before it in priority order are left out
+}
+
+// IsZero reports whether sel picks every story.
+func (sel Selector) IsZero() bool {
+	return len(sel.Only) == 0 && len(sel.Exclude) == 0 && len(sel.IDs) == 0 && sel.From == ""
+}
+
+// Check reports story IDs and tags in sel that no story in the PRD has, which
+// are most likely typos.
+func (sel Selector) Check(prd *PRD) error {
+	for _, id := range sel.IDs {
+		if FindStory(prd, id) == nil {
+			return fmt.Errorf("story %s not found", id)
+		}
+	}
+	if sel.From != "" && FindStory(prd, sel.From) == nil {
+		return fmt.Errorf("story %s not found", sel.From)
+	}
+	for _, tag := range slices.Concat(sel.Only, sel.Exclude) {
+		if !slices.ContainsFunc(prd.UserStories, func(s UserStory) bool { return s.HasTag(tag) }) {
+			return fmt.Errorf("no story has tag %q", tag)
+		}
+	}
+	return nil
+}
+
+// Matches reports whether sel picks story s of the PRD. Stories split from a
+// story (see SplitStory) count as that story, so a selection keeps covering
+// the work after a split.
+func (sel Selector) Matches(prd *PRD, s *UserStory) bool {
+	if len(sel.Only) > 0 && !slices.ContainsFunc(sel.Only, s.HasTag) {
+		return false
+	}
+	if slices.ContainsFunc(sel.Exclude, s.HasTag) {
+		return false
+	}
+	if len(sel.IDs) > 0 && !slices.ContainsFunc(sel.IDs, func(id string) bool { return splitFrom(s.ID, id) }) {
+		return false
+	}
+	if sel.From != "" {
+		if from, ok := sel.fromPriority(prd); ok && s.Priority < from {
+			return false
+		}
+	}
+	return true
+}
+
+// fromPriority returns the priority of the From story, or of the first story
+// split from it. It reports false if neither exists.
+func (sel Selector) fromPriority(prd *PRD) (int, bool) {
+	priority, found := 0, false
+	for _, s := range prd.UserStories {
+		if splitFrom(s.ID, sel.From) && (!found || s.Priority < priority) {
+			priority, found = s.Priority, true
+		}
+	}
+	return priority, found
+}
+
+// splitFrom reports whether id is base or the ID of a story split from it.
+func splitFrom(id, base string) bool {
+	return id == base || strings.HasPrefix(id, base+".")
+}
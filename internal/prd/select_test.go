@@ -0,0 +1,73 @@
+package prd
+
+import (
+	"slices"
+	"testing"
+)
+
+func selectPRD() *PRD {
+	return &PRD{UserStories: []UserStory{
+		{ID: "US-001", Priority: 1, Tags: []string{"backend"}},
+		{ID: "US-002", Priority: 2, Tags: []string{"UI"}},
+		{ID: "US-003.1", Priority: 3, Tags: []string{"backend", "ui"}},
+		{ID: "US-003.2", Priority: 4},
+		{ID: "US-004", Priority: 5},
+	}}
+}
+
+func selected(p *PRD, sel Selector) []string {
+	var ids []string
+	for i := range p.UserStories {
+		if sel.Matches(p, &p.UserStories[i]) {
+			ids = append(ids, p.UserStories[i].ID)
+		}
+	}
+	return ids
+}
+
+func TestSelectorMatches(t *testing.T) {
+	p := selectPRD()
+	tests := []struct {
+		name string
+		sel  Selector
+		want []string
+	}{
+		{"zero", Selector{}, []string{"US-001", "US-002", "US-003.1", "US-003.2", "US-004"}},
+		{"only", Selector{Only: []string{"ui"}}, []string{"US-002", "US-003.1"}},
+		{"exclude", Selector{Exclude: []string{"ui"}}, []string{"US-001", "US-003.2", "US-004"}},
+		{"only and exclude", Selector{Only: []string{"backend"}, Exclude: []string{"ui"}}, []string{"US-001"}},
+		{"ids include split parts", Selector{IDs: []string{"US-003", "US-004"}}, []string{"US-003.1", "US-003.2", "US-004"}},
+		{"from", Selector{From: "US-002"}, []string{"US-002", "US-003.1", "US-003.2", "US-004"}},
+		{"from split story", Selector{From: "US-003"}, []string{"US-003.1", "US-003.2", "US-004"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := selected(p, tt.sel); !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSelectorCheck(t *testing.T) {
+	p := selectPRD()
+	if err := (Selector{Only: []string{"Backend"}, IDs: []string{"US-004"}, From: "US-002"}).Check(p); err != nil {
+		t.Errorf("Check: %v", err)
+	}
+	for _, sel := range []Selector{
+		{IDs: []string{"US-404"}},
+		{From: "US-404"},
+		{Only: []string{"frontend"}},
+		{Exclude: []string{"frontend"}},
+	} {
+		if err := sel.Check(p); err == nil {
+			t.Errorf("Check(%+v) accepted an unknown ID or tag", sel)
+		}
+	}
+}
+
+func TestTags(t *testing.T) {
+	if got, want := Tags(selectPRD()), []string{"backend", "UI"}; !slices.Equal(got, want) {
+		t.Errorf("Tags = %v, want %v", got, want)
+	}
+}
@@ -87,6 +87,93 @@ func summarizeEvents(events []claude.StreamEvent) string {
 	return sb.String()
 }
 
+// entryTimeLayout is the timestamp format of progress entry headings.
+const entryTimeLayout = "2006-01-02 15:04:05"
+
+// Entry is one iteration summary read back from a progress.txt file.
+type Entry struct {
+	Time    time.Time `json:"time"`
+	StoryID string    `json:"storyId"`
+	Passed  bool      `json:"passed"`
+	Body    string    `json:"body"` // summary lines, without the trailing separator
+}
+
+// ParseEntries reads the iteration summaries written by AppendEntry. Lines
+// outside an entry, such as the header and notes added by agents, are
+// ignored. A missing file yields no entries.
+func ParseEntries(path string) ([]Entry, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("opening progress file: %w", err)
+	}
+	defer f.Close()
+
+	var entries []Entry
+	var cur *Entry
+	var body strings.Builder
+	flush := func() {
+		if cur != nil {
+			cur.Body = body.String()
+			entries = append(entries, *cur)
+			cur = nil
+		}
+		body.Reset()
+	}
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if e, ok := parseEntryHeading(line); ok {
+			flush()
+			cur = &e
+			continue
+		}
+		if cur == nil {
+			continue
+		}
+		if line == "---" {
+			flush()
+			continue
+		}
+		body.WriteString(line)
+		body.WriteString("\n")
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading progress file: %w", err)
+	}
+	flush()
+	return entries, nil
+}
+
+// parseEntryHeading parses a "## <time> - <story> [PASS|FAIL]" line.
+func parseEntryHeading(line string) (Entry, bool) {
+	rest, ok := strings.CutPrefix(line, "## ")
+	if !ok || len(rest) < len(entryTimeLayout) {
+		return Entry{}, false
+	}
+	t, err := time.ParseInLocation(entryTimeLayout, rest[:len(entryTimeLayout)], time.Local)
+	if err != nil {
+		return Entry{}, false
+	}
+	rest, ok = strings.CutPrefix(rest[len(entryTimeLayout):], " - ")
+	if !ok {
+		return Entry{}, false
+	}
+	var passed bool
+	switch {
+	case strings.HasSuffix(rest, " [PASS]"):
+		passed = true
+	case strings.HasSuffix(rest, " [FAIL]"):
+	default:
+		return Entry{}, false
+	}
+	return Entry{Time: t, StoryID: rest[:len(rest)-len(" [PASS]")], Passed: passed}, true
+}
+
 // readProgressBranch reads the "Branch:" line from a progress.txt file header.
 func readProgressBranch(path string) (string, error) {
 	f, err := os.Open(path)
@@ -111,7 +198,7 @@ func readProgressBranch(path string) (string, error) {
 
 // ArchiveIfBranchChanged checks whether an existing progress.txt was created
 // for a different branch than the current PRD. If so, it moves progress.txt
-// (and prd.json if present) to an archive directory. Returns true if archiving
+// (and a copy of the PRD file if present) to an archive directory. Returns true if archiving
 // was performed.
 func ArchiveIfBranchChanged(workDir, prdPath, progressPath, currentBranch string) (bool, error) {
 	// Check if progress.txt exists.
@@ -144,10 +231,10 @@ func ArchiveIfBranchChanged(workDir, prdPath, progressPath, currentBranch string
 		return false, fmt.Errorf("archiving progress.txt: %w", err)
 	}
 
-	// Move prd.json to archive if it exists (it may have been overwritten already).
+	// Copy the PRD to archive if it exists (it may have been overwritten already).
 	// We copy instead of move since the current PRD needs to stay.
 	if prdData, readErr := os.ReadFile(prdPath); readErr == nil {
-		_ = os.WriteFile(filepath.Join(archiveDir, "prd.json"), prdData, 0644)
+		_ = os.WriteFile(filepath.Join(archiveDir, filepath.Base(prdPath)), prdData, 0644)
 	}
 
 	return true, nil
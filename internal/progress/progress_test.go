@@ -122,6 +122,53 @@ func TestAppendEntry_Fail(t *testing.T) {
 	}
 }
 
+func TestParseEntries(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "progress.txt")
+
+	if err := InitIfNeeded(path, "test-project", "ralph/test-branch"); err != nil {
+		t.Fatal(err)
+	}
+	if err := AppendEntry(path, "US-001", false, []claude.StreamEvent{
+		{Type: claude.EventError, Message: "tests failed"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	// Agents append their own notes between entries.
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("\nCodebase pattern: use table tests\n")
+	f.Close()
+	if err := AppendEntry(path, "US-001", true, []claude.StreamEvent{
+		{Type: claude.EventToolUse, ToolName: "Edit"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := ParseEntries(path)
+	if err != nil {
+		t.Fatalf("ParseEntries: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2: %+v", len(entries), entries)
+	}
+	if e := entries[0]; e.StoryID != "US-001" || e.Passed || e.Body != "- Error: tests failed\n" {
+		t.Errorf("entries[0] = %+v", e)
+	}
+	if e := entries[1]; !e.Passed || !strings.Contains(e.Body, "Edit(1)") || e.Time.IsZero() {
+		t.Errorf("entries[1] = %+v", e)
+	}
+}
+
+func TestParseEntries_MissingFile(t *testing.T) {
+	entries, err := ParseEntries(filepath.Join(t.TempDir(), "progress.txt"))
+	if err != nil || entries != nil {
+		t.Errorf("ParseEntries = %v, %v; want nil, nil", entries, err)
+	}
+}
+
 func TestArchiveIfBranchChanged_NoProgressFile(t *testing.T) {
 	dir := t.TempDir()
 
@@ -0,0 +1,371 @@
+// Package search provides an in-memory full-text index over recorded agent
+// session events, so iterations can be found by what the agent said or did.
+package search
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/radvoogh/ralph-wiggo/internal/claude"
+)
+
+// maxDocText caps how much text of a single event is indexed and kept for
+// snippets. Tool outputs beyond this are rarely useful search targets.
+const maxDocText = 64 * 1024
+
+// snippetRadius is the number of characters shown either side of a match.
+const snippetRadius = 80
+
+// Query describes a search. Text is split into terms that must all match;
+// double-quoted parts must additionally match as exact phrases. The other
+// fields, when set, restrict hits to a run, story or tool name.
+type Query struct {
+	Text    string
+	RunID   string
+	StoryID string
+	Tool    string
+	Limit   int // maximum number of hits; 0 means no limit
+}
+
+// Hit is a single matching event.
+type Hit struct {
+	RunID     string
+	StoryID   string
+	Iteration int
+	Offset    int // index of the event within the iteration
+	Type      claude.EventType
+	ToolName  string
+	Snippet   string
+	Score     int
+}
+
+// Anchor returns the fragment identifying the event on the run story page.
+func (h Hit) Anchor() string {
+	return fmt.Sprintf("iter-%d-evt-%d", h.Iteration, h.Offset)
+}
+
+// URL returns the dashboard path of the run story page, scrolled to the event.
+func (h Hit) URL() string {
+	return fmt.Sprintf("/history/%s/story/%s#%s", h.RunID, h.StoryID, h.Anchor())
+}
+
+// doc is an indexed event.
+type doc struct {
+	runID     string
+	storyID   string
+	iteration int
+	offset    int
+	typ       claude.EventType
+	toolName  string
+	text      string // original text, for snippets and phrase checks
+	lower     string // lowercased text
+}
+
+// Index is an inverted index from terms to events. It is safe for concurrent
+// use.
+type Index struct {
+	mu       sync.RWMutex
+	docs     []doc
+	postings map[string][]int32 // term -> ascending doc indices
+}
+
+// NewIndex returns an empty index.
+func NewIndex() *Index {
+	return &Index{postings: make(map[string][]int32)}
+}
+
+// AddIteration indexes the events of one iteration. Tool results are indexed
+// under the name of the tool call they answer.
+func (ix *Index) AddIteration(runID, storyID string, iteration int, events []claude.StreamEvent) {
+	toolNames := make(map[string]string)
+	for _, evt := range events {
+		if evt.Type == claude.EventToolUse && evt.ToolID != "" {
+			toolNames[evt.ToolID] = evt.ToolName
+		}
+	}
+
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	for offset, evt := range events {
+		d := doc{
+			runID:     runID,
+			storyID:   storyID,
+			iteration: iteration,
+			offset:    offset,
+			typ:       evt.Type,
+		}
+		switch evt.Type {
+		case claude.EventAssistant, claude.EventError:
+			d.text = evt.Message
+		case claude.EventToolUse:
+			d.toolName = evt.ToolName
+			d.text = evt.ToolName + " " + inputText(evt.Input)
+		case claude.EventToolResult:
+			d.toolName = toolNames[evt.ToolID]
+			d.text = evt.OutputText()
+		default:
+			continue
+		}
+		if d.text == "" {
+			continue
+		}
+		d.text = truncate(d.text, maxDocText)
+		d.lower = strings.ToLower(d.text)
+
+		id := int32(len(ix.docs))
+		ix.docs = append(ix.docs, d)
+		seen := make(map[string]bool)
+		for _, term := range tokenize(d.lower) {
+			if !seen[term] {
+				seen[term] = true
+				ix.postings[term] = append(ix.postings[term], id)
+			}
+		}
+	}
+}
+
+// Search returns the events matching q, best matches first. Among equally
+// scored hits, more recently indexed events come first.
+func (ix *Index) Search(q Query) []Hit {
+	terms, phrases := parseQuery(q.Text)
+	if len(terms) == 0 {
+		return nil
+	}
+
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	// Intersect postings, starting from the rarest term.
+	sort.Slice(terms, func(i, j int) bool {
+		return len(ix.postings[terms[i]]) < len(ix.postings[terms[j]])
+	})
+	candidates := ix.postings[terms[0]]
+	for _, term := range terms[1:] {
+		candidates = intersect(candidates, ix.postings[term])
+	}
+
+	var hits []Hit
+	for _, id := range candidates {
+		d := &ix.docs[id]
+		if q.RunID != "" && d.runID != q.RunID {
+			continue
+		}
+		if q.StoryID != "" && d.storyID != q.StoryID {
+			continue
+		}
+		if q.Tool != "" && !strings.EqualFold(d.toolName, q.Tool) {
+			continue
+		}
+		if !containsAll(d.lower, phrases) {
+			continue
+		}
+		score := 0
+		for _, term := range terms {
+			score += strings.Count(d.lower, term)
+		}
+		hits = append(hits, Hit{
+			RunID:     d.runID,
+			StoryID:   d.storyID,
+			Iteration: d.iteration,
+			Offset:    d.offset,
+			Type:      d.typ,
+			ToolName:  d.toolName,
+			Snippet:   snippet(d.text, d.lower, firstMatch(d.lower, phrases, terms)),
+			Score:     score,
+		})
+	}
+
+	// candidates are in index order, so a stable sort on score keeps later
+	// (more recent) events last; reverse the tie order explicitly.
+	sort.SliceStable(hits, func(i, j int) bool {
+		return hits[i].Score > hits[j].Score
+	})
+	reverseTies(hits)
+
+	if q.Limit > 0 && len(hits) > q.Limit {
+		hits = hits[:q.Limit]
+	}
+	return hits
+}
+
+// Len returns the number of indexed events.
+func (ix *Index) Len() int {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	return len(ix.docs)
+}
+
+// Terms returns the lowercased search terms of query text, for highlighting
+// matches.
+func Terms(text string) []string {
+	terms, _ := parseQuery(text)
+	return terms
+}
+
+// parseQuery splits query text into lowercased terms and quoted phrases.
+// Terms inside phrases are also returned as terms so they use the index.
+func parseQuery(text string) (terms, phrases []string) {
+	parts := strings.Split(strings.ToLower(text), `"`)
+	for i, part := range parts {
+		if i%2 == 1 {
+			if p := strings.TrimSpace(part); p != "" {
+				phrases = append(phrases, p)
+			}
+		}
+		terms = append(terms, tokenize(part)...)
+	}
+	seen := make(map[string]bool)
+	uniq := terms[:0]
+	for _, t := range terms {
+		if !seen[t] {
+			seen[t] = true
+			uniq = append(uniq, t)
+		}
+	}
+	return uniq, phrases
+}
+
+// tokenize splits lowercased text into index terms: runs of letters, digits
+// and underscores of at least two characters.
+func tokenize(s string) []string {
+	fields := strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	})
+	terms := fields[:0]
+	for _, f := range fields {
+		if utf8.RuneCountInString(f) >= 2 {
+			terms = append(terms, f)
+		}
+	}
+	return terms
+}
+
+// inputText flattens a tool_use input object into searchable text: all
+// string values (recursively), separated by spaces.
+func inputText(raw json.RawMessage) string {
+	var v any
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return string(raw)
+	}
+	var sb strings.Builder
+	var walk func(v any)
+	walk = func(v any) {
+		switch x := v.(type) {
+		case string:
+			sb.WriteString(x)
+			sb.WriteByte(' ')
+		case []any:
+			for _, e := range x {
+				walk(e)
+			}
+		case map[string]any:
+			keys := make([]string, 0, len(x))
+			for k := range x {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				walk(x[k])
+			}
+		}
+	}
+	walk(v)
+	return strings.TrimSpace(sb.String())
+}
+
+// intersect returns the common elements of two ascending slices.
+func intersect(a, b []int32) []int32 {
+	var out []int32
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] < b[j]:
+			i++
+		case a[i] > b[j]:
+			j++
+		default:
+			out = append(out, a[i])
+			i++
+			j++
+		}
+	}
+	return out
+}
+
+// containsAll reports whether s contains every phrase.
+func containsAll(s string, phrases []string) bool {
+	for _, p := range phrases {
+		if !strings.Contains(s, p) {
+			return false
+		}
+	}
+	return true
+}
+
+// firstMatch returns the byte offset in lower of the first phrase or term
+// found, or 0.
+func firstMatch(lower string, phrases, terms []string) int {
+	for _, list := range [][]string{phrases, terms} {
+		for _, p := range list {
+			if i := strings.Index(lower, p); i >= 0 {
+				return i
+			}
+		}
+	}
+	return 0
+}
+
+// snippet returns a single-line excerpt of text around byte offset at.
+// lower must be the lowercased text; offsets are mapped through it, which is
+// exact for the ASCII text that makes up nearly all agent output.
+func snippet(text, lower string, at int) string {
+	if len(lower) != len(text) {
+		at = 0
+	}
+	start, end := max(0, at-snippetRadius), min(len(text), at+snippetRadius)
+	for start > 0 && !utf8.RuneStart(text[start]) {
+		start--
+	}
+	for end < len(text) && !utf8.RuneStart(text[end]) {
+		end++
+	}
+	s := strings.Join(strings.Fields(text[start:end]), " ")
+	if start > 0 {
+		s = "…" + s
+	}
+	if end < len(text) {
+		s += "…"
+	}
+	return s
+}
+
+// reverseTies reverses each run of equal-score hits so that, within a score,
+// more recently indexed events come first.
+func reverseTies(hits []Hit) {
+	for i := 0; i < len(hits); {
+		j := i
+		for j < len(hits) && hits[j].Score == hits[i].Score {
+			j++
+		}
+		for a, b := i, j-1; a < b; a, b = a+1, b-1 {
+			hits[a], hits[b] = hits[b], hits[a]
+		}
+		i = j
+	}
+}
+
+// truncate limits s to at most n bytes without splitting a rune.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
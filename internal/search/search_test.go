@@ -0,0 +1,86 @@
+package search
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/radvoogh/ralph-wiggo/internal/claude"
+)
+
+func output(s string) json.RawMessage {
+	data, _ := json.Marshal(s)
+	return data
+}
+
+func testIndex() *Index {
+	ix := NewIndex()
+	ix.AddIteration("run-1", "US-001", 1, []claude.StreamEvent{
+		{Type: claude.EventInit, SessionID: "s1"},
+		{Type: claude.EventAssistant, Message: "Running the migration tests now."},
+		{Type: claude.EventToolUse, ToolName: "Bash", ToolID: "t1", Input: json.RawMessage(`{"command":"go test ./internal/db/..."}`)},
+		{Type: claude.EventToolResult, ToolID: "t1", Output: output("FAIL: TestMigrate\nconnection refused"), IsError: true},
+	})
+	ix.AddIteration("run-2", "US-002", 3, []claude.StreamEvent{
+		{Type: claude.EventToolUse, ToolName: "Edit", ToolID: "t2", Input: json.RawMessage(`{"file_path":"internal/db/migrate.go","old_string":"a","new_string":"b"}`)},
+		{Type: claude.EventError, Message: "connection refused by upstream"},
+	})
+	return ix
+}
+
+func TestSearchMatchesEventKinds(t *testing.T) {
+	ix := testIndex()
+	if ix.Len() != 5 {
+		t.Fatalf("Len = %d, want 5 (init events are not indexed)", ix.Len())
+	}
+
+	tests := []struct {
+		name string
+		q    Query
+		want []string // "run/story/iteration/offset"
+	}{
+		{"assistant text", Query{Text: "migration"}, []string{"run-1/US-001/1/1"}},
+		{"tool input", Query{Text: "internal/db"}, []string{"run-2/US-002/3/0", "run-1/US-001/1/2"}},
+		{"tool output and error", Query{Text: "connection refused"}, []string{"run-2/US-002/3/1", "run-1/US-001/1/3"}},
+		{"run filter", Query{Text: "connection", RunID: "run-1"}, []string{"run-1/US-001/1/3"}},
+		{"story filter", Query{Text: "connection", StoryID: "US-002"}, []string{"run-2/US-002/3/1"}},
+		{"tool filter includes results", Query{Text: "testmigrate", Tool: "bash"}, []string{"run-1/US-001/1/3"}},
+		{"phrase", Query{Text: `"refused by"`}, []string{"run-2/US-002/3/1"}},
+		{"all terms required", Query{Text: "connection migration"}, nil},
+		{"limit", Query{Text: "refused", Limit: 1}, []string{"run-2/US-002/3/1"}},
+		{"empty", Query{Text: "  "}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, h := range ix.Search(tt.q) {
+				got = append(got, fmt.Sprintf("%s/%s/%d/%d", h.RunID, h.StoryID, h.Iteration, h.Offset))
+			}
+			if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+				t.Errorf("hits = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHitURLAndSnippet(t *testing.T) {
+	ix := NewIndex()
+	long := strings.Repeat("padding ", 50) + "needle " + strings.Repeat("tail ", 50)
+	ix.AddIteration("run-9", "US-007", 2, []claude.StreamEvent{{Type: claude.EventAssistant, Message: long}})
+
+	hits := ix.Search(Query{Text: "needle"})
+	if len(hits) != 1 {
+		t.Fatalf("expected 1 hit, got %d", len(hits))
+	}
+	h := hits[0]
+	if got, want := h.URL(), "/history/run-9/story/US-007#iter-2-evt-0"; got != want {
+		t.Errorf("URL = %q, want %q", got, want)
+	}
+	if !strings.Contains(h.Snippet, "needle") || !strings.HasPrefix(h.Snippet, "…") || !strings.HasSuffix(h.Snippet, "…") {
+		t.Errorf("Snippet = %q", h.Snippet)
+	}
+	if len(h.Snippet) > 2*snippetRadius+len("……") {
+		t.Errorf("Snippet too long: %d bytes", len(h.Snippet))
+	}
+}
@@ -0,0 +1,183 @@
+// Package splitter asks Claude to break a story that exhausted its iterations
+// into smaller stories the agent loop can complete one at a time.
+package splitter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/radvoogh/ralph-wiggo/internal/claude"
+	"github.com/radvoogh/ralph-wiggo/internal/prd"
+	"github.com/radvoogh/ralph-wiggo/internal/state"
+)
+
+// JSONRunner is the interface required to invoke Claude for a split. It is
+// satisfied by *claude.Executor.
+type JSONRunner interface {
+	RunJSON(ctx context.Context, cfg claude.RunConfig, jsonSchema string) (json.RawMessage, error)
+}
+
+// maxParts is the most stories a split may produce. With autoSplit they are
+// inserted without review, so larger proposals are rejected.
+const maxParts = 5
+
+// splitSchema is the JSON schema for the replacement stories; maxItems is
+// maxParts.
+const splitSchema = `{
+  "type": "object",
+  "required": ["stories"],
+  "properties": {
+    "stories": {
+      "type": "array",
+      "minItems": 2,
+      "maxItems": 5,
+      "description": "Smaller stories that together cover the original story, in the order they should be implemented.",
+      "items": {
+        "type": "object",
+        "required": ["title", "description", "acceptanceCriteria"],
+        "properties": {
+          "title": { "type": "string" },
+          "description": { "type": "string" },
+          "acceptanceCriteria": { "type": "array", "items": { "type": "string" } },
+          "notes": { "type": "string", "description": "What was learned from the failed attempts that applies to this story" }
+        }
+      }
+    }
+  }
+}`
+
+// splitResponse is the parsed response from Claude.
+type splitResponse struct {
+	Stories []prd.UserStory `json:"stories"`
+}
+
+// Propose asks Claude to split story into smaller stories, given a digest of
+// the failed iterations (see Digest). The returned stories have no IDs or
+// priorities yet; prd.SplitStory assigns them.
+func Propose(ctx context.Context, exec JSONRunner, cfg claude.RunConfig, story *prd.UserStory, digest string) ([]prd.UserStory, error) {
+	cfg.Prompt = buildSplitPrompt(story, digest)
+	raw, err := exec.RunJSON(ctx, cfg, splitSchema)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp splitResponse
+	if err := json.Unmarshal(raw, &resp); err != nil {
+		return nil, fmt.Errorf("parsing split response: %w", err)
+	}
+	if len(resp.Stories) < 2 {
+		return nil, errors.New("split response has fewer than 2 stories")
+	}
+	if len(resp.Stories) > maxParts {
+		return nil, fmt.Errorf("split response has %d stories, more than %d", len(resp.Stories), maxParts)
+	}
+	for i, s := range resp.Stories {
+		if strings.TrimSpace(s.Title) == "" {
+			return nil, fmt.Errorf("split story %d has no title", i+1)
+		}
+	}
+	return resp.Stories, nil
+}
+
+// buildSplitPrompt constructs the prompt sent to Claude for a split.
+func buildSplitPrompt(s *prd.UserStory, digest string) string {
+	var sb strings.Builder
+	sb.WriteString("An autonomous coding agent repeatedly failed to complete the following user story, most likely because it is too large. ")
+	sb.WriteString(fmt.Sprintf("Split it into 2 to %d smaller stories that together cover all of its acceptance criteria. ", maxParts))
+	sb.WriteString("Each story must be completable in a single agent session, and the stories must be ordered so that each only depends on earlier ones. ")
+	sb.WriteString("Work already committed by the failed attempts stays in the repository, so do not repeat it.\n\n")
+	sb.WriteString(fmt.Sprintf("**ID:** %s\n", s.ID))
+	sb.WriteString(fmt.Sprintf("**Title:** %s\n", s.Title))
+	sb.WriteString(fmt.Sprintf("**Description:** %s\n\n", s.Description))
+	sb.WriteString("**Acceptance Criteria:**\n")
+	for _, ac := range s.AcceptanceCriteria {
+		sb.WriteString(fmt.Sprintf("- %s\n", ac))
+	}
+	if s.Notes != "" {
+		sb.WriteString(fmt.Sprintf("\n**Notes:** %s\n", s.Notes))
+	}
+	if digest != "" {
+		sb.WriteString("\n**Failed attempts:**\n\n")
+		sb.WriteString(digest)
+	}
+	return sb.String()
+}
+
+// maxDigestText bounds each message quoted in a digest.
+const maxDigestText = 500
+
+// Digest summarizes failed iterations for the split prompt: per iteration,
+// its errors, the tool calls that failed and the agent's final message.
+func Digest(iters []state.Iteration) string {
+	var sb strings.Builder
+	for _, iter := range iters {
+		sb.WriteString(fmt.Sprintf("Iteration %d (%s):\n", iter.Number, iter.Status))
+		if len(iter.Events) == 0 {
+			sb.WriteString("- no events recorded\n")
+			continue
+		}
+
+		tools := make(map[string]claude.StreamEvent)
+		var final string
+		for _, evt := range iter.Events {
+			switch evt.Type {
+			case claude.EventToolUse:
+				tools[evt.ToolID] = evt
+			case claude.EventToolResult:
+				if evt.IsError {
+					sb.WriteString(fmt.Sprintf("- %s failed: %s\n", toolLabel(tools[evt.ToolID]), clip(rawText(evt.Output))))
+				}
+			case claude.EventError:
+				sb.WriteString(fmt.Sprintf("- Error: %s\n", clip(evt.Message)))
+			case claude.EventAssistant:
+				if evt.Message != "" {
+					final = evt.Message
+				}
+			}
+		}
+		if final != "" {
+			sb.WriteString(fmt.Sprintf("- Final message: %s\n", clip(final)))
+		}
+	}
+	return sb.String()
+}
+
+// toolLabel names a tool call, with its command for Bash.
+func toolLabel(evt claude.StreamEvent) string {
+	if evt.ToolName == "" {
+		return "tool call"
+	}
+	var input struct {
+		Command string `json:"command"`
+	}
+	if evt.ToolName == "Bash" && json.Unmarshal(evt.Input, &input) == nil && input.Command != "" {
+		return fmt.Sprintf("Bash `%s`", clip(input.Command))
+	}
+	return evt.ToolName
+}
+
+// rawText returns a tool output as text, unquoting JSON strings.
+func rawText(raw json.RawMessage) string {
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return s
+	}
+	return string(raw)
+}
+
+// clip flattens s to one line and truncates it to maxDigestText bytes.
+func clip(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if len(s) > maxDigestText {
+		cut := maxDigestText
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		s = s[:cut] + "…"
+	}
+	return s
+}
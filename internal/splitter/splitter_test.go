@@ -0,0 +1,106 @@
+package splitter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/radvoogh/ralph-wiggo/internal/claude"
+	"github.com/radvoogh/ralph-wiggo/internal/prd"
+	"github.com/radvoogh/ralph-wiggo/internal/state"
+)
+
+// mockJSONRunner implements JSONRunner, recording the prompt it was sent.
+type mockJSONRunner struct {
+	response json.RawMessage
+	err      error
+	prompt   string
+}
+
+func (m *mockJSONRunner) RunJSON(_ context.Context, cfg claude.RunConfig, _ string) (json.RawMessage, error) {
+	m.prompt = cfg.Prompt
+	return m.response, m.err
+}
+
+func testStory() *prd.UserStory {
+	return &prd.UserStory{
+		ID:                 "US-003",
+		Title:              "Payments",
+		Description:        "As a user, I want to pay.",
+		AcceptanceCriteria: []string{"Checkout works", "Refunds work"},
+	}
+}
+
+func TestPropose(t *testing.T) {
+	runner := &mockJSONRunner{response: json.RawMessage(`{"stories":[
+		{"title":"Checkout","description":"d1","acceptanceCriteria":["Checkout works"]},
+		{"title":"Refunds","description":"d2","acceptanceCriteria":["Refunds work"],"notes":"reuse client"}]}`)}
+
+	parts, err := Propose(context.Background(), runner, claude.RunConfig{Model: "m"}, testStory(), "Iteration 1 (failed):\n- Error: boom\n")
+	if err != nil {
+		t.Fatalf("Propose: %v", err)
+	}
+	if len(parts) != 2 || parts[0].Title != "Checkout" || parts[1].Notes != "reuse client" {
+		t.Errorf("parts = %+v", parts)
+	}
+	for _, want := range []string{"US-003", "- Refunds work", "- Error: boom"} {
+		if !strings.Contains(runner.prompt, want) {
+			t.Errorf("prompt missing %q", want)
+		}
+	}
+}
+
+func TestProposeErrors(t *testing.T) {
+	for name, runner := range map[string]*mockJSONRunner{
+		"call fails":   {err: errors.New("claude failed")},
+		"invalid JSON": {response: json.RawMessage(`not json`)},
+		"single story": {response: json.RawMessage(`{"stories":[{"title":"All"}]}`)},
+		"too many":     {response: json.RawMessage(`{"stories":[{"title":"A"},{"title":"B"},{"title":"C"},{"title":"D"},{"title":"E"},{"title":"F"}]}`)},
+		"empty title":  {response: json.RawMessage(`{"stories":[{"title":"A"},{"title":" "}]}`)},
+	} {
+		if _, err := Propose(context.Background(), runner, claude.RunConfig{}, testStory(), ""); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestDigest(t *testing.T) {
+	iters := []state.Iteration{
+		{Number: 1, Status: state.StatusFailed, Events: []claude.StreamEvent{
+			{Type: claude.EventToolUse, ToolName: "Bash", ToolID: "t1", Input: json.RawMessage(`{"command":"go test ./..."}`)},
+			{Type: claude.EventToolResult, ToolID: "t1", IsError: true, Output: json.RawMessage(`"FAIL: TestPay\nexpected 1"`)},
+			{Type: claude.EventAssistant, Message: "Working on it."},
+			{Type: claude.EventAssistant, Message: "Ran out of turns."},
+			{Type: claude.EventError, Message: "max turns reached"},
+		}},
+		{Number: 2, Status: state.StatusFailed},
+	}
+	got := Digest(iters)
+	for _, want := range []string{
+		"Iteration 1 (failed):",
+		"- Bash `go test ./...` failed: FAIL: TestPay expected 1",
+		"- Error: max turns reached",
+		"- Final message: Ran out of turns.",
+		"Iteration 2 (failed):\n- no events recorded",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("digest missing %q:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "Working on it.") {
+		t.Error("digest includes an earlier assistant message")
+	}
+}
+
+func TestClip(t *testing.T) {
+	long := strings.Repeat("é", maxDigestText)
+	got := clip(long)
+	if !strings.HasSuffix(got, "…") || len(got) > maxDigestText+len("…") {
+		t.Errorf("clip length = %d", len(got))
+	}
+	if !strings.HasPrefix(got, "é") || strings.ContainsRune(got, '\uFFFD') {
+		t.Error("clip split a rune")
+	}
+}
@@ -0,0 +1,297 @@
+package state
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/radvoogh/ralph-wiggo/internal/claude"
+)
+
+// broadcaster fans out live story events and run events to subscribers in
+// this process. It is embedded by each Store implementation; nothing it holds
+// is persisted.
+type broadcaster struct {
+	broadMu    sync.Mutex
+	broadcasts map[StreamKey]*storyBroadcast
+	epoch      uint64 // last epoch assigned to a broadcast; guarded by broadMu
+
+	runSubMu sync.Mutex
+	runSubs  map[*runSubscriber]struct{}
+}
+
+// newBroadcaster returns a broadcaster with no subscribers. Epochs are seeded
+// from the clock so event IDs from a previous process never match.
+func newBroadcaster() *broadcaster {
+	return &broadcaster{
+		broadcasts: make(map[StreamKey]*storyBroadcast),
+		epoch:      uint64(time.Now().UnixNano()),
+		runSubs:    make(map[*runSubscriber]struct{}),
+	}
+}
+
+// StreamKey identifies the live event stream of one iteration of a story
+// within a run.
+type StreamKey struct {
+	RunID     string `json:"runID"`
+	StoryID   string `json:"storyID"`
+	Iteration int    `json:"iteration"`
+}
+
+// String formats the key as "<run>/<story>/<iteration>".
+func (k StreamKey) String() string {
+	return fmt.Sprintf("%s/%s/%d", k.RunID, k.StoryID, k.Iteration)
+}
+
+// StreamInfo describes a broadcast known to this process.
+type StreamInfo struct {
+	StreamKey
+	Started time.Time `json:"started"`
+	Events  int       `json:"events"`
+	Closed  bool      `json:"closed"` // the iteration finished; only buffered events remain
+}
+
+// storyBroadcast holds live event subscribers and a buffer of events published
+// so far for a single story iteration.
+type storyBroadcast struct {
+	started     time.Time
+	epoch       uint64
+	nextSeq     uint64
+	events      []BroadcastEvent
+	subscribers []*eventSubscriber
+	closed      bool
+}
+
+// eventSubscriber is a single SSE subscriber channel.
+type eventSubscriber struct {
+	ch     chan BroadcastEvent
+	lagged atomic.Bool
+}
+
+// subscriberBuffer is the number of live events queued per subscriber before
+// it is considered too slow and cut off with a gap.
+const subscriberBuffer = 256
+
+// EventID identifies a published event within a story broadcast. Seq increases
+// monotonically within a broadcast; Epoch differs between broadcasts (and
+// between processes), so IDs from another iteration never match.
+type EventID struct {
+	Epoch uint64
+	Seq   uint64
+}
+
+// String formats the ID as "<epoch>-<seq>" for use as an SSE event ID.
+func (id EventID) String() string {
+	return fmt.Sprintf("%d-%d", id.Epoch, id.Seq)
+}
+
+// ParseEventID parses an ID produced by EventID.String. It returns false if
+// the string is empty or malformed.
+func ParseEventID(s string) (EventID, bool) {
+	epochStr, seqStr, ok := strings.Cut(s, "-")
+	if !ok {
+		return EventID{}, false
+	}
+	epoch, err := strconv.ParseUint(epochStr, 10, 64)
+	if err != nil {
+		return EventID{}, false
+	}
+	seq, err := strconv.ParseUint(seqStr, 10, 64)
+	if err != nil {
+		return EventID{}, false
+	}
+	return EventID{Epoch: epoch, Seq: seq}, true
+}
+
+// BroadcastEvent is a streaming event tagged with its position in a story's
+// broadcast.
+type BroadcastEvent struct {
+	ID    EventID
+	Event claude.StreamEvent
+}
+
+// Subscription is a live feed of events for a single story iteration. C is
+// closed when the iteration completes or when the subscriber falls too far behind;
+// Lagged distinguishes the two.
+type Subscription struct {
+	C <-chan BroadcastEvent
+
+	sub   *eventSubscriber
+	close func()
+}
+
+// Lagged reports whether the subscription was cut off because it could not
+// keep up with published events. Events after the last one received were not
+// delivered and must be refetched by resubscribing.
+func (s *Subscription) Lagged() bool {
+	return s.sub.lagged.Load()
+}
+
+// Close unsubscribes from the broadcast. It is safe to call more than once.
+func (s *Subscription) Close() {
+	s.close()
+}
+
+// getBroadcast returns (or creates) the broadcast state for a stream.
+// Caller must hold b.broadMu.
+func (b *broadcaster) getBroadcast(key StreamKey) *storyBroadcast {
+	bc, ok := b.broadcasts[key]
+	if !ok {
+		b.epoch++
+		bc = &storyBroadcast{started: time.Now(), epoch: b.epoch}
+		b.broadcasts[key] = bc
+	}
+	return bc
+}
+
+// PublishEvent sends a streaming event to all live subscribers of a stream and
+// stores it so late-joining subscribers receive the full history. Subscribers
+// whose buffers are full are cut off and marked as lagged rather than silently
+// missing the event.
+func (b *broadcaster) PublishEvent(key StreamKey, evt claude.StreamEvent) {
+	b.broadMu.Lock()
+	defer b.broadMu.Unlock()
+
+	bc := b.getBroadcast(key)
+	if bc.closed {
+		return
+	}
+
+	bc.nextSeq++
+	be := BroadcastEvent{ID: EventID{Epoch: bc.epoch, Seq: bc.nextSeq}, Event: evt}
+	bc.events = append(bc.events, be)
+
+	live := bc.subscribers[:0]
+	for _, sub := range bc.subscribers {
+		select {
+		case sub.ch <- be:
+			live = append(live, sub)
+		default:
+			sub.lagged.Store(true)
+			close(sub.ch)
+		}
+	}
+	clear(bc.subscribers[len(live):])
+	bc.subscribers = live
+}
+
+// Subscribe returns the events published to a stream after the given ID, and
+// a Subscription for future live events. If after belongs to a different
+// epoch (or is the zero value), the full buffered history is returned. A
+// stream that has not started yet is created, so subscribers may attach
+// before its first event. The subscription channel is closed when
+// CloseSubscribers is called for the stream.
+func (b *broadcaster) Subscribe(key StreamKey, after EventID) ([]BroadcastEvent, *Subscription) {
+	b.broadMu.Lock()
+	defer b.broadMu.Unlock()
+
+	bc := b.getBroadcast(key)
+
+	// Snapshot existing events the caller has not seen yet.
+	var snapshot []BroadcastEvent
+	for _, be := range bc.events {
+		if after.Epoch == bc.epoch && be.ID.Seq <= after.Seq {
+			continue
+		}
+		snapshot = append(snapshot, be)
+	}
+
+	sub := &eventSubscriber{ch: make(chan BroadcastEvent, subscriberBuffer)}
+	if bc.closed {
+		close(sub.ch)
+		return snapshot, &Subscription{C: sub.ch, sub: sub, close: func() {}}
+	}
+
+	bc.subscribers = append(bc.subscribers, sub)
+
+	unsub := func() {
+		b.broadMu.Lock()
+		defer b.broadMu.Unlock()
+		subs := bc.subscribers
+		for i, ss := range subs {
+			if ss == sub {
+				bc.subscribers = append(subs[:i], subs[i+1:]...)
+				break
+			}
+		}
+	}
+
+	return snapshot, &Subscription{C: sub.ch, sub: sub, close: unsub}
+}
+
+// CloseSubscribers closes all subscriber channels of a stream. Call this when
+// the iteration is complete. Its events stay buffered for late subscribers
+// until the story's next iteration in the same run begins.
+func (b *broadcaster) CloseSubscribers(key StreamKey) {
+	b.broadMu.Lock()
+	defer b.broadMu.Unlock()
+
+	bc, ok := b.broadcasts[key]
+	if !ok {
+		return
+	}
+
+	bc.closed = true
+	for _, sub := range bc.subscribers {
+		close(sub.ch)
+	}
+	bc.subscribers = nil
+}
+
+// BeginBroadcast starts the stream for a new iteration and drops the buffered
+// events of the story's finished iterations in the same run, which the store
+// has recorded by then. Subscribers already waiting on the stream are kept.
+func (b *broadcaster) BeginBroadcast(key StreamKey) {
+	b.broadMu.Lock()
+	defer b.broadMu.Unlock()
+
+	for k, bc := range b.broadcasts {
+		if bc.closed && k.RunID == key.RunID && k.StoryID == key.StoryID {
+			delete(b.broadcasts, k)
+		}
+	}
+	b.getBroadcast(key)
+}
+
+// Stream returns information about a stream this process has buffered
+// events for, whether live or finished.
+func (b *broadcaster) Stream(key StreamKey) (StreamInfo, bool) {
+	b.broadMu.Lock()
+	defer b.broadMu.Unlock()
+
+	bc, ok := b.broadcasts[key]
+	if !ok {
+		return StreamInfo{}, false
+	}
+	return bc.info(key), true
+}
+
+// ActiveStreams returns the streams of iterations still in progress, most
+// recently started first.
+func (b *broadcaster) ActiveStreams() []StreamInfo {
+	b.broadMu.Lock()
+	defer b.broadMu.Unlock()
+
+	var out []StreamInfo
+	for k, bc := range b.broadcasts {
+		if !bc.closed {
+			out = append(out, bc.info(k))
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].Started.Equal(out[j].Started) {
+			return out[i].Started.After(out[j].Started)
+		}
+		return out[i].String() < out[j].String()
+	})
+	return out
+}
+
+// info describes bc. Caller must hold b.broadMu.
+func (bc *storyBroadcast) info(key StreamKey) StreamInfo {
+	return StreamInfo{StreamKey: key, Started: bc.started, Events: len(bc.events), Closed: bc.closed}
+}
@@ -0,0 +1,99 @@
+package state
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// RunSortKeys lists the keys accepted by SortRuns. The first is the default.
+var RunSortKeys = []string{"started", "ended", "duration", "passed", "skipped", "status"}
+
+// FilterRuns returns the runs with the given status, or all runs if status is
+// empty.
+func FilterRuns(runs []*Run, status Status) []*Run {
+	if status == "" {
+		return runs
+	}
+	var out []*Run
+	for _, r := range runs {
+		if r.Status == status {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// SortRuns sorts runs in place by one of RunSortKeys: most recent, longest or
+// largest first, and by status in RunStatuses order. Ties fall back to start
+// time, newest first. Unfinished runs sort before finished ones by end time.
+func SortRuns(runs []*Run, key string) error {
+	var less func(a, b *Run) int
+	switch key {
+	case "", "started":
+		less = func(a, b *Run) int { return 0 }
+	case "ended":
+		less = func(a, b *Run) int {
+			switch {
+			case a.Finished() != b.Finished():
+				return boolCmp(!a.Finished(), !b.Finished())
+			case a.EndTime.Equal(b.EndTime):
+				return 0
+			case a.EndTime.After(b.EndTime):
+				return -1
+			}
+			return 1
+		}
+	case "duration":
+		less = func(a, b *Run) int { return cmpDesc(int64(a.Duration()), int64(b.Duration())) }
+	case "passed":
+		less = func(a, b *Run) int { return cmpDesc(int64(a.Passed), int64(b.Passed)) }
+	case "skipped":
+		less = func(a, b *Run) int { return cmpDesc(int64(a.Skipped), int64(b.Skipped)) }
+	case "status":
+		less = func(a, b *Run) int { return cmpDesc(int64(statusRank(b.Status)), int64(statusRank(a.Status))) }
+	default:
+		return fmt.Errorf("unknown sort key %q (want one of %s)", key, strings.Join(RunSortKeys, ", "))
+	}
+
+	sort.SliceStable(runs, func(i, j int) bool {
+		if c := less(runs[i], runs[j]); c != 0 {
+			return c < 0
+		}
+		return runs[i].StartTime.After(runs[j].StartTime)
+	})
+	return nil
+}
+
+// statusRank returns the position of a status in RunStatuses, or len if it is
+// not a run status.
+func statusRank(s Status) int {
+	for i, rs := range RunStatuses {
+		if rs == s {
+			return i
+		}
+	}
+	return len(RunStatuses)
+}
+
+// cmpDesc orders larger values first.
+func cmpDesc(a, b int64) int {
+	switch {
+	case a > b:
+		return -1
+	case a < b:
+		return 1
+	}
+	return 0
+}
+
+// boolCmp orders true before false.
+func boolCmp(a, b bool) int {
+	switch {
+	case a == b:
+		return 0
+	case a:
+		return -1
+	}
+	return 1
+}
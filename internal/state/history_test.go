@@ -0,0 +1,52 @@
+package state
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSortAndFilterRuns(t *testing.T) {
+	base := time.Date(2026, 2, 20, 12, 0, 0, 0, time.UTC)
+	runs := []*Run{
+		{ID: "a", StartTime: base, EndTime: base.Add(time.Hour), Status: StatusCompleted, Passed: 3},
+		{ID: "b", StartTime: base.Add(time.Minute), EndTime: base.Add(2 * time.Minute), Status: StatusPartial, Passed: 1, Skipped: 2},
+		{ID: "c", StartTime: base.Add(2 * time.Minute), Status: StatusRunning},
+	}
+	ids := func(rs []*Run) string {
+		var s string
+		for _, r := range rs {
+			s += r.ID
+		}
+		return s
+	}
+
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"", "cba"},
+		{"started", "cba"},
+		{"ended", "cab"},
+		{"passed", "abc"},
+		{"skipped", "bca"},
+		{"status", "cab"},
+	}
+	for _, tt := range tests {
+		if err := SortRuns(runs, tt.key); err != nil {
+			t.Fatalf("SortRuns(%q): %v", tt.key, err)
+		}
+		if got := ids(runs); got != tt.want {
+			t.Errorf("SortRuns(%q) = %s, want %s", tt.key, got, tt.want)
+		}
+	}
+	if err := SortRuns(runs, "bogus"); err == nil {
+		t.Error("expected error for unknown sort key")
+	}
+
+	if got := ids(FilterRuns(runs, StatusPartial)); got != "b" {
+		t.Errorf("FilterRuns(partial) = %s, want b", got)
+	}
+	if got := FilterRuns(runs, ""); len(got) != 3 {
+		t.Errorf("FilterRuns(\"\") returned %d runs, want 3", len(got))
+	}
+}
@@ -0,0 +1,197 @@
+package state
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/radvoogh/ralph-wiggo/internal/claude"
+)
+
+// RetentionPolicy decides which runs are kept and which of those keep their
+// full event history. A negative or zero limit disables that rule.
+type RetentionPolicy struct {
+	KeepRuns     int           // keep the newest N runs
+	MaxAge       time.Duration // keep runs started less than this long ago
+	CompactAfter int           // compact every kept run except the newest N
+}
+
+// DefaultRetention is used for limits the config file and flags leave unset.
+var DefaultRetention = RetentionPolicy{KeepRuns: 50, CompactAfter: 10}
+
+// RetentionPlan lists what a policy removes from run history.
+type RetentionPlan struct {
+	Prune   []*Run // runs to delete
+	Compact []*Run // kept runs with iterations still to compact
+}
+
+// PlanRetention applies a policy to runs. A run is kept if any rule keeps it:
+// it is among the newest KeepRuns, younger than MaxAge, or the latest run on
+// its branch. If neither KeepRuns nor MaxAge is set, every run is kept.
+//
+// Runs without an end time are treated like finished ones: the caller must
+// ensure no run is active (gc holds the run lock), so they were killed or
+// crashed, or predate recording end times.
+func PlanRetention(runs []*Run, policy RetentionPolicy, now time.Time) RetentionPlan {
+	sorted := append([]*Run(nil), runs...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].StartTime.After(sorted[j].StartTime)
+	})
+
+	pruning := policy.KeepRuns > 0 || policy.MaxAge > 0
+	latestOnBranch := make(map[string]bool)
+
+	var plan RetentionPlan
+	kept := 0
+	for i, run := range sorted {
+		keep := !pruning ||
+			!latestOnBranch[run.BranchName] ||
+			(policy.KeepRuns > 0 && i < policy.KeepRuns) ||
+			(policy.MaxAge > 0 && now.Sub(run.StartTime) < policy.MaxAge)
+		latestOnBranch[run.BranchName] = true
+
+		if !keep {
+			plan.Prune = append(plan.Prune, run)
+			continue
+		}
+		kept++
+		if policy.CompactAfter > 0 && kept > policy.CompactAfter && needsCompaction(run) {
+			plan.Compact = append(plan.Compact, run)
+		}
+	}
+	return plan
+}
+
+// needsCompaction reports whether a run has iterations that still hold their
+// full event history. Iterations cut off while running are left alone, as
+// CompactIteration does.
+func needsCompaction(run *Run) bool {
+	for _, sess := range run.Stories {
+		for _, iter := range sess.Iterations {
+			if iter.Summary == nil && iter.Status != StatusRunning {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// IterationSummary records what compaction removed from an iteration.
+type IterationSummary struct {
+	Events    int            `json:"events"`    // events before compaction
+	ToolCalls map[string]int `json:"toolCalls"` // calls per tool name
+}
+
+// editTools are the tools whose calls carry file diffs, which compaction keeps.
+var editTools = map[string]bool{
+	"Edit":         true,
+	"MultiEdit":    true,
+	"Write":        true,
+	"NotebookEdit": true,
+}
+
+// CompactIteration returns iter reduced to a summary plus the events worth
+// keeping: file edits, errors, the session result and the final assistant
+// message. It also returns the number of events dropped. Iterations that are
+// running or already compacted are returned unchanged.
+func CompactIteration(iter Iteration) (Iteration, int) {
+	if iter.Summary != nil || iter.Status == StatusRunning {
+		return iter, 0
+	}
+
+	summary := &IterationSummary{Events: len(iter.Events), ToolCalls: make(map[string]int)}
+	lastMessage := -1
+	for i, evt := range iter.Events {
+		switch evt.Type {
+		case claude.EventToolUse:
+			summary.ToolCalls[evt.ToolName]++
+		case claude.EventAssistant:
+			lastMessage = i
+		}
+	}
+
+	var kept []claude.StreamEvent
+	for i, evt := range iter.Events {
+		switch {
+		case evt.Type == claude.EventToolUse && editTools[evt.ToolName],
+			evt.Type == claude.EventError,
+			evt.Type == claude.EventResult,
+			i == lastMessage:
+			kept = append(kept, evt)
+		}
+	}
+
+	iter.Events = kept
+	iter.Summary = summary
+	return iter, summary.Events - len(kept)
+}
+
+// CompactRun returns a copy of run with every iteration compacted, and the
+// number of events dropped. The original run is not modified.
+func CompactRun(run *Run) (*Run, int) {
+	out := *run
+	out.Stories = make([]*AgentSession, len(run.Stories))
+	dropped := 0
+	for i, sess := range run.Stories {
+		cs := *sess
+		cs.Iterations = make([]Iteration, len(sess.Iterations))
+		for j, iter := range sess.Iterations {
+			var n int
+			cs.Iterations[j], n = CompactIteration(iter)
+			dropped += n
+		}
+		out.Stories[i] = &cs
+	}
+	return &out, dropped
+}
+
+// RetentionReport describes what ApplyRetention removed, or would remove.
+type RetentionReport struct {
+	Pruned        []string // run IDs deleted
+	Compacted     []string // run IDs compacted
+	EventsDropped int      // events removed by compaction
+}
+
+// ApplyRetention plans retention for the runs in store and, unless dryRun is
+// set, deletes and compacts runs accordingly. No run may be active.
+func ApplyRetention(store RunStore, policy RetentionPolicy, now time.Time, dryRun bool) (RetentionReport, error) {
+	var report RetentionReport
+	runs, err := store.ListRuns()
+	if err != nil {
+		return report, err
+	}
+	plan := PlanRetention(runs, policy, now)
+
+	for _, run := range plan.Prune {
+		if !dryRun {
+			if err := store.DeleteRun(run.ID); err != nil {
+				return report, err
+			}
+		}
+		report.Pruned = append(report.Pruned, run.ID)
+	}
+
+	for _, listed := range plan.Compact {
+		// ListRuns may omit events; compact the full run.
+		run, err := store.GetRun(listed.ID)
+		if err != nil {
+			return report, err
+		}
+		compacted, dropped := CompactRun(run)
+		if !dryRun {
+			if err := store.SaveRun(compacted); err != nil {
+				return report, err
+			}
+		}
+		report.Compacted = append(report.Compacted, run.ID)
+		report.EventsDropped += dropped
+	}
+
+	// Stores that keep history in a single file need to reclaim the space.
+	if v, ok := store.(interface{ Vacuum() error }); ok && !dryRun && (len(plan.Prune) > 0 || len(plan.Compact) > 0) {
+		if err := v.Vacuum(); err != nil {
+			return report, fmt.Errorf("state: reclaiming space: %w", err)
+		}
+	}
+	return report, nil
+}
@@ -0,0 +1,179 @@
+package state
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/radvoogh/ralph-wiggo/internal/claude"
+)
+
+func TestPlanRetention(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	run := func(id, branch string, age time.Duration, finished bool) *Run {
+		r := &Run{ID: id, BranchName: branch, StartTime: now.Add(-age), Status: StatusCompleted}
+		if finished {
+			r.EndTime = r.StartTime.Add(time.Minute)
+		} else {
+			r.Status = StatusRunning
+		}
+		r.Stories = []*AgentSession{{StoryID: "US-001", Iterations: []Iteration{{Number: 1, Status: StatusPassed}}}}
+		return r
+	}
+	runs := []*Run{
+		run("r1", "a", 1*day, true),
+		run("r2", "a", 2*day, true),
+		run("r3", "b", 3*day, true),  // latest on branch b
+		run("r4", "a", 4*day, false), // crashed: no end time
+		run("r5", "a", 5*day, true),
+		run("r6", "a", 40*day, true),
+	}
+	ids := func(rs []*Run) []string {
+		var out []string
+		for _, r := range rs {
+			out = append(out, r.ID)
+		}
+		return out
+	}
+
+	tests := []struct {
+		name    string
+		policy  RetentionPolicy
+		prune   []string
+		compact []string
+	}{
+		{"keep all", RetentionPolicy{}, nil, nil},
+		{"keep newest", RetentionPolicy{KeepRuns: 1}, []string{"r2", "r4", "r5", "r6"}, nil},
+		{"max age", RetentionPolicy{MaxAge: 30 * day}, []string{"r6"}, nil},
+		{"either rule keeps", RetentionPolicy{KeepRuns: 2, MaxAge: 4*day + time.Hour}, []string{"r5", "r6"}, nil},
+		{"compact older", RetentionPolicy{KeepRuns: 2, CompactAfter: 2}, []string{"r4", "r5", "r6"}, []string{"r3"}},
+		{"compact unfinished", RetentionPolicy{KeepRuns: 4, CompactAfter: 3}, []string{"r5", "r6"}, []string{"r4"}},
+	}
+	for _, tt := range tests {
+		plan := PlanRetention(runs, tt.policy, now)
+		if got := ids(plan.Prune); !slices.Equal(got, tt.prune) {
+			t.Errorf("%s: prune = %v, want %v", tt.name, got, tt.prune)
+		}
+		if got := ids(plan.Compact); !slices.Equal(got, tt.compact) {
+			t.Errorf("%s: compact = %v, want %v", tt.name, got, tt.compact)
+		}
+	}
+}
+
+func TestCompactIteration(t *testing.T) {
+	edit := json.RawMessage(`{"file_path":"a.go","old_string":"x","new_string":"y"}`)
+	iter := Iteration{Number: 1, Status: StatusPassed, Events: []claude.StreamEvent{
+		{Type: claude.EventInit, SessionID: "s1"},
+		{Type: claude.EventAssistant, Message: "looking around"},
+		{Type: claude.EventToolUse, ToolName: "Bash", ToolID: "t1"},
+		{Type: claude.EventToolResult, ToolID: "t1", Output: json.RawMessage(`"lots of output"`)},
+		{Type: claude.EventToolUse, ToolName: "Edit", ToolID: "t2", Input: edit},
+		{Type: claude.EventToolResult, ToolID: "t2"},
+		{Type: claude.EventAssistant, Message: "done"},
+		{Type: claude.EventResult, Subtype: claude.ResultSuccess},
+	}}
+
+	got, dropped := CompactIteration(iter)
+	if dropped != 5 {
+		t.Errorf("dropped = %d, want 5", dropped)
+	}
+	var kept []string
+	for _, evt := range got.Events {
+		kept = append(kept, string(evt.Type)+":"+evt.ToolName+evt.Message)
+	}
+	want := []string{"tool_use:Edit", "assistant:done", "result:"}
+	if !slices.Equal(kept, want) {
+		t.Errorf("kept events = %v, want %v", kept, want)
+	}
+	if got.Summary == nil || got.Summary.Events != 8 || got.Summary.ToolCalls["Bash"] != 1 || got.Summary.ToolCalls["Edit"] != 1 {
+		t.Errorf("Summary = %+v", got.Summary)
+	}
+	if len(iter.Events) != 8 {
+		t.Error("CompactIteration modified its argument")
+	}
+
+	// Compacting again changes nothing.
+	if again, n := CompactIteration(got); n != 0 || len(again.Events) != len(got.Events) {
+		t.Errorf("second compaction dropped %d events", n)
+	}
+}
+
+// retentionFixture saves three finished runs on one branch, a day apart,
+// each with a single chatty iteration.
+func retentionFixture(t *testing.T, store Store, now time.Time) {
+	t.Helper()
+	for i, id := range []string{"run-new", "run-mid", "run-old"} {
+		start := now.Add(-time.Duration(i+1) * 24 * time.Hour)
+		run := &Run{ID: id, BranchName: "ralph/x", StartTime: start, EndTime: start.Add(time.Hour), Status: StatusCompleted,
+			Stories: []*AgentSession{{StoryID: "US-001", Status: StatusPassed, Iterations: []Iteration{{
+				StoryID: "US-001", Number: 1, Status: StatusPassed, Events: []claude.StreamEvent{
+					{Type: claude.EventAssistant, Message: "thinking"},
+					{Type: claude.EventToolUse, ToolName: "Bash", ToolID: "t1"},
+					{Type: claude.EventAssistant, Message: "finished"},
+				},
+			}}}}}
+		if err := store.SaveRun(run); err != nil {
+			t.Fatalf("SaveRun: %v", err)
+		}
+	}
+}
+
+func TestApplyRetention(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	policy := RetentionPolicy{KeepRuns: 2, CompactAfter: 1}
+
+	for _, backend := range []string{BackendJSON, BackendSQLite} {
+		t.Run(backend, func(t *testing.T) {
+			dir := t.TempDir()
+			store, err := Open(backend, dir)
+			if err != nil {
+				t.Fatalf("Open: %v", err)
+			}
+			defer store.Close()
+			retentionFixture(t, store, now)
+
+			report, err := ApplyRetention(store, policy, now, true)
+			if err != nil {
+				t.Fatalf("ApplyRetention (dry run): %v", err)
+			}
+			if !slices.Equal(report.Pruned, []string{"run-old"}) || !slices.Equal(report.Compacted, []string{"run-mid"}) || report.EventsDropped != 2 {
+				t.Errorf("dry-run report = %+v", report)
+			}
+			if runs, _ := store.ListRuns(); len(runs) != 3 {
+				t.Fatalf("dry run removed runs: %d left", len(runs))
+			}
+
+			if _, err := ApplyRetention(store, policy, now, false); err != nil {
+				t.Fatalf("ApplyRetention: %v", err)
+			}
+			if _, err := store.GetRun("run-old"); err == nil {
+				t.Error("pruned run still present")
+			}
+			if _, err := os.Stat(filepath.Join(dir, "runs", "run-old.json")); backend == BackendJSON && !os.IsNotExist(err) {
+				t.Errorf("pruned run file still present: %v", err)
+			}
+			mid, err := store.GetRun("run-mid")
+			if err != nil {
+				t.Fatalf("GetRun: %v", err)
+			}
+			iter := mid.Stories[0].Iterations[0]
+			if iter.Summary == nil || iter.Summary.Events != 3 || len(iter.Events) != 1 || iter.Events[0].Message != "finished" {
+				t.Errorf("compacted iteration = %+v", iter)
+			}
+			newest, _ := store.GetRun("run-new")
+			if it := newest.Stories[0].Iterations[0]; it.Summary != nil || len(it.Events) != 3 {
+				t.Errorf("newest run was compacted: %+v", it)
+			}
+
+			// Another pass has nothing left to do.
+			report, err = ApplyRetention(store, policy, now, false)
+			if err != nil || len(report.Pruned)+len(report.Compacted) != 0 {
+				t.Errorf("second pass = %+v, %v", report, err)
+			}
+		})
+	}
+}
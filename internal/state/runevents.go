@@ -0,0 +1,109 @@
+package state
+
+import (
+	"fmt"
+	"time"
+)
+
+// RunEventType identifies the kind of run-level event.
+type RunEventType string
+
+const (
+	RunEventStoryStatus    RunEventType = "story_status"
+	RunEventIterationStart RunEventType = "iteration_start"
+	RunEventIterationEnd   RunEventType = "iteration_end"
+	RunEventBatchStart     RunEventType = "batch_start"
+	RunEventMerge          RunEventType = "merge"
+	RunEventRunComplete    RunEventType = "run_complete"
+)
+
+// RunEvent is a coarse-grained notification about the progress of a run, used
+// to drive live dashboard updates. Unlike story StreamEvents, run events are
+// not buffered: subscribers are expected to re-read state when one arrives.
+type RunEvent struct {
+	Type      RunEventType `json:"type"`
+	RunID     string       `json:"runID,omitempty"`
+	StoryID   string       `json:"storyID,omitempty"`
+	Iteration int          `json:"iteration,omitempty"`
+	Status    Status       `json:"status,omitempty"`
+	Stories   []string     `json:"stories,omitempty"` // story IDs in a batch
+	Message   string       `json:"message,omitempty"`
+	Time      time.Time    `json:"time"`
+}
+
+// runCompleteEvent returns the run event announcing a run's outcome.
+func runCompleteEvent(runID string, res RunResult) RunEvent {
+	return RunEvent{
+		Type:    RunEventRunComplete,
+		RunID:   runID,
+		Status:  res.Status,
+		Message: res.StopReason,
+		Time:    res.EndTime,
+	}
+}
+
+// runSubscriber is a single run event subscriber channel.
+type runSubscriber struct {
+	ch chan RunEvent
+}
+
+// PublishRunEvent sends a run event to all subscribers. The event time is set
+// if the caller left it zero. Subscribers that are not keeping up miss the
+// event; since each event only signals that state changed, the next one they
+// receive brings them up to date.
+func (b *broadcaster) PublishRunEvent(evt RunEvent) {
+	if evt.Time.IsZero() {
+		evt.Time = time.Now()
+	}
+
+	b.runSubMu.Lock()
+	defer b.runSubMu.Unlock()
+
+	for sub := range b.runSubs {
+		select {
+		case sub.ch <- evt:
+		default:
+		}
+	}
+}
+
+// SubscribeRunEvents returns a channel of run events and an unsubscribe
+// function.
+func (b *broadcaster) SubscribeRunEvents() (<-chan RunEvent, func()) {
+	sub := &runSubscriber{ch: make(chan RunEvent, 64)}
+
+	b.runSubMu.Lock()
+	b.runSubs[sub] = struct{}{}
+	b.runSubMu.Unlock()
+
+	unsub := func() {
+		b.runSubMu.Lock()
+		defer b.runSubMu.Unlock()
+		delete(b.runSubs, sub)
+	}
+	return sub.ch, unsub
+}
+
+// StartIteration marks a story as running within a run and notifies run event
+// subscribers. The iteration itself is recorded by AddIteration when it ends.
+func (s *MemoryStore) StartIteration(runID, storyID string, number int) error {
+	s.mu.Lock()
+	run, ok := s.runs[runID]
+	if !ok {
+		s.mu.Unlock()
+		return fmt.Errorf("state: run %q not found", runID)
+	}
+	session := findOrCreateSession(run, storyID)
+	session.Status = StatusRunning
+	session.ActiveSince = time.Now()
+	s.mu.Unlock()
+
+	s.PublishRunEvent(RunEvent{
+		Type:      RunEventIterationStart,
+		RunID:     runID,
+		StoryID:   storyID,
+		Iteration: number,
+		Status:    StatusRunning,
+	})
+	return nil
+}
@@ -0,0 +1,43 @@
+package state
+
+import (
+	"sort"
+
+	"github.com/radvoogh/ralph-wiggo/internal/search"
+)
+
+// Search runs a full-text query over the events of every recorded iteration.
+// The index is built from run history on first use and kept up to date as
+// AddIteration records new iterations.
+func (s *MemoryStore) Search(q search.Query) []search.Hit {
+	return s.searchIndex().Search(q)
+}
+
+// searchIndex returns the search index, building it if needed.
+func (s *MemoryStore) searchIndex() *search.Index {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.index != nil {
+		return s.index
+	}
+
+	runs := make([]*Run, 0, len(s.runs))
+	for _, r := range s.runs {
+		runs = append(runs, r)
+	}
+	// Index oldest first so that, among equal scores, recent runs rank first.
+	sort.Slice(runs, func(i, j int) bool {
+		return runs[i].StartTime.Before(runs[j].StartTime)
+	})
+
+	s.index = search.NewIndex()
+	for _, run := range runs {
+		for _, session := range run.Stories {
+			for _, iter := range session.Iterations {
+				s.index.AddIteration(run.ID, iter.StoryID, iter.Number, iter.Events)
+			}
+		}
+	}
+	return s.index
+}
@@ -0,0 +1,836 @@
+package state
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	_ "modernc.org/sqlite" // registers the pure-Go "sqlite" driver
+
+	"github.com/radvoogh/ralph-wiggo/internal/claude"
+	"github.com/radvoogh/ralph-wiggo/internal/search"
+)
+
+// sqliteMigrations bring a database schema up to date. The number applied so
+// far is kept in PRAGMA user_version; append new entries, never edit old ones.
+var sqliteMigrations = []string{
+	`CREATE TABLE runs (
+		id          TEXT PRIMARY KEY,
+		prd_path    TEXT NOT NULL,
+		branch_name TEXT NOT NULL,
+		start_time  INTEGER,
+		status      TEXT NOT NULL
+	);
+	CREATE TABLE sessions (
+		run_id       TEXT NOT NULL REFERENCES runs(id) ON DELETE CASCADE,
+		story_id     TEXT NOT NULL,
+		position     INTEGER NOT NULL,
+		status       TEXT NOT NULL,
+		active_since INTEGER,
+		PRIMARY KEY (run_id, story_id)
+	);
+	CREATE INDEX sessions_story ON sessions(story_id);
+	CREATE TABLE iterations (
+		id         INTEGER PRIMARY KEY,
+		run_id     TEXT NOT NULL,
+		story_id   TEXT NOT NULL,
+		number     INTEGER NOT NULL,
+		start_time INTEGER,
+		end_time   INTEGER,
+		status     TEXT NOT NULL,
+		UNIQUE (run_id, story_id, number),
+		FOREIGN KEY (run_id, story_id) REFERENCES sessions(run_id, story_id) ON DELETE CASCADE
+	);
+	CREATE TABLE events (
+		iteration_id INTEGER NOT NULL REFERENCES iterations(id) ON DELETE CASCADE,
+		seq          INTEGER NOT NULL,
+		type         TEXT NOT NULL,
+		data         TEXT NOT NULL,
+		PRIMARY KEY (iteration_id, seq)
+	) WITHOUT ROWID;`,
+	`ALTER TABLE runs ADD COLUMN end_time INTEGER;
+	ALTER TABLE runs ADD COLUMN passed INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE runs ADD COLUMN skipped INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE runs ADD COLUMN total INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE runs ADD COLUMN stop_reason TEXT NOT NULL DEFAULT '';`,
+	`ALTER TABLE iterations ADD COLUMN summary TEXT;`,
+}
+
+// SQLiteStore is a Store backed by an embedded SQLite database. Unlike
+// MemoryStore it does not hold run history in memory, and it writes each
+// streamed event as it arrives instead of rewriting the whole run after every
+// iteration. Reads return finished iterations only, like MemoryStore. ListRuns
+// omits iteration events; GetRun and GetIterationsForStory include them.
+type SQLiteStore struct {
+	db *sql.DB
+	*broadcaster
+
+	mu      sync.Mutex
+	active  map[StreamKey]*activeIteration // iterations receiving streamed events
+	index   *search.Index                  // full-text index, built on first Search; guarded by mu
+	jsonDir string                         // directory of the imported JSON run files; guarded by mu
+}
+
+// activeIteration is an iteration whose events are being written as they are
+// published.
+type activeIteration struct {
+	id      int64 // iterations.id
+	nextSeq int
+}
+
+// OpenSQLiteStore opens (creating if needed) the SQLite database at path and
+// applies any pending schema migrations.
+func OpenSQLiteStore(path string) (*SQLiteStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("state: creating state dir: %w", err)
+	}
+
+	// WAL and a busy timeout let a separate `serve` process read while the
+	// agent loop writes.
+	dsn := "file:" + path + "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("state: opening %s: %w", path, err)
+	}
+	// A single connection serializes writers within this process.
+	db.SetMaxOpenConns(1)
+
+	if err := migrateSQLite(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("state: migrating %s: %w", path, err)
+	}
+
+	return &SQLiteStore{
+		db:          db,
+		broadcaster: newBroadcaster(),
+		active:      make(map[StreamKey]*activeIteration),
+	}, nil
+}
+
+// migrateSQLite applies the migrations the database has not seen yet, each in
+// its own transaction.
+func migrateSQLite(db *sql.DB) error {
+	var version int
+	if err := db.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		return err
+	}
+	if version > len(sqliteMigrations) {
+		return fmt.Errorf("database schema version %d is newer than this ralph-wiggo (%d)", version, len(sqliteMigrations))
+	}
+
+	for i := version; i < len(sqliteMigrations); i++ {
+		err := withTx(db, func(tx *sql.Tx) error {
+			if _, err := tx.Exec(sqliteMigrations[i]); err != nil {
+				return err
+			}
+			_, err := tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, i+1))
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("migration %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// DeleteRun removes a run with its sessions, iterations and events, and the
+// JSON file it was imported from, if any.
+func (s *SQLiteStore) DeleteRun(id string) error {
+	res, err := s.db.Exec(`DELETE FROM runs WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("state: deleting run %s: %w", id, err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("state: run %q not found", id)
+	}
+	s.mu.Lock()
+	s.index = nil // rebuilt without the run on the next search
+	dir := s.jsonDir
+	s.mu.Unlock()
+
+	if dir != "" {
+		for _, name := range []string{id + ".json", id + importedSuffix} {
+			err := os.Remove(filepath.Join(dir, name))
+			if err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("state: deleting run %s: %w", id, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Vacuum rebuilds the database file to return space freed by deleted runs and
+// compacted events to the filesystem.
+func (s *SQLiteStore) Vacuum() error {
+	_, err := s.db.Exec(`VACUUM`)
+	return err
+}
+
+// Close closes the database.
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+// SaveRun inserts or updates a run, along with any sessions and iterations it
+// carries.
+func (s *SQLiteStore) SaveRun(run *Run) error {
+	err := withTx(s.db, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`INSERT INTO runs (id, prd_path, branch_name, start_time, status,
+				end_time, passed, skipped, total, stop_reason)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT (id) DO UPDATE SET
+				prd_path = excluded.prd_path,
+				branch_name = excluded.branch_name,
+				start_time = excluded.start_time,
+				status = excluded.status,
+				end_time = excluded.end_time,
+				passed = excluded.passed,
+				skipped = excluded.skipped,
+				total = excluded.total,
+				stop_reason = excluded.stop_reason`,
+			run.ID, run.PRDPath, run.BranchName, sqlTime(run.StartTime), run.Status,
+			sqlTime(run.EndTime), run.Passed, run.Skipped, run.Total, run.StopReason)
+		if err != nil {
+			return err
+		}
+
+		for i, sess := range run.Stories {
+			_, err := tx.Exec(`INSERT INTO sessions (run_id, story_id, position, status, active_since)
+				VALUES (?, ?, ?, ?, ?)
+				ON CONFLICT (run_id, story_id) DO UPDATE SET
+					position = excluded.position,
+					status = excluded.status,
+					active_since = excluded.active_since`,
+				run.ID, sess.StoryID, i, sess.Status, sqlTime(sess.ActiveSince))
+			if err != nil {
+				return err
+			}
+			for _, iter := range sess.Iterations {
+				if _, err := saveIteration(tx, run.ID, sess.StoryID, iter); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("state: saving run %s: %w", run.ID, err)
+	}
+	return nil
+}
+
+// GetRun returns a run by its ID, including all iteration events.
+func (s *SQLiteStore) GetRun(id string) (*Run, error) {
+	runs, err := s.loadRuns(true, `id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(runs) == 0 {
+		return nil, fmt.Errorf("state: run %q not found", id)
+	}
+	return runs[0], nil
+}
+
+// ListRuns returns all runs sorted by start time (newest first). Iterations
+// are included without their events; use GetRun for those.
+func (s *SQLiteStore) ListRuns() ([]*Run, error) {
+	return s.loadRuns(false, `1`)
+}
+
+// StartIteration marks a story as running, records the iteration, and starts
+// writing events published for the story to it.
+func (s *SQLiteStore) StartIteration(runID, storyID string, number int) error {
+	now := time.Now()
+	var id int64
+	err := withTx(s.db, func(tx *sql.Tx) error {
+		if err := ensureSession(tx, runID, storyID); err != nil {
+			return err
+		}
+		_, err := tx.Exec(`UPDATE sessions SET status = ?, active_since = ? WHERE run_id = ? AND story_id = ?`,
+			StatusRunning, sqlTime(now), runID, storyID)
+		if err != nil {
+			return err
+		}
+		id, err = saveIteration(tx, runID, storyID, Iteration{Number: number, StartTime: now, Status: StatusRunning})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.active[StreamKey{RunID: runID, StoryID: storyID, Iteration: number}] = &activeIteration{id: id}
+	s.mu.Unlock()
+
+	s.PublishRunEvent(RunEvent{
+		Type:      RunEventIterationStart,
+		RunID:     runID,
+		StoryID:   storyID,
+		Iteration: number,
+		Status:    StatusRunning,
+	})
+	return nil
+}
+
+// PublishEvent broadcasts a streaming event to live subscribers and writes it
+// to the stream's iteration, if StartIteration was called for it. A failed
+// write is not fatal: AddIteration rewrites the events of an iteration whose
+// stored events are incomplete.
+func (s *SQLiteStore) PublishEvent(key StreamKey, evt claude.StreamEvent) {
+	s.broadcaster.PublishEvent(key, evt)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a := s.active[key]
+	if a == nil {
+		return
+	}
+	data, err := json.Marshal(evt)
+	if err != nil {
+		return
+	}
+	_, err = s.db.Exec(`INSERT OR REPLACE INTO events (iteration_id, seq, type, data) VALUES (?, ?, ?, ?)`,
+		a.id, a.nextSeq, evt.Type, data)
+	if err == nil {
+		a.nextSeq++
+	}
+}
+
+// AddIteration records a finished iteration and updates the story's session
+// status. Events already written while streaming are kept if complete.
+func (s *SQLiteStore) AddIteration(runID string, iter Iteration) error {
+	var id int64
+	err := withTx(s.db, func(tx *sql.Tx) error {
+		if err := ensureSession(tx, runID, iter.StoryID); err != nil {
+			return err
+		}
+		var err error
+		id, err = saveIteration(tx, runID, iter.StoryID, iter)
+		if err != nil {
+			return err
+		}
+
+		var status sql.NullString
+		switch iter.Status {
+		case StatusPassed, StatusFailed, StatusRunning:
+			status = sql.NullString{String: string(iter.Status), Valid: true}
+		}
+		_, err = tx.Exec(`UPDATE sessions SET status = COALESCE(?, status), active_since = NULL
+			WHERE run_id = ? AND story_id = ?`, status, runID, iter.StoryID)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	key := StreamKey{RunID: runID, StoryID: iter.StoryID, Iteration: iter.Number}
+	if a := s.active[key]; a != nil && a.id == id {
+		delete(s.active, key)
+	}
+	if s.index != nil {
+		s.index.AddIteration(runID, iter.StoryID, iter.Number, iter.Events)
+	}
+	s.mu.Unlock()
+
+	s.PublishRunEvent(RunEvent{
+		Type:      RunEventIterationEnd,
+		RunID:     runID,
+		StoryID:   iter.StoryID,
+		Iteration: iter.Number,
+		Status:    iter.Status,
+	})
+	return nil
+}
+
+// FinishRun records the outcome of a run and notifies run event subscribers.
+// Stories still marked running were cut off and become failed.
+func (s *SQLiteStore) FinishRun(runID string, res RunResult) error {
+	err := withTx(s.db, func(tx *sql.Tx) error {
+		if err := requireRun(tx, runID); err != nil {
+			return err
+		}
+		_, err := tx.Exec(`UPDATE runs SET status = ?, stop_reason = ?, end_time = ?, passed = ?, skipped = ?, total = ?
+			WHERE id = ?`,
+			res.Status, res.StopReason, sqlTime(res.EndTime), res.Passed, res.Skipped, res.Total, runID)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`UPDATE sessions SET active_since = NULL,
+				status = CASE status WHEN ? THEN ? ELSE status END
+			WHERE run_id = ?`, StatusRunning, StatusFailed, runID)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	s.PublishRunEvent(runCompleteEvent(runID, res))
+	return nil
+}
+
+// GetIterationsForStory returns all iterations for a specific story within a
+// run, including their events.
+func (s *SQLiteStore) GetIterationsForStory(runID, storyID string) ([]Iteration, error) {
+	if err := requireRun(s.db, runID); err != nil {
+		return nil, err
+	}
+	return s.loadIterations(true, `run_id = ? AND story_id = ?`, runID, storyID)
+}
+
+// GetLatestSession returns the most recent agent session for a story across
+// all runs, including iteration events, and the ID of its run. Runs started at
+// the same time are ordered by ID. Returns nil if no session is found.
+func (s *SQLiteStore) GetLatestSession(storyID string) (*AgentSession, string) {
+	var runID string
+	err := s.db.QueryRow(`SELECT s.run_id FROM sessions s JOIN runs r ON r.id = s.run_id
+		WHERE s.story_id = ? ORDER BY r.start_time DESC, r.id DESC LIMIT 1`, storyID).Scan(&runID)
+	if err != nil {
+		return nil, ""
+	}
+
+	sessions, err := s.loadSessions(`run_id = ? AND story_id = ?`, runID, storyID)
+	if err != nil || len(sessions) == 0 {
+		return nil, ""
+	}
+	sess := sessions[0].session
+	sess.Iterations, err = s.loadIterations(true, `run_id = ? AND story_id = ?`, runID, storyID)
+	if err != nil {
+		return nil, ""
+	}
+	return sess, runID
+}
+
+// Search runs a full-text query over the events of every finished iteration.
+// The index is built from the database on first use and kept up to date as
+// AddIteration records new iterations. If the index cannot be built, Search
+// returns no hits and retries on the next call.
+func (s *SQLiteStore) Search(q search.Query) []search.Hit {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.index == nil {
+		ix, err := s.buildIndex()
+		if err != nil {
+			return nil
+		}
+		s.index = ix
+	}
+	return s.index.Search(q)
+}
+
+// buildIndex indexes all finished iterations, oldest run first. Caller must
+// hold s.mu.
+func (s *SQLiteStore) buildIndex() (*search.Index, error) {
+	rows, err := s.db.Query(`SELECT i.id, i.run_id, i.story_id, i.number, e.data
+		FROM iterations i
+		JOIN runs r ON r.id = i.run_id
+		JOIN events e ON e.iteration_id = i.id
+		WHERE i.status != ?
+		ORDER BY r.start_time, i.id, e.seq`, StatusRunning)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ix := search.NewIndex()
+	var cur struct {
+		id             int64
+		runID, storyID string
+		number         int
+		events         []claude.StreamEvent
+	}
+	flush := func() {
+		if len(cur.events) > 0 {
+			ix.AddIteration(cur.runID, cur.storyID, cur.number, cur.events)
+		}
+		cur.events = nil
+	}
+	for rows.Next() {
+		var (
+			id             int64
+			runID, storyID string
+			number         int
+			data           string
+		)
+		if err := rows.Scan(&id, &runID, &storyID, &number, &data); err != nil {
+			return nil, err
+		}
+		if id != cur.id {
+			flush()
+			cur.id, cur.runID, cur.storyID, cur.number = id, runID, storyID, number
+		}
+		var evt claude.StreamEvent
+		if err := json.Unmarshal([]byte(data), &evt); err != nil {
+			return nil, err
+		}
+		cur.events = append(cur.events, evt)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	flush()
+	return ix, nil
+}
+
+// importedSuffix is appended to the name of a JSON run file once the run is in
+// the database. The file is kept as a backup, but later imports skip it, so a
+// run deleted from the database does not come back.
+const importedSuffix = ".json.imported"
+
+// ImportJSON imports the run files written by MemoryStore in dir, skipping
+// runs already in the database. It returns the number of runs imported.
+// Imported files, and files of runs the database already has, are renamed
+// with importedSuffix; corrupt ones are quarantined. DeleteRun removes the
+// file of a run along with it.
+func (s *SQLiteStore) ImportJSON(dir string) (int, error) {
+	s.mu.Lock()
+	s.jsonDir = dir
+	s.mu.Unlock()
+
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	existing := make(map[string]bool)
+	rows, err := s.db.Query(`SELECT id FROM runs`)
+	if err != nil {
+		return 0, err
+	}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		existing[id] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	imported := 0
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || filepath.Ext(name) != ".json" {
+			continue
+		}
+		path := filepath.Join(dir, name)
+		if !existing[strings.TrimSuffix(name, ".json")] {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return imported, fmt.Errorf("reading %s: %w", name, err)
+			}
+			run, err := parseRunFile(data)
+			if err != nil {
+				quarantineRunFile(path, err)
+				continue
+			}
+			if !existing[run.ID] {
+				if err := s.SaveRun(run); err != nil {
+					return imported, err
+				}
+				existing[run.ID] = true
+				imported++
+			}
+		}
+		if err := os.Rename(path, strings.TrimSuffix(path, ".json")+importedSuffix); err != nil {
+			return imported, fmt.Errorf("marking %s imported: %w", name, err)
+		}
+	}
+	return imported, nil
+}
+
+// loadRuns returns the runs matching a WHERE clause over the runs table,
+// newest first, with their sessions and iterations.
+func (s *SQLiteStore) loadRuns(withEvents bool, where string, args ...any) ([]*Run, error) {
+	rows, err := s.db.Query(`SELECT id, prd_path, branch_name, start_time, status,
+			end_time, passed, skipped, total, stop_reason
+		FROM runs WHERE `+where+` ORDER BY start_time DESC`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("state: listing runs: %w", err)
+	}
+	var runs []*Run
+	byID := make(map[string]*Run)
+	for rows.Next() {
+		var (
+			run        Run
+			start, end sql.NullInt64
+		)
+		err := rows.Scan(&run.ID, &run.PRDPath, &run.BranchName, &start, &run.Status,
+			&end, &run.Passed, &run.Skipped, &run.Total, &run.StopReason)
+		if err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("state: listing runs: %w", err)
+		}
+		run.StartTime, run.EndTime = fromSQLTime(start), fromSQLTime(end)
+		run.Stories = []*AgentSession{}
+		runs = append(runs, &run)
+		byID[run.ID] = &run
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("state: listing runs: %w", err)
+	}
+	if len(runs) == 0 {
+		return runs, nil
+	}
+
+	sub := `run_id IN (SELECT id FROM runs WHERE ` + where + `)`
+	sessions, err := s.loadSessions(sub, args...)
+	if err != nil {
+		return nil, err
+	}
+	type key struct{ runID, storyID string }
+	byKey := make(map[key]*AgentSession)
+	for _, rs := range sessions {
+		run := byID[rs.runID]
+		run.Stories = append(run.Stories, rs.session)
+		byKey[key{rs.runID, rs.session.StoryID}] = rs.session
+	}
+
+	iters, err := s.loadIterations(withEvents, sub, args...)
+	if err != nil {
+		return nil, err
+	}
+	for _, iter := range iters {
+		if sess := byKey[key{iter.RunID, iter.StoryID}]; sess != nil {
+			sess.Iterations = append(sess.Iterations, iter)
+		}
+	}
+	return runs, nil
+}
+
+// sessionRow is an agent session along with the run it belongs to.
+type sessionRow struct {
+	runID   string
+	session *AgentSession
+}
+
+// loadSessions returns the sessions matching a WHERE clause over the sessions
+// table, ordered by run and position, without iterations.
+func (s *SQLiteStore) loadSessions(where string, args ...any) ([]sessionRow, error) {
+	rows, err := s.db.Query(`SELECT run_id, story_id, status, active_since FROM sessions
+		WHERE `+where+` ORDER BY run_id, position`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("state: loading sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var sessions []sessionRow
+	for rows.Next() {
+		var (
+			rs     sessionRow
+			sess   = &AgentSession{Iterations: []Iteration{}}
+			active sql.NullInt64
+		)
+		if err := rows.Scan(&rs.runID, &sess.StoryID, &sess.Status, &active); err != nil {
+			return nil, fmt.Errorf("state: loading sessions: %w", err)
+		}
+		sess.ActiveSince = fromSQLTime(active)
+		rs.session = sess
+		sessions = append(sessions, rs)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("state: loading sessions: %w", err)
+	}
+	return sessions, nil
+}
+
+// loadIterations returns the iterations matching a WHERE clause over the
+// iterations table in recorded order, with their events if withEvents is set.
+// The clause may only reference columns of the iterations table. Iterations
+// still running are left out, as MemoryStore only records an iteration when it
+// ends; their events are read once AddIteration finishes them.
+func (s *SQLiteStore) loadIterations(withEvents bool, where string, args ...any) ([]Iteration, error) {
+	where = "status != '" + string(StatusRunning) + "' AND (" + where + ")"
+	rows, err := s.db.Query(`SELECT id, run_id, story_id, number, start_time, end_time, status, summary FROM iterations
+		WHERE `+where+` ORDER BY id`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("state: loading iterations: %w", err)
+	}
+	var iters []Iteration
+	index := make(map[int64]int) // iterations.id -> position in iters
+	for rows.Next() {
+		var (
+			id         int64
+			iter       Iteration
+			start, end sql.NullInt64
+			summary    sql.NullString
+		)
+		if err := rows.Scan(&id, &iter.RunID, &iter.StoryID, &iter.Number, &start, &end, &iter.Status, &summary); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("state: loading iterations: %w", err)
+		}
+		iter.StartTime, iter.EndTime = fromSQLTime(start), fromSQLTime(end)
+		if summary.Valid {
+			iter.Summary = new(IterationSummary)
+			if err := json.Unmarshal([]byte(summary.String), iter.Summary); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("state: decoding summary of iteration %d: %w", id, err)
+			}
+		}
+		index[id] = len(iters)
+		iters = append(iters, iter)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("state: loading iterations: %w", err)
+	}
+	if !withEvents || len(iters) == 0 {
+		return iters, nil
+	}
+
+	rows, err = s.db.Query(`SELECT iteration_id, data FROM events
+		WHERE iteration_id IN (SELECT id FROM iterations WHERE `+where+`)
+		ORDER BY iteration_id, seq`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("state: loading events: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			id   int64
+			data string
+			evt  claude.StreamEvent
+		)
+		if err := rows.Scan(&id, &data); err != nil {
+			return nil, fmt.Errorf("state: loading events: %w", err)
+		}
+		if err := json.Unmarshal([]byte(data), &evt); err != nil {
+			return nil, fmt.Errorf("state: decoding event of iteration %d: %w", id, err)
+		}
+		if i, ok := index[id]; ok {
+			iters[i].Events = append(iters[i].Events, evt)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("state: loading events: %w", err)
+	}
+	return iters, nil
+}
+
+// saveIteration inserts or updates an iteration and returns its row ID. The
+// stored events are replaced by iter.Events unless they already match in
+// number, which is the case when they were written while streaming.
+func saveIteration(tx *sql.Tx, runID, storyID string, iter Iteration) (int64, error) {
+	var summary sql.NullString
+	if iter.Summary != nil {
+		data, err := json.Marshal(iter.Summary)
+		if err != nil {
+			return 0, err
+		}
+		summary = sql.NullString{String: string(data), Valid: true}
+	}
+
+	var id int64
+	err := tx.QueryRow(`INSERT INTO iterations (run_id, story_id, number, start_time, end_time, status, summary)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (run_id, story_id, number) DO UPDATE SET
+			start_time = excluded.start_time,
+			end_time = excluded.end_time,
+			status = excluded.status,
+			summary = excluded.summary
+		RETURNING id`,
+		runID, storyID, iter.Number, sqlTime(iter.StartTime), sqlTime(iter.EndTime), iter.Status, summary).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	var stored int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM events WHERE iteration_id = ?`, id).Scan(&stored); err != nil {
+		return 0, err
+	}
+	if stored == len(iter.Events) {
+		return id, nil
+	}
+	if _, err := tx.Exec(`DELETE FROM events WHERE iteration_id = ?`, id); err != nil {
+		return 0, err
+	}
+
+	stmt, err := tx.Prepare(`INSERT INTO events (iteration_id, seq, type, data) VALUES (?, ?, ?, ?)`)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+	for seq, evt := range iter.Events {
+		data, err := json.Marshal(evt)
+		if err != nil {
+			return 0, err
+		}
+		if _, err := stmt.Exec(id, seq, evt.Type, data); err != nil {
+			return 0, err
+		}
+	}
+	return id, nil
+}
+
+// ensureSession creates a pending session for a story within a run if there
+// is none yet. It fails if the run does not exist.
+func ensureSession(tx *sql.Tx, runID, storyID string) error {
+	if err := requireRun(tx, runID); err != nil {
+		return err
+	}
+	_, err := tx.Exec(`INSERT INTO sessions (run_id, story_id, position, status)
+		SELECT ?, ?, COUNT(*), ? FROM sessions WHERE run_id = ?
+		ON CONFLICT (run_id, story_id) DO NOTHING`,
+		runID, storyID, StatusPending, runID)
+	return err
+}
+
+// queryRower is implemented by *sql.DB and *sql.Tx.
+type queryRower interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// requireRun returns an error if the run does not exist.
+func requireRun(q queryRower, runID string) error {
+	var one int
+	err := q.QueryRow(`SELECT 1 FROM runs WHERE id = ?`, runID).Scan(&one)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("state: run %q not found", runID)
+	}
+	return err
+}
+
+// withTx runs fn in a transaction, committing if it returns nil and rolling
+// back otherwise.
+func withTx(db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// sqlTime stores a time as Unix nanoseconds, and the zero time as NULL.
+func sqlTime(t time.Time) sql.NullInt64 {
+	if t.IsZero() {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: t.UnixNano(), Valid: true}
+}
+
+// fromSQLTime is the inverse of sqlTime.
+func fromSQLTime(n sql.NullInt64) time.Time {
+	if !n.Valid {
+		return time.Time{}
+	}
+	return time.Unix(0, n.Int64)
+}
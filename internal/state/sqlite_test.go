@@ -0,0 +1,312 @@
+package state
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/radvoogh/ralph-wiggo/internal/claude"
+	"github.com/radvoogh/ralph-wiggo/internal/search"
+)
+
+func openTestSQLite(t *testing.T, path string) *SQLiteStore {
+	t.Helper()
+	s, err := OpenSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("OpenSQLiteStore: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestSQLiteSaveAndGetRun(t *testing.T) {
+	s := openTestSQLite(t, filepath.Join(t.TempDir(), "state.db"))
+
+	run := testRun()
+	if err := s.SaveRun(run); err != nil {
+		t.Fatalf("SaveRun: %v", err)
+	}
+	got, err := s.GetRun("run-001")
+	if err != nil {
+		t.Fatalf("GetRun: %v", err)
+	}
+	if got.BranchName != run.BranchName || got.Status != StatusRunning || !got.StartTime.Equal(run.StartTime) {
+		t.Errorf("GetRun = %+v, want %+v", got, run)
+	}
+	if _, err := s.GetRun("missing"); err == nil {
+		t.Error("expected error for missing run")
+	}
+	if err := s.AddIteration("missing", Iteration{StoryID: "US-001", Number: 1}); err == nil {
+		t.Error("expected error adding iteration to missing run")
+	}
+}
+
+func TestSQLiteStreamsEventsDuringIteration(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.db")
+	s := openTestSQLite(t, path)
+	if err := s.SaveRun(testRun()); err != nil {
+		t.Fatalf("SaveRun: %v", err)
+	}
+
+	if err := s.StartIteration("run-001", "US-001", 1); err != nil {
+		t.Fatalf("StartIteration: %v", err)
+	}
+	events := []claude.StreamEvent{
+		{Type: claude.EventInit, SessionID: "s1"},
+		{Type: claude.EventAssistant, Message: "working on it"},
+	}
+	for _, evt := range events {
+		s.PublishEvent(testKey("US-001", 1), evt)
+	}
+
+	// Another connection sees the story running, but not the iteration until
+	// it ends.
+	reader := openTestSQLite(t, path)
+	iters, err := reader.GetIterationsForStory("run-001", "US-001")
+	if err != nil {
+		t.Fatalf("GetIterationsForStory: %v", err)
+	}
+	if len(iters) != 0 {
+		t.Fatalf("in-progress iterations = %+v, want none", iters)
+	}
+	if sess, runID := reader.GetLatestSession("US-001"); sess == nil || runID != "run-001" || sess.Status != StatusRunning || sess.ActiveSince.IsZero() {
+		t.Errorf("in-progress session = %+v (run %q)", sess, runID)
+	}
+
+	iter := Iteration{RunID: "run-001", StoryID: "US-001", Number: 1, Status: StatusPassed,
+		StartTime: time.Now(), EndTime: time.Now(), Events: events}
+	if err := s.AddIteration("run-001", iter); err != nil {
+		t.Fatalf("AddIteration: %v", err)
+	}
+
+	run, err := reader.GetRun("run-001")
+	if err != nil {
+		t.Fatalf("GetRun: %v", err)
+	}
+	if len(run.Stories) != 1 || run.Stories[0].Status != StatusPassed || !run.Stories[0].ActiveSince.IsZero() {
+		t.Fatalf("sessions = %+v", run.Stories)
+	}
+	got := run.Stories[0].Iterations
+	if len(got) != 1 || got[0].Status != StatusPassed || len(got[0].Events) != 2 || got[0].Events[1].Message != "working on it" {
+		t.Errorf("iterations = %+v", got)
+	}
+
+	// ListRuns leaves events out.
+	runs, err := reader.ListRuns()
+	if err != nil {
+		t.Fatalf("ListRuns: %v", err)
+	}
+	if len(runs) != 1 || len(runs[0].Stories[0].Iterations) != 1 || runs[0].Stories[0].Iterations[0].Events != nil {
+		t.Errorf("ListRuns = %+v", runs)
+	}
+}
+
+func TestSQLiteAddIterationReplacesIncompleteEvents(t *testing.T) {
+	s := openTestSQLite(t, filepath.Join(t.TempDir(), "state.db"))
+	if err := s.SaveRun(testRun()); err != nil {
+		t.Fatalf("SaveRun: %v", err)
+	}
+	if err := s.StartIteration("run-001", "US-002", 1); err != nil {
+		t.Fatalf("StartIteration: %v", err)
+	}
+	s.PublishEvent(testKey("US-002", 1), claude.StreamEvent{Type: claude.EventAssistant, Message: "partial"})
+
+	iter := Iteration{RunID: "run-001", StoryID: "US-002", Number: 1, Status: StatusFailed, Events: []claude.StreamEvent{
+		{Type: claude.EventAssistant, Message: "first"},
+		{Type: claude.EventError, Message: "second"},
+	}}
+	if err := s.AddIteration("run-001", iter); err != nil {
+		t.Fatalf("AddIteration: %v", err)
+	}
+	iters, err := s.GetIterationsForStory("run-001", "US-002")
+	if err != nil {
+		t.Fatalf("GetIterationsForStory: %v", err)
+	}
+	if len(iters) != 1 || len(iters[0].Events) != 2 || iters[0].Events[0].Message != "first" {
+		t.Errorf("iterations = %+v", iters)
+	}
+}
+
+func TestSQLiteImportJSON(t *testing.T) {
+	dir := t.TempDir()
+	mem, err := NewMemoryStore(filepath.Join(dir, "runs"))
+	if err != nil {
+		t.Fatalf("NewMemoryStore: %v", err)
+	}
+	if err := mem.SaveRun(testRun()); err != nil {
+		t.Fatalf("SaveRun: %v", err)
+	}
+	iter := Iteration{RunID: "run-001", StoryID: "US-001", Number: 1, Status: StatusFailed,
+		Events: []claude.StreamEvent{{Type: claude.EventError, Message: "imported widget failure"}}}
+	if err := mem.AddIteration("run-001", iter); err != nil {
+		t.Fatalf("AddIteration: %v", err)
+	}
+
+	store, err := Open(BackendSQLite, dir)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer func() { store.Close() }()
+
+	run, err := store.GetRun("run-001")
+	if err != nil {
+		t.Fatalf("GetRun after import: %v", err)
+	}
+	if len(run.Stories) != 1 || len(run.Stories[0].Iterations) != 1 || run.Stories[0].Status != StatusFailed {
+		t.Fatalf("imported run = %+v", run)
+	}
+	if hits := store.Search(search.Query{Text: "widget"}); len(hits) != 1 {
+		t.Errorf("search hits after import = %d, want 1", len(hits))
+	}
+
+	// Importing again is a no-op.
+	n, err := store.(*SQLiteStore).ImportJSON(filepath.Join(dir, "runs"))
+	if err != nil || n != 0 {
+		t.Errorf("second ImportJSON = %d, %v; want 0, nil", n, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "runs", "run-001.json")); !os.IsNotExist(err) {
+		t.Errorf("run file still in place after import: %v", err)
+	}
+
+	// A deleted run stays deleted when the store is opened again.
+	if err := store.DeleteRun("run-001"); err != nil {
+		t.Fatalf("DeleteRun: %v", err)
+	}
+	store.Close()
+	store, err = Open(BackendSQLite, dir)
+	if err != nil {
+		t.Fatalf("Open again: %v", err)
+	}
+	if runs, _ := store.ListRuns(); len(runs) != 0 {
+		t.Errorf("runs after delete and reopen = %d, want 0", len(runs))
+	}
+	if entries, _ := os.ReadDir(filepath.Join(dir, "runs")); len(entries) != 0 {
+		t.Errorf("run files left after delete: %v", entries)
+	}
+}
+
+func TestSQLiteReopenKeepsSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.db")
+	s1, err := OpenSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("OpenSQLiteStore 1: %v", err)
+	}
+	if err := s1.SaveRun(testRun()); err != nil {
+		t.Fatalf("SaveRun: %v", err)
+	}
+	s1.Close()
+
+	s2 := openTestSQLite(t, path)
+	if _, err := s2.GetRun("run-001"); err != nil {
+		t.Errorf("GetRun after reopen: %v", err)
+	}
+}
+
+func TestOpenUnknownBackend(t *testing.T) {
+	if _, err := Open("postgres", t.TempDir()); err == nil {
+		t.Error("expected error for unknown backend")
+	}
+}
+
+func TestSQLiteFinishRun(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.db")
+	s := openTestSQLite(t, path)
+
+	run := testRun()
+	if err := s.SaveRun(run); err != nil {
+		t.Fatalf("SaveRun: %v", err)
+	}
+	if err := s.StartIteration("run-001", "US-001", 1); err != nil {
+		t.Fatalf("StartIteration: %v", err)
+	}
+	end := run.StartTime.Add(time.Minute)
+	res := RunResult{Status: StatusBudgetExhausted, StopReason: "budget exhausted", EndTime: end, Passed: 2, Skipped: 1, Total: 3}
+	if err := s.FinishRun("run-001", res); err != nil {
+		t.Fatalf("FinishRun: %v", err)
+	}
+	s.Close()
+
+	s = openTestSQLite(t, path)
+	got, err := s.GetRun("run-001")
+	if err != nil {
+		t.Fatalf("GetRun: %v", err)
+	}
+	if got.Status != StatusBudgetExhausted || got.StopReason != "budget exhausted" || !got.EndTime.Equal(end) {
+		t.Errorf("GetRun = status %q, reason %q, end %v", got.Status, got.StopReason, got.EndTime)
+	}
+	if got.Passed != 2 || got.Skipped != 1 || got.Total != 3 {
+		t.Errorf("Passed, Skipped, Total = %d, %d, %d, want 2, 1, 3", got.Passed, got.Skipped, got.Total)
+	}
+	if len(got.Stories) != 1 || got.Stories[0].Status != StatusFailed {
+		t.Errorf("stories = %+v, want US-001 failed", got.Stories)
+	}
+}
+
+// TestStoresAgreeOnRunningIteration checks that both backends report an
+// iteration in progress the same way.
+func TestStoresAgreeOnRunningIteration(t *testing.T) {
+	mem, err := NewMemoryStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewMemoryStore: %v", err)
+	}
+	stores := map[string]Store{
+		"json":   mem,
+		"sqlite": openTestSQLite(t, filepath.Join(t.TempDir(), "state.db")),
+	}
+
+	type view struct {
+		Status     Status
+		Iterations []int
+		Listed     int
+		ForStory   int
+	}
+	views := make(map[string]view)
+	for name, s := range stores {
+		if err := s.SaveRun(testRun()); err != nil {
+			t.Fatalf("%s: SaveRun: %v", name, err)
+		}
+		if err := s.StartIteration("run-001", "US-001", 1); err != nil {
+			t.Fatalf("%s: StartIteration: %v", name, err)
+		}
+		s.PublishEvent(testKey("US-001", 1), claude.StreamEvent{Type: claude.EventAssistant, Message: "first"})
+		iter := Iteration{RunID: "run-001", StoryID: "US-001", Number: 1, Status: StatusFailed,
+			Events: []claude.StreamEvent{{Type: claude.EventAssistant, Message: "first"}}}
+		if err := s.AddIteration("run-001", iter); err != nil {
+			t.Fatalf("%s: AddIteration: %v", name, err)
+		}
+		if err := s.StartIteration("run-001", "US-001", 2); err != nil {
+			t.Fatalf("%s: StartIteration: %v", name, err)
+		}
+		s.PublishEvent(testKey("US-001", 2), claude.StreamEvent{Type: claude.EventAssistant, Message: "second"})
+
+		var v view
+		sess, _ := s.GetLatestSession("US-001")
+		if sess == nil {
+			t.Fatalf("%s: no latest session", name)
+		}
+		v.Status = sess.Status
+		for _, it := range sess.Iterations {
+			v.Iterations = append(v.Iterations, it.Number)
+		}
+		runs, err := s.ListRuns()
+		if err != nil || len(runs) != 1 || len(runs[0].Stories) != 1 {
+			t.Fatalf("%s: ListRuns = %+v, %v", name, runs, err)
+		}
+		v.Listed = len(runs[0].Stories[0].Iterations)
+		iters, err := s.GetIterationsForStory("run-001", "US-001")
+		if err != nil {
+			t.Fatalf("%s: GetIterationsForStory: %v", name, err)
+		}
+		v.ForStory = len(iters)
+		views[name] = v
+	}
+
+	want := view{Status: StatusRunning, Iterations: []int{1}, Listed: 1, ForStory: 1}
+	for name, v := range views {
+		if fmt.Sprint(v) != fmt.Sprint(want) {
+			t.Errorf("%s: %+v, want %+v", name, v, want)
+		}
+	}
+}
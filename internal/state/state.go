@@ -1,11 +1,13 @@
 // Package state provides structured state management for agent runs and
-// iterations. It supports an in-memory store backed by JSON files on disk
-// so that the web UI and CLI can report on run progress and history.
+// iterations. It supports an in-memory store backed by JSON files on disk and
+// an SQLite store, so that the web UI and CLI can report on run progress and
+// history.
 package state
 
 import (
 	"encoding/json"
 	"fmt"
+	"log"
 	"os"
 	"path/filepath"
 	"sort"
@@ -13,6 +15,8 @@ import (
 	"time"
 
 	"github.com/radvoogh/ralph-wiggo/internal/claude"
+	"github.com/radvoogh/ralph-wiggo/internal/fsutil"
+	"github.com/radvoogh/ralph-wiggo/internal/search"
 )
 
 // Status represents the state of a story or run.
@@ -23,8 +27,21 @@ const (
 	StatusRunning Status = "running"
 	StatusPassed  Status = "passed"
 	StatusFailed  Status = "failed"
+	StatusSplit   Status = "split" // a story replaced by smaller ones
+
+	// Terminal run statuses, recorded by FinishRun. A run may also end as
+	// StatusFailed after a fatal error.
+	StatusCompleted       Status = "completed"        // every story passes
+	StatusPartial         Status = "partial"          // stories were skipped after max iterations
+	StatusInterrupted     Status = "interrupted"      // stopped by a signal
+	StatusBudgetExhausted Status = "budget_exhausted" // skipped stories ran out of budget
 )
 
+// RunStatuses lists the statuses a run can have, in display order.
+var RunStatuses = []Status{
+	StatusRunning, StatusCompleted, StatusPartial, StatusInterrupted, StatusFailed, StatusBudgetExhausted,
+}
+
 // Run represents a single execution of the agent loop against a PRD.
 type Run struct {
 	ID         string          `json:"id"`
@@ -33,6 +50,37 @@ type Run struct {
 	StartTime  time.Time       `json:"startTime"`
 	Status     Status          `json:"status"`
 	Stories    []*AgentSession `json:"stories"`
+
+	// Set by FinishRun when the run ends.
+	EndTime    time.Time `json:"endTime,omitzero"`
+	Passed     int       `json:"passed,omitempty"`  // stories passing at the end of the run
+	Skipped    int       `json:"skipped,omitempty"` // stories given up on after max iterations
+	Total      int       `json:"total,omitempty"`   // stories in the PRD
+	StopReason string    `json:"stopReason,omitempty"`
+}
+
+// RunResult is the outcome of a run, recorded by FinishRun.
+type RunResult struct {
+	Status     Status
+	StopReason string
+	EndTime    time.Time
+	Passed     int
+	Skipped    int
+	Total      int
+}
+
+// Finished reports whether the run has ended.
+func (r *Run) Finished() bool {
+	return !r.EndTime.IsZero()
+}
+
+// Duration returns how long the run took, or how long it has been going if it
+// has not finished.
+func (r *Run) Duration() time.Duration {
+	if r.Finished() {
+		return r.EndTime.Sub(r.StartTime)
+	}
+	return time.Since(r.StartTime)
 }
 
 // Iteration represents a single attempt to implement a story within a run.
@@ -44,6 +92,9 @@ type Iteration struct {
 	EndTime   time.Time           `json:"endTime"`
 	Status    Status              `json:"status"`
 	Events    []claude.StreamEvent `json:"events"`
+	// Summary is set once the iteration has been compacted; Events then
+	// holds only the events compaction keeps.
+	Summary *IterationSummary `json:"summary,omitempty"`
 }
 
 // AgentSession tracks the state of an agent working on a single story.
@@ -51,6 +102,9 @@ type AgentSession struct {
 	StoryID    string      `json:"storyID"`
 	Status     Status      `json:"status"`
 	Iterations []Iteration `json:"iterations"`
+	// ActiveSince is when the in-progress iteration started; zero when no
+	// iteration is running.
+	ActiveSince time.Time `json:"activeSince,omitzero"`
 }
 
 // RunStore defines the interface for persisting and querying run state.
@@ -60,6 +114,63 @@ type RunStore interface {
 	ListRuns() ([]*Run, error)
 	AddIteration(runID string, iter Iteration) error
 	GetIterationsForStory(runID, storyID string) ([]Iteration, error)
+	FinishRun(runID string, res RunResult) error
+	DeleteRun(id string) error
+}
+
+// Store is the state API used by the agent loop and the dashboard: a RunStore
+// plus live event broadcasting and search. MemoryStore and SQLiteStore both
+// implement it.
+type Store interface {
+	RunStore
+	StartIteration(runID, storyID string, number int) error
+	GetLatestSession(storyID string) (sess *AgentSession, runID string)
+	Search(q search.Query) []search.Hit
+
+	BeginBroadcast(key StreamKey)
+	PublishEvent(key StreamKey, evt claude.StreamEvent)
+	Subscribe(key StreamKey, after EventID) ([]BroadcastEvent, *Subscription)
+	CloseSubscribers(key StreamKey)
+	Stream(key StreamKey) (StreamInfo, bool)
+	ActiveStreams() []StreamInfo
+	PublishRunEvent(evt RunEvent)
+	SubscribeRunEvents() (<-chan RunEvent, func())
+
+	Close() error
+}
+
+// Backends accepted by Open.
+const (
+	BackendJSON   = "json"
+	BackendSQLite = "sqlite"
+)
+
+// Open opens the state store kept in stateDir (normally .ralph-wiggo) with the
+// named backend. An empty backend selects BackendJSON. The SQLite backend
+// imports any JSON run files it has not seen yet, so switching backends keeps
+// history, and marks them imported (see SQLiteStore.ImportJSON).
+func Open(backend, stateDir string) (Store, error) {
+	runsDir := filepath.Join(stateDir, "runs")
+	switch backend {
+	case "", BackendJSON:
+		s, err := NewMemoryStore(runsDir)
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+	case BackendSQLite:
+		s, err := OpenSQLiteStore(filepath.Join(stateDir, "state.db"))
+		if err != nil {
+			return nil, err
+		}
+		if _, err := s.ImportJSON(runsDir); err != nil {
+			s.Close()
+			return nil, fmt.Errorf("state: importing JSON runs: %w", err)
+		}
+		return s, nil
+	default:
+		return nil, fmt.Errorf("state: unknown backend %q (want %q or %q)", backend, BackendJSON, BackendSQLite)
+	}
 }
 
 // MemoryStore is an in-memory RunStore backed by JSON files on disk.
@@ -68,21 +179,9 @@ type MemoryStore struct {
 	runs    map[string]*Run
 	baseDir string // directory for JSON persistence (e.g. .ralph-wiggo/runs/)
 
-	broadMu    sync.Mutex
-	broadcasts map[string]*storyBroadcast
-}
-
-// storyBroadcast holds live event subscribers and a buffer of events published
-// so far for a single story's current iteration.
-type storyBroadcast struct {
-	events      []claude.StreamEvent
-	subscribers []*eventSubscriber
-	closed      bool
-}
+	*broadcaster
 
-// eventSubscriber is a single SSE subscriber channel.
-type eventSubscriber struct {
-	ch chan claude.StreamEvent
+	index *search.Index // full-text index, built on first Search; guarded by mu
 }
 
 // NewMemoryStore creates a new MemoryStore that persists state to the given
@@ -91,7 +190,7 @@ func NewMemoryStore(baseDir string) (*MemoryStore, error) {
 	s := &MemoryStore{
 		runs:       make(map[string]*Run),
 		baseDir:    baseDir,
-		broadcasts: make(map[string]*storyBroadcast),
+		broadcaster: newBroadcaster(),
 	}
 	if err := s.loadFromDisk(); err != nil {
 		return nil, fmt.Errorf("state: loading run history: %w", err)
@@ -146,23 +245,9 @@ func (s *MemoryStore) AddIteration(runID string, iter Iteration) error {
 		return fmt.Errorf("state: run %q not found", runID)
 	}
 
-	// Find or create the agent session for this story.
-	var session *AgentSession
-	for _, sess := range run.Stories {
-		if sess.StoryID == iter.StoryID {
-			session = sess
-			break
-		}
-	}
-	if session == nil {
-		session = &AgentSession{
-			StoryID: iter.StoryID,
-			Status:  StatusPending,
-		}
-		run.Stories = append(run.Stories, session)
-	}
-
+	session := findOrCreateSession(run, iter.StoryID)
 	session.Iterations = append(session.Iterations, iter)
+	session.ActiveSince = time.Time{}
 
 	// Update session status based on iteration outcome.
 	switch iter.Status {
@@ -174,7 +259,67 @@ func (s *MemoryStore) AddIteration(runID string, iter Iteration) error {
 		session.Status = StatusRunning
 	}
 
-	return s.persistRun(run)
+	if err := s.persistRun(run); err != nil {
+		return err
+	}
+	if s.index != nil {
+		s.index.AddIteration(runID, iter.StoryID, iter.Number, iter.Events)
+	}
+
+	s.PublishRunEvent(RunEvent{
+		Type:      RunEventIterationEnd,
+		RunID:     runID,
+		StoryID:   iter.StoryID,
+		Iteration: iter.Number,
+		Status:    iter.Status,
+	})
+	return nil
+}
+
+// FinishRun records the outcome of a run, persists it, and notifies run event
+// subscribers. Stories still marked running were cut off and become failed.
+func (s *MemoryStore) FinishRun(runID string, res RunResult) error {
+	s.mu.Lock()
+	run, ok := s.runs[runID]
+	if !ok {
+		s.mu.Unlock()
+		return fmt.Errorf("state: run %q not found", runID)
+	}
+	run.Status = res.Status
+	run.StopReason = res.StopReason
+	run.EndTime = res.EndTime
+	run.Passed, run.Skipped, run.Total = res.Passed, res.Skipped, res.Total
+	for _, sess := range run.Stories {
+		if sess.Status == StatusRunning {
+			sess.Status = StatusFailed
+		}
+		sess.ActiveSince = time.Time{}
+	}
+	err := s.persistRun(run)
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	s.PublishRunEvent(runCompleteEvent(runID, res))
+	return nil
+}
+
+// findOrCreateSession returns the agent session for a story within a run,
+// creating a pending one if the story has no session yet. Caller must hold
+// s.mu for writing.
+func findOrCreateSession(run *Run, storyID string) *AgentSession {
+	for _, sess := range run.Stories {
+		if sess.StoryID == storyID {
+			return sess
+		}
+	}
+	session := &AgentSession{
+		StoryID: storyID,
+		Status:  StatusPending,
+	}
+	run.Stories = append(run.Stories, session)
+	return session
 }
 
 // GetIterationsForStory returns all iterations for a story within a run.
@@ -195,6 +340,23 @@ func (s *MemoryStore) GetIterationsForStory(runID, storyID string) ([]Iteration,
 	return nil, nil
 }
 
+// DeleteRun removes a run and its file.
+func (s *MemoryStore) DeleteRun(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.runs[id]; !ok {
+		return fmt.Errorf("state: run %q not found", id)
+	}
+	err := os.Remove(filepath.Join(s.baseDir, id+".json"))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("state: deleting run %s: %w", id, err)
+	}
+	delete(s.runs, id)
+	s.index = nil // rebuilt without the run on the next search
+	return nil
+}
+
 // persistRun writes a single run to disk as a JSON file. Caller must hold s.mu.
 func (s *MemoryStore) persistRun(run *Run) error {
 	if err := os.MkdirAll(s.baseDir, 0755); err != nil {
@@ -207,7 +369,7 @@ func (s *MemoryStore) persistRun(run *Run) error {
 	}
 
 	path := filepath.Join(s.baseDir, run.ID+".json")
-	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+	if err := fsutil.WriteFileAtomic(path, append(data, '\n'), 0644); err != nil {
 		return fmt.Errorf("state: writing run %s: %w", run.ID, err)
 	}
 	return nil
@@ -233,127 +395,67 @@ func (s *MemoryStore) loadFromDisk() error {
 			return fmt.Errorf("reading %s: %w", entry.Name(), err)
 		}
 
-		var run Run
-		if err := json.Unmarshal(data, &run); err != nil {
-			return fmt.Errorf("parsing %s: %w", entry.Name(), err)
+		run, err := parseRunFile(data)
+		if err != nil {
+			quarantineRunFile(filepath.Join(s.baseDir, entry.Name()), err)
+			continue
 		}
-		s.runs[run.ID] = &run
+		s.runs[run.ID] = run
 	}
 	return nil
 }
 
-// getBroadcast returns (or creates) the broadcast state for a story.
-// Caller must hold s.broadMu.
-func (s *MemoryStore) getBroadcast(storyID string) *storyBroadcast {
-	bc, ok := s.broadcasts[storyID]
-	if !ok {
-		bc = &storyBroadcast{}
-		s.broadcasts[storyID] = bc
+// parseRunFile decodes the contents of a run file written by persistRun.
+func parseRunFile(data []byte) (*Run, error) {
+	var run Run
+	if err := json.Unmarshal(data, &run); err != nil {
+		return nil, err
 	}
-	return bc
-}
-
-// PublishEvent sends a streaming event to all live subscribers for a story and
-// stores it so late-joining subscribers receive the full history.
-func (s *MemoryStore) PublishEvent(storyID string, evt claude.StreamEvent) {
-	s.broadMu.Lock()
-	defer s.broadMu.Unlock()
-
-	bc := s.getBroadcast(storyID)
-	if bc.closed {
-		return
-	}
-
-	bc.events = append(bc.events, evt)
-	for _, sub := range bc.subscribers {
-		select {
-		case sub.ch <- evt:
-		default:
-			// Drop if subscriber is slow.
-		}
-	}
-}
-
-// Subscribe returns all events published so far for a story, a channel for
-// future live events, and an unsubscribe function. The channel is closed when
-// CloseSubscribers is called for the story.
-func (s *MemoryStore) Subscribe(storyID string) ([]claude.StreamEvent, <-chan claude.StreamEvent, func()) {
-	s.broadMu.Lock()
-	defer s.broadMu.Unlock()
-
-	bc := s.getBroadcast(storyID)
-
-	// Snapshot existing events.
-	snapshot := make([]claude.StreamEvent, len(bc.events))
-	copy(snapshot, bc.events)
-
-	sub := &eventSubscriber{ch: make(chan claude.StreamEvent, 64)}
-	if bc.closed {
-		close(sub.ch)
-		return snapshot, sub.ch, func() {}
-	}
-
-	bc.subscribers = append(bc.subscribers, sub)
-
-	unsub := func() {
-		s.broadMu.Lock()
-		defer s.broadMu.Unlock()
-		subs := bc.subscribers
-		for i, ss := range subs {
-			if ss == sub {
-				bc.subscribers = append(subs[:i], subs[i+1:]...)
-				break
-			}
-		}
+	if run.ID == "" {
+		return nil, fmt.Errorf("missing run ID")
 	}
-
-	return snapshot, sub.ch, unsub
+	return &run, nil
 }
 
-// CloseSubscribers closes all subscriber channels for a story and resets the
-// broadcast buffer. Call this when the story's agent iteration is complete.
-func (s *MemoryStore) CloseSubscribers(storyID string) {
-	s.broadMu.Lock()
-	defer s.broadMu.Unlock()
-
-	bc, ok := s.broadcasts[storyID]
-	if !ok {
+// quarantineRunFile renames a run file that cannot be parsed (e.g. one
+// truncated by a crash before writes were atomic) so the store can start
+// without it. The file is kept for inspection; its new name no longer ends in
+// .json, so later loads skip it.
+func quarantineRunFile(path string, cause error) {
+	dest := fmt.Sprintf("%s.corrupt-%d", path, time.Now().Unix())
+	if err := os.Rename(path, dest); err != nil {
+		log.Printf("state: skipping corrupt run file %s: %v (moving it aside failed: %v)", path, cause, err)
 		return
 	}
-
-	bc.closed = true
-	for _, sub := range bc.subscribers {
-		close(sub.ch)
-	}
-	bc.subscribers = nil
+	log.Printf("state: moved corrupt run file %s to %s: %v", path, dest, cause)
 }
 
-// ResetBroadcast clears the broadcast state for a story so it can accept new
-// subscribers for a subsequent iteration.
-func (s *MemoryStore) ResetBroadcast(storyID string) {
-	s.broadMu.Lock()
-	defer s.broadMu.Unlock()
-	delete(s.broadcasts, storyID)
+// Close implements Store. A MemoryStore holds no resources, so it is a no-op.
+func (s *MemoryStore) Close() error {
+	return nil
 }
 
 // GetLatestSession returns the most recent agent session for a story across
-// all runs. Returns nil if no session is found.
-func (s *MemoryStore) GetLatestSession(storyID string) *AgentSession {
+// all runs, and the ID of its run. Runs started at the same time are ordered by
+// ID. Returns nil if no session is found.
+func (s *MemoryStore) GetLatestSession(storyID string) (sess *AgentSession, runID string) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	var latest *AgentSession
-	var latestTime time.Time
-
+	var latest *Run
 	for _, run := range s.runs {
-		for _, sess := range run.Stories {
-			if sess.StoryID == storyID {
-				if latest == nil || run.StartTime.After(latestTime) {
-					latest = sess
-					latestTime = run.StartTime
-				}
+		for _, rs := range run.Stories {
+			if rs.StoryID != storyID {
+				continue
+			}
+			if latest == nil || run.StartTime.After(latest.StartTime) ||
+				(run.StartTime.Equal(latest.StartTime) && run.ID > latest.ID) {
+				latest, sess = run, rs
 			}
 		}
 	}
-	return latest
+	if latest == nil {
+		return nil, ""
+	}
+	return sess, latest.ID
 }
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/radvoogh/ralph-wiggo/internal/claude"
+	"github.com/radvoogh/ralph-wiggo/internal/search"
 )
 
 func testRun() *Run {
@@ -330,6 +331,40 @@ func TestNewMemoryStoreEmptyDir(t *testing.T) {
 	}
 }
 
+func TestCorruptRunFileQuarantined(t *testing.T) {
+	dir := t.TempDir()
+	store1, err := NewMemoryStore(dir)
+	if err != nil {
+		t.Fatalf("NewMemoryStore 1: %v", err)
+	}
+	if err := store1.SaveRun(testRun()); err != nil {
+		t.Fatalf("SaveRun: %v", err)
+	}
+	// A file truncated mid-write, as left by a crash before atomic writes.
+	if err := os.WriteFile(filepath.Join(dir, "run-002.json"), []byte(`{"id":"run-002","stor`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	store2, err := NewMemoryStore(dir)
+	if err != nil {
+		t.Fatalf("NewMemoryStore should tolerate corrupt files: %v", err)
+	}
+	if _, err := store2.GetRun("run-001"); err != nil {
+		t.Errorf("intact run not loaded: %v", err)
+	}
+
+	matches, err := filepath.Glob(filepath.Join(dir, "run-002.json.corrupt-*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 1 {
+		t.Errorf("expected corrupt file to be moved aside, found %v", matches)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "run-002.json")); !os.IsNotExist(err) {
+		t.Error("corrupt file still in place")
+	}
+}
+
 func TestSaveRunOverwrite(t *testing.T) {
 	dir := t.TempDir()
 	store, err := NewMemoryStore(dir)
@@ -356,3 +391,310 @@ func TestSaveRunOverwrite(t *testing.T) {
 		t.Errorf("Status = %q, want %q after overwrite", got.Status, StatusPassed)
 	}
 }
+
+// testKey returns the stream key of a story iteration in testRun.
+func testKey(storyID string, iteration int) StreamKey {
+	return StreamKey{RunID: "run-001", StoryID: storyID, Iteration: iteration}
+}
+
+func TestPublishEventSequence(t *testing.T) {
+	store, err := NewMemoryStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewMemoryStore: %v", err)
+	}
+
+	for _, msg := range []string{"one", "two", "three"} {
+		store.PublishEvent(testKey("US-001", 1), claude.StreamEvent{Type: claude.EventAssistant, Message: msg})
+	}
+
+	snapshot, sub := store.Subscribe(testKey("US-001", 1), EventID{})
+	defer sub.Close()
+	if len(snapshot) != 3 {
+		t.Fatalf("expected 3 events in snapshot, got %d", len(snapshot))
+	}
+	for i, be := range snapshot {
+		if be.ID.Seq != uint64(i+1) {
+			t.Errorf("snapshot[%d].ID.Seq = %d, want %d", i, be.ID.Seq, i+1)
+		}
+		if be.ID.Epoch != snapshot[0].ID.Epoch {
+			t.Errorf("snapshot[%d] epoch changed within a broadcast", i)
+		}
+	}
+
+	store.PublishEvent(testKey("US-001", 1), claude.StreamEvent{Type: claude.EventAssistant, Message: "four"})
+	be := <-sub.C
+	if be.ID.Seq != 4 || be.Event.Message != "four" {
+		t.Errorf("live event = %+v, want seq 4 message %q", be, "four")
+	}
+}
+
+func TestSubscribeResumesAfterEventID(t *testing.T) {
+	store, err := NewMemoryStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewMemoryStore: %v", err)
+	}
+
+	for _, msg := range []string{"one", "two", "three"} {
+		store.PublishEvent(testKey("US-001", 1), claude.StreamEvent{Type: claude.EventAssistant, Message: msg})
+	}
+
+	first, sub := store.Subscribe(testKey("US-001", 1), EventID{})
+	sub.Close()
+
+	// Reconnecting after the second event only replays the third.
+	snapshot, sub := store.Subscribe(testKey("US-001", 1), first[1].ID)
+	defer sub.Close()
+	if len(snapshot) != 1 || snapshot[0].Event.Message != "three" {
+		t.Fatalf("resumed snapshot = %+v, want only %q", snapshot, "three")
+	}
+
+	// An ID from a previous iteration's stream replays everything in the new one.
+	store.CloseSubscribers(testKey("US-001", 1))
+	store.BeginBroadcast(testKey("US-001", 2))
+	store.PublishEvent(testKey("US-001", 2), claude.StreamEvent{Type: claude.EventAssistant, Message: "fresh"})
+	snapshot, sub2 := store.Subscribe(testKey("US-001", 2), first[2].ID)
+	defer sub2.Close()
+	if len(snapshot) != 1 || snapshot[0].Event.Message != "fresh" {
+		t.Fatalf("snapshot after reset = %+v, want only %q", snapshot, "fresh")
+	}
+	if snapshot[0].ID.Epoch == first[2].ID.Epoch {
+		t.Error("expected a new epoch for the next iteration")
+	}
+	if _, ok := store.Stream(testKey("US-001", 1)); ok {
+		t.Error("finished iteration still buffered after the next one began")
+	}
+}
+
+func TestSlowSubscriberLags(t *testing.T) {
+	store, err := NewMemoryStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewMemoryStore: %v", err)
+	}
+
+	_, sub := store.Subscribe(testKey("US-001", 1), EventID{})
+	defer sub.Close()
+
+	// Publish more events than the subscriber buffer without reading.
+	for i := 0; i < subscriberBuffer+1; i++ {
+		store.PublishEvent(testKey("US-001", 1), claude.StreamEvent{Type: claude.EventAssistant})
+	}
+
+	received := 0
+	for range sub.C {
+		received++
+	}
+	if received != subscriberBuffer {
+		t.Errorf("received %d events before gap, want %d", received, subscriberBuffer)
+	}
+	if !sub.Lagged() {
+		t.Error("expected subscription to be marked as lagged")
+	}
+}
+
+func TestCloseSubscribersNotLagged(t *testing.T) {
+	store, err := NewMemoryStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewMemoryStore: %v", err)
+	}
+
+	_, sub := store.Subscribe(testKey("US-001", 1), EventID{})
+	defer sub.Close()
+	store.CloseSubscribers(testKey("US-001", 1))
+
+	if _, open := <-sub.C; open {
+		t.Fatal("expected channel to be closed")
+	}
+	if sub.Lagged() {
+		t.Error("completed subscription should not be marked as lagged")
+	}
+}
+
+func TestParseEventID(t *testing.T) {
+	id := EventID{Epoch: 42, Seq: 7}
+	got, ok := ParseEventID(id.String())
+	if !ok || got != id {
+		t.Errorf("ParseEventID(%q) = %+v, %v; want %+v, true", id.String(), got, ok, id)
+	}
+	for _, bad := range []string{"", "7", "a-b", "1-x"} {
+		if _, ok := ParseEventID(bad); ok {
+			t.Errorf("ParseEventID(%q) succeeded, want failure", bad)
+		}
+	}
+}
+
+func TestRunEvents(t *testing.T) {
+	store, err := NewMemoryStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewMemoryStore: %v", err)
+	}
+	if err := store.SaveRun(testRun()); err != nil {
+		t.Fatalf("SaveRun: %v", err)
+	}
+
+	events, unsub := store.SubscribeRunEvents()
+	defer unsub()
+
+	if err := store.StartIteration("run-001", "US-001", 1); err != nil {
+		t.Fatalf("StartIteration: %v", err)
+	}
+	evt := <-events
+	if evt.Type != RunEventIterationStart || evt.StoryID != "US-001" || evt.Iteration != 1 {
+		t.Errorf("start event = %+v", evt)
+	}
+	if evt.Time.IsZero() {
+		t.Error("expected event time to be set")
+	}
+
+	sess, runID := store.GetLatestSession("US-001")
+	if sess == nil || runID != "run-001" || sess.Status != StatusRunning || sess.ActiveSince.IsZero() {
+		t.Fatalf("session after StartIteration = %+v (run %q), want running with ActiveSince", sess, runID)
+	}
+
+	iter := Iteration{RunID: "run-001", StoryID: "US-001", Number: 1, Status: StatusPassed}
+	if err := store.AddIteration("run-001", iter); err != nil {
+		t.Fatalf("AddIteration: %v", err)
+	}
+	evt = <-events
+	if evt.Type != RunEventIterationEnd || evt.Status != StatusPassed {
+		t.Errorf("end event = %+v", evt)
+	}
+	if !sess.ActiveSince.IsZero() {
+		t.Error("expected ActiveSince to be cleared when the iteration ends")
+	}
+
+	if err := store.StartIteration("nonexistent", "US-001", 1); err == nil {
+		t.Error("expected error for nonexistent run")
+	}
+}
+
+func TestSearchIndexesHistoryAndNewIterations(t *testing.T) {
+	dir := t.TempDir()
+	store1, err := NewMemoryStore(dir)
+	if err != nil {
+		t.Fatalf("NewMemoryStore 1: %v", err)
+	}
+	if err := store1.SaveRun(testRun()); err != nil {
+		t.Fatalf("SaveRun: %v", err)
+	}
+	old := Iteration{RunID: "run-001", StoryID: "US-001", Number: 1, Status: StatusFailed,
+		Events: []claude.StreamEvent{{Type: claude.EventError, Message: "flaky widget"}}}
+	if err := store1.AddIteration("run-001", old); err != nil {
+		t.Fatalf("AddIteration: %v", err)
+	}
+
+	// A fresh store builds its index from history on first search...
+	store2, err := NewMemoryStore(dir)
+	if err != nil {
+		t.Fatalf("NewMemoryStore 2: %v", err)
+	}
+	if hits := store2.Search(search.Query{Text: "widget"}); len(hits) != 1 {
+		t.Fatalf("history hits = %d, want 1", len(hits))
+	}
+
+	// ...and picks up iterations recorded afterwards.
+	next := Iteration{RunID: "run-001", StoryID: "US-001", Number: 2, Status: StatusPassed,
+		Events: []claude.StreamEvent{{Type: claude.EventAssistant, Message: "fixed the widget"}}}
+	if err := store2.AddIteration("run-001", next); err != nil {
+		t.Fatalf("AddIteration: %v", err)
+	}
+	hits := store2.Search(search.Query{Text: "widget"})
+	if len(hits) != 2 {
+		t.Fatalf("hits = %d, want 2", len(hits))
+	}
+	if hits[0].Iteration != 2 {
+		t.Errorf("most recent hit should rank first among ties, got iteration %d", hits[0].Iteration)
+	}
+}
+
+func TestFinishRun(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewMemoryStore(dir)
+	if err != nil {
+		t.Fatalf("NewMemoryStore: %v", err)
+	}
+	run := testRun()
+	run.Stories = []*AgentSession{{StoryID: "US-001", Status: StatusRunning}}
+	if err := store.SaveRun(run); err != nil {
+		t.Fatalf("SaveRun: %v", err)
+	}
+
+	events, unsub := store.SubscribeRunEvents()
+	defer unsub()
+
+	end := run.StartTime.Add(90 * time.Second)
+	res := RunResult{Status: StatusInterrupted, StopReason: "interrupted by signal", EndTime: end, Passed: 1, Skipped: 2, Total: 4}
+	if err := store.FinishRun("run-001", res); err != nil {
+		t.Fatalf("FinishRun: %v", err)
+	}
+
+	// The result must survive a reload from disk.
+	reloaded, err := NewMemoryStore(dir)
+	if err != nil {
+		t.Fatalf("NewMemoryStore (reload): %v", err)
+	}
+	got, err := reloaded.GetRun("run-001")
+	if err != nil {
+		t.Fatalf("GetRun: %v", err)
+	}
+	if got.Status != StatusInterrupted || got.StopReason != "interrupted by signal" {
+		t.Errorf("Status, StopReason = %q, %q", got.Status, got.StopReason)
+	}
+	if got.Passed != 1 || got.Skipped != 2 || got.Total != 4 {
+		t.Errorf("Passed, Skipped, Total = %d, %d, %d, want 1, 2, 4", got.Passed, got.Skipped, got.Total)
+	}
+	if !got.Finished() || got.Duration() != 90*time.Second {
+		t.Errorf("Finished() = %v, Duration() = %v, want true, 1m30s", got.Finished(), got.Duration())
+	}
+	if got.Stories[0].Status != StatusFailed {
+		t.Errorf("running story status = %q, want %q", got.Stories[0].Status, StatusFailed)
+	}
+
+	select {
+	case evt := <-events:
+		if evt.Type != RunEventRunComplete || evt.Status != StatusInterrupted {
+			t.Errorf("event = %+v, want run_complete with status interrupted", evt)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no run_complete event published")
+	}
+
+	if err := store.FinishRun("nonexistent", res); err == nil {
+		t.Error("expected error finishing nonexistent run")
+	}
+}
+
+func TestStreamsKeyedByRunAndIteration(t *testing.T) {
+	store, err := NewMemoryStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewMemoryStore: %v", err)
+	}
+
+	// A retry and a later run of the same story are separate streams.
+	older := StreamKey{RunID: "run-001", StoryID: "US-001", Iteration: 2}
+	newer := StreamKey{RunID: "run-002", StoryID: "US-001", Iteration: 1}
+	store.BeginBroadcast(older)
+	store.PublishEvent(older, claude.StreamEvent{Type: claude.EventAssistant, Message: "old"})
+	time.Sleep(time.Millisecond)
+	store.BeginBroadcast(newer)
+	store.PublishEvent(newer, claude.StreamEvent{Type: claude.EventAssistant, Message: "new"})
+
+	snapshot, sub := store.Subscribe(older, EventID{})
+	sub.Close()
+	if len(snapshot) != 1 || snapshot[0].Event.Message != "old" {
+		t.Errorf("older stream = %+v, want only %q", snapshot, "old")
+	}
+
+	active := store.ActiveStreams()
+	if len(active) != 2 || active[0].StreamKey != newer || active[1].StreamKey != older {
+		t.Fatalf("ActiveStreams = %+v, want newer then older", active)
+	}
+
+	store.CloseSubscribers(older)
+	active = store.ActiveStreams()
+	if len(active) != 1 || active[0].StreamKey != newer || active[0].Events != 1 {
+		t.Errorf("ActiveStreams after close = %+v, want only %v", active, newer)
+	}
+	if info, ok := store.Stream(older); !ok || !info.Closed {
+		t.Errorf("Stream(older) = %+v, %v, want closed and still buffered", info, ok)
+	}
+}
@@ -0,0 +1,142 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/radvoogh/ralph-wiggo/internal/state"
+)
+
+// Comparison lines up two runs of a PRD story by story.
+type Comparison struct {
+	A, B    RunTotals
+	Stories []StoryComparison
+}
+
+// RunTotals aggregates one side of a comparison.
+type RunTotals struct {
+	RunID      string
+	Branch     string
+	Status     string
+	StartTime  time.Time
+	Stories    int // stories the run worked on
+	Passed     int
+	Iterations int
+	DurationMS int64
+	CostUSD    float64
+	Added      int
+	Deleted    int
+	ToolCalls  map[string]int
+}
+
+// StoryComparison is one story's outcome in each run. A side is nil if that
+// run never worked on the story.
+type StoryComparison struct {
+	ID   string
+	A, B *StoryOutcome
+}
+
+// StoryOutcome summarizes a story's session within one run.
+type StoryOutcome struct {
+	Status     string
+	Iterations int
+	DurationMS int64
+	CostUSD    float64
+	Added      int
+	Deleted    int
+	ToolCalls  map[string]int
+}
+
+// Passed reports whether the story passed in this run.
+func (o *StoryOutcome) Passed() bool {
+	return o != nil && o.Status == string(state.StatusPassed)
+}
+
+// CompareRuns compares two runs using only what they recorded. Stories are
+// listed in run a's order, followed by stories only run b worked on.
+func CompareRuns(a, b *state.Run) *Comparison {
+	c := &Comparison{}
+	ra, rb := BuildReport(a, nil, nil), BuildReport(b, nil, nil)
+	outA, outB := make(map[string]*StoryOutcome), make(map[string]*StoryOutcome)
+	c.A = runTotals(a, ra, outA)
+	c.B = runTotals(b, rb, outB)
+
+	for _, s := range ra.Stories {
+		c.Stories = append(c.Stories, StoryComparison{ID: s.ID, A: outA[s.ID], B: outB[s.ID]})
+	}
+	for _, s := range rb.Stories {
+		if outA[s.ID] == nil {
+			c.Stories = append(c.Stories, StoryComparison{ID: s.ID, B: outB[s.ID]})
+		}
+	}
+	return c
+}
+
+// runTotals sums a run's report and fills outcomes with its stories.
+func runTotals(run *state.Run, r *Report, outcomes map[string]*StoryOutcome) RunTotals {
+	t := RunTotals{
+		RunID:      run.ID,
+		Branch:     run.BranchName,
+		Status:     string(run.Status),
+		StartTime:  run.StartTime,
+		Stories:    len(r.Stories),
+		Iterations: r.Iterations,
+		DurationMS: r.DurationMS,
+		CostUSD:    r.CostUSD,
+		Added:      r.Added,
+		Deleted:    r.Deleted,
+		ToolCalls:  make(map[string]int),
+	}
+	for _, s := range r.Stories {
+		o := &StoryOutcome{
+			Status:     s.Status,
+			Iterations: len(s.Iterations),
+			DurationMS: s.DurationMS,
+			CostUSD:    s.CostUSD,
+			Added:      s.Added,
+			Deleted:    s.Deleted,
+			ToolCalls:  make(map[string]int),
+		}
+		for _, it := range s.Iterations {
+			for tool, n := range it.ToolCalls {
+				o.ToolCalls[tool] += n
+			}
+		}
+		for tool, n := range o.ToolCalls {
+			t.ToolCalls[tool] += n
+		}
+		if o.Passed() {
+			t.Passed++
+		}
+		outcomes[s.ID] = o
+	}
+	return t
+}
+
+// handleCompare renders two runs side by side, chosen by the a and b query
+// parameters.
+func (s *Server) handleCompare(w http.ResponseWriter, r *http.Request) {
+	if s.store == nil {
+		http.Error(w, "No state store available", http.StatusServiceUnavailable)
+		return
+	}
+
+	idA, idB := r.URL.Query().Get("a"), r.URL.Query().Get("b")
+	if idA == "" || idB == "" {
+		http.Error(w, "both a and b run IDs are required", http.StatusBadRequest)
+		return
+	}
+	a, errA := s.store.GetRun(idA)
+	b, errB := s.store.GetRun(idB)
+	if err := errors.Join(errA, errB); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := s.tmpl.ExecuteTemplate(w, "compare.html", CompareRuns(a, b)); err != nil {
+		http.Error(w, fmt.Sprintf("rendering comparison: %v", err), http.StatusInternalServerError)
+	}
+}
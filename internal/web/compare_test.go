@@ -0,0 +1,96 @@
+package web
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/radvoogh/ralph-wiggo/internal/claude"
+	"github.com/radvoogh/ralph-wiggo/internal/state"
+)
+
+// compareFixture returns the report fixture's run and a later run that
+// passed US-001 first time and also worked on US-003.
+func compareFixture() (a, b *state.Run) {
+	a, _, _ = reportFixture()
+	start := a.StartTime.Add(time.Hour)
+	b = &state.Run{
+		ID: "run-2", BranchName: "ralph/test", StartTime: start, EndTime: start.Add(3 * time.Minute),
+		Status: state.StatusPartial,
+		Stories: []*state.AgentSession{
+			{StoryID: "US-003", Status: state.StatusFailed, Iterations: []state.Iteration{{
+				Number: 1, Status: state.StatusFailed, StartTime: start, EndTime: start.Add(time.Minute),
+				Events: []claude.StreamEvent{{Type: claude.EventToolUse, ToolName: "Read"}, {Type: claude.EventResult, CostUSD: 0.1}},
+			}}},
+			{StoryID: "US-001", Status: state.StatusPassed, Iterations: []state.Iteration{{
+				Number: 1, Status: state.StatusPassed, StartTime: start.Add(time.Minute), EndTime: start.Add(2 * time.Minute),
+				Events: []claude.StreamEvent{{Type: claude.EventToolUse, ToolName: "Edit"}, {Type: claude.EventResult, CostUSD: 0.2}},
+			}}},
+		},
+	}
+	return a, b
+}
+
+func TestCompareRuns(t *testing.T) {
+	c := CompareRuns(compareFixture())
+
+	if len(c.Stories) != 2 || c.Stories[0].ID != "US-001" || c.Stories[1].ID != "US-003" {
+		t.Fatalf("stories = %+v", c.Stories)
+	}
+	us1, us3 := c.Stories[0], c.Stories[1]
+	if us1.A.Iterations != 2 || us1.B.Iterations != 1 || !us1.A.Passed() || !us1.B.Passed() {
+		t.Errorf("US-001 = %+v / %+v", us1.A, us1.B)
+	}
+	if us3.A != nil || us3.B.Passed() {
+		t.Errorf("US-003 = %+v / %+v, want only run B, failed", us3.A, us3.B)
+	}
+	if c.A.Iterations != 2 || c.B.Iterations != 2 || c.A.Passed != 1 || c.B.Passed != 1 {
+		t.Errorf("totals = %+v / %+v", c.A, c.B)
+	}
+	if c.A.CostUSD != 0.75 || c.B.CostUSD < 0.299 || c.B.CostUSD > 0.301 {
+		t.Errorf("costs = %v / %v", c.A.CostUSD, c.B.CostUSD)
+	}
+	if c.A.ToolCalls["Bash"] != 4 || c.B.ToolCalls["Read"] != 1 || us1.B.ToolCalls["Edit"] != 1 {
+		t.Errorf("tool calls = %v / %v", c.A.ToolCalls, c.B.ToolCalls)
+	}
+	if got := FormatToolCalls(c.A.ToolCalls); got != "Bash×4, Edit×1, Write×1" {
+		t.Errorf("FormatToolCalls = %q", got)
+	}
+}
+
+func TestHandleCompare(t *testing.T) {
+	srv, _ := newTestServer(t)
+	store, err := state.NewMemoryStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewMemoryStore: %v", err)
+	}
+	srv.store = store
+	a, b := compareFixture()
+	for _, run := range []*state.Run{a, b} {
+		if err := store.SaveRun(run); err != nil {
+			t.Fatalf("SaveRun: %v", err)
+		}
+	}
+
+	rec := get(srv, "/history/compare?a=run-1&b=run-2")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	body := rec.Body.String()
+	for _, want := range []string{"run-1 vs run-2", "US-003", "$0.75", "1/2 passed", "Bash×4"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("comparison missing %q", want)
+		}
+	}
+
+	if rec := get(srv, "/history/compare?a=run-1&b=missing"); rec.Code != http.StatusNotFound {
+		t.Errorf("missing run: status = %d", rec.Code)
+	}
+	if rec := get(srv, "/history/compare?a=run-1"); rec.Code != http.StatusBadRequest {
+		t.Errorf("missing b: status = %d", rec.Code)
+	}
+	if body := get(srv, "/history").Body.String(); !strings.Contains(body, `action="/history/compare"`) {
+		t.Error("history page has no compare form")
+	}
+}
@@ -0,0 +1,183 @@
+package web
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffOp is the kind of a line in a diff.
+type diffOp byte
+
+const (
+	diffContext diffOp = ' '
+	diffDelete  diffOp = '-'
+	diffInsert  diffOp = '+'
+	diffHunk    diffOp = '@' // hunk header; Text holds the "@@ ... @@" line
+)
+
+// diffLine is a single line of a unified diff.
+type diffLine struct {
+	Op   diffOp
+	Text string
+}
+
+// diffContextLines is the number of unchanged lines shown around changes.
+const diffContextLines = 3
+
+// maxDiffCells bounds the LCS table size. Larger inputs are shown as a full
+// replacement rather than spending time and memory on an exact diff.
+const maxDiffCells = 1_000_000
+
+// unifiedDiff computes a line-based unified diff between two texts, grouped
+// into hunks with a few lines of context. It also returns the number of added
+// and deleted lines.
+func unifiedDiff(oldText, newText string) (lines []diffLine, added, deleted int) {
+	a, b := splitLines(oldText), splitLines(newText)
+	ops := diffOps(a, b)
+
+	for _, op := range ops {
+		switch op.Op {
+		case diffInsert:
+			added++
+		case diffDelete:
+			deleted++
+		}
+	}
+	return groupHunks(ops), added, deleted
+}
+
+// splitLines splits text into lines, ignoring a trailing newline.
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// diffOps returns the full edit script turning a into b, using a longest
+// common subsequence over lines.
+func diffOps(a, b []string) []diffLine {
+	// Trim common prefix and suffix so the LCS table only covers the change.
+	pre := 0
+	for pre < len(a) && pre < len(b) && a[pre] == b[pre] {
+		pre++
+	}
+	suf := 0
+	for suf < len(a)-pre && suf < len(b)-pre && a[len(a)-1-suf] == b[len(b)-1-suf] {
+		suf++
+	}
+
+	var ops []diffLine
+	for _, l := range a[:pre] {
+		ops = append(ops, diffLine{diffContext, l})
+	}
+
+	ma, mb := a[pre:len(a)-suf], b[pre:len(b)-suf]
+	if len(ma)*len(mb) > maxDiffCells {
+		for _, l := range ma {
+			ops = append(ops, diffLine{diffDelete, l})
+		}
+		for _, l := range mb {
+			ops = append(ops, diffLine{diffInsert, l})
+		}
+	} else {
+		ops = append(ops, lcsOps(ma, mb)...)
+	}
+
+	for _, l := range a[len(a)-suf:] {
+		ops = append(ops, diffLine{diffContext, l})
+	}
+	return ops
+}
+
+// lcsOps computes an edit script with a dynamic-programming LCS table.
+func lcsOps(a, b []string) []diffLine {
+	n, m := len(a), len(b)
+	// lcs[i][j] is the LCS length of a[i:] and b[j:].
+	lcs := make([][]int32, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int32, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var ops []diffLine
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, diffLine{diffContext, a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, diffLine{diffDelete, a[i]})
+			i++
+		default:
+			ops = append(ops, diffLine{diffInsert, b[j]})
+			j++
+		}
+	}
+	for ; i < n; i++ {
+		ops = append(ops, diffLine{diffDelete, a[i]})
+	}
+	for ; j < m; j++ {
+		ops = append(ops, diffLine{diffInsert, b[j]})
+	}
+	return ops
+}
+
+// groupHunks collapses long runs of context into hunks, each introduced by
+// an "@@ -l,s +l,s @@" header line.
+func groupHunks(ops []diffLine) []diffLine {
+	// Mark which ops are within diffContextLines of a change.
+	keep := make([]bool, len(ops))
+	for i, op := range ops {
+		if op.Op == diffContext {
+			continue
+		}
+		for k := max(0, i-diffContextLines); k <= min(len(ops)-1, i+diffContextLines); k++ {
+			keep[k] = true
+		}
+	}
+
+	var out []diffLine
+	oldLine, newLine := 1, 1
+	for i := 0; i < len(ops); {
+		if !keep[i] {
+			oldLine++
+			newLine++
+			i++
+			continue
+		}
+
+		// Collect one hunk.
+		start := i
+		oldStart, newStart := oldLine, newLine
+		oldCount, newCount := 0, 0
+		for i < len(ops) && keep[i] {
+			switch ops[i].Op {
+			case diffContext:
+				oldCount++
+				newCount++
+			case diffDelete:
+				oldCount++
+			case diffInsert:
+				newCount++
+			}
+			i++
+		}
+		oldLine += oldCount
+		newLine += newCount
+
+		out = append(out, diffLine{diffHunk, fmt.Sprintf("@@ -%d,%d +%d,%d @@", oldStart, oldCount, newStart, newCount)})
+		out = append(out, ops[start:i]...)
+	}
+	return out
+}
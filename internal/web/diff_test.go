@@ -0,0 +1,68 @@
+package web
+
+import (
+	"strings"
+	"testing"
+)
+
+// formatDiff renders diff lines as plain unified-diff text.
+func formatDiff(lines []diffLine) string {
+	var sb strings.Builder
+	for _, l := range lines {
+		if l.Op == diffHunk {
+			sb.WriteString(l.Text)
+		} else {
+			sb.WriteByte(byte(l.Op))
+			sb.WriteString(l.Text)
+		}
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	oldText := "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\n"
+	newText := "a\nb\nc\nd\nE\nf\ng\nh\ni\nj\nk\n"
+
+	lines, added, deleted := unifiedDiff(oldText, newText)
+	if added != 2 || deleted != 1 {
+		t.Errorf("added, deleted = %d, %d; want 2, 1", added, deleted)
+	}
+
+	want := "@@ -2,9 +2,10 @@\n b\n c\n d\n-e\n+E\n f\n g\n h\n i\n j\n+k\n"
+	if got := formatDiff(lines); got != want {
+		t.Errorf("diff =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestUnifiedDiffSeparateHunks(t *testing.T) {
+	var oldLines, newLines []string
+	for i := 0; i < 20; i++ {
+		line := string(rune('a' + i))
+		oldLines = append(oldLines, line)
+		newLines = append(newLines, line)
+	}
+	newLines[1] = "B"
+	newLines[18] = "S"
+
+	lines, _, _ := unifiedDiff(strings.Join(oldLines, "\n"), strings.Join(newLines, "\n"))
+	hunks := 0
+	for _, l := range lines {
+		if l.Op == diffHunk {
+			hunks++
+		}
+	}
+	if hunks != 2 {
+		t.Errorf("expected 2 hunks, got %d:\n%s", hunks, formatDiff(lines))
+	}
+}
+
+func TestUnifiedDiffNewFile(t *testing.T) {
+	lines, added, deleted := unifiedDiff("", "one\ntwo\n")
+	if added != 2 || deleted != 0 {
+		t.Errorf("added, deleted = %d, %d; want 2, 0", added, deleted)
+	}
+	if got, want := formatDiff(lines), "@@ -1,0 +1,2 @@\n+one\n+two\n"; got != want {
+		t.Errorf("diff =\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,285 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/radvoogh/ralph-wiggo/internal/prd"
+)
+
+// storyFormData is the template context for the create/edit story form.
+type storyFormData struct {
+	Project  string
+	IsNew    bool
+	Story    prd.UserStory
+	Criteria string // acceptance criteria, one per line
+	Tags     string // comma-separated
+	Version  string
+	Error    string
+}
+
+// errConflictMessage explains an edit rejected because the PRD file changed.
+const errConflictMessage = "The PRD file was changed on disk (most likely by the running agent) after this page was loaded. " +
+	"Your change was not saved. Review the current contents and submit again."
+
+// validationError marks an edit rejected by input checks or prd.Validate, as
+// opposed to an I/O failure.
+type validationError struct {
+	err error
+}
+
+func (e *validationError) Error() string { return e.err.Error() }
+func (e *validationError) Unwrap() error { return e.err }
+
+// editErrorStatus maps an edit error to an HTTP status code.
+func editErrorStatus(err error) int {
+	var verr *validationError
+	switch {
+	case errors.Is(err, prd.ErrConflict):
+		return http.StatusConflict
+	case errors.As(err, &verr):
+		return http.StatusUnprocessableEntity
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// editMessage returns the user-facing message for an edit error.
+func editMessage(err error) string {
+	if errors.Is(err, prd.ErrConflict) {
+		return errConflictMessage
+	}
+	return err.Error()
+}
+
+// editPRD applies fn to a freshly loaded PRD and writes the result, provided
+// the file still has the version the client's page was rendered from. The
+// result must pass prd.Validate. Edits never overwrite changes made by the
+// agent: if the file changed in between, prd.ErrConflict is returned and
+// nothing is written.
+func (s *Server) editPRD(version string, fn func(p *prd.PRD) error) error {
+	p, current, err := prd.LoadPRDVersion(s.prdPath)
+	if err != nil {
+		return err
+	}
+	if version == "" || current != version {
+		return prd.ErrConflict
+	}
+	if err := fn(p); err != nil {
+		return &validationError{err}
+	}
+	if err := prd.Validate(p); err != nil {
+		return &validationError{fmt.Errorf("invalid PRD: %w", err)}
+	}
+	_, err = prd.SavePRDIfUnchanged(s.prdPath, p, version)
+	return err
+}
+
+// parseStoryForm reads a story from submitted form values.
+func parseStoryForm(r *http.Request) (prd.UserStory, error) {
+	story := prd.UserStory{
+		ID:          strings.TrimSpace(r.FormValue("id")),
+		Title:       strings.TrimSpace(r.FormValue("title")),
+		Description: strings.TrimSpace(r.FormValue("description")),
+		Notes:       strings.TrimSpace(r.FormValue("notes")),
+		Passes:      r.FormValue("passes") != "",
+	}
+	for _, line := range strings.Split(r.FormValue("criteria"), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			story.AcceptanceCriteria = append(story.AcceptanceCriteria, line)
+		}
+	}
+	if story.AcceptanceCriteria == nil {
+		story.AcceptanceCriteria = []string{}
+	}
+	for tag := range strings.SplitSeq(r.FormValue("tags"), ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			story.Tags = append(story.Tags, tag)
+		}
+	}
+	if v := strings.TrimSpace(r.FormValue("priority")); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return story, &validationError{fmt.Errorf("priority must be a number, got %q", v)}
+		}
+		story.Priority = n
+	}
+	if story.Title == "" {
+		return story, &validationError{errors.New("title is required")}
+	}
+	return story, nil
+}
+
+// renderStoryForm renders the story form, with an error banner and matching
+// status code if err is non-nil.
+func (s *Server) renderStoryForm(w http.ResponseWriter, data storyFormData, err error) {
+	if data.Project == "" {
+		if p, _, lerr := s.loadPRD(); lerr == nil {
+			data.Project = p.Project
+		}
+	}
+	data.Criteria = strings.Join(data.Story.AcceptanceCriteria, "\n")
+	data.Tags = strings.Join(data.Story.Tags, ", ")
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err != nil {
+		data.Error = editMessage(err)
+		// Hand the form the current version so a deliberate resubmit works.
+		if _, version, lerr := s.loadPRD(); lerr == nil {
+			data.Version = version
+		}
+		w.WriteHeader(editErrorStatus(err))
+	}
+	if terr := s.tmpl.ExecuteTemplate(w, "story_form.html", data); terr != nil {
+		http.Error(w, fmt.Sprintf("rendering story form: %v", terr), http.StatusInternalServerError)
+	}
+}
+
+// handleStoryNew renders (GET) or submits (POST) the new story form.
+func (s *Server) handleStoryNew(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		p, version, err := s.loadPRD()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("loading PRD: %v", err), http.StatusInternalServerError)
+			return
+		}
+		s.renderStoryForm(w, storyFormData{
+			Project: p.Project,
+			IsNew:   true,
+			Story:   prd.UserStory{ID: prd.NextStoryID(p), Priority: len(p.UserStories) + 1},
+			Version: version,
+		}, nil)
+
+	case http.MethodPost:
+		story, err := parseStoryForm(r)
+		if err == nil {
+			err = s.editPRD(r.FormValue("version"), func(p *prd.PRD) error {
+				return prd.AddStory(p, story)
+			})
+		}
+		if err != nil {
+			s.renderStoryForm(w, storyFormData{IsNew: true, Story: story, Version: r.FormValue("version")}, err)
+			return
+		}
+		http.Redirect(w, r, "/story/"+story.ID, http.StatusSeeOther)
+
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleStoryEdit renders (GET) or submits (POST) the edit form for a story.
+// Story IDs cannot be changed; a changed priority moves the story and
+// renumbers the rest.
+func (s *Server) handleStoryEdit(w http.ResponseWriter, r *http.Request, storyID string) {
+	switch r.Method {
+	case http.MethodGet:
+		p, version, err := s.loadPRD()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("loading PRD: %v", err), http.StatusInternalServerError)
+			return
+		}
+		story := prd.FindStory(p, storyID)
+		if story == nil {
+			http.NotFound(w, r)
+			return
+		}
+		s.renderStoryForm(w, storyFormData{Project: p.Project, Story: *story, Version: version}, nil)
+
+	case http.MethodPost:
+		story, err := parseStoryForm(r)
+		story.ID = storyID
+		if err == nil {
+			err = s.editPRD(r.FormValue("version"), func(p *prd.PRD) error {
+				existing := prd.FindStory(p, storyID)
+				if existing == nil {
+					return fmt.Errorf("story %s no longer exists", storyID)
+				}
+				existing.Title = story.Title
+				existing.Description = story.Description
+				existing.AcceptanceCriteria = story.AcceptanceCriteria
+				existing.Notes = story.Notes
+				existing.Tags = story.Tags
+				existing.Passes = story.Passes
+				if story.Priority != 0 && story.Priority != existing.Priority {
+					return prd.MoveStory(p, storyID, story.Priority)
+				}
+				return nil
+			})
+		}
+		if err != nil {
+			s.renderStoryForm(w, storyFormData{Story: story, Version: r.FormValue("version")}, err)
+			return
+		}
+		http.Redirect(w, r, "/story/"+storyID, http.StatusSeeOther)
+
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleStoryReset sets a story's passes flag back to false so the agent loop
+// picks it up again.
+func (s *Server) handleStoryReset(w http.ResponseWriter, r *http.Request, storyID string) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	err := s.editPRD(r.FormValue("version"), func(p *prd.PRD) error {
+		story := prd.FindStory(p, storyID)
+		if story == nil {
+			return fmt.Errorf("story %s no longer exists", storyID)
+		}
+		story.Passes = false
+		return nil
+	})
+	if err != nil {
+		s.handleStoryDetail(w, r, storyID, err)
+		return
+	}
+	http.Redirect(w, r, "/story/"+storyID, http.StatusSeeOther)
+}
+
+// handleStoryDelete removes a story and renumbers the remaining priorities.
+func (s *Server) handleStoryDelete(w http.ResponseWriter, r *http.Request, storyID string) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	err := s.editPRD(r.FormValue("version"), func(p *prd.PRD) error {
+		return prd.RemoveStory(p, storyID)
+	})
+	if err != nil {
+		s.handleStoryDetail(w, r, storyID, err)
+		return
+	}
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// handleReorder assigns priorities from a drag-and-drop ordering of the
+// dashboard table. The form carries "order" (comma-separated story IDs) and
+// "version". It responds 204 on success; errors are returned as plain text.
+func (s *Server) handleReorder(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	ids := strings.Split(r.FormValue("order"), ",")
+	err := s.editPRD(r.FormValue("version"), func(p *prd.PRD) error {
+		return prd.Reorder(p, ids)
+	})
+	if err != nil {
+		http.Error(w, editMessage(err), editErrorStatus(err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,248 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/radvoogh/ralph-wiggo/internal/prd"
+)
+
+// newTestServer writes a two-story PRD to a temp dir and returns a server for it.
+func newTestServer(t *testing.T) (*Server, string) {
+	t.Helper()
+	return newTestServerFile(t, "prd.json")
+}
+
+// newTestServerFile is newTestServer with the PRD saved under the given file
+// name, which selects its format.
+func newTestServerFile(t *testing.T, name string) (*Server, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	p := &prd.PRD{
+		Project:    "test-project",
+		BranchName: "ralph/test",
+		UserStories: []prd.UserStory{
+			{ID: "US-001", Title: "First", Priority: 1, Passes: true, AcceptanceCriteria: []string{}},
+			{ID: "US-002", Title: "Second", Priority: 2, AcceptanceCriteria: []string{}},
+		},
+	}
+	if err := prd.SavePRD(path, p); err != nil {
+		t.Fatalf("SavePRD: %v", err)
+	}
+	srv, err := NewServer(path, 0, nil)
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	return srv, path
+}
+
+// post submits form values to the server and returns the recorded response.
+func post(srv *Server, path string, form url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	srv.srv.Handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func currentVersion(t *testing.T, path string) string {
+	t.Helper()
+	_, version, err := prd.LoadPRDVersion(path)
+	if err != nil {
+		t.Fatalf("LoadPRDVersion: %v", err)
+	}
+	return version
+}
+
+func TestCreateStory(t *testing.T) {
+	srv, path := newTestServer(t)
+
+	rec := post(srv, "/story/new", url.Values{
+		"version":  {currentVersion(t, path)},
+		"id":       {"US-003"},
+		"title":    {"Third"},
+		"criteria": {"one\n\n  two  \n"},
+		"tags":     {"backend, ,api"},
+		"priority": {"1"},
+	})
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("status = %d, want 303; body: %s", rec.Code, rec.Body)
+	}
+
+	p, err := prd.LoadPRD(path)
+	if err != nil {
+		t.Fatalf("LoadPRD: %v", err)
+	}
+	story := prd.FindStory(p, "US-003")
+	if story == nil {
+		t.Fatal("US-003 not created")
+	}
+	if story.Priority != 1 || len(story.AcceptanceCriteria) != 2 || story.AcceptanceCriteria[1] != "two" ||
+		strings.Join(story.Tags, ",") != "backend,api" {
+		t.Errorf("created story = %+v", story)
+	}
+	if err := prd.Validate(p); err != nil {
+		t.Errorf("Validate: %v", err)
+	}
+}
+
+func TestEditRejectsStaleVersion(t *testing.T) {
+	srv, path := newTestServer(t)
+	stale := currentVersion(t, path)
+
+	// Simulate the agent updating prd.json after the form was rendered.
+	p, err := prd.LoadPRD(path)
+	if err != nil {
+		t.Fatalf("LoadPRD: %v", err)
+	}
+	p.UserStories[1].Notes = "written by agent"
+	if err := prd.SavePRD(path, p); err != nil {
+		t.Fatalf("SavePRD: %v", err)
+	}
+
+	rec := post(srv, "/story/US-002/edit", url.Values{
+		"version": {stale},
+		"title":   {"Edited"},
+	})
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("status = %d, want 409", rec.Code)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if !strings.Contains(string(data), "written by agent") || strings.Contains(string(data), "Edited") {
+		t.Error("agent's change was clobbered by a stale edit")
+	}
+}
+
+func TestResetAndDeleteStory(t *testing.T) {
+	srv, path := newTestServer(t)
+
+	rec := post(srv, "/story/US-001/reset", url.Values{"version": {currentVersion(t, path)}})
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("reset status = %d, want 303", rec.Code)
+	}
+	rec = post(srv, "/story/US-001/delete", url.Values{"version": {currentVersion(t, path)}})
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("delete status = %d, want 303", rec.Code)
+	}
+
+	p, err := prd.LoadPRD(path)
+	if err != nil {
+		t.Fatalf("LoadPRD: %v", err)
+	}
+	if len(p.UserStories) != 1 || p.UserStories[0].ID != "US-002" || p.UserStories[0].Priority != 1 {
+		t.Errorf("stories after delete = %+v", p.UserStories)
+	}
+}
+
+func TestEditMarkdownPRD(t *testing.T) {
+	srv, path := newTestServerFile(t, "prd.md")
+
+	rec := post(srv, "/story/US-001/reset", url.Values{"version": {currentVersion(t, path)}})
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("reset status = %d, want 303; body: %s", rec.Code, rec.Body)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "## US-001: First") || !strings.Contains(string(data), "passes: false") {
+		t.Errorf("prd.md after reset:\n%s", data)
+	}
+}
+
+func TestStoryDetailSettings(t *testing.T) {
+	srv, path := newTestServer(t)
+	srv.SetDefaults(prd.Settings{Model: "claude-opus-4-6", MaxTurns: 50, MaxIterations: 10, AllowedTools: []string{"Bash", "Read"}})
+	if _, err := prd.UpdatePRD(path, func(p *prd.PRD) error {
+		s := prd.FindStory(p, "US-002")
+		s.Model = "claude-sonnet-4-5"
+		s.Timeout = "20m"
+		s.Prompt = "Do not touch the migrations."
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/story/US-002", nil)
+	rec := httptest.NewRecorder()
+	srv.srv.Handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d; body: %s", rec.Code, rec.Body)
+	}
+	body := rec.Body.String()
+	for _, want := range []string{
+		"claude-sonnet-4-5 <span class=\"setting-override\">",
+		"20m0s <span class=\"setting-override\">",
+		"<td>50</td>",
+		"<td>Bash, Read</td>",
+		"Do not touch the migrations.",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("story page lacks %q", want)
+		}
+	}
+}
+
+func TestDashboardTagFilter(t *testing.T) {
+	srv, path := newTestServer(t)
+	if _, err := prd.UpdatePRD(path, func(p *prd.PRD) error {
+		prd.FindStory(p, "US-002").Tags = []string{"backend"}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/stories?tag=backend", nil)
+	rec := httptest.NewRecorder()
+	srv.srv.Handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d; body: %s", rec.Code, rec.Body)
+	}
+	body := rec.Body.String()
+	if strings.Contains(body, "US-001") || !strings.Contains(body, "US-002") {
+		t.Errorf("filtered list should only have US-002:\n%s", body)
+	}
+	if !strings.Contains(body, "0/1 backend stories passed") {
+		t.Errorf("progress is not limited to the tag:\n%s", body)
+	}
+	if strings.Contains(body, "draggable") {
+		t.Error("filtered list should not be reorderable")
+	}
+}
+
+func TestReorderStories(t *testing.T) {
+	srv, path := newTestServer(t)
+
+	rec := post(srv, "/api/stories/reorder", url.Values{
+		"version": {currentVersion(t, path)},
+		"order":   {"US-002,US-001"},
+	})
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("status = %d, want 204; body: %s", rec.Code, rec.Body)
+	}
+	p, err := prd.LoadPRD(path)
+	if err != nil {
+		t.Fatalf("LoadPRD: %v", err)
+	}
+	if prd.FindStory(p, "US-002").Priority != 1 {
+		t.Errorf("US-002 priority = %d, want 1", prd.FindStory(p, "US-002").Priority)
+	}
+
+	// An incomplete order is rejected without writing.
+	rec = post(srv, "/api/stories/reorder", url.Values{
+		"version": {currentVersion(t, path)},
+		"order":   {"US-001"},
+	})
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("status = %d, want 422", rec.Code)
+	}
+}
@@ -0,0 +1,483 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/radvoogh/ralph-wiggo/internal/claude"
+	"github.com/radvoogh/ralph-wiggo/internal/prd"
+	"github.com/radvoogh/ralph-wiggo/internal/progress"
+	"github.com/radvoogh/ralph-wiggo/internal/state"
+)
+
+// Report is a self-contained account of a single run: how each story ended,
+// what every iteration did and cost, and the progress log written meanwhile.
+type Report struct {
+	RunID      string    `json:"runId"`
+	Project    string    `json:"project,omitempty"`
+	Branch     string    `json:"branch"`
+	Status     string    `json:"status"`
+	StopReason string    `json:"stopReason,omitempty"`
+	StartTime  time.Time `json:"startTime"`
+	EndTime    time.Time `json:"endTime,omitzero"`
+	DurationMS int64     `json:"durationMs"`
+	CostUSD    float64   `json:"costUsd"`
+	Passed     int       `json:"passed"`
+	Skipped    int       `json:"skipped"`
+	Total      int       `json:"total"`
+	Iterations int       `json:"iterations"`
+	Added      int       `json:"linesAdded"`
+	Deleted    int       `json:"linesDeleted"`
+
+	Stories  []StoryReport    `json:"stories"`
+	Progress []progress.Entry `json:"progress,omitempty"`
+}
+
+// StoryReport is the outcome of one story within a run.
+type StoryReport struct {
+	ID         string            `json:"id"`
+	Title      string            `json:"title,omitempty"`
+	Status     string            `json:"status"` // session status, or "not run"
+	Passes     bool              `json:"passes"` // as recorded in the PRD now
+	DurationMS int64             `json:"durationMs"`
+	CostUSD    float64           `json:"costUsd"`
+	Added      int               `json:"linesAdded"`
+	Deleted    int               `json:"linesDeleted"`
+	Iterations []IterationReport `json:"iterations"`
+}
+
+// IterationReport summarizes one agent iteration.
+type IterationReport struct {
+	Number     int            `json:"number"`
+	Status     state.Status   `json:"status"`
+	StartTime  time.Time      `json:"startTime"`
+	EndTime    time.Time      `json:"endTime,omitzero"`
+	DurationMS int64          `json:"durationMs"`
+	CostUSD    float64        `json:"costUsd"`
+	Turns      int            `json:"turns,omitempty"`
+	Added      int            `json:"linesAdded"`
+	Deleted    int            `json:"linesDeleted"`
+	Files      []string       `json:"files,omitempty"`     // files edited or written
+	ToolCalls  map[string]int `json:"toolCalls,omitempty"` // calls per tool name
+	Checks     []Check        `json:"checks,omitempty"`
+
+	Events  []claude.StreamEvent    `json:"events"`
+	Summary *state.IterationSummary `json:"summary,omitempty"` // set if gc compacted the iteration
+}
+
+// Check is a verification command the agent ran, such as a test suite or
+// linter, and whether its last run in the iteration succeeded.
+type Check struct {
+	Command string `json:"command"`
+	Passed  bool   `json:"passed"`
+}
+
+// checkCommand matches shell commands that build, test or lint the project.
+var checkCommand = regexp.MustCompile(`(^|[;&|(]\s*)(go (test|vet|build)|make|npm (run )?(test|lint|build|check|typecheck)|pnpm (test|lint|build)|yarn (test|lint|build)|pytest|cargo (test|check|clippy|build)|golangci-lint|staticcheck|tsc|eslint|ruff|mypy)\b`)
+
+// BuildReport assembles the report for run. The PRD supplies story titles and
+// order and may be nil. Only progress entries written while the run was in
+// progress are included.
+func BuildReport(run *state.Run, p *prd.PRD, entries []progress.Entry) *Report {
+	r := &Report{
+		RunID:      run.ID,
+		Branch:     run.BranchName,
+		Status:     string(run.Status),
+		StopReason: run.StopReason,
+		StartTime:  run.StartTime,
+		EndTime:    run.EndTime,
+		DurationMS: run.Duration().Milliseconds(),
+		Passed:     run.Passed,
+		Skipped:    run.Skipped,
+		Total:      run.Total,
+	}
+
+	sessions := make(map[string]*state.AgentSession)
+	for _, sess := range run.Stories {
+		sessions[sess.StoryID] = sess
+	}
+
+	seen := make(map[string]bool)
+	if p != nil {
+		r.Project = p.Project
+		for _, story := range p.UserStories {
+			seen[story.ID] = true
+			sr := buildStoryReport(story.ID, sessions[story.ID])
+			sr.Title = story.Title
+			sr.Passes = story.Passes
+			r.Stories = append(r.Stories, sr)
+		}
+	}
+	// Stories since removed from the PRD keep their place in run order.
+	for _, sess := range run.Stories {
+		if !seen[sess.StoryID] {
+			r.Stories = append(r.Stories, buildStoryReport(sess.StoryID, sess))
+		}
+	}
+
+	for _, sr := range r.Stories {
+		r.CostUSD += sr.CostUSD
+		r.Added += sr.Added
+		r.Deleted += sr.Deleted
+		r.Iterations += len(sr.Iterations)
+	}
+	if !run.Finished() {
+		for _, sr := range r.Stories {
+			if sr.Status == string(state.StatusPassed) {
+				r.Passed++
+			}
+		}
+		r.Total = len(r.Stories)
+	}
+
+	// Progress timestamps have second precision.
+	from := run.StartTime.Truncate(time.Second)
+	for _, e := range entries {
+		if e.Time.Before(from) || (!run.EndTime.IsZero() && e.Time.After(run.EndTime)) {
+			continue
+		}
+		r.Progress = append(r.Progress, e)
+	}
+	return r
+}
+
+// buildStoryReport summarizes a story's session, which is nil if the run
+// never started the story.
+func buildStoryReport(id string, sess *state.AgentSession) StoryReport {
+	sr := StoryReport{ID: id, Status: "not run", Iterations: []IterationReport{}}
+	if sess == nil {
+		return sr
+	}
+	sr.Status = string(sess.Status)
+	for _, iter := range sess.Iterations {
+		ir := buildIterationReport(iter)
+		sr.DurationMS += ir.DurationMS
+		sr.CostUSD += ir.CostUSD
+		sr.Added += ir.Added
+		sr.Deleted += ir.Deleted
+		sr.Iterations = append(sr.Iterations, ir)
+	}
+	return sr
+}
+
+// buildIterationReport derives costs, diffstats and checks from an
+// iteration's events.
+func buildIterationReport(iter state.Iteration) IterationReport {
+	ir := IterationReport{
+		Number:    iter.Number,
+		Status:    iter.Status,
+		StartTime: iter.StartTime,
+		EndTime:   iter.EndTime,
+		ToolCalls: make(map[string]int),
+		Events:    iter.Events,
+		Summary:   iter.Summary,
+	}
+
+	results := make(map[string]claude.StreamEvent)
+	for _, evt := range iter.Events {
+		if evt.Type == claude.EventToolResult && evt.ToolID != "" {
+			results[evt.ToolID] = evt
+		}
+	}
+
+	var resultMS int64
+	checks := make(map[string]int) // command -> index in ir.Checks
+	for _, evt := range iter.Events {
+		switch evt.Type {
+		case claude.EventResult:
+			ir.CostUSD += evt.CostUSD
+			ir.Turns += evt.NumTurns
+			resultMS += evt.DurationMS
+		case claude.EventToolUse:
+			ir.ToolCalls[evt.ToolName]++
+			result, answered := results[evt.ToolID]
+			in := parseToolInput(evt.Input)
+			switch evt.ToolName {
+			case "Edit", "MultiEdit", "Write":
+				if answered && result.IsError {
+					continue
+				}
+				added, deleted := editStat(evt.ToolName, in)
+				ir.Added += added
+				ir.Deleted += deleted
+				if path := in.str("file_path"); path != "" && !slices.Contains(ir.Files, path) {
+					ir.Files = append(ir.Files, path)
+				}
+			case "Bash":
+				cmd := strings.TrimSpace(in.str("command"))
+				if !answered || !checkCommand.MatchString(cmd) {
+					continue
+				}
+				// Keep the last outcome of each command.
+				i, ok := checks[cmd]
+				if !ok {
+					i = len(ir.Checks)
+					checks[cmd] = i
+					ir.Checks = append(ir.Checks, Check{Command: cmd})
+				}
+				ir.Checks[i].Passed = !result.IsError
+			}
+		}
+	}
+
+	// Compacted iterations dropped most tool calls; the summary counted them.
+	if iter.Summary != nil {
+		ir.ToolCalls = iter.Summary.ToolCalls
+	}
+
+	switch {
+	case !iter.StartTime.IsZero() && !iter.EndTime.IsZero():
+		ir.DurationMS = iter.EndTime.Sub(iter.StartTime).Milliseconds()
+	default:
+		ir.DurationMS = resultMS
+	}
+	return ir
+}
+
+// editStat counts the lines an edit tool call added and deleted.
+func editStat(toolName string, in toolInput) (added, deleted int) {
+	switch toolName {
+	case "Edit":
+		_, added, deleted = unifiedDiff(in.str("old_string"), in.str("new_string"))
+	case "Write":
+		_, added, deleted = unifiedDiff("", in.str("content"))
+	case "MultiEdit":
+		var edits []struct {
+			OldString string `json:"old_string"`
+			NewString string `json:"new_string"`
+		}
+		if err := json.Unmarshal(in["edits"], &edits); err != nil {
+			return 0, 0
+		}
+		for _, e := range edits {
+			_, a, d := unifiedDiff(e.OldString, e.NewString)
+			added += a
+			deleted += d
+		}
+	}
+	return added, deleted
+}
+
+// reportIterationView adapts an iteration report to the dashboard's
+// iteration template.
+func reportIterationView(ir IterationReport) iterationView {
+	return newIterationView(ir.Number, ir.Status, ir.EndTime, ir.Events, ir.Summary)
+}
+
+// formatDurationMS formats a duration in milliseconds to the second.
+func formatDurationMS(ms int64) string {
+	return (time.Duration(ms) * time.Millisecond).Round(time.Second).String()
+}
+
+// formatCost formats a cost in US dollars.
+func formatCost(usd float64) string {
+	return fmt.Sprintf("$%.2f", usd)
+}
+
+// WriteJSON writes the report, including full transcripts, as indented JSON.
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// reportPageData is the template context for an HTML report.
+type reportPageData struct {
+	*Report
+	CSS template.CSS
+}
+
+// WriteHTML writes the report as a single HTML page rendered with the
+// dashboard templates. The stylesheet is inlined so the page works offline.
+func (r *Report) WriteHTML(w io.Writer) error {
+	tmpl, err := parseTemplates()
+	if err != nil {
+		return err
+	}
+	css, err := staticFS.ReadFile("static/style.css")
+	if err != nil {
+		return fmt.Errorf("reading stylesheet: %w", err)
+	}
+	return tmpl.ExecuteTemplate(w, "report.html", reportPageData{Report: r, CSS: template.CSS(css)})
+}
+
+// WriteMarkdown writes the report as Markdown. Transcripts are collapsed in
+// <details> blocks, which most Markdown renderers support.
+func (r *Report) WriteMarkdown(w io.Writer) error {
+	var sb strings.Builder
+	title := r.RunID
+	if r.Project != "" {
+		title = r.Project + " — " + r.RunID
+	}
+	fmt.Fprintf(&sb, "# Run report: %s\n\n", title)
+	fmt.Fprintf(&sb, "- Branch: `%s`\n", r.Branch)
+	fmt.Fprintf(&sb, "- Status: %s", r.Status)
+	if r.StopReason != "" {
+		fmt.Fprintf(&sb, " (%s)", r.StopReason)
+	}
+	sb.WriteString("\n")
+	fmt.Fprintf(&sb, "- Started: %s\n", r.StartTime.Format(time.RFC1123))
+	if !r.EndTime.IsZero() {
+		fmt.Fprintf(&sb, "- Ended: %s\n", r.EndTime.Format(time.RFC1123))
+	}
+	fmt.Fprintf(&sb, "- Duration: %s\n", formatDurationMS(r.DurationMS))
+	fmt.Fprintf(&sb, "- Stories passed: %d/%d, skipped: %d\n", r.Passed, r.Total, r.Skipped)
+	fmt.Fprintf(&sb, "- Iterations: %d\n", r.Iterations)
+	fmt.Fprintf(&sb, "- Cost: %s\n", formatCost(r.CostUSD))
+	fmt.Fprintf(&sb, "- Lines: +%d −%d\n\n", r.Added, r.Deleted)
+
+	sb.WriteString("## Stories\n\n")
+	sb.WriteString("| Story | Title | Status | Iterations | Duration | Cost | Lines |\n")
+	sb.WriteString("|---|---|---|---|---|---|---|\n")
+	for _, s := range r.Stories {
+		fmt.Fprintf(&sb, "| %s | %s | %s | %d | %s | %s | +%d −%d |\n",
+			mdCell(s.ID), mdCell(s.Title), s.Status, len(s.Iterations),
+			formatDurationMS(s.DurationMS), formatCost(s.CostUSD), s.Added, s.Deleted)
+	}
+
+	for _, s := range r.Stories {
+		if len(s.Iterations) == 0 {
+			continue
+		}
+		fmt.Fprintf(&sb, "\n## %s", s.ID)
+		if s.Title != "" {
+			fmt.Fprintf(&sb, ": %s", s.Title)
+		}
+		sb.WriteString("\n")
+		for _, it := range s.Iterations {
+			fmt.Fprintf(&sb, "\n### Iteration %d — %s\n\n", it.Number, it.Status)
+			fmt.Fprintf(&sb, "- Duration: %s, cost: %s", formatDurationMS(it.DurationMS), formatCost(it.CostUSD))
+			if it.Turns > 0 {
+				fmt.Fprintf(&sb, ", turns: %d", it.Turns)
+			}
+			sb.WriteString("\n")
+			fmt.Fprintf(&sb, "- Lines: +%d −%d", it.Added, it.Deleted)
+			if len(it.Files) > 0 {
+				fmt.Fprintf(&sb, " in `%s`", strings.Join(it.Files, "`, `"))
+			}
+			sb.WriteString("\n")
+			if len(it.ToolCalls) > 0 {
+				fmt.Fprintf(&sb, "- Tool calls: %s\n", FormatToolCalls(it.ToolCalls))
+			}
+			for _, c := range it.Checks {
+				mark := "FAIL"
+				if c.Passed {
+					mark = "PASS"
+				}
+				fmt.Fprintf(&sb, "- Check %s: `%s`\n", mark, strings.ReplaceAll(truncateString(c.Command, 200), "`", "'"))
+			}
+			if it.Summary != nil {
+				fmt.Fprintf(&sb, "- Compacted from %d events\n", it.Summary.Events)
+			}
+			sb.WriteString("\n<details><summary>Transcript</summary>\n\n")
+			sb.WriteString(fenced(transcriptText(it.Events)))
+			sb.WriteString("\n</details>\n")
+		}
+	}
+
+	if len(r.Progress) > 0 {
+		sb.WriteString("\n## Progress log\n\n")
+		for _, e := range r.Progress {
+			mark := "FAIL"
+			if e.Passed {
+				mark = "PASS"
+			}
+			fmt.Fprintf(&sb, "- %s %s [%s]\n", e.Time.Format("2006-01-02 15:04:05"), e.StoryID, mark)
+			for _, line := range strings.Split(strings.TrimRight(e.Body, "\n"), "\n") {
+				if line != "" {
+					fmt.Fprintf(&sb, "  %s\n", line)
+				}
+			}
+		}
+	}
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// mdCell escapes text for a Markdown table cell.
+func mdCell(s string) string {
+	return strings.NewReplacer("|", `\|`, "\n", " ").Replace(s)
+}
+
+// FormatToolCalls formats tool call counts as "Edit×3, Read×2", most used
+// first.
+func FormatToolCalls(calls map[string]int) string {
+	names := make([]string, 0, len(calls))
+	for name := range calls {
+		names = append(names, name)
+	}
+	slices.SortFunc(names, func(a, b string) int {
+		if calls[a] != calls[b] {
+			return calls[b] - calls[a]
+		}
+		return strings.Compare(a, b)
+	})
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = fmt.Sprintf("%s×%d", name, calls[name])
+	}
+	return strings.Join(parts, ", ")
+}
+
+// transcriptText renders events as plain text, one block per event.
+func transcriptText(events []claude.StreamEvent) string {
+	var sb strings.Builder
+	uses := make(map[string]string)
+	for _, evt := range events {
+		switch evt.Type {
+		case claude.EventAssistant:
+			if evt.Message != "" {
+				fmt.Fprintf(&sb, "%s\n\n", evt.Message)
+			}
+		case claude.EventToolUse:
+			uses[evt.ToolID] = evt.ToolName
+			in := parseToolInput(evt.Input)
+			target := in.str("file_path")
+			switch evt.ToolName {
+			case "Bash":
+				target = "$ " + in.str("command")
+			case "Glob", "Grep":
+				target = withPath(in.str("pattern"), in.str("path"))
+			}
+			fmt.Fprintf(&sb, "> %s %s\n", evt.ToolName, truncateString(target, 500))
+		case claude.EventToolResult:
+			if evt.IsError || uses[evt.ToolID] == "Bash" {
+				label := "output"
+				if evt.IsError {
+					label = "error"
+				}
+				fmt.Fprintf(&sb, "< %s: %s\n", label, truncateString(strings.TrimSpace(evt.OutputText()), 1000))
+			}
+		case claude.EventError:
+			fmt.Fprintf(&sb, "! %s\n", evt.Message)
+			if evt.Stderr != "" {
+				fmt.Fprintf(&sb, "< stderr: %s\n", truncateString(evt.Stderr, 1000))
+			}
+		case claude.EventResult:
+			sb.WriteString("= agent finished\n")
+		}
+	}
+	return sb.String()
+}
+
+// fenced wraps text in a code fence longer than any backtick run inside it.
+func fenced(text string) string {
+	longest, run := 0, 0
+	for _, c := range text {
+		if c == '`' {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+	fence := strings.Repeat("`", max(3, longest+1))
+	return fence + "text\n" + strings.TrimRight(text, "\n") + "\n" + fence + "\n"
+}
@@ -0,0 +1,152 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/radvoogh/ralph-wiggo/internal/claude"
+	"github.com/radvoogh/ralph-wiggo/internal/prd"
+	"github.com/radvoogh/ralph-wiggo/internal/progress"
+	"github.com/radvoogh/ralph-wiggo/internal/state"
+)
+
+// reportFixture returns a finished run in which US-001 passed on its second
+// iteration and US-002 never ran.
+func reportFixture() (*state.Run, *prd.PRD, []progress.Entry) {
+	start := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	failed := state.Iteration{
+		Number: 1, Status: state.StatusFailed,
+		StartTime: start, EndTime: start.Add(2 * time.Minute),
+		Events: []claude.StreamEvent{
+			{Type: claude.EventToolUse, ToolName: "Write", ToolID: "t1", Input: json.RawMessage(`{"file_path":"a.go","content":"package a\nfunc A() {}\n"}`)},
+			{Type: claude.EventToolResult, ToolID: "t1"},
+			{Type: claude.EventToolUse, ToolName: "Bash", ToolID: "t2", Input: json.RawMessage(`{"command":"go test ./..."}`)},
+			{Type: claude.EventToolResult, ToolID: "t2", IsError: true, Output: json.RawMessage(`"FAIL"`)},
+			{Type: claude.EventResult, CostUSD: 0.25, NumTurns: 4},
+		},
+	}
+	passed := state.Iteration{
+		Number: 2, Status: state.StatusPassed,
+		StartTime: start.Add(3 * time.Minute), EndTime: start.Add(4 * time.Minute),
+		Events: []claude.StreamEvent{
+			{Type: claude.EventToolUse, ToolName: "Edit", ToolID: "t3", Input: json.RawMessage(`{"file_path":"a.go","old_string":"func A() {}","new_string":"func A() int { return 1 }"}`)},
+			{Type: claude.EventToolResult, ToolID: "t3"},
+			{Type: claude.EventToolUse, ToolName: "Bash", ToolID: "t4", Input: json.RawMessage(`{"command":"go test ./..."}`)},
+			{Type: claude.EventToolResult, ToolID: "t4", IsError: true},
+			{Type: claude.EventToolUse, ToolName: "Bash", ToolID: "t5", Input: json.RawMessage(`{"command":"go test ./..."}`)},
+			{Type: claude.EventToolResult, ToolID: "t5", Output: json.RawMessage(`"ok"`)},
+			{Type: claude.EventToolUse, ToolName: "Bash", ToolID: "t6", Input: json.RawMessage(`{"command":"git status"}`)},
+			{Type: claude.EventToolResult, ToolID: "t6"},
+			{Type: claude.EventAssistant, Message: "All tests pass."},
+			{Type: claude.EventResult, CostUSD: 0.5, NumTurns: 6},
+		},
+	}
+	run := &state.Run{
+		ID: "run-1", BranchName: "ralph/test", StartTime: start, EndTime: start.Add(5 * time.Minute),
+		Status: state.StatusCompleted, Passed: 1, Total: 2,
+		Stories: []*state.AgentSession{{StoryID: "US-001", Status: state.StatusPassed, Iterations: []state.Iteration{failed, passed}}},
+	}
+	p := &prd.PRD{Project: "demo", UserStories: []prd.UserStory{
+		{ID: "US-001", Title: "First", Passes: true},
+		{ID: "US-002", Title: "Second"},
+	}}
+	entries := []progress.Entry{
+		{Time: start.Add(-time.Hour), StoryID: "US-000", Passed: true},
+		{Time: start.Add(2 * time.Minute), StoryID: "US-001", Body: "- Error: tests failed\n"},
+		{Time: start.Add(4 * time.Minute), StoryID: "US-001", Passed: true},
+	}
+	return run, p, entries
+}
+
+func TestBuildReport(t *testing.T) {
+	r := BuildReport(reportFixture())
+
+	if r.Project != "demo" || r.Passed != 1 || r.Total != 2 || r.Iterations != 2 {
+		t.Errorf("report = %+v", r)
+	}
+	if r.CostUSD != 0.75 {
+		t.Errorf("CostUSD = %v, want 0.75", r.CostUSD)
+	}
+	if len(r.Progress) != 2 {
+		t.Errorf("got %d progress entries, want the 2 written during the run", len(r.Progress))
+	}
+	if len(r.Stories) != 2 || r.Stories[1].Status != "not run" || r.Stories[1].Title != "Second" {
+		t.Fatalf("stories = %+v", r.Stories)
+	}
+
+	first, second := r.Stories[0].Iterations[0], r.Stories[0].Iterations[1]
+	if first.Added != 2 || first.Deleted != 0 || first.DurationMS != 120000 || first.Turns != 4 {
+		t.Errorf("iteration 1 = %+v", first)
+	}
+	if len(first.Checks) != 1 || first.Checks[0].Passed {
+		t.Errorf("iteration 1 checks = %+v, want one failed go test", first.Checks)
+	}
+	if second.Added != 1 || second.Deleted != 1 || len(second.Files) != 1 || second.Files[0] != "a.go" {
+		t.Errorf("iteration 2 diffstat = +%d -%d %v", second.Added, second.Deleted, second.Files)
+	}
+	// The retried test run counts once, with its last outcome; git status is
+	// not a check.
+	if len(second.Checks) != 1 || !second.Checks[0].Passed || second.Checks[0].Command != "go test ./..." {
+		t.Errorf("iteration 2 checks = %+v", second.Checks)
+	}
+	if second.ToolCalls["Bash"] != 3 || second.ToolCalls["Edit"] != 1 {
+		t.Errorf("iteration 2 tool calls = %v", second.ToolCalls)
+	}
+}
+
+func TestBuildReportCompactedIteration(t *testing.T) {
+	run, p, _ := reportFixture()
+	run.Stories[0].Iterations[1], _ = state.CompactIteration(run.Stories[0].Iterations[1])
+
+	it := BuildReport(run, p, nil).Stories[0].Iterations[1]
+	if it.ToolCalls["Bash"] != 3 || it.Summary == nil {
+		t.Errorf("compacted iteration tool calls = %v, summary = %v", it.ToolCalls, it.Summary)
+	}
+	if it.CostUSD != 0.5 || it.Added != 1 {
+		t.Errorf("compacted iteration cost = %v, added = %d", it.CostUSD, it.Added)
+	}
+}
+
+func TestReportWriters(t *testing.T) {
+	r := BuildReport(reportFixture())
+
+	var buf bytes.Buffer
+	if err := r.WriteHTML(&buf); err != nil {
+		t.Fatalf("WriteHTML: %v", err)
+	}
+	page := buf.String()
+	for _, want := range []string{"<style>", ".badge-passed", "US-001", "$0.75", "All tests pass.", `<details class="transcript">`} {
+		if !strings.Contains(page, want) {
+			t.Errorf("HTML report missing %q", want)
+		}
+	}
+	if strings.Contains(page, "/static/") {
+		t.Error("HTML report links to server assets")
+	}
+
+	buf.Reset()
+	if err := r.WriteMarkdown(&buf); err != nil {
+		t.Fatalf("WriteMarkdown: %v", err)
+	}
+	md := buf.String()
+	for _, want := range []string{"# Run report: demo — run-1", "| US-002 | Second | not run |", "- Check PASS: `go test ./...`", "<details><summary>Transcript</summary>", "> Bash $ go test ./..."} {
+		if !strings.Contains(md, want) {
+			t.Errorf("Markdown report missing %q", want)
+		}
+	}
+
+	buf.Reset()
+	if err := r.WriteJSON(&buf); err != nil {
+		t.Fatalf("WriteJSON: %v", err)
+	}
+	var decoded Report
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("decoding JSON report: %v", err)
+	}
+	if decoded.RunID != "run-1" || len(decoded.Stories[0].Iterations[1].Events) != 10 {
+		t.Errorf("decoded report = %+v", decoded)
+	}
+}
@@ -0,0 +1,114 @@
+package web
+
+import (
+	"fmt"
+	"html"
+	"html/template"
+	"net/http"
+	"strings"
+
+	"github.com/radvoogh/ralph-wiggo/internal/search"
+)
+
+// maxSearchHits caps the number of results shown on the search page.
+const maxSearchHits = 100
+
+// searchData is the template context for the search page.
+type searchData struct {
+	Query   string
+	RunID   string
+	StoryID string
+	Tool    string
+	Hits    []searchHit
+	More    bool // results were truncated at maxSearchHits
+}
+
+// searchHit is a single search result prepared for display.
+type searchHit struct {
+	search.Hit
+	Kind    string
+	Snippet template.HTML
+}
+
+// handleSearch renders the full-text search page over recorded sessions.
+func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	if s.store == nil {
+		http.Error(w, "No state store available", http.StatusServiceUnavailable)
+		return
+	}
+
+	q := r.URL.Query()
+	data := searchData{
+		Query:   strings.TrimSpace(q.Get("q")),
+		RunID:   q.Get("run"),
+		StoryID: q.Get("story"),
+		Tool:    q.Get("tool"),
+	}
+	if data.Query != "" {
+		hits := s.store.Search(search.Query{
+			Text:    data.Query,
+			RunID:   data.RunID,
+			StoryID: data.StoryID,
+			Tool:    data.Tool,
+			Limit:   maxSearchHits + 1,
+		})
+		if len(hits) > maxSearchHits {
+			hits, data.More = hits[:maxSearchHits], true
+		}
+		terms := search.Terms(data.Query)
+		for _, h := range hits {
+			kind := string(h.Type)
+			if h.ToolName != "" {
+				kind += " · " + h.ToolName
+			}
+			data.Hits = append(data.Hits, searchHit{
+				Hit:     h,
+				Kind:    kind,
+				Snippet: highlightHTML(h.Snippet, terms),
+			})
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := s.tmpl.ExecuteTemplate(w, "search.html", data); err != nil {
+		http.Error(w, fmt.Sprintf("rendering search: %v", err), http.StatusInternalServerError)
+	}
+}
+
+// highlightHTML escapes text and wraps case-insensitive occurrences of the
+// given lowercased terms in <mark>.
+func highlightHTML(text string, terms []string) template.HTML {
+	lower := strings.ToLower(text)
+	if len(lower) != len(text) {
+		return template.HTML(html.EscapeString(text))
+	}
+
+	marked := make([]bool, len(text))
+	for _, term := range terms {
+		for i := 0; ; {
+			j := strings.Index(lower[i:], term)
+			if j < 0 {
+				break
+			}
+			for k := i + j; k < i+j+len(term); k++ {
+				marked[k] = true
+			}
+			i += j + len(term)
+		}
+	}
+
+	var sb strings.Builder
+	for i := 0; i < len(text); {
+		j := i
+		for j < len(text) && marked[j] == marked[i] {
+			j++
+		}
+		if marked[i] {
+			fmt.Fprintf(&sb, "<mark>%s</mark>", html.EscapeString(text[i:j]))
+		} else {
+			sb.WriteString(html.EscapeString(text[i:j]))
+		}
+		i = j
+	}
+	return template.HTML(sb.String())
+}
@@ -0,0 +1,11 @@
+package web
+
+import "testing"
+
+func TestHighlightHTML(t *testing.T) {
+	got := string(highlightHTML("Connection <refused> by CONNECTION", []string{"connection", "refused"}))
+	want := "<mark>Connection</mark> &lt;<mark>refused</mark>&gt; by <mark>CONNECTION</mark>"
+	if got != want {
+		t.Errorf("highlightHTML = %q, want %q", got, want)
+	}
+}
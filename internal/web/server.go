@@ -2,8 +2,10 @@
 package web
 
 import (
+	"bytes"
 	"context"
 	"embed"
+	"encoding/json"
 	"fmt"
 	"html"
 	"html/template"
@@ -11,7 +13,10 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/radvoogh/ralph-wiggo/internal/claude"
@@ -25,6 +30,16 @@ var staticFS embed.FS
 //go:embed templates/*.html
 var templateFS embed.FS
 
+const (
+	// sseKeepalive is how often an idle SSE stream sends a comment line.
+	sseKeepalive = 15 * time.Second
+	// sseRetry is the reconnect delay suggested to browsers.
+	sseRetry = 3 * time.Second
+	// prdPollInterval is how often the run events stream checks prd.json for
+	// changes made outside this process (e.g. by the agent).
+	prdPollInterval = time.Second
+)
+
 // storyRow is an enriched story for the dashboard table.
 type storyRow struct {
 	ID          string
@@ -34,6 +49,8 @@ type storyRow struct {
 	StatusClass string // CSS class matching Status
 	IterCount   int    // number of iterations attempted
 	Elapsed     string // human-readable time indicator
+	Since       string // RFC 3339 reference time for client-side elapsed updates
+	Tags        []string
 }
 
 // dashboardData is the template context for the main dashboard.
@@ -44,6 +61,12 @@ type dashboardData struct {
 	Total      int
 	Percent    int
 	Stories    []storyRow
+	Version    string // PRD version token for edits made from the page
+
+	// Tags of all stories, for filtering, and the tag the list is filtered
+	// by, if any. A filtered list cannot be reordered.
+	Tags []string
+	Tag  string
 }
 
 // storyDetailData is the template context for a story detail page.
@@ -53,11 +76,30 @@ type storyDetailData struct {
 	Story       prd.UserStory
 	StatusClass string
 	HasStore    bool
+	Version     string // PRD version token for edits made from the page
+	Error       string // message from a failed edit, if any
+	Settings    []settingRow
+
+	// Iterations offered for streaming or replay, newest first, and the
+	// stream URL query of the selected one (empty to follow the latest).
+	Iterations  []iterationOption
+	StreamQuery string
+}
+
+// settingRow is an agent setting a story runs with, as shown on its page.
+type settingRow struct {
+	Name       string
+	Value      string
+	Overridden bool // set by the story rather than the run-wide default
 }
 
 // historyData is the template context for the run history page.
 type historyData struct {
-	Runs []runSummary
+	Runs     []runSummary
+	Status   string   // status filter, empty for all
+	Sort     string   // sort key
+	Statuses []string // run statuses offered by the filter
+	SortKeys []string // sort keys offered by the form
 }
 
 // runSummary is a summary of a single run for the history list.
@@ -65,10 +107,14 @@ type runSummary struct {
 	ID         string
 	BranchName string
 	StartTime  string
+	EndTime    string // empty while the run is unfinished
+	Duration   string
 	StoryCount int
 	Passed     int
 	Failed     int
+	Skipped    int
 	Status     string
+	StopReason string
 }
 
 // runDetailData is the template context for a single run's detail page.
@@ -104,6 +150,7 @@ type iterationView struct {
 	StatusCls string
 	EndTime   string
 	Events    []claude.StreamEvent
+	Summary   *state.IterationSummary // set if gc compacted the iteration
 }
 
 // runProgressData is the template context for viewing progress.txt.
@@ -117,21 +164,52 @@ type Server struct {
 	prdPath string
 	tmpl    *template.Template
 	srv     *http.Server
-	store   *state.MemoryStore
+	store   state.Store
+
+	// defaults are the run-wide agent settings stories are shown with.
+	defaults prd.Settings
+
+	prdMu      sync.Mutex
+	prdCache   *prd.PRD
+	prdVersion string
+	prdStamp   fileStamp
 }
 
-// NewServer creates a new web server that reads PRD data from the given path.
-// The store parameter may be nil if no state store is available.
-func NewServer(prdPath string, port int, store *state.MemoryStore) (*Server, error) {
+// fileStamp identifies a version of a file on disk by modification time and size.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// parseTemplates parses the embedded page templates. Run reports use the same
+// templates outside a server.
+func parseTemplates() (*template.Template, error) {
 	funcMap := template.FuncMap{
 		"renderEvent": func(evt claude.StreamEvent) template.HTML {
 			return template.HTML(renderEventHTML(evt))
 		},
+		"renderEvents": func(events []claude.StreamEvent, anchorPrefix string) template.HTML {
+			return template.HTML(renderEventsHTML(events, anchorPrefix))
+		},
+		"iterationView": reportIterationView,
+		"duration":      formatDurationMS,
+		"cost":          formatCost,
+		"tools":         FormatToolCalls,
 	}
 	tmpl, err := template.New("").Funcs(funcMap).ParseFS(templateFS, "templates/*.html")
 	if err != nil {
 		return nil, fmt.Errorf("parsing templates: %w", err)
 	}
+	return tmpl, nil
+}
+
+// NewServer creates a new web server that reads PRD data from the given path.
+// The store parameter may be nil if no state store is available.
+func NewServer(prdPath string, port int, store state.Store) (*Server, error) {
+	tmpl, err := parseTemplates()
+	if err != nil {
+		return nil, err
+	}
 
 	s := &Server{
 		prdPath: prdPath,
@@ -151,18 +229,29 @@ func NewServer(prdPath string, port int, store *state.MemoryStore) (*Server, err
 	// Dashboard route.
 	mux.HandleFunc("/", s.handleDashboard)
 
-	// API endpoint for htmx polling of story list.
+	// API endpoint for rendering the story list partial.
 	mux.HandleFunc("/api/stories", s.handleStories)
 
+	// SSE endpoint for live dashboard updates.
+	mux.HandleFunc("/api/run/events", s.handleRunEvents)
+
 	// Story detail page.
-	mux.HandleFunc("/story/", s.handleStoryDetail)
+	mux.HandleFunc("/story/", s.handleStoryRoutes)
+
+	// Story editing endpoints.
+	mux.HandleFunc("/api/stories/reorder", s.handleReorder)
 
-	// SSE streaming endpoint for story events.
+	// SSE streaming endpoint for story events, and the streams in progress.
 	mux.HandleFunc("/api/story/", s.handleStoryAPI)
+	mux.HandleFunc("/api/streams", s.handleStreams)
 
 	// History routes.
 	mux.HandleFunc("/history", s.handleHistory)
 	mux.HandleFunc("/history/", s.handleHistoryRoutes)
+	mux.HandleFunc("/history/compare", s.handleCompare)
+
+	// Full-text search over recorded sessions.
+	mux.HandleFunc("/search", s.handleSearch)
 
 	s.srv = &http.Server{
 		Addr:    fmt.Sprintf(":%d", port),
@@ -195,9 +284,10 @@ func (s *Server) Shutdown(ctx context.Context) error {
 }
 
 // loadDashboardData reads the PRD and computes template data, enriching
-// story rows with state store information when available.
-func (s *Server) loadDashboardData() (*dashboardData, error) {
-	p, err := prd.LoadPRD(s.prdPath)
+// story rows with state store information when available. A non-empty tag
+// limits the list, and its progress, to the stories with that tag.
+func (s *Server) loadDashboardData(tag string) (*dashboardData, error) {
+	p, version, err := s.loadPRD()
 	if err != nil {
 		return nil, err
 	}
@@ -205,10 +295,14 @@ func (s *Server) loadDashboardData() (*dashboardData, error) {
 	passed := 0
 	var rows []storyRow
 	for _, story := range p.UserStories {
+		if tag != "" && !story.HasTag(tag) {
+			continue
+		}
 		row := storyRow{
 			ID:       story.ID,
 			Title:    story.Title,
 			Priority: story.Priority,
+			Tags:     story.Tags,
 		}
 
 		if story.Passes {
@@ -222,7 +316,7 @@ func (s *Server) loadDashboardData() (*dashboardData, error) {
 
 		// Enrich with state store data if available.
 		if s.store != nil {
-			session := s.store.GetLatestSession(story.ID)
+			session, _ := s.store.GetLatestSession(story.ID)
 			if session != nil {
 				row.IterCount = len(session.Iterations)
 
@@ -237,13 +331,17 @@ func (s *Server) loadDashboardData() (*dashboardData, error) {
 					}
 				}
 
-				// Compute elapsed time from iterations.
-				if len(session.Iterations) > 0 {
+				// Compute elapsed time from the active or last iteration.
+				if session.Status == state.StatusRunning {
+					row.Elapsed = "running…"
+					if !session.ActiveSince.IsZero() {
+						row.Since = session.ActiveSince.Format(time.RFC3339)
+					}
+				} else if len(session.Iterations) > 0 {
 					last := session.Iterations[len(session.Iterations)-1]
 					if !last.EndTime.IsZero() {
 						row.Elapsed = formatElapsed(time.Since(last.EndTime))
-					} else if session.Status == state.StatusRunning {
-						row.Elapsed = "running…"
+						row.Since = last.EndTime.Format(time.RFC3339)
 					}
 				}
 			}
@@ -256,7 +354,7 @@ func (s *Server) loadDashboardData() (*dashboardData, error) {
 		rows = append(rows, row)
 	}
 
-	total := len(p.UserStories)
+	total := len(rows)
 	pct := 0
 	if total > 0 {
 		pct = (passed * 100) / total
@@ -269,9 +367,49 @@ func (s *Server) loadDashboardData() (*dashboardData, error) {
 		Total:      total,
 		Percent:    pct,
 		Stories:    rows,
+		Version:    version,
+		Tags:       prd.Tags(p),
+		Tag:        tag,
 	}, nil
 }
 
+// loadPRD returns the parsed PRD and its version token, re-reading the file
+// only when its modification time or size has changed since the last read.
+// The returned PRD is shared and must not be modified.
+func (s *Server) loadPRD() (*prd.PRD, string, error) {
+	info, err := os.Stat(s.prdPath)
+	if err != nil {
+		return nil, "", fmt.Errorf("reading PRD file: %w", err)
+	}
+	stamp := fileStamp{modTime: info.ModTime(), size: info.Size()}
+
+	s.prdMu.Lock()
+	defer s.prdMu.Unlock()
+
+	if s.prdCache != nil && s.prdStamp == stamp {
+		return s.prdCache, s.prdVersion, nil
+	}
+
+	p, version, err := prd.LoadPRDVersion(s.prdPath)
+	if err != nil {
+		return nil, "", err
+	}
+	s.prdCache = p
+	s.prdVersion = version
+	s.prdStamp = stamp
+	return p, version, nil
+}
+
+// currentPRDStamp returns the on-disk stamp of the PRD file, or the zero
+// stamp if it cannot be read.
+func (s *Server) currentPRDStamp() fileStamp {
+	info, err := os.Stat(s.prdPath)
+	if err != nil {
+		return fileStamp{}
+	}
+	return fileStamp{modTime: info.ModTime(), size: info.Size()}
+}
+
 // formatElapsed returns a human-readable string for a duration.
 func formatElapsed(d time.Duration) string {
 	if d < time.Minute {
@@ -290,7 +428,7 @@ func (s *Server) handleDashboard(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	data, err := s.loadDashboardData()
+	data, err := s.loadDashboardData(r.URL.Query().Get("tag"))
 	if err != nil {
 		http.Error(w, fmt.Sprintf("loading PRD: %v", err), http.StatusInternalServerError)
 		return
@@ -304,7 +442,7 @@ func (s *Server) handleDashboard(w http.ResponseWriter, r *http.Request) {
 
 // handleStories renders just the story list partial for htmx polling.
 func (s *Server) handleStories(w http.ResponseWriter, r *http.Request) {
-	data, err := s.loadDashboardData()
+	data, err := s.loadDashboardData(r.URL.Query().Get("tag"))
 	if err != nil {
 		http.Error(w, fmt.Sprintf("loading PRD: %v", err), http.StatusInternalServerError)
 		return
@@ -316,15 +454,156 @@ func (s *Server) handleStories(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// handleStoryDetail renders the story detail page.
-func (s *Server) handleStoryDetail(w http.ResponseWriter, r *http.Request) {
-	storyID := strings.TrimPrefix(r.URL.Path, "/story/")
-	if storyID == "" {
+// handleRunEvents streams dashboard updates as server-sent events. A freshly
+// rendered story list, filtered by the tag query parameter, is sent on
+// connect, after each run event, and whenever prd.json changes on disk. Run
+// events are also forwarded as JSON "run" events.
+func (s *Server) handleRunEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	var events <-chan state.RunEvent
+	if s.store != nil {
+		ch, unsub := s.store.SubscribeRunEvents()
+		defer unsub()
+		events = ch
+	}
+
+	tag := r.URL.Query().Get("tag")
+	sendStories := func() {
+		data, err := s.loadDashboardData(tag)
+		if err != nil {
+			writeSSE(w, "stories", fmt.Sprintf(`<div class="event event-error">loading PRD: %s</div>`, html.EscapeString(err.Error())))
+			return
+		}
+		var buf bytes.Buffer
+		if err := s.tmpl.ExecuteTemplate(&buf, "stories", data); err != nil {
+			writeSSE(w, "stories", fmt.Sprintf(`<div class="event event-error">rendering stories: %s</div>`, html.EscapeString(err.Error())))
+			return
+		}
+		writeSSE(w, "stories", buf.String())
+	}
+
+	fmt.Fprintf(w, "retry: %d\n\n", sseRetry.Milliseconds())
+	stamp := s.currentPRDStamp()
+	sendStories()
+	flusher.Flush()
+
+	poll := time.NewTicker(prdPollInterval)
+	defer poll.Stop()
+	keepalive := time.NewTicker(sseKeepalive)
+	defer keepalive.Stop()
+
+	ctx := r.Context()
+	for {
+		select {
+		case evt := <-events:
+			// Forward this event and any others already queued, then render
+			// once for the whole burst.
+			for more := true; more; {
+				if data, err := json.Marshal(evt); err == nil {
+					writeSSE(w, "run", string(data))
+				}
+				select {
+				case evt = <-events:
+				default:
+					more = false
+				}
+			}
+			stamp = s.currentPRDStamp()
+			sendStories()
+			flusher.Flush()
+		case <-poll.C:
+			if cur := s.currentPRDStamp(); cur != stamp {
+				stamp = cur
+				sendStories()
+				flusher.Flush()
+			}
+		case <-keepalive.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+			flusher.Flush()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// handleStoryRoutes routes /story/<id>/... paths.
+func (s *Server) handleStoryRoutes(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/story/")
+	if path == "" {
 		http.NotFound(w, r)
 		return
 	}
+	if path == "new" {
+		s.handleStoryNew(w, r)
+		return
+	}
+
+	// Parse: <story-id>, <story-id>/edit, <story-id>/reset, <story-id>/delete
+	storyID, action, _ := strings.Cut(path, "/")
+	switch action {
+	case "":
+		s.handleStoryDetail(w, r, storyID, nil)
+	case "edit":
+		s.handleStoryEdit(w, r, storyID)
+	case "reset":
+		s.handleStoryReset(w, r, storyID)
+	case "delete":
+		s.handleStoryDelete(w, r, storyID)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// SetDefaults sets the run-wide agent settings that story pages show, with
+// each story's overrides applied. Call it before Start.
+func (s *Server) SetDefaults(defaults prd.Settings) {
+	s.defaults = defaults
+}
+
+// storySettings lists the settings a story runs with given the run-wide
+// defaults, marking those the story overrides.
+func storySettings(story *prd.UserStory, defaults prd.Settings) []settingRow {
+	eff := story.Effective(defaults)
+	o := story.Overrides
+	orNone := func(v string) string {
+		if v == "" {
+			return "none"
+		}
+		return v
+	}
+	budget, turns, timeout := "none", "none", "none"
+	if eff.MaxBudget > 0 {
+		budget = formatCost(eff.MaxBudget)
+	}
+	if eff.MaxTurns > 0 {
+		turns = strconv.Itoa(eff.MaxTurns)
+	}
+	if eff.Timeout > 0 {
+		timeout = eff.Timeout.String()
+	}
+	return []settingRow{
+		{"Model", orNone(eff.Model), o.Model != ""},
+		{"Max turns", turns, o.MaxTurns > 0},
+		{"Max budget", budget, o.MaxBudget > 0},
+		{"Max iterations", strconv.Itoa(eff.MaxIterations), o.MaxIterations > 0},
+		{"Allowed tools", orNone(strings.Join(eff.AllowedTools, ", ")), len(o.AllowedTools) > 0},
+		{"Timeout", timeout, eff.Timeout > 0 && o.Timeout != ""},
+	}
+}
 
-	p, err := prd.LoadPRD(s.prdPath)
+// handleStoryDetail renders the story detail page. A non-nil editErr is shown
+// as a banner, e.g. when a reset or delete was rejected.
+func (s *Server) handleStoryDetail(w http.ResponseWriter, r *http.Request, storyID string, editErr error) {
+	p, version, err := s.loadPRD()
 	if err != nil {
 		http.Error(w, fmt.Sprintf("loading PRD: %v", err), http.StatusInternalServerError)
 		return
@@ -346,7 +625,7 @@ func (s *Server) handleStoryDetail(w http.ResponseWriter, r *http.Request) {
 	if story.Passes {
 		statusClass = "passed"
 	} else if s.store != nil {
-		session := s.store.GetLatestSession(storyID)
+		session, _ := s.store.GetLatestSession(storyID)
 		if session != nil {
 			switch session.Status {
 			case state.StatusRunning:
@@ -363,9 +642,29 @@ func (s *Server) handleStoryDetail(w http.ResponseWriter, r *http.Request) {
 		Story:       *story,
 		StatusClass: statusClass,
 		HasStore:    s.store != nil,
+		Version:     version,
+		Settings:    storySettings(story, s.defaults),
+	}
+	if editErr != nil {
+		data.Error = editMessage(editErr)
+	}
+	if s.store != nil {
+		// An invalid selection falls back to following the latest iteration.
+		key, explicit, _ := streamKeyFromQuery(r.URL.Query(), storyID)
+		if explicit {
+			data.StreamQuery = streamQuery(key)
+		}
+		data.Iterations, err = s.storyIterations(storyID, key)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("listing iterations: %v", err), http.StatusInternalServerError)
+			return
+		}
 	}
 
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if editErr != nil {
+		w.WriteHeader(editErrorStatus(editErr))
+	}
 	if err := s.tmpl.ExecuteTemplate(w, "story.html", data); err != nil {
 		http.Error(w, fmt.Sprintf("rendering story detail: %v", err), http.StatusInternalServerError)
 	}
@@ -395,7 +694,7 @@ func (s *Server) handleSSEStream(w http.ResponseWriter, r *http.Request, storyID
 	w.Header().Set("Connection", "keep-alive")
 
 	// Verify the story exists.
-	p, err := prd.LoadPRD(s.prdPath)
+	p, _, err := s.loadPRD()
 	if err != nil {
 		writeSSE(w, "message", `<div class="event event-error">Failed to load PRD</div>`)
 		writeSSE(w, "done", "")
@@ -424,54 +723,175 @@ func (s *Server) handleSSEStream(w http.ResponseWriter, r *http.Request, storyID
 		return
 	}
 
-	// For completed stories: send all historical events then close.
-	if story.Passes {
-		session := s.store.GetLatestSession(storyID)
-		if session != nil {
-			for _, iter := range session.Iterations {
-				for _, evt := range iter.Events {
-					h := renderEventHTML(evt)
-					if h != "" {
-						writeSSE(w, "message", h)
-					}
-				}
-			}
+	// Browsers send the ID of the last event they saw when reconnecting.
+	lastID, _ := state.ParseEventID(r.Header.Get("Last-Event-ID"))
+
+	key, explicit, err := streamKeyFromQuery(r.URL.Query(), storyID)
+	if err != nil {
+		writeSSE(w, "message", fmt.Sprintf(`<div class="event event-error">%s</div>`, html.EscapeString(err.Error())))
+		writeSSE(w, "done", "")
+		flusher.Flush()
+		return
+	}
+	if !explicit {
+		key, explicit = s.activeStream(storyID)
+	}
+
+	if explicit {
+		// A stream this process is (or was just) broadcasting is served live;
+		// anything else is replayed from the store.
+		if _, ok := s.store.Stream(key); ok {
+			s.streamLive(w, r, key, lastID)
+			return
 		}
+		iters, _ := s.store.GetIterationsForStory(key.RunID, storyID)
+		i := slices.IndexFunc(iters, func(it state.Iteration) bool { return it.Number == key.Iteration })
+		if i < 0 {
+			writeSSE(w, "message", `<div class="event event-error">Iteration not found</div>`)
+			writeSSE(w, "done", "")
+			flusher.Flush()
+			return
+		}
+		replayIterations(w, iters[i:i+1], lastID)
+		flusher.Flush()
+		return
+	}
+
+	// Nothing is streaming: replay the story's latest session, if it has run.
+	if session, _ := s.store.GetLatestSession(storyID); session != nil && len(session.Iterations) > 0 {
+		replayIterations(w, session.Iterations, lastID)
+		flusher.Flush()
+		return
+	}
+
+	if story.Passes {
 		writeSSE(w, "message", `<div class="event event-result">Stream complete</div>`)
 		writeSSE(w, "done", "")
 		flusher.Flush()
 		return
 	}
 
-	// For running/pending stories: subscribe to live events.
-	snapshot, ch, unsub := s.store.Subscribe(storyID)
+	// The story has not run yet: wait for its first iteration and follow it.
+	key, ok = s.waitForIteration(w, r, storyID)
+	if ok {
+		s.streamLive(w, r, key, lastID)
+	}
+}
+
+// replayIterations sends the recorded events of iterations followed by a
+// "done" event. Replayed events use epoch 0, so a reconnect resumes at the
+// right offset.
+func replayIterations(w http.ResponseWriter, iters []state.Iteration, lastID state.EventID) {
+	render := newEventRenderer()
+	var seq uint64
+	for _, iter := range iters {
+		for _, evt := range iter.Events {
+			seq++
+			if lastID.Epoch == 0 && seq <= lastID.Seq {
+				render.render(evt) // remember tool calls for later results
+				continue
+			}
+			h := render.render(evt)
+			if h != "" {
+				writeSSEWithID(w, state.EventID{Seq: seq}.String(), "message", h)
+			}
+		}
+	}
+	writeSSE(w, "message", `<div class="event event-result">Stream complete</div>`)
+	writeSSE(w, "done", "")
+}
+
+// waitForIteration keeps the connection open until an iteration of the story
+// starts, and returns its stream key. It returns false if the client goes
+// away first.
+func (s *Server) waitForIteration(w http.ResponseWriter, r *http.Request, storyID string) (state.StreamKey, bool) {
+	flusher := w.(http.Flusher)
+	events, unsub := s.store.SubscribeRunEvents()
 	defer unsub()
 
-	// Send events that were published before the subscription.
-	for _, evt := range snapshot {
-		h := renderEventHTML(evt)
+	// The iteration may have started before we subscribed.
+	if key, ok := s.activeStream(storyID); ok {
+		return key, true
+	}
+
+	fmt.Fprintf(w, "retry: %d\n\n", sseRetry.Milliseconds())
+	flusher.Flush()
+
+	keepalive := time.NewTicker(sseKeepalive)
+	defer keepalive.Stop()
+
+	ctx := r.Context()
+	for {
+		select {
+		case evt := <-events:
+			if evt.Type == state.RunEventIterationStart && evt.StoryID == storyID {
+				return state.StreamKey{RunID: evt.RunID, StoryID: storyID, Iteration: evt.Iteration}, true
+			}
+		case <-keepalive.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+			flusher.Flush()
+		case <-ctx.Done():
+			return state.StreamKey{}, false
+		}
+	}
+}
+
+// streamLive subscribes to a stream and sends its events, skipping any the
+// client already received before reconnecting, until the iteration completes
+// or the client disconnects.
+func (s *Server) streamLive(w http.ResponseWriter, r *http.Request, key state.StreamKey, lastID state.EventID) {
+	flusher := w.(http.Flusher)
+	render := newEventRenderer()
+
+	// Subscribe from the start so the events the client already has can prime
+	// the renderer, as replayIterations does.
+	snapshot, sub := s.store.Subscribe(key, state.EventID{})
+	defer sub.Close()
+
+	fmt.Fprintf(w, "retry: %d\n\n", sseRetry.Milliseconds())
+	for _, be := range snapshot {
+		if be.ID.Epoch == lastID.Epoch && be.ID.Seq <= lastID.Seq {
+			render.render(be.Event) // remember tool calls for later results
+			continue
+		}
+		h := render.render(be.Event)
 		if h != "" {
-			writeSSE(w, "message", h)
+			writeSSEWithID(w, be.ID.String(), "message", h)
 		}
 	}
 	flusher.Flush()
 
+	keepalive := time.NewTicker(sseKeepalive)
+	defer keepalive.Stop()
+
 	// Stream live events until the channel closes or the client disconnects.
 	ctx := r.Context()
 	for {
 		select {
-		case evt, open := <-ch:
+		case be, open := <-sub.C:
 			if !open {
+				if sub.Lagged() {
+					// The client fell behind and missed events. Signal the gap
+					// and end the response; the browser reconnects with
+					// Last-Event-ID and the missing events are replayed.
+					writeSSE(w, "gap", "")
+					flusher.Flush()
+					return
+				}
 				writeSSE(w, "message", `<div class="event event-result">Stream complete</div>`)
 				writeSSE(w, "done", "")
 				flusher.Flush()
 				return
 			}
-			h := renderEventHTML(evt)
+			h := render.render(be.Event)
 			if h != "" {
-				writeSSE(w, "message", h)
+				writeSSEWithID(w, be.ID.String(), "message", h)
 				flusher.Flush()
 			}
+		case <-keepalive.C:
+			// SSE comment lines keep idle connections open through proxies.
+			fmt.Fprint(w, ": keepalive\n\n")
+			flusher.Flush()
 		case <-ctx.Done():
 			return
 		}
@@ -480,6 +900,15 @@ func (s *Server) handleSSEStream(w http.ResponseWriter, r *http.Request, storyID
 
 // writeSSE writes a single server-sent event to the response writer.
 func writeSSE(w http.ResponseWriter, event, data string) {
+	writeSSEWithID(w, "", event, data)
+}
+
+// writeSSEWithID writes a server-sent event carrying an event ID, which the
+// browser echoes back as Last-Event-ID when it reconnects.
+func writeSSEWithID(w http.ResponseWriter, id, event, data string) {
+	if id != "" {
+		fmt.Fprintf(w, "id: %s\n", id)
+	}
 	fmt.Fprintf(w, "event: %s\n", event)
 	for _, line := range strings.Split(data, "\n") {
 		fmt.Fprintf(w, "data: %s\n", line)
@@ -487,40 +916,11 @@ func writeSSE(w http.ResponseWriter, event, data string) {
 	fmt.Fprint(w, "\n")
 }
 
-// renderEventHTML converts a streaming event into an HTML fragment for the SSE stream.
+// renderEventHTML converts a single streaming event into an HTML fragment.
+// Use an eventRenderer instead when rendering a stream, so tool results can be
+// rendered with the view for their tool.
 func renderEventHTML(evt claude.StreamEvent) string {
-	switch evt.Type {
-	case claude.EventAssistant:
-		if evt.Message == "" {
-			return ""
-		}
-		return fmt.Sprintf(`<div class="event event-text">%s</div>`, html.EscapeString(evt.Message))
-	case claude.EventToolUse:
-		input := ""
-		if evt.Input != nil {
-			input = truncateString(string(evt.Input), 2000)
-		}
-		return fmt.Sprintf(`<div class="event event-tool"><details><summary>tool: %s</summary><pre class="tool-io">%s</pre></details></div>`,
-			html.EscapeString(evt.ToolName), html.EscapeString(input))
-	case claude.EventToolResult:
-		output := ""
-		if evt.Output != nil {
-			output = truncateString(string(evt.Output), 2000)
-		}
-		return fmt.Sprintf(`<div class="event event-tool-result"><details><summary>result</summary><pre class="tool-io">%s</pre></details></div>`,
-			html.EscapeString(output))
-	case claude.EventError:
-		return fmt.Sprintf(`<div class="event event-error">%s</div>`, html.EscapeString(evt.Message))
-	case claude.EventInit:
-		if evt.SessionID == "" {
-			return ""
-		}
-		return fmt.Sprintf(`<div class="event event-init">session: %s</div>`, html.EscapeString(evt.SessionID))
-	case claude.EventResult:
-		return `<div class="event event-result">Agent finished</div>`
-	default:
-		return ""
-	}
+	return newEventRenderer().render(evt)
 }
 
 // handleHistory renders the run history list page.
@@ -530,11 +930,19 @@ func (s *Server) handleHistory(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	status := r.URL.Query().Get("status")
+	sortKey := r.URL.Query().Get("sort")
+
 	runs, err := s.store.ListRuns()
 	if err != nil {
 		http.Error(w, fmt.Sprintf("listing runs: %v", err), http.StatusInternalServerError)
 		return
 	}
+	runs = state.FilterRuns(runs, state.Status(status))
+	if err := state.SortRuns(runs, sortKey); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	var summaries []runSummary
 	for _, run := range runs {
@@ -547,20 +955,34 @@ func (s *Server) handleHistory(w http.ResponseWriter, r *http.Request) {
 				failed++
 			}
 		}
-		status := string(run.Status)
-		summaries = append(summaries, runSummary{
+		summary := runSummary{
 			ID:         run.ID,
 			BranchName: run.BranchName,
 			StartTime:  run.StartTime.Format("2006-01-02 15:04"),
+			Duration:   run.Duration().Round(time.Second).String(),
 			StoryCount: len(run.Stories),
 			Passed:     passed,
 			Failed:     failed,
-			Status:     status,
-		})
+			Status:     string(run.Status),
+			StopReason: run.StopReason,
+		}
+		if run.Finished() {
+			summary.EndTime = run.EndTime.Format("2006-01-02 15:04")
+			summary.Passed = run.Passed
+			summary.Skipped = run.Skipped
+		}
+		summaries = append(summaries, summary)
 	}
 
-	data := historyData{Runs: summaries}
-
+	data := historyData{
+		Runs:     summaries,
+		Status:   status,
+		Sort:     sortKey,
+		SortKeys: state.RunSortKeys,
+	}
+	for _, st := range state.RunStatuses {
+		data.Statuses = append(data.Statuses, string(st))
+	}
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	if err := s.tmpl.ExecuteTemplate(w, "history.html", data); err != nil {
 		http.Error(w, fmt.Sprintf("rendering history: %v", err), http.StatusInternalServerError)
@@ -686,26 +1108,7 @@ func (s *Server) handleRunStoryDetail(w http.ResponseWriter, r *http.Request, ru
 
 	var iterations []iterationView
 	for _, iter := range session.Iterations {
-		iterCls := "pending"
-		switch iter.Status {
-		case state.StatusPassed:
-			iterCls = "passed"
-		case state.StatusFailed:
-			iterCls = "failed"
-		case state.StatusRunning:
-			iterCls = "running"
-		}
-		endTime := ""
-		if !iter.EndTime.IsZero() {
-			endTime = iter.EndTime.Format("2006-01-02 15:04:05")
-		}
-		iterations = append(iterations, iterationView{
-			Number:    iter.Number,
-			Status:    string(iter.Status),
-			StatusCls: iterCls,
-			EndTime:   endTime,
-			Events:    iter.Events,
-		})
+		iterations = append(iterations, newIterationView(iter.Number, iter.Status, iter.EndTime, iter.Events, iter.Summary))
 	}
 
 	data := runStoryDetailData{
@@ -723,6 +1126,31 @@ func (s *Server) handleRunStoryDetail(w http.ResponseWriter, r *http.Request, ru
 	}
 }
 
+// newIterationView builds the display form of a recorded iteration.
+func newIterationView(number int, status state.Status, end time.Time, events []claude.StreamEvent, summary *state.IterationSummary) iterationView {
+	cls := "pending"
+	switch status {
+	case state.StatusPassed:
+		cls = "passed"
+	case state.StatusFailed:
+		cls = "failed"
+	case state.StatusRunning:
+		cls = "running"
+	}
+	endTime := ""
+	if !end.IsZero() {
+		endTime = end.Format("2006-01-02 15:04:05")
+	}
+	return iterationView{
+		Number:    number,
+		Status:    string(status),
+		StatusCls: cls,
+		EndTime:   endTime,
+		Events:    events,
+		Summary:   summary,
+	}
+}
+
 // handleRunProgress shows progress.txt content for a run.
 func (s *Server) handleRunProgress(w http.ResponseWriter, r *http.Request, runID string) {
 	if s.store == nil {
@@ -0,0 +1,63 @@
+// Drag-and-drop reordering of the dashboard story table. Dropping a row posts
+// the new order to the server, which renumbers priorities in prd.json. The
+// table is re-rendered over SSE once the file changes.
+(function() {
+  var dragged = null;
+
+  function rowOf(el) {
+    while (el && el.tagName !== 'TR') el = el.parentElement;
+    return el && el.hasAttribute('data-id') ? el : null;
+  }
+
+  function reload() {
+    var list = document.getElementById('story-list');
+    fetch('/api/stories').then(function(resp) {
+      return resp.text();
+    }).then(function(body) {
+      list.innerHTML = body;
+    });
+  }
+
+  document.addEventListener('dragstart', function(e) {
+    dragged = rowOf(e.target);
+    if (!dragged) return;
+    dragged.classList.add('dragging');
+    e.dataTransfer.effectAllowed = 'move';
+    e.dataTransfer.setData('text/plain', dragged.getAttribute('data-id'));
+  });
+
+  document.addEventListener('dragover', function(e) {
+    var row = rowOf(e.target);
+    if (!dragged || !row || row === dragged || row.parentElement !== dragged.parentElement) return;
+    e.preventDefault();
+    var rect = row.getBoundingClientRect();
+    var after = e.clientY > rect.top + rect.height / 2;
+    row.parentElement.insertBefore(dragged, after ? row.nextSibling : row);
+  });
+
+  document.addEventListener('drop', function(e) {
+    if (dragged) e.preventDefault();
+  });
+
+  document.addEventListener('dragend', function() {
+    if (!dragged) return;
+    var table = dragged.closest('table');
+    dragged.classList.remove('dragging');
+    dragged = null;
+
+    var ids = [];
+    var rows = table.querySelectorAll('tr[data-id]');
+    for (var i = 0; i < rows.length; i++) ids.push(rows[i].getAttribute('data-id'));
+
+    var body = new URLSearchParams();
+    body.set('order', ids.join(','));
+    body.set('version', table.getAttribute('data-version') || '');
+    fetch('/api/stories/reorder', {method: 'POST', body: body}).then(function(resp) {
+      if (resp.ok) return;
+      return resp.text().then(function(msg) {
+        alert(msg);
+        reload();
+      });
+    });
+  });
+})();
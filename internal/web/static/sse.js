@@ -31,9 +31,37 @@
       source.close();
     });
 
-    source.onerror = function() {
-      source.close();
-    };
+    // A "gap" means we fell behind and missed events. The server ends the
+    // response and EventSource reconnects with Last-Event-ID, so the missed
+    // events are replayed; nothing to do here beyond letting that happen.
+    // Likewise, errors are left to EventSource's built-in retry rather than
+    // closing the connection, so dropped connections resume where they left
+    // off instead of re-sending the whole stream.
+  }
+
+  // Tool results arrive after their tool call; nest them inside the matching
+  // tool block (rendered with id="tool-<id>") instead of appending them to the
+  // end of the stream. Returns false if the fragment is not a placeable result.
+  function placeToolResult(data) {
+    var tpl = document.createElement('template');
+    tpl.innerHTML = data.trim();
+    var el = tpl.content.firstElementChild;
+    if (!el || tpl.content.childElementCount !== 1) return false;
+
+    var id = el.getAttribute('data-tool-id');
+    if (!id) return false;
+    var block = document.getElementById('tool-' + id);
+    var slot = block && block.querySelector('.tool-result-slot');
+    if (!slot) return false;
+
+    el.className = el.className.replace('event event-tool-result', 'tool-result');
+    slot.appendChild(el);
+    if (el.classList.contains('tool-error')) {
+      block.classList.add('event-tool-error');
+      var details = block.querySelector('details');
+      if (details) details.open = true;
+    }
+    return true;
   }
 
   function registerSwap(target, source) {
@@ -42,7 +70,9 @@
 
     source.addEventListener(eventName, function(e) {
       var mode = target.getAttribute('hx-swap') || 'innerHTML';
-      if (mode === 'beforeend') {
+      if (mode === 'beforeend' && placeToolResult(e.data)) {
+        return;
+      } else if (mode === 'beforeend') {
         target.insertAdjacentHTML('beforeend', e.data);
       } else if (mode === 'afterbegin') {
         target.insertAdjacentHTML('afterbegin', e.data);
@@ -0,0 +1,143 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+
+	"github.com/radvoogh/ralph-wiggo/internal/state"
+)
+
+// maxIterationOptions caps the iterations offered by the story page's picker.
+const maxIterationOptions = 50
+
+// iterationOption is an iteration of a story that the story page can stream
+// or replay.
+type iterationOption struct {
+	state.StreamKey
+	Status   string
+	Live     bool // still streaming in this process
+	Selected bool
+}
+
+// streamQuery encodes a stream key as the run and iter query parameters.
+func streamQuery(key state.StreamKey) string {
+	return url.Values{
+		"run":  {key.RunID},
+		"iter": {strconv.Itoa(key.Iteration)},
+	}.Encode()
+}
+
+// streamKeyFromQuery reads the stream selected by the run and iter query
+// parameters. It returns false if neither is set, meaning the caller should
+// follow the story's latest iteration.
+func streamKeyFromQuery(q url.Values, storyID string) (state.StreamKey, bool, error) {
+	runID, iterStr := q.Get("run"), q.Get("iter")
+	if runID == "" && iterStr == "" {
+		return state.StreamKey{}, false, nil
+	}
+	if runID == "" || iterStr == "" {
+		return state.StreamKey{}, false, errors.New("both run and iter are required")
+	}
+	iter, err := strconv.Atoi(iterStr)
+	if err != nil || iter < 1 {
+		return state.StreamKey{}, false, fmt.Errorf("invalid iteration %q", iterStr)
+	}
+	return state.StreamKey{RunID: runID, StoryID: storyID, Iteration: iter}, true, nil
+}
+
+// handleStreams lists the streams in progress as JSON. With ?story=, only that
+// story's streams are listed.
+func (s *Server) handleStreams(w http.ResponseWriter, r *http.Request) {
+	streams := []state.StreamInfo{}
+	if s.store != nil {
+		storyID := r.URL.Query().Get("story")
+		for _, info := range s.store.ActiveStreams() {
+			if storyID == "" || info.StoryID == storyID {
+				streams = append(streams, info)
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(streams); err != nil {
+		http.Error(w, fmt.Sprintf("encoding streams: %v", err), http.StatusInternalServerError)
+	}
+}
+
+// activeStream returns the most recently started live stream of a story.
+func (s *Server) activeStream(storyID string) (state.StreamKey, bool) {
+	for _, info := range s.store.ActiveStreams() {
+		if info.StoryID == storyID {
+			return info.StreamKey, true
+		}
+	}
+	return state.StreamKey{}, false
+}
+
+// storyIterations lists the recorded and live iterations of a story, newest
+// first, marking the selected one.
+func (s *Server) storyIterations(storyID string, selected state.StreamKey) ([]iterationOption, error) {
+	runs, err := s.store.ListRuns()
+	if err != nil {
+		return nil, err
+	}
+
+	byKey := make(map[state.StreamKey]*iterationOption)
+	var opts []*iterationOption
+	add := func(key state.StreamKey, status string) *iterationOption {
+		if o, ok := byKey[key]; ok {
+			return o
+		}
+		o := &iterationOption{StreamKey: key, Status: status}
+		byKey[key] = o
+		opts = append(opts, o)
+		return o
+	}
+
+	starts := make(map[string]int64)
+	for _, run := range runs {
+		starts[run.ID] = run.StartTime.UnixNano()
+		for _, sess := range run.Stories {
+			if sess.StoryID != storyID {
+				continue
+			}
+			for _, iter := range sess.Iterations {
+				add(state.StreamKey{RunID: run.ID, StoryID: storyID, Iteration: iter.Number}, string(iter.Status))
+			}
+		}
+	}
+	for _, info := range s.store.ActiveStreams() {
+		if info.StoryID != storyID {
+			continue
+		}
+		o := add(info.StreamKey, string(state.StatusRunning))
+		o.Live = true
+		o.Status = string(state.StatusRunning)
+	}
+
+	sort.SliceStable(opts, func(i, j int) bool {
+		a, b := opts[i], opts[j]
+		if a.RunID != b.RunID {
+			if starts[a.RunID] != starts[b.RunID] {
+				return starts[a.RunID] > starts[b.RunID]
+			}
+			return a.RunID > b.RunID
+		}
+		return a.Iteration > b.Iteration
+	})
+	if len(opts) > maxIterationOptions {
+		opts = opts[:maxIterationOptions]
+	}
+
+	out := make([]iterationOption, len(opts))
+	for i, o := range opts {
+		o.Selected = o.StreamKey == selected
+		out[i] = *o
+	}
+	return out, nil
+}
@@ -0,0 +1,123 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/radvoogh/ralph-wiggo/internal/claude"
+	"github.com/radvoogh/ralph-wiggo/internal/state"
+)
+
+// get requests path from the server and returns the recorded response.
+func get(srv *Server, path string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	srv.srv.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	return rec
+}
+
+func TestStoryStreamSelectsRunAndIteration(t *testing.T) {
+	srv, _ := newTestServer(t)
+	store, err := state.NewMemoryStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewMemoryStore: %v", err)
+	}
+	srv.store = store
+
+	// Two runs of the same story, the second retrying it.
+	start := time.Date(2026, 2, 20, 12, 0, 0, 0, time.UTC)
+	for i, runID := range []string{"run-1", "run-2"} {
+		if err := store.SaveRun(&state.Run{ID: runID, StartTime: start.Add(time.Duration(i) * time.Hour), Status: state.StatusRunning}); err != nil {
+			t.Fatalf("SaveRun: %v", err)
+		}
+	}
+	record := func(runID string, number int, msg string) {
+		t.Helper()
+		iter := state.Iteration{StoryID: "US-002", Number: number, Status: state.StatusFailed,
+			Events: []claude.StreamEvent{{Type: claude.EventAssistant, Message: msg}}}
+		if err := store.AddIteration(runID, iter); err != nil {
+			t.Fatalf("AddIteration: %v", err)
+		}
+	}
+	record("run-1", 1, "run one first try")
+	record("run-2", 1, "run two first try")
+
+	body := get(srv, "/api/story/US-002/stream?run=run-1&iter=1").Body.String()
+	if !strings.Contains(body, "run one first try") || strings.Contains(body, "run two") {
+		t.Errorf("run-1 iteration 1 stream = %q", body)
+	}
+
+	// Following the story replays its latest session.
+	body = get(srv, "/api/story/US-002/stream").Body.String()
+	if !strings.Contains(body, "run two first try") || strings.Contains(body, "run one") {
+		t.Errorf("latest stream = %q", body)
+	}
+
+	// A finished stream still buffered in this process is served from the
+	// broadcast, before the iteration is recorded.
+	key := state.StreamKey{RunID: "run-2", StoryID: "US-002", Iteration: 2}
+	store.BeginBroadcast(key)
+	store.PublishEvent(key, claude.StreamEvent{Type: claude.EventAssistant, Message: "retry in progress"})
+
+	var streams []state.StreamInfo
+	if err := json.Unmarshal(get(srv, "/api/streams?story=US-002").Body.Bytes(), &streams); err != nil {
+		t.Fatalf("decoding /api/streams: %v", err)
+	}
+	if len(streams) != 1 || streams[0].StreamKey != key || streams[0].Events != 1 {
+		t.Errorf("/api/streams = %+v, want %v with 1 event", streams, key)
+	}
+
+	store.CloseSubscribers(key)
+	body = get(srv, "/api/story/US-002/stream?run=run-2&iter=2").Body.String()
+	if !strings.Contains(body, "retry in progress") || !strings.Contains(body, "event: done") {
+		t.Errorf("buffered stream = %q", body)
+	}
+
+	body = get(srv, "/api/story/US-002/stream?run=run-1&iter=9").Body.String()
+	if !strings.Contains(body, "Iteration not found") {
+		t.Errorf("missing iteration stream = %q", body)
+	}
+
+	// The story page offers every iteration, newest run first.
+	page := get(srv, "/story/US-002?run=run-1&iter=1").Body.String()
+	i2, i1 := strings.Index(page, "run-2 #1"), strings.Index(page, "run-1 #1")
+	if i2 < 0 || i1 < 0 || i2 > i1 {
+		t.Errorf("iteration picker missing or misordered in story page")
+	}
+	if !strings.Contains(page, `/api/story/US-002/stream?iter=1&amp;run=run-1`) {
+		t.Errorf("story page does not stream the selected iteration")
+	}
+}
+
+func TestStoryStreamResumePairsToolResults(t *testing.T) {
+	srv, _ := newTestServer(t)
+	store, err := state.NewMemoryStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewMemoryStore: %v", err)
+	}
+	srv.store = store
+
+	key := state.StreamKey{RunID: "run-1", StoryID: "US-002", Iteration: 1}
+	store.BeginBroadcast(key)
+	store.PublishEvent(key, claude.StreamEvent{Type: claude.EventToolUse, ToolName: "Glob", ToolID: "t1", Input: json.RawMessage(`{"pattern":"*.go"}`)})
+	store.PublishEvent(key, toolResult("t1", "a.go\nb.go\n", false))
+	store.CloseSubscribers(key)
+	events, sub := store.Subscribe(key, state.EventID{})
+	sub.Close()
+
+	// The client reconnects after receiving the tool call.
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/story/US-002/stream?run=run-1&iter=1", nil)
+	req.Header.Set("Last-Event-ID", events[0].ID.String())
+	srv.srv.Handler.ServeHTTP(rec, req)
+	body := rec.Body.String()
+	if strings.Contains(body, "id: "+events[0].ID.String()+"\n") {
+		t.Errorf("resumed stream resent the tool call:\n%s", body)
+	}
+	if !strings.Contains(body, `data-tool-id="t1"`) || !strings.Contains(body, "<li>a.go</li>") {
+		t.Errorf("resumed tool result not rendered as a Glob result:\n%s", body)
+	}
+}
@@ -0,0 +1,322 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/radvoogh/ralph-wiggo/internal/claude"
+)
+
+// maxDiffLines caps the number of diff lines rendered for a single tool call.
+const maxDiffLines = 400
+
+// maxListItems caps the number of file list entries rendered for a result.
+const maxListItems = 200
+
+// toolInput is a decoded tool_use input object.
+type toolInput map[string]json.RawMessage
+
+// parseToolInput decodes a tool_use input, returning nil if it is not a JSON
+// object.
+func parseToolInput(raw json.RawMessage) toolInput {
+	var in toolInput
+	if err := json.Unmarshal(raw, &in); err != nil {
+		return nil
+	}
+	return in
+}
+
+// str returns the string value of key, or "" if missing or not a string.
+func (in toolInput) str(key string) string {
+	v, ok := in[key]
+	if !ok {
+		return ""
+	}
+	var s string
+	if err := json.Unmarshal(v, &s); err != nil {
+		return ""
+	}
+	return s
+}
+
+// eventRenderer renders a stream of events as HTML fragments. It remembers
+// tool_use events so that a later tool_result can be rendered with the view
+// for its tool. Use one renderer per stream.
+type eventRenderer struct {
+	uses map[string]claude.StreamEvent
+}
+
+// newEventRenderer returns an eventRenderer with no remembered tool calls.
+func newEventRenderer() *eventRenderer {
+	return &eventRenderer{uses: make(map[string]claude.StreamEvent)}
+}
+
+// render converts a single event into an HTML fragment. Tool results are
+// rendered standalone with a data-tool-id attribute; the browser moves them
+// into the matching tool block as they arrive.
+func (r *eventRenderer) render(evt claude.StreamEvent) string {
+	switch evt.Type {
+	case claude.EventAssistant:
+		if evt.Message == "" {
+			return ""
+		}
+		return fmt.Sprintf(`<div class="event event-text">%s</div>`, html.EscapeString(evt.Message))
+	case claude.EventToolUse:
+		if evt.ToolID != "" {
+			r.uses[evt.ToolID] = evt
+		}
+		return renderToolHTML(evt, nil)
+	case claude.EventToolResult:
+		use := r.uses[evt.ToolID]
+		cls := "event event-tool-result"
+		if evt.IsError {
+			cls += " tool-error"
+		}
+		return fmt.Sprintf(`<div class="%s" data-tool-id="%s">%s</div>`,
+			cls, html.EscapeString(evt.ToolID), renderToolResultBody(use.ToolName, parseToolInput(use.Input), evt))
+	case claude.EventError:
+		stderr := ""
+		if evt.Stderr != "" {
+			stderr = fmt.Sprintf(`<pre class="tool-io">%s</pre>`, html.EscapeString(evt.Stderr))
+		}
+		return fmt.Sprintf(`<div class="event event-error">%s%s</div>`, html.EscapeString(evt.Message), stderr)
+	case claude.EventInit:
+		if evt.SessionID == "" {
+			return ""
+		}
+		return fmt.Sprintf(`<div class="event event-init">session: %s</div>`, html.EscapeString(evt.SessionID))
+	case claude.EventResult:
+		return `<div class="event event-result">Agent finished</div>`
+	default:
+		return ""
+	}
+}
+
+// renderEventsHTML renders a complete list of events, nesting each tool
+// result inside the block for the tool_use it answers. If anchorPrefix is not
+// empty, each event is preceded by an empty element with id anchorPrefix
+// followed by the event's offset, so search results can link to it; a nested
+// result's anchor sits with its tool block.
+func renderEventsHTML(events []claude.StreamEvent, anchorPrefix string) string {
+	results := make(map[string]int)
+	for i, evt := range events {
+		if evt.Type == claude.EventToolResult && evt.ToolID != "" {
+			results[evt.ToolID] = i
+		}
+	}
+
+	anchor := func(sb *strings.Builder, offset int) {
+		if anchorPrefix != "" {
+			fmt.Fprintf(sb, `<span class="event-anchor" id="%s%d"></span>`, html.EscapeString(anchorPrefix), offset)
+		}
+	}
+
+	r := newEventRenderer()
+	paired := make(map[string]bool)
+	var sb strings.Builder
+	for i, evt := range events {
+		switch evt.Type {
+		case claude.EventToolUse:
+			if j, ok := results[evt.ToolID]; ok && evt.ToolID != "" {
+				paired[evt.ToolID] = true
+				anchor(&sb, i)
+				anchor(&sb, j)
+				sb.WriteString(renderToolHTML(evt, &events[j]))
+				continue
+			}
+		case claude.EventToolResult:
+			if paired[evt.ToolID] {
+				continue
+			}
+		}
+		anchor(&sb, i)
+		sb.WriteString(r.render(evt))
+	}
+	return sb.String()
+}
+
+// renderToolHTML renders a tool_use event as a collapsible block with a view
+// specific to the tool, and its result if already known. Failed calls are
+// highlighted and expanded.
+func renderToolHTML(use claude.StreamEvent, result *claude.StreamEvent) string {
+	in := parseToolInput(use.Input)
+	failed := result != nil && result.IsError
+
+	var target, stat, body string
+	switch use.ToolName {
+	case "Edit":
+		target = in.str("file_path")
+		body, stat = renderDiff(in.str("old_string"), in.str("new_string"))
+	case "MultiEdit":
+		target = in.str("file_path")
+		body, stat = renderMultiEdit(in)
+	case "Write":
+		target = in.str("file_path")
+		body, stat = renderDiff("", in.str("content"))
+	case "Bash":
+		target = in.str("description")
+		body = fmt.Sprintf(`<pre class="tool-io tool-cmd">$ %s</pre>`, html.EscapeString(in.str("command")))
+	case "Read":
+		target = in.str("file_path")
+	case "Glob":
+		target = withPath(in.str("pattern"), in.str("path"))
+	case "Grep":
+		target = withPath(in.str("pattern"), in.str("path"))
+	default:
+		body = fmt.Sprintf(`<pre class="tool-io">%s</pre>`, html.EscapeString(truncateString(prettyJSON(use.Input), 2000)))
+	}
+	if use.ToolName == "Bash" && target == "" {
+		target = truncateString(in.str("command"), 120)
+	}
+
+	var sb strings.Builder
+	cls := "event event-tool tool-" + strings.ToLower(use.ToolName)
+	if failed {
+		cls += " event-tool-error"
+	}
+	fmt.Fprintf(&sb, `<div class="%s"`, html.EscapeString(cls))
+	if use.ToolID != "" {
+		fmt.Fprintf(&sb, ` id="tool-%s"`, html.EscapeString(use.ToolID))
+	}
+	sb.WriteString(`><details`)
+	if failed {
+		sb.WriteString(` open`)
+	}
+	fmt.Fprintf(&sb, `><summary><span class="tool-name">%s</span>`, html.EscapeString(use.ToolName))
+	if target != "" {
+		fmt.Fprintf(&sb, ` <span class="tool-target">%s</span>`, html.EscapeString(target))
+	}
+	sb.WriteString(stat)
+	if failed {
+		sb.WriteString(` <span class="badge badge-failed">error</span>`)
+	}
+	sb.WriteString(`</summary>`)
+	sb.WriteString(body)
+	sb.WriteString(`<div class="tool-result-slot">`)
+	if result != nil {
+		cls := "tool-result"
+		if result.IsError {
+			cls += " tool-error"
+		}
+		fmt.Fprintf(&sb, `<div class="%s">%s</div>`, cls, renderToolResultBody(use.ToolName, in, *result))
+	}
+	sb.WriteString(`</div></details></div>`)
+	return sb.String()
+}
+
+// renderToolResultBody renders the output of a tool call. toolName may be
+// empty if the matching tool_use is unknown.
+func renderToolResultBody(toolName string, in toolInput, result claude.StreamEvent) string {
+	out := result.OutputText()
+	if out == "" && !result.IsError {
+		return `<div class="tool-result-note">(no output)</div>`
+	}
+
+	switch {
+	case result.IsError:
+		return fmt.Sprintf(`<pre class="tool-io tool-output-error">%s</pre>`, html.EscapeString(truncateString(out, 4000)))
+	case toolName == "Edit" || toolName == "MultiEdit" || toolName == "Write":
+		return fmt.Sprintf(`<div class="tool-result-note">%s</div>`, html.EscapeString(truncateString(out, 300)))
+	case toolName == "Glob" || (toolName == "Grep" && in.str("output_mode") != "content"):
+		return renderFileList(out)
+	default:
+		return fmt.Sprintf(`<pre class="tool-io">%s</pre>`, html.EscapeString(truncateString(out, 4000)))
+	}
+}
+
+// renderDiff renders a unified diff between two texts and a "+N −M" stat.
+func renderDiff(oldText, newText string) (body, stat string) {
+	lines, added, deleted := unifiedDiff(oldText, newText)
+	return renderDiffLines(lines), diffStat(added, deleted)
+}
+
+// renderMultiEdit renders each edit of a MultiEdit call as its own diff.
+func renderMultiEdit(in toolInput) (body, stat string) {
+	var edits []struct {
+		OldString string `json:"old_string"`
+		NewString string `json:"new_string"`
+	}
+	if err := json.Unmarshal(in["edits"], &edits); err != nil {
+		return "", ""
+	}
+	var all []diffLine
+	totalAdded, totalDeleted := 0, 0
+	for _, e := range edits {
+		lines, added, deleted := unifiedDiff(e.OldString, e.NewString)
+		all = append(all, lines...)
+		totalAdded += added
+		totalDeleted += deleted
+	}
+	return renderDiffLines(all), diffStat(totalAdded, totalDeleted)
+}
+
+// renderDiffLines renders diff lines as a preformatted block.
+func renderDiffLines(lines []diffLine) string {
+	var sb strings.Builder
+	sb.WriteString(`<pre class="tool-io diff">`)
+	for i, l := range lines {
+		if i == maxDiffLines {
+			fmt.Fprintf(&sb, `<span class="diff-hunk">... %d more lines</span>`+"\n", len(lines)-maxDiffLines)
+			break
+		}
+		switch l.Op {
+		case diffHunk:
+			fmt.Fprintf(&sb, `<span class="diff-hunk">%s</span>`+"\n", html.EscapeString(l.Text))
+		case diffInsert:
+			fmt.Fprintf(&sb, `<span class="diff-add">+%s</span>`+"\n", html.EscapeString(l.Text))
+		case diffDelete:
+			fmt.Fprintf(&sb, `<span class="diff-del">-%s</span>`+"\n", html.EscapeString(l.Text))
+		default:
+			fmt.Fprintf(&sb, ` %s`+"\n", html.EscapeString(l.Text))
+		}
+	}
+	sb.WriteString(`</pre>`)
+	return sb.String()
+}
+
+// diffStat renders the "+N −M" summary for a diff.
+func diffStat(added, deleted int) string {
+	return fmt.Sprintf(` <span class="diffstat"><span class="diff-add">+%d</span> <span class="diff-del">&minus;%d</span></span>`, added, deleted)
+}
+
+// renderFileList renders newline-separated tool output as a list of files.
+func renderFileList(out string) string {
+	var items []string
+	for _, line := range strings.Split(out, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			items = append(items, line)
+		}
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, `<div class="tool-result-note">%d result(s)</div><ul class="file-list">`, len(items))
+	for i, item := range items {
+		if i == maxListItems {
+			fmt.Fprintf(&sb, `<li class="tool-result-note">... %d more</li>`, len(items)-maxListItems)
+			break
+		}
+		fmt.Fprintf(&sb, `<li>%s</li>`, html.EscapeString(item))
+	}
+	sb.WriteString(`</ul>`)
+	return sb.String()
+}
+
+// withPath formats a search pattern with its optional search path.
+func withPath(pattern, path string) string {
+	if path == "" {
+		return pattern
+	}
+	return pattern + " in " + path
+}
+
+// prettyJSON indents raw JSON for display, returning it unchanged if invalid.
+func prettyJSON(raw json.RawMessage) string {
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, raw, "", "  "); err != nil {
+		return string(raw)
+	}
+	return buf.String()
+}
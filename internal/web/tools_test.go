@@ -0,0 +1,76 @@
+package web
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/radvoogh/ralph-wiggo/internal/claude"
+)
+
+func toolResult(id, output string, isError bool) claude.StreamEvent {
+	out, _ := json.Marshal(output)
+	return claude.StreamEvent{Type: claude.EventToolResult, ToolID: id, Output: out, IsError: isError}
+}
+
+func TestRenderEventsHTMLPairsResults(t *testing.T) {
+	events := []claude.StreamEvent{
+		{Type: claude.EventToolUse, ToolName: "Bash", ToolID: "t1", Input: json.RawMessage(`{"command":"go test ./..."}`)},
+		{Type: claude.EventAssistant, Message: "checking"},
+		toolResult("t1", "FAIL: TestX", true),
+	}
+
+	out := renderEventsHTML(events, "")
+	if strings.Count(out, `event-tool-result`) != 0 {
+		t.Error("paired result should not be rendered standalone")
+	}
+	use := strings.Index(out, `id="tool-t1"`)
+	res := strings.Index(out, "FAIL: TestX")
+	text := strings.Index(out, "checking")
+	if use < 0 || res < 0 || !(use < res && res < text) {
+		t.Errorf("result not nested in its tool block:\n%s", out)
+	}
+	if !strings.Contains(out, "event-tool-error") || !strings.Contains(out, "<details open>") {
+		t.Error("failed tool call should be highlighted and expanded")
+	}
+	if !strings.Contains(out, "$ go test ./...") {
+		t.Error("Bash view should show the command")
+	}
+
+	anchored := renderEventsHTML(events, "iter-1-evt-")
+	for _, id := range []string{`id="iter-1-evt-0"`, `id="iter-1-evt-1"`, `id="iter-1-evt-2"`} {
+		if !strings.Contains(anchored, id) {
+			t.Errorf("missing anchor %s", id)
+		}
+	}
+	if strings.Index(anchored, `id="iter-1-evt-2"`) > strings.Index(anchored, `id="tool-t1"`) {
+		t.Error("nested result's anchor should precede its tool block")
+	}
+}
+
+func TestRenderToolHTMLEditDiff(t *testing.T) {
+	use := claude.StreamEvent{
+		Type:     claude.EventToolUse,
+		ToolName: "Edit",
+		ToolID:   "t2",
+		Input:    json.RawMessage(`{"file_path":"main.go","old_string":"a\nb","new_string":"a\nc"}`),
+	}
+	out := renderToolHTML(use, nil)
+	for _, want := range []string{"main.go", `<span class="diff-del">-b</span>`, `<span class="diff-add">+c</span>`, "+1", "&minus;1"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Edit view missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestEventRendererStandaloneResult(t *testing.T) {
+	r := newEventRenderer()
+	r.render(claude.StreamEvent{Type: claude.EventToolUse, ToolName: "Glob", ToolID: "t3", Input: json.RawMessage(`{"pattern":"*.go"}`)})
+	out := r.render(toolResult("t3", "a.go\nb.go\n", false))
+	if !strings.Contains(out, `data-tool-id="t3"`) {
+		t.Errorf("standalone result missing tool ID:\n%s", out)
+	}
+	if !strings.Contains(out, "<li>a.go</li>") || !strings.Contains(out, "2 result(s)") {
+		t.Errorf("Glob result should render as a file list:\n%s", out)
+	}
+}